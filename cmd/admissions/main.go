@@ -1,11 +1,18 @@
 package main
 
 import (
-	"github.com/L2SH-Dev/admissions/internal/admin"
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/L2SH-Dev/admissions/internal/audit/auditadmin"
 	"github.com/L2SH-Dev/admissions/internal/config"
 	"github.com/L2SH-Dev/admissions/internal/datastore"
 	"github.com/L2SH-Dev/admissions/internal/exams"
 	"github.com/L2SH-Dev/admissions/internal/logging"
+	"github.com/L2SH-Dev/admissions/internal/mailing"
+	"github.com/L2SH-Dev/admissions/internal/mailing/mailadmin"
+	"github.com/L2SH-Dev/admissions/internal/migrations"
 	"github.com/L2SH-Dev/admissions/internal/ping"
 	"github.com/L2SH-Dev/admissions/internal/regdata"
 	"github.com/L2SH-Dev/admissions/internal/server"
@@ -18,6 +25,17 @@ func main() {
 
 	storage := datastore.InitStorage()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(migrate(storage, os.Args[2:]))
+	}
+
+	// The schema is only changed by the migrate command, serving on an
+	// outdated one would fail on the first query that touches the change
+	if err := migrations.Check(storage.DB()); err != nil {
+		slog.Error("Database is not migrated, run `admissions migrate up`", slog.Any("error", err))
+		os.Exit(1)
+	}
+
 	srv := server.NewServer(storage)
 
 	srv.AddFrontend("ui/dist")
@@ -26,9 +44,12 @@ func main() {
 		users.NewUsersHandler,
 		regdata.NewRegistrationDataHandler,
 		exams.NewExamsHandler,
+		mailadmin.NewMailingAdminHandler,
+		auditadmin.NewAuditAdminHandler,
 	)
 
-	admin.CreateDefaultAdmin(storage)
+	outboxWorker := mailing.NewOutboxWorker(mailing.NewOutboxRepo(storage), mailing.NewMailer())
+	go outboxWorker.Run(context.Background())
 
 	srv.Start()
 }
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/migrations"
+)
+
+const migrateUsage = `Usage: admissions migrate <command>
+
+Commands:
+  up      apply all pending migrations
+  down    revert the latest applied migration
+  status  list migrations and whether they are applied`
+
+// migrate runs the migrate subcommand and returns the exit code
+func migrate(storage datastore.Storage, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrations.Up(storage.DB())
+		for _, migration := range applied {
+			fmt.Printf("applied %s\n", migration)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+
+	case "down":
+		reverted, err := migrations.Down(storage.DB())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if reverted == nil {
+			fmt.Println("no applied migrations")
+		} else {
+			fmt.Printf("reverted %s\n", reverted)
+		}
+
+	case "status":
+		statuses, err := migrations.Status(storage.DB())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, status := range statuses {
+			state := "pending"
+			if status.AppliedAt != nil {
+				state = "applied " + status.AppliedAt.Format(time.DateTime)
+			}
+			if status.Unknown {
+				state += " (unknown to this version)"
+			}
+			fmt.Printf("%04d_%-24s %s\n", status.Version, status.Name, state)
+		}
+
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	return 0
+}
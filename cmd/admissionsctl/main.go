@@ -0,0 +1,330 @@
+// Command admissionsctl runs operational tasks against the database and the
+// cache of the server, using the same config and service layers.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"github.com/L2SH-Dev/admissions/internal/admin"
+	"github.com/L2SH-Dev/admissions/internal/config"
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/exams"
+	"github.com/L2SH-Dev/admissions/internal/migrations"
+	"github.com/L2SH-Dev/admissions/internal/users"
+)
+
+// env is what the commands run with. The actor is the user the actions are
+// recorded in the audit log for, it is only nil when create-staff creates
+// the first user.
+type env struct {
+	service admin.AdminService
+	actor   *users.User
+}
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, e *env, args []string) error
+}
+
+var commands = map[string]command{
+	"create-staff":    {"-login LOGIN -email EMAIL -first-name NAME -last-name NAME -role ROLE", createStaff},
+	"reset-password":  {"-login LOGIN [-password-stdin]", resetPassword},
+	"logout":          {"-login LOGIN", logout},
+	"verify-email":    {"-registration ID", verifyEmail},
+	"accept":          {"-registration ID", accept},
+	"reject":          {"-registration ID -reason REASON", reject},
+	"seed-exam-types": {"", seedExamTypes},
+	"dump-schedule":   {"[-o FILE]", dumpSchedule},
+	"import-schedule": {"-f FILE", importSchedule},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: admissionsctl -actor LOGIN <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-16s %s\n", name, commands[name].usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "-actor may be omitted for create-staff on an empty database to create the first admin.")
+}
+
+func main() {
+	config.Init()
+
+	actorLogin := flag.String("actor", "", "login of the user the actions are taken on behalf of")
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	// Interrupting the command cancels the queries it is running
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	storage := datastore.InitStorage()
+	if err := migrations.Check(storage.DB()); err != nil {
+		fail(fmt.Errorf("%w, run `admissions migrate up`", err))
+	}
+
+	service := admin.NewAdminService(storage)
+
+	// Without an actor the service only lets create-staff create the first user
+	var actor *users.User
+	if *actorLogin != "" {
+		var err error
+		actor, err = service.GetUser(ctx, *actorLogin)
+		if err != nil {
+			fail(fmt.Errorf("actor %q: %w", *actorLogin, err))
+		}
+	} else if flag.Arg(0) != "create-staff" {
+		fail(fmt.Errorf("%s: missing -actor", flag.Arg(0)))
+	}
+
+	if err := cmd.run(ctx, &env{service: service, actor: actor}, flag.Args()[1:]); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
+
+// parse parses the flags of the command and checks the required ones are set
+func parse(fs *flag.FlagSet, args []string, required ...string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, name := range required {
+		if fs.Lookup(name).Value.String() == "" {
+			missing = append(missing, "-"+name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s: missing %s", fs.Name(), strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+func createStaff(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("create-staff", flag.ExitOnError)
+	input := &admin.StaffInput{}
+	fs.StringVar(&input.Login, "login", "", "login of the user")
+	fs.StringVar(&input.Email, "email", "", "email of the user")
+	fs.StringVar(&input.FirstName, "first-name", "", "first name")
+	fs.StringVar(&input.LastName, "last-name", "", "last name")
+	fs.StringVar(&input.Role, "role", "", "title of the role")
+	if err := parse(fs, args, "login", "email", "first-name", "last-name", "role"); err != nil {
+		return err
+	}
+
+	user, password, err := e.service.CreateStaff(ctx, input, e.actor)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("created user %s (id %d) with role %s\npassword: %s\n", user.Login, user.ID, user.Role.Title, password)
+	return nil
+}
+
+func resetPassword(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("reset-password", flag.ExitOnError)
+	login := fs.String("login", "", "login of the user")
+	passwordStdin := fs.Bool("password-stdin", false, "read the new password from stdin instead of generating it")
+	if err := parse(fs, args, "login"); err != nil {
+		return err
+	}
+
+	// The password is not taken from the arguments, they end up in the
+	// shell history and in the process list
+	var password string
+	if *passwordStdin {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		password = strings.TrimRight(line, "\r\n")
+		if password == "" {
+			return fmt.Errorf("reset-password: empty password on stdin")
+		}
+	}
+
+	newPassword, err := e.service.ResetPassword(ctx, *login, password, e.actor)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("password of %s is reset, all sessions are logged out\n", *login)
+	if password == "" {
+		fmt.Printf("password: %s\n", newPassword)
+	}
+	return nil
+}
+
+func logout(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("logout", flag.ExitOnError)
+	login := fs.String("login", "", "login of the user")
+	if err := parse(fs, args, "login"); err != nil {
+		return err
+	}
+
+	if err := e.service.Logout(ctx, *login, e.actor); err != nil {
+		return err
+	}
+
+	fmt.Printf("all sessions of %s are logged out\n", *login)
+	return nil
+}
+
+func verifyEmail(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("verify-email", flag.ExitOnError)
+	id := fs.Uint("registration", 0, "ID of the registration")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *id == 0 {
+		return fmt.Errorf("verify-email: missing -registration")
+	}
+
+	if err := e.service.VerifyEmail(ctx, *id, e.actor); err != nil {
+		return err
+	}
+
+	fmt.Printf("email of registration %d is verified\n", *id)
+	return nil
+}
+
+func accept(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("accept", flag.ExitOnError)
+	id := fs.Uint("registration", 0, "ID of the registration")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if *id == 0 {
+		return fmt.Errorf("accept: missing -registration")
+	}
+
+	user, err := e.service.Accept(ctx, *id, e.actor)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("registration %d is accepted, login %s is sent to the applicant\n", *id, user.Login)
+	return nil
+}
+
+func reject(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("reject", flag.ExitOnError)
+	id := fs.Uint("registration", 0, "ID of the registration")
+	reason := fs.String("reason", "", "reason sent to the applicant")
+	if err := parse(fs, args, "reason"); err != nil {
+		return err
+	}
+	if *id == 0 {
+		return fmt.Errorf("reject: missing -registration")
+	}
+
+	if err := e.service.Reject(ctx, *id, *reason, e.actor); err != nil {
+		return err
+	}
+
+	fmt.Printf("registration %d is rejected\n", *id)
+	return nil
+}
+
+func seedExamTypes(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("seed-exam-types", flag.ExitOnError)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	if err := e.service.SeedExamTypes(ctx); err != nil {
+		return err
+	}
+
+	fmt.Println("exam types from the config are created")
+	return nil
+}
+
+func dumpSchedule(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("dump-schedule", flag.ExitOnError)
+	path := fs.String("o", "", "file to write the schedule to, stdout if empty")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	entries, err := e.service.DumpSchedule(ctx)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *path != "" {
+		file, err := os.Create(*path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(entries)
+}
+
+func importSchedule(ctx context.Context, e *env, args []string) error {
+	fs := flag.NewFlagSet("import-schedule", flag.ExitOnError)
+	path := fs.String("f", "", "schedule file written by dump-schedule")
+	if err := parse(fs, args, "f"); err != nil {
+		return err
+	}
+
+	file, err := os.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var entries []*exams.ScheduleEntry
+	if err := json.NewDecoder(file).Decode(&entries); err != nil {
+		return fmt.Errorf("%w: %w", exams.ErrInvalidSchedule, err)
+	}
+
+	created, err := e.service.ImportSchedule(ctx, entries, e.actor)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d of %d exams created, the rest already exist\n", created, len(entries))
+	return nil
+}
@@ -73,7 +73,7 @@ require (
 	gorm.io/gorm v1.25.12
 )
 
-require github.com/essentialkaos/translit/v3 v3.0.0 // indirect
+require github.com/essentialkaos/translit/v3 v3.0.0
 
 require (
 	github.com/davecgh/go-spew v1.1.2-0.20180830191138-d8f796af33cc // indirect
@@ -0,0 +1,345 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/audit"
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/exams"
+	"github.com/L2SH-Dev/admissions/internal/mailing"
+	"github.com/L2SH-Dev/admissions/internal/regdata"
+	"github.com/L2SH-Dev/admissions/internal/users"
+	"github.com/L2SH-Dev/admissions/internal/users/auth"
+	"github.com/L2SH-Dev/admissions/internal/users/auth/passwords"
+	"github.com/L2SH-Dev/admissions/internal/users/roles"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrLoginTaken    = errors.New("login is already taken")
+	ErrActorRequired = errors.New("an actor is required once users exist")
+)
+
+// StaffInput describes a staff account. Staff users get a registration of
+// their own, the fields applicants fill in are set to placeholders.
+type StaffInput struct {
+	Login     string
+	Email     string
+	FirstName string
+	LastName  string
+	Role      string
+}
+
+// AdminService runs operational tasks outside of the HTTP API. Actions are
+// recorded in the audit log on behalf of the actor, without an IP.
+type AdminService interface {
+	GetUser(ctx context.Context, login string) (*users.User, error)
+	CreateStaff(ctx context.Context, input *StaffInput, actor *users.User) (*users.User, string, error)
+	ResetPassword(ctx context.Context, login, password string, actor *users.User) (string, error)
+	Logout(ctx context.Context, login string, actor *users.User) error
+	VerifyEmail(ctx context.Context, registrationID uint, actor *users.User) error
+	Accept(ctx context.Context, registrationID uint, actor *users.User) (*users.User, error)
+	Reject(ctx context.Context, registrationID uint, reason string, actor *users.User) error
+	SeedExamTypes(ctx context.Context) error
+	DumpSchedule(ctx context.Context) ([]*exams.ScheduleEntry, error)
+	ImportSchedule(ctx context.Context, entries []*exams.ScheduleEntry, actor *users.User) (int, error)
+}
+
+type AdminServiceImpl struct {
+	storage          datastore.Storage
+	usersService     users.UsersService
+	passwordsService passwords.PasswordsService
+	authService      auth.AuthService
+	regdataRepo      regdata.RegistrationDataRepo
+	regdataService   regdata.RegistrationDataService
+	examsService     exams.ExamsService
+	auditService     audit.AuditService
+}
+
+func NewAdminService(storage datastore.Storage) AdminService {
+	usersService := users.NewUsersService(
+		users.NewUsersRepo(storage),
+		roles.NewRolesService(roles.NewRolesRepo(storage)),
+	)
+	passwordsService := passwords.NewPasswordsService(passwords.NewPasswordsRepo(storage))
+	authService := auth.NewAuthService(auth.NewAuthRepo(storage), passwordsService)
+	mailingService := mailing.NewMailingService(mailing.NewOutboxMailer(mailing.NewOutboxRepo(storage)))
+	regdataRepo := regdata.NewRegistrationDataRepo(storage)
+	regdataService := regdata.NewRegistrationDataService(
+		storage,
+		regdataRepo,
+		usersService,
+		authService,
+		passwordsService,
+		mailingService,
+	)
+
+	return &AdminServiceImpl{
+		storage:          storage,
+		usersService:     usersService,
+		passwordsService: passwordsService,
+		authService:      authService,
+		regdataRepo:      regdataRepo,
+		regdataService:   regdataService,
+		examsService:     exams.NewExamsService(storage, exams.NewExamsRepo(storage), regdataService, mailingService),
+		auditService:     audit.NewAuditService(audit.NewAuditRepo(storage)),
+	}
+}
+
+// record logs the event in the transaction of the action, an action that
+// cannot be recorded is rolled back. The first user is created without an
+// actor.
+func (s *AdminServiceImpl) record(ctx context.Context, tx datastore.Storage, actor *users.User, event audit.Event) error {
+	if actor == nil {
+		return nil
+	}
+
+	return s.auditService.WithTx(tx).Record(ctx, actor, "", event)
+}
+
+func (s *AdminServiceImpl) GetUser(ctx context.Context, login string) (*users.User, error) {
+	return s.usersService.GetByLogin(ctx, login)
+}
+
+// CreateStaff creates an accepted registration and a user with the role.
+// The password is generated and returned, it is not sent anywhere. Without
+// an actor only the first user of an empty database can be created, which
+// is how the first admin is bootstrapped.
+func (s *AdminServiceImpl) CreateStaff(ctx context.Context, input *StaffInput, actor *users.User) (*users.User, string, error) {
+	password := s.passwordsService.Generate()
+	user, err := s.createStaff(ctx, input, password, actor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return user, password, nil
+}
+
+func (s *AdminServiceImpl) createStaff(ctx context.Context, input *StaffInput, password string, actor *users.User) (*users.User, error) {
+	_, err := s.usersService.GetByLogin(ctx, input.Login)
+	if err == nil {
+		return nil, ErrLoginTaken
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	registrationData := regdata.RegistrationData{
+		Email:           input.Email,
+		EmailVerified:   true,
+		FirstName:       input.FirstName,
+		LastName:        input.LastName,
+		Gender:          "N",
+		BirthDate:       time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC),
+		Grade:           6,
+		OldSchool:       "Лицей \"Первая школа\"",
+		ParentFirstName: "Сотрудник",
+		ParentLastName:  input.LastName,
+		ParentPhone:     "+70000000000",
+	}
+
+	// A failed step leaves no registration or user without a password, so
+	// the creation can be retried
+	var user *users.User
+	err = s.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		if actor == nil {
+			count, err := s.usersService.WithTx(tx).Count(ctx)
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrActorRequired
+			}
+		}
+
+		if err := s.regdataService.WithTx(tx).Create(ctx, &registrationData); err != nil {
+			return err
+		}
+
+		var err error
+		user, err = s.usersService.WithTx(tx).CreateWithRole(ctx, registrationData.ID, input.Login, input.Role)
+		if err != nil {
+			return err
+		}
+
+		// Staff get a user without going through acceptance
+		if err := s.regdataRepo.WithTx(tx).UpdateStatus(ctx, &registrationData, regdata.StatusAccepted, user.ID); err != nil {
+			return err
+		}
+
+		if err := s.authService.WithTx(tx).Register(ctx, user.ID, password); err != nil {
+			return err
+		}
+
+		return s.record(ctx, tx, actor, audit.Event{
+			Action:     audit.ActionUserCreateStaff,
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID,
+			Diff: map[string]audit.Change{
+				"login": {New: user.Login},
+				"role":  {New: user.Role.Title},
+			},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ResetPassword sets the password of the user, a new one is generated if
+// the password is empty. All sessions of the user are logged out.
+func (s *AdminServiceImpl) ResetPassword(ctx context.Context, login, password string, actor *users.User) (string, error) {
+	user, err := s.usersService.GetByLogin(ctx, login)
+	if err != nil {
+		return "", err
+	}
+
+	if password == "" {
+		password = s.passwordsService.Generate()
+	}
+	if err := s.authService.ValidatePassword(password); err != nil {
+		return "", err
+	}
+
+	err = s.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		if err := s.authService.WithTx(tx).UpdatePassword(ctx, user.ID, password); err != nil {
+			return err
+		}
+
+		return s.record(ctx, tx, actor, audit.Event{
+			Action:     audit.ActionUserResetPassword,
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID,
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return password, nil
+}
+
+// Logout ends all sessions of the user
+func (s *AdminServiceImpl) Logout(ctx context.Context, login string, actor *users.User) error {
+	user, err := s.usersService.GetByLogin(ctx, login)
+	if err != nil {
+		return err
+	}
+
+	// Sessions live in the cache, so the logout is recorded first and not
+	// done if it cannot be
+	err = s.record(ctx, s.storage, actor, audit.Event{
+		Action:     audit.ActionUserLogout,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.authService.RevokeAllSessions(ctx, user.ID)
+
+	return nil
+}
+
+// VerifyEmail marks the email of the registration verified as if the
+// applicant followed the link
+func (s *AdminServiceImpl) VerifyEmail(ctx context.Context, registrationID uint, actor *users.User) error {
+	return s.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		if err := s.regdataService.WithTx(tx).SetEmailVerified(ctx, registrationID); err != nil {
+			return err
+		}
+
+		return s.record(ctx, tx, actor, audit.Event{
+			Action:     audit.ActionRegDataVerifyEmail,
+			TargetType: audit.TargetRegistration,
+			TargetID:   registrationID,
+		})
+	})
+}
+
+func (s *AdminServiceImpl) Accept(ctx context.Context, registrationID uint, actor *users.User) (*users.User, error) {
+	var user *users.User
+	err := s.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		var err error
+		user, err = s.regdataService.WithTx(tx).Accept(ctx, registrationID, actor.ID)
+		if err != nil {
+			return err
+		}
+
+		return s.record(ctx, tx, actor, audit.Event{
+			Action:     audit.ActionRegDataAccept,
+			TargetType: audit.TargetRegistration,
+			TargetID:   registrationID,
+			Diff: map[string]audit.Change{
+				"status": {Old: regdata.StatusEmailVerified, New: regdata.StatusAccepted},
+				"login":  {New: user.Login},
+			},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *AdminServiceImpl) Reject(ctx context.Context, registrationID uint, reason string, actor *users.User) error {
+	regData, err := s.regdataService.GetByID(ctx, registrationID)
+	if err != nil {
+		return err
+	}
+
+	return s.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		if err := s.regdataService.WithTx(tx).Reject(ctx, registrationID, reason, actor.ID); err != nil {
+			return err
+		}
+
+		return s.record(ctx, tx, actor, audit.Event{
+			Action:     audit.ActionRegDataReject,
+			TargetType: audit.TargetRegistration,
+			TargetID:   registrationID,
+			Diff: map[string]audit.Change{
+				"status":           {Old: regData.Status, New: regdata.StatusRejected},
+				"rejection_reason": {Old: regData.RejectionReason, New: reason},
+			},
+		})
+	})
+}
+
+// SeedExamTypes creates the exam types listed in the config that are missing
+func (s *AdminServiceImpl) SeedExamTypes(ctx context.Context) error {
+	return s.examsService.CreateDefaultExamTypes(ctx)
+}
+
+func (s *AdminServiceImpl) DumpSchedule(ctx context.Context) ([]*exams.ScheduleEntry, error) {
+	return s.examsService.DumpSchedule(ctx)
+}
+
+func (s *AdminServiceImpl) ImportSchedule(ctx context.Context, entries []*exams.ScheduleEntry, actor *users.User) (int, error) {
+	var created int
+	err := s.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		var err error
+		created, err = s.examsService.WithTx(tx).ImportSchedule(ctx, entries)
+		if err != nil {
+			return err
+		}
+
+		return s.record(ctx, tx, actor, audit.Event{
+			Action:     audit.ActionExamImportSchedule,
+			TargetType: audit.TargetExam,
+			Diff: map[string]audit.Change{
+				"entries": {New: len(entries)},
+				"created": {New: created},
+			},
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return created, nil
+}
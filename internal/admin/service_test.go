@@ -0,0 +1,243 @@
+package admin_test
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/admin"
+	"github.com/L2SH-Dev/admissions/internal/audit"
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/listing"
+	"github.com/L2SH-Dev/admissions/internal/migrations"
+	"github.com/L2SH-Dev/admissions/internal/regdata"
+	"github.com/L2SH-Dev/admissions/internal/users"
+	"github.com/L2SH-Dev/admissions/internal/users/auth"
+	"github.com/L2SH-Dev/admissions/internal/users/auth/passwords"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	storage datastore.MockStorage
+)
+
+func TestMain(m *testing.M) {
+	viper.Set("secrets.jwt_key", "test_key")
+	viper.Set("users.default_role", "user")
+	viper.Set("users.roles", []string{"admin", "user"})
+	viper.Set("users.roles.user.permissions.admin", false)
+	viper.Set("users.roles.user.permissions.write_general", false)
+	viper.Set("users.roles.user.permissions.ai_access", false)
+	viper.Set("users.roles.admin.permissions.admin", true)
+	viper.Set("users.roles.admin.permissions.write_general", true)
+	viper.Set("users.roles.admin.permissions.ai_access", false)
+
+	s, cleanup := datastore.InitMockStorage()
+	storage = s
+
+	code := m.Run()
+
+	cleanup()
+	os.Exit(code)
+}
+
+func setupTestService(t *testing.T) admin.AdminService {
+	t.Cleanup(func() {
+		err := storage.Flush()
+		assert.NoError(t, err)
+	})
+
+	_, err := migrations.Up(storage.DB())
+	require.NoError(t, err)
+
+	return admin.NewAdminService(storage)
+}
+
+func newAuthService() auth.AuthService {
+	return auth.NewAuthService(auth.NewAuthRepo(storage), passwords.NewPasswordsService(passwords.NewPasswordsRepo(storage)))
+}
+
+func auditEntries(t *testing.T, action string) []*audit.Entry {
+	service := audit.NewAuditService(audit.NewAuditRepo(storage))
+	entries, _, err := service.List(context.Background(), &audit.Filter{Action: action}, listing.Page{Number: 1, Limit: 10, Sort: "created_at"})
+	require.NoError(t, err)
+	return entries
+}
+
+func staffInput(login string) *admin.StaffInput {
+	return &admin.StaffInput{
+		Login:     login,
+		Email:     login + "@example.com",
+		FirstName: "Иван",
+		LastName:  "Петров",
+		Role:      "admin",
+	}
+}
+
+// bootstrap creates the first admin the way admissionsctl does on an empty
+// database
+func bootstrap(t *testing.T, service admin.AdminService) (*users.User, string) {
+	user, password, err := service.CreateStaff(context.Background(), staffInput("admin"), nil)
+	require.NoError(t, err)
+	return user, password
+}
+
+func TestCreateStaffBootstrap(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	first, password := bootstrap(t, service)
+	assert.Equal(t, "admin", first.Role.Title)
+	assert.NotEmpty(t, password)
+
+	// The first admin is not audited, there is nobody to attribute it to
+	assert.Empty(t, auditEntries(t, audit.ActionUserCreateStaff))
+
+	// Once a user exists an actor is required
+	_, _, err := service.CreateStaff(ctx, staffInput("i.petrov"), nil)
+	assert.ErrorIs(t, err, admin.ErrActorRequired)
+
+	user, _, err := service.CreateStaff(ctx, staffInput("i.petrov"), first)
+	require.NoError(t, err)
+
+	entries := auditEntries(t, audit.ActionUserCreateStaff)
+	require.Len(t, entries, 1)
+	assert.Equal(t, first.ID, entries[0].ActorID)
+	assert.Equal(t, user.ID, entries[0].TargetID)
+
+	_, _, err = service.CreateStaff(ctx, staffInput("i.petrov"), first)
+	assert.ErrorIs(t, err, admin.ErrLoginTaken)
+}
+
+func TestCreateStaffRollback(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+	actor, _ := bootstrap(t, service)
+
+	// The role is looked up after the registration is created
+	input := staffInput("i.petrov")
+	input.Role = "janitor"
+	_, _, err := service.CreateStaff(ctx, input, actor)
+	require.Error(t, err)
+
+	var count int64
+	err = storage.DB().Model(&regdata.RegistrationData{}).Where("email = ?", input.Email).Count(&count).Error
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	_, err = service.GetUser(ctx, input.Login)
+	assert.Error(t, err)
+	assert.Empty(t, auditEntries(t, audit.ActionUserCreateStaff))
+
+	// Nothing is left behind, so the creation can be retried
+	input.Role = "admin"
+	_, _, err = service.CreateStaff(ctx, input, actor)
+	require.NoError(t, err)
+}
+
+func TestResetPasswordRevokesSessions(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+	authService := newAuthService()
+
+	actor, _ := bootstrap(t, service)
+	user, password, err := service.CreateStaff(ctx, staffInput("i.petrov"), actor)
+	require.NoError(t, err)
+
+	_, err = authService.Login(ctx, user.ID, password, nil)
+	require.NoError(t, err)
+	sessions, err := authService.ListSessions(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+
+	_, err = service.ResetPassword(ctx, user.Login, "weak", actor)
+	assert.Error(t, err)
+
+	newPassword, err := service.ResetPassword(ctx, user.Login, "NewPassword$123", actor)
+	require.NoError(t, err)
+	assert.Equal(t, "NewPassword$123", newPassword)
+
+	sessions, err = authService.ListSessions(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	_, err = authService.Login(ctx, user.ID, password, nil)
+	assert.Error(t, err)
+	_, err = authService.Login(ctx, user.ID, newPassword, nil)
+	require.NoError(t, err)
+
+	// An empty password is generated
+	generated, err := service.ResetPassword(ctx, user.Login, "", actor)
+	require.NoError(t, err)
+	assert.NotEmpty(t, generated)
+
+	entries := auditEntries(t, audit.ActionUserResetPassword)
+	require.Len(t, entries, 2)
+	assert.Equal(t, user.ID, entries[0].TargetID)
+}
+
+func TestLogout(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+	authService := newAuthService()
+
+	actor, _ := bootstrap(t, service)
+	user, password, err := service.CreateStaff(ctx, staffInput("i.petrov"), actor)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		_, err = authService.Login(ctx, user.ID, password, nil)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, service.Logout(ctx, user.Login, actor))
+
+	sessions, err := authService.ListSessions(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+
+	// The password still works
+	_, err = authService.Login(ctx, user.ID, password, nil)
+	require.NoError(t, err)
+
+	assert.Error(t, service.Logout(ctx, "nobody", actor))
+	assert.Len(t, auditEntries(t, audit.ActionUserLogout), 1)
+}
+
+func TestVerifyEmail(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+	actor, _ := bootstrap(t, service)
+
+	repo := regdata.NewRegistrationDataRepo(storage)
+	data := &regdata.RegistrationData{
+		Email:           "test@example.com",
+		FirstName:       "Test",
+		LastName:        "User",
+		Gender:          "M",
+		BirthDate:       time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC),
+		Grade:           9,
+		OldSchool:       "Test School",
+		ParentFirstName: "Parent",
+		ParentLastName:  "Test",
+		ParentPhone:     "+79999999999",
+	}
+	require.NoError(t, repo.Create(ctx, data))
+
+	require.NoError(t, service.VerifyEmail(ctx, data.ID, actor))
+
+	stored, err := repo.GetByID(ctx, data.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.EmailVerified)
+	assert.Equal(t, regdata.StatusEmailVerified, stored.Status)
+
+	entries := auditEntries(t, audit.ActionRegDataVerifyEmail)
+	require.Len(t, entries, 1)
+	assert.Equal(t, data.ID, entries[0].TargetID)
+
+	assert.Error(t, service.VerifyEmail(ctx, data.ID+1, actor))
+	assert.Len(t, auditEntries(t, audit.ActionRegDataVerifyEmail), 1)
+}
@@ -0,0 +1,41 @@
+package audit
+
+// Actions recorded in the audit log
+const (
+	ActionRegDataAccept          = "regdata.accept"
+	ActionRegDataReject          = "regdata.reject"
+	ActionRegDataRevertRejection = "regdata.revert_rejection"
+	ActionRegDataUpdate          = "regdata.update"
+	ActionRegDataChangeStatus    = "regdata.change_status"
+	ActionRegDataMerge           = "regdata.merge"
+	ActionRegDataDownload        = "regdata.download"
+	ActionRegDataVerifyEmail     = "regdata.verify_email"
+
+	ActionExamCreate         = "exams.create"
+	ActionExamDelete         = "exams.delete"
+	ActionExamUpdateCapacity = "exams.update_capacity"
+	ActionExamDownload       = "exams.download"
+	ActionExamResultsWrite   = "exams.results.write"
+	ActionExamResultsImport  = "exams.results.import"
+	ActionExamResultsPublish = "exams.results.publish"
+	ActionExamResultsHide    = "exams.results.unpublish"
+	ActionExamImportSchedule = "exams.import_schedule"
+
+	ActionRoleCreate = "users.create_role"
+	ActionRoleGrant  = "users.set_role"
+
+	ActionUserCreateStaff   = "users.create_staff"
+	ActionUserResetPassword = "users.reset_password"
+	ActionUserLogout        = "users.logout"
+
+	ActionAuditExport = "audit.export"
+)
+
+// Types of the objects actions are taken on
+const (
+	TargetRegistration = "registration"
+	TargetExam         = "exam"
+	TargetRole         = "role"
+	TargetUser         = "user"
+	TargetAuditLog     = "audit_log"
+)
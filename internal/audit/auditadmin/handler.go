@@ -0,0 +1,181 @@
+package auditadmin
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/audit"
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/listing"
+	"github.com/L2SH-Dev/admissions/internal/server"
+	"github.com/L2SH-Dev/admissions/internal/users"
+	"github.com/L2SH-Dev/admissions/internal/users/auth"
+	"github.com/L2SH-Dev/admissions/internal/users/auth/passwords"
+	"github.com/L2SH-Dev/admissions/internal/users/roles"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+)
+
+// AuditAdminHandler lets admins browse and export the audit log. It lives
+// apart from the audit package because it depends on users, which in turn
+// records its actions in the log.
+type AuditAdminHandler interface {
+	server.Handler
+	List(c echo.Context) error
+	Download(c echo.Context) error
+}
+
+type AuditAdminHandlerImpl struct {
+	auditService audit.AuditService
+	usersService users.UsersService
+	authService  auth.AuthService
+}
+
+func NewAuditAdminHandler(storage datastore.Storage) server.Handler {
+	rolesRepo := roles.NewRolesRepo(storage)
+	rolesService := roles.NewRolesService(rolesRepo)
+	usersRepo := users.NewUsersRepo(storage)
+	usersService := users.NewUsersService(usersRepo, rolesService)
+
+	passwordsRepo := passwords.NewPasswordsRepo(storage)
+	passwordsService := passwords.NewPasswordsService(passwordsRepo)
+	authRepo := auth.NewAuthRepo(storage)
+	authService := auth.NewAuthService(authRepo, passwordsService)
+
+	return &AuditAdminHandlerImpl{
+		auditService: audit.NewAuditService(audit.NewAuditRepo(storage)),
+		usersService: usersService,
+		authService:  authService,
+	}
+}
+
+func (h *AuditAdminHandlerImpl) AddRoutes(g *echo.Group) {
+	adminGroup := g.Group("/audit/admin")
+
+	usersMiddlewareService := users.NewUsersMiddlewareService(h.usersService, h.authService)
+	usersMiddlewareService.AddAuthMiddleware(adminGroup, viper.GetString("secrets.jwt_key"))
+	usersMiddlewareService.AddUserPreloadMiddleware(adminGroup)
+	usersMiddlewareService.AddAdminMiddleware(adminGroup)
+	adminGroup.Use(usersMiddlewareService.RequirePermission(roles.PermissionAuditRead))
+
+	adminGroup.GET("", h.List)
+	adminGroup.GET("/download", h.Download)
+}
+
+// parseFilter reads actor_id, action, target_type, target_id, and from and
+// to as dates with the end inclusive
+func parseFilter(c echo.Context) (*audit.Filter, error) {
+	filter := &audit.Filter{
+		Action:     c.QueryParam("action"),
+		TargetType: c.QueryParam("target_type"),
+	}
+
+	var to time.Time
+	err := echo.QueryParamsBinder(c).
+		Uint("actor_id", &filter.ActorID).
+		Uint("target_id", &filter.TargetID).
+		Time("from", &filter.From, time.DateOnly).
+		Time("to", &to, time.DateOnly).
+		BindError()
+	if err != nil {
+		return nil, err
+	}
+	if !to.IsZero() {
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	return filter, nil
+}
+
+// List returns the log, latest actions first by default
+func (h *AuditAdminHandlerImpl) List(c echo.Context) error {
+	filter, err := parseFilter(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	page, err := listing.ParsePage(c, audit.SortableColumns, "-created_at")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	entries, total, err := h.auditService.List(c.Request().Context(), filter, page)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	listing.SetHeaders(c, page, total)
+	return c.JSON(http.StatusOK, entries)
+}
+
+// Download exports the filtered log as CSV, oldest actions first. The
+// export is itself recorded in the log.
+func (h *AuditAdminHandlerImpl) Download(c echo.Context) error {
+	filter, err := parseFilter(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	tz, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	err = h.auditService.Log(c, audit.Event{
+		Action:     audit.ActionAuditExport,
+		TargetType: audit.TargetAuditLog,
+		Diff:       c.QueryParams(),
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	// The log may be large, so it is streamed rather than built in memory
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="audit.csv"`)
+	c.Response().WriteHeader(http.StatusOK)
+
+	// Write UTF-8 BOM
+	if _, err := c.Response().Write([]byte{0xEF, 0xBB, 0xBF}); err != nil {
+		return err
+	}
+	writer := csv.NewWriter(c.Response())
+	writer.Write([]string{
+		"ID",
+		"Время",
+		"ID пользователя",
+		"Роль",
+		"Действие",
+		"Объект",
+		"ID объекта",
+		"IP",
+		"Изменения",
+	})
+
+	err = h.auditService.Each(c.Request().Context(), filter, func(entries []*audit.Entry) error {
+		for _, entry := range entries {
+			writer.Write([]string{
+				strconv.FormatUint(uint64(entry.ID), 10),
+				entry.CreatedAt.In(tz).Format("2006.01.02 15:04:05"),
+				strconv.FormatUint(uint64(entry.ActorID), 10),
+				entry.ActorRole,
+				entry.Action,
+				entry.TargetType,
+				strconv.FormatUint(uint64(entry.TargetID), 10),
+				entry.IP,
+				string(entry.Diff),
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	})
+	if err != nil {
+		// Headers are already sent, the client gets a truncated file
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
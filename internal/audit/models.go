@@ -0,0 +1,81 @@
+package audit
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrAppendOnly = errors.New("audit log entries cannot be changed or deleted")
+
+// Entry records a single admin action. Entries are only ever inserted, the
+// table rejects updates and deletes.
+type Entry struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index;not null"`
+	ActorID    uint      `json:"actor_id" gorm:"index;not null"`
+	ActorRole  string    `json:"actor_role" gorm:"not null"`
+	Action     string    `json:"action" gorm:"index;not null"`
+	TargetType string    `json:"target_type" gorm:"index:idx_audit_entries_target;not null"`
+	TargetID   uint      `json:"target_id" gorm:"index:idx_audit_entries_target"`
+	IP         string    `json:"ip"`
+	Diff       JSON      `json:"diff" gorm:"type:jsonb"`
+}
+
+func (Entry) TableName() string {
+	return "audit_entries"
+}
+
+func (e *Entry) BeforeUpdate(_ *gorm.DB) error {
+	return ErrAppendOnly
+}
+
+func (e *Entry) BeforeDelete(_ *gorm.DB) error {
+	return ErrAppendOnly
+}
+
+// Change is the value of a field before and after the action
+type Change struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// JSON is stored as jsonb and embedded as is in responses
+type JSON json.RawMessage
+
+func (j JSON) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+func (j *JSON) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*j = nil
+	case []byte:
+		*j = append(JSON(nil), v...)
+	case string:
+		*j = JSON(v)
+	default:
+		return fmt.Errorf("cannot scan %T into audit JSON", value)
+	}
+	return nil
+}
+
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+func (j *JSON) UnmarshalJSON(data []byte) error {
+	*j = append(JSON(nil), data...)
+	return nil
+}
@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/listing"
+	"gorm.io/gorm"
+)
+
+// Size of the batches the export reads the log in
+const exportBatchSize = 500
+
+// SortableColumns lists the columns the log can be sorted by
+var SortableColumns = []string{"id", "created_at", "actor_id", "action", "target_type"}
+
+// Filter narrows down the log, zero values match everything. From and To
+// bound the time of the action.
+type Filter struct {
+	ActorID    uint
+	Action     string
+	TargetType string
+	TargetID   uint
+	From       time.Time
+	To         time.Time
+}
+
+func (f *Filter) apply(query *gorm.DB) *gorm.DB {
+	if f.ActorID != 0 {
+		query = query.Where("actor_id = ?", f.ActorID)
+	}
+	if f.Action != "" {
+		query = query.Where("action = ?", f.Action)
+	}
+	if f.TargetType != "" {
+		query = query.Where("target_type = ?", f.TargetType)
+	}
+	if f.TargetID != 0 {
+		query = query.Where("target_id = ?", f.TargetID)
+	}
+	if !f.From.IsZero() {
+		query = query.Where("created_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		query = query.Where("created_at < ?", f.To)
+	}
+	return query
+}
+
+type AuditRepo interface {
+	Create(ctx context.Context, entry *Entry) error
+	List(ctx context.Context, filter *Filter, page listing.Page) ([]*Entry, int64, error)
+	Each(ctx context.Context, filter *Filter, fn func(entries []*Entry) error) error
+	WithTx(tx datastore.Storage) AuditRepo
+}
+
+type AuditRepoImpl struct {
+	storage datastore.Storage
+}
+
+func NewAuditRepo(storage datastore.Storage) AuditRepo {
+	return &AuditRepoImpl{storage: storage}
+}
+
+func (r *AuditRepoImpl) WithTx(tx datastore.Storage) AuditRepo {
+	return &AuditRepoImpl{storage: tx}
+}
+
+func (r *AuditRepoImpl) Create(ctx context.Context, entry *Entry) error {
+	return r.storage.DB().WithContext(ctx).Create(entry).Error
+}
+
+func (r *AuditRepoImpl) List(ctx context.Context, filter *Filter, page listing.Page) ([]*Entry, int64, error) {
+	query := filter.apply(r.storage.DB().WithContext(ctx).Model(&Entry{}))
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entries []*Entry
+	if err := page.Apply(query).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// Each passes the matching entries to fn in batches, oldest first, so that
+// exporting the whole log does not load it into memory at once
+func (r *AuditRepoImpl) Each(ctx context.Context, filter *Filter, fn func(entries []*Entry) error) error {
+	var entries []*Entry
+	return filter.apply(r.storage.DB().WithContext(ctx).Model(&Entry{})).
+		FindInBatches(&entries, exportBatchSize, func(_ *gorm.DB, _ int) error {
+			return fn(entries)
+		}).Error
+}
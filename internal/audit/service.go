@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/listing"
+	"github.com/labstack/echo/v4"
+)
+
+var ErrNoActor = errors.New("audit event without a current user")
+
+// Actor is the user taking an action. It is implemented by users.User,
+// which cannot be referenced here because users records its own actions.
+type Actor interface {
+	AuditActor() (id uint, role string)
+}
+
+// Event describes an action to record. Diff is stored as JSON, usually a
+// map of Change values keyed by field name.
+type Event struct {
+	Action     string
+	TargetType string
+	TargetID   uint
+	Diff       any
+}
+
+type AuditService interface {
+	Record(ctx context.Context, actor Actor, ip string, event Event) error
+	Log(c echo.Context, event Event) error
+	List(ctx context.Context, filter *Filter, page listing.Page) ([]*Entry, int64, error)
+	Each(ctx context.Context, filter *Filter, fn func(entries []*Entry) error) error
+	WithTx(tx datastore.Storage) AuditService
+}
+
+type AuditServiceImpl struct {
+	repo AuditRepo
+}
+
+func NewAuditService(repo AuditRepo) AuditService {
+	return &AuditServiceImpl{repo: repo}
+}
+
+// WithTx returns the service recording entries in the transaction of tx,
+// the entry is then stored if and only if the action it describes is
+func (s *AuditServiceImpl) WithTx(tx datastore.Storage) AuditService {
+	return &AuditServiceImpl{repo: s.repo.WithTx(tx)}
+}
+
+func (s *AuditServiceImpl) Record(ctx context.Context, actor Actor, ip string, event Event) error {
+	entry := &Entry{
+		Action:     event.Action,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		IP:         ip,
+	}
+	entry.ActorID, entry.ActorRole = actor.AuditActor()
+
+	if event.Diff != nil {
+		diff, err := json.Marshal(event.Diff)
+		if err != nil {
+			return err
+		}
+		entry.Diff = diff
+	}
+
+	return s.repo.Create(ctx, entry)
+}
+
+// Log records the event on behalf of the current user of the request.
+// Handlers log changes through WithTx in the transaction of the change, so
+// that a change is never stored without its entry, and fail the request
+// when the entry cannot be written.
+func (s *AuditServiceImpl) Log(c echo.Context, event Event) error {
+	actor, ok := c.Get("currentUser").(Actor)
+	if !ok {
+		return errors.Join(ErrNoActor, errors.New(event.Action))
+	}
+
+	if err := s.Record(c.Request().Context(), actor, c.RealIP(), event); err != nil {
+		return errors.Join(errors.New("failed to record audit event"), err)
+	}
+	return nil
+}
+
+func (s *AuditServiceImpl) List(ctx context.Context, filter *Filter, page listing.Page) ([]*Entry, int64, error) {
+	return s.repo.List(ctx, filter, page)
+}
+
+func (s *AuditServiceImpl) Each(ctx context.Context, filter *Filter, fn func(entries []*Entry) error) error {
+	return s.repo.Each(ctx, filter, fn)
+}
@@ -0,0 +1,183 @@
+package audit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/L2SH-Dev/admissions/internal/audit"
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/listing"
+	"github.com/L2SH-Dev/admissions/internal/migrations"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	storage datastore.MockStorage
+)
+
+func TestMain(m *testing.M) {
+	s, cleanup := datastore.InitMockStorage()
+	storage = s
+
+	code := m.Run()
+
+	cleanup()
+	os.Exit(code)
+}
+
+type testActor struct {
+	id   uint
+	role string
+}
+
+func (a *testActor) AuditActor() (uint, string) {
+	return a.id, a.role
+}
+
+func setupTestService(t *testing.T) audit.AuditService {
+	t.Cleanup(func() {
+		err := storage.Flush()
+		assert.NoError(t, err)
+	})
+
+	_, err := migrations.Up(storage.DB())
+	require.NoError(t, err)
+
+	return audit.NewAuditService(audit.NewAuditRepo(storage))
+}
+
+var testPage = listing.Page{Number: 1, Limit: 50, Sort: "id"}
+
+func TestRecordAndList(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+	admin := &testActor{id: 1, role: "admin"}
+	principal := &testActor{id: 2, role: "principal"}
+
+	require.NoError(t, service.Record(ctx, admin, "10.0.0.1", audit.Event{
+		Action:     audit.ActionRegDataAccept,
+		TargetType: audit.TargetRegistration,
+		TargetID:   7,
+		Diff: map[string]audit.Change{
+			"status": {Old: "email_verified", New: "accepted"},
+		},
+	}))
+	require.NoError(t, service.Record(ctx, principal, "10.0.0.2", audit.Event{
+		Action:     audit.ActionExamDelete,
+		TargetType: audit.TargetExam,
+		TargetID:   3,
+	}))
+
+	entries, total, err := service.List(ctx, &audit.Filter{}, testPage)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	require.Len(t, entries, 2)
+	assert.Equal(t, uint(1), entries[0].ActorID)
+	assert.Equal(t, "admin", entries[0].ActorRole)
+	assert.Equal(t, "10.0.0.1", entries[0].IP)
+	assert.JSONEq(t, `{"status": {"old": "email_verified", "new": "accepted"}}`, string(entries[0].Diff))
+	assert.Nil(t, entries[1].Diff)
+
+	entries, total, err = service.List(ctx, &audit.Filter{TargetType: audit.TargetExam, ActorID: 2}, testPage)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, audit.ActionExamDelete, entries[0].Action)
+
+	var exported []*audit.Entry
+	err = service.Each(ctx, &audit.Filter{Action: audit.ActionRegDataAccept}, func(entries []*audit.Entry) error {
+		exported = append(exported, entries...)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, exported, 1)
+	assert.Equal(t, uint(7), exported[0].TargetID)
+}
+
+func TestAppendOnly(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+	require.NoError(t, service.Record(ctx, &testActor{id: 1, role: "admin"}, "10.0.0.1", audit.Event{
+		Action:     audit.ActionExamCreate,
+		TargetType: audit.TargetExam,
+		TargetID:   1,
+	}))
+
+	entries, _, err := service.List(ctx, &audit.Filter{}, testPage)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	entry := entries[0]
+
+	entry.ActorID = 2
+	assert.ErrorIs(t, storage.DB().Save(entry).Error, audit.ErrAppendOnly)
+	assert.ErrorIs(t, storage.DB().Delete(entry).Error, audit.ErrAppendOnly)
+
+	// The database refuses as well
+	assert.Error(t, storage.DB().Exec("UPDATE audit_entries SET actor_id = 2").Error)
+	assert.Error(t, storage.DB().Exec("DELETE FROM audit_entries").Error)
+	assert.Error(t, storage.DB().Exec("TRUNCATE audit_entries").Error)
+
+	entries, _, err = service.List(ctx, &audit.Filter{}, testPage)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, uint(1), entries[0].ActorID)
+}
+
+func TestLog(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set(echo.HeaderXRealIP, "192.168.1.5")
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+
+	// Without a user there is nobody to attribute the action to
+	err := service.Log(c, audit.Event{Action: audit.ActionExamCreate, TargetType: audit.TargetExam})
+	assert.ErrorIs(t, err, audit.ErrNoActor)
+
+	c.Set("currentUser", &testActor{id: 5, role: "admin"})
+	err = service.Log(c, audit.Event{Action: audit.ActionExamCreate, TargetType: audit.TargetExam, TargetID: 9})
+	require.NoError(t, err)
+
+	entries, total, err := service.List(ctx, &audit.Filter{}, testPage)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, uint(5), entries[0].ActorID)
+	assert.Equal(t, "192.168.1.5", entries[0].IP)
+}
+
+func TestLogWithTx(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), httptest.NewRecorder())
+	c.Set("currentUser", &testActor{id: 5, role: "admin"})
+
+	// The entry is rolled back with the action it describes
+	failed := errors.New("action failed")
+	err := storage.WithTx(ctx, func(tx datastore.Storage) error {
+		if err := service.WithTx(tx).Log(c, audit.Event{Action: audit.ActionExamCreate, TargetType: audit.TargetExam}); err != nil {
+			return err
+		}
+		return failed
+	})
+	assert.ErrorIs(t, err, failed)
+
+	_, total, err := service.List(ctx, &audit.Filter{}, testPage)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+
+	err = storage.WithTx(ctx, func(tx datastore.Storage) error {
+		return service.WithTx(tx).Log(c, audit.Event{Action: audit.ActionExamCreate, TargetType: audit.TargetExam})
+	})
+	require.NoError(t, err)
+
+	_, total, err = service.List(ctx, &audit.Filter{}, testPage)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+}
@@ -1,9 +1,10 @@
 package config
 
 import (
+	"log/slog"
+
 	"github.com/L2SH-Dev/admissions/internal/secrets"
 	"github.com/spf13/viper"
-	"golang.org/x/exp/slog"
 )
 
 func Init() {
@@ -9,7 +9,13 @@ import (
 
 func InitCacheConnection() *redis.Client {
 	addr := fmt.Sprintf("%s:%d", viper.GetString("cache.host"), viper.GetInt("cache.port"))
+	timeout := viper.GetDuration("cache.timeout")
 	return redis.NewClient(&redis.Options{
-		Addr: addr,
+		Addr:         addr,
+		DialTimeout:  timeout,
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout,
+		// Commands are also cancelled with the request they are run for
+		ContextTimeoutEnabled: true,
 	})
 }
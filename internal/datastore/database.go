@@ -2,9 +2,9 @@ package datastore
 
 import (
 	"fmt"
+	"log/slog"
 
 	"github.com/spf13/viper"
-	"golang.org/x/exp/slog"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -16,13 +16,14 @@ func InitDBConnection() *gorm.DB {
 
 	db, err := gorm.Open(
 		postgres.Open(fmt.Sprintf(
-			"host=%s port=%v user=%s dbname=%s password=%s sslmode=disable TimeZone=%s",
+			"host=%s port=%v user=%s dbname=%s password=%s sslmode=disable TimeZone=%s statement_timeout=%d",
 			dbConfig.GetString("host"),
 			dbConfig.GetInt("port"),
 			dbConfig.GetString("user"),
 			dbConfig.GetString("name"),
 			db_password,
 			dbConfig.GetString("connection.timezone"),
+			dbConfig.GetDuration("connection.statement_timeout").Milliseconds(),
 		)), &gorm.Config{
 			Logger: logger.Default.LogMode(logger.Silent),
 		})
@@ -1,6 +1,8 @@
 package datastore
 
 import (
+	"context"
+
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
@@ -8,6 +10,7 @@ import (
 type Storage interface {
 	DB() *gorm.DB
 	Cache() *redis.Client
+	WithTx(ctx context.Context, fn func(tx Storage) error) error
 }
 
 type StorageImpl struct {
@@ -35,3 +38,13 @@ func (s StorageImpl) DB() *gorm.DB {
 func (s StorageImpl) Cache() *redis.Client {
 	return s.cache
 }
+
+// WithTx runs fn in a database transaction, committed if fn returns nil and
+// rolled back otherwise. Repositories take part in it when they are created
+// from, or rebound with their WithTx to, the storage passed to fn. Nested
+// calls run in savepoints. The cache is not transactional.
+func (s StorageImpl) WithTx(ctx context.Context, fn func(tx Storage) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(StorageImpl{db: tx, cache: s.cache})
+	})
+}
@@ -0,0 +1,32 @@
+package exams
+
+import (
+	"io"
+	"strconv"
+)
+
+// ImportRow exposes a parsed row of the results file to the tests
+type ImportRow struct {
+	Line  int
+	RawID string
+	row   *importRow
+}
+
+func ParseImportFile(file io.Reader) ([]*ImportRow, error) {
+	rows, err := parseImportFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	exported := make([]*ImportRow, 0, len(rows))
+	for _, row := range rows {
+		exported = append(exported, &ImportRow{Line: row.line, RawID: row.rawID, row: row})
+	}
+	return exported, nil
+}
+
+func (r *ImportRow) ToInput(defaultMaxPoints float32) (*ResultInput, error) {
+	id, _ := strconv.ParseUint(r.row.rawID, 10, 32)
+	r.row.userID = uint(id)
+	return r.row.toInput(defaultMaxPoints)
+}
@@ -0,0 +1,48 @@
+package exams
+
+import (
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/listing"
+	"gorm.io/gorm"
+)
+
+// Columns the exams list can be sorted by
+var sortableColumns = []string{
+	"id",
+	"created_at",
+	"start",
+	"grade",
+	"capacity",
+	"location",
+}
+
+// ExamFilter narrows down the exams list, zero values match everything.
+// From and To bound the start of the exam, the location is a case
+// insensitive substring.
+type ExamFilter struct {
+	Grade    uint
+	TypeID   uint
+	From     time.Time
+	To       time.Time
+	Location string
+}
+
+func (f *ExamFilter) apply(query *gorm.DB) *gorm.DB {
+	if f.Grade != 0 {
+		query = query.Where("grade = ?", f.Grade)
+	}
+	if f.TypeID != 0 {
+		query = query.Where("exam_type_id = ?", f.TypeID)
+	}
+	if !f.From.IsZero() {
+		query = query.Where("start >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		query = query.Where("start < ?", f.To)
+	}
+	if f.Location != "" {
+		query = query.Where("location ILIKE ?", listing.Contains(f.Location))
+	}
+	return query
+}
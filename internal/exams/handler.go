@@ -2,11 +2,17 @@ package exams
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/L2SH-Dev/admissions/internal/audit"
 	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/listing"
+	"github.com/L2SH-Dev/admissions/internal/mailing"
 	"github.com/L2SH-Dev/admissions/internal/regdata"
 	"github.com/L2SH-Dev/admissions/internal/server"
 	"github.com/L2SH-Dev/admissions/internal/users"
@@ -15,6 +21,7 @@ import (
 	"github.com/L2SH-Dev/admissions/internal/users/roles"
 	"github.com/labstack/echo/v4"
 	"github.com/spf13/viper"
+	"gorm.io/gorm"
 )
 
 type ExamsHandler interface {
@@ -27,19 +34,33 @@ type ExamsHandler interface {
 	Unregister(c echo.Context) error
 	Allocation(c echo.Context) error
 	RegistrationStatus(c echo.Context) error
+	MyResults(c echo.Context) error
+	JoinWaitlist(c echo.Context) error
+	LeaveWaitlist(c echo.Context) error
 
 	// admin endpoints
 	List(c echo.Context) error
 	Create(c echo.Context) error
 	Delete(c echo.Context) error
+	UpdateCapacity(c echo.Context) error
+	ListWaitlist(c echo.Context) error
 	ListTypes(c echo.Context) error
 	DownloadRegistrations(c echo.Context) error
+	ListResults(c echo.Context) error
+	RecordResult(c echo.Context) error
+	UpdateResult(c echo.Context) error
+	SubmitResults(c echo.Context) error
+	PublishResults(c echo.Context) error
+	UnpublishResults(c echo.Context) error
+	ImportResults(c echo.Context) error
 }
 
 type ExamsHandlerImpl struct {
+	storage      datastore.Storage
 	service      ExamsService
 	usersService users.UsersService
 	authService  auth.AuthService
+	auditService audit.AuditService
 }
 
 func NewExamsHandler(storage datastore.Storage) server.Handler {
@@ -53,18 +74,22 @@ func NewExamsHandler(storage datastore.Storage) server.Handler {
 	authRepo := auth.NewAuthRepo(storage)
 	authService := auth.NewAuthService(authRepo, passwordsService)
 
+	mailingService := mailing.NewMailingService(mailing.NewOutboxMailer(mailing.NewOutboxRepo(storage)))
+
 	regDataRepo := regdata.NewRegistrationDataRepo(storage)
-	regDataService := regdata.NewRegistrationDataService(regDataRepo, usersService, authService, passwordsService)
+	regDataService := regdata.NewRegistrationDataService(storage, regDataRepo, usersService, authService, passwordsService, mailingService)
 
 	repo := NewExamsRepo(storage)
-	service := NewExamsService(repo, regDataService)
+	service := NewExamsService(storage, repo, regDataService, mailingService)
 
-	service.CreateDefaultExamTypes()
+	service.CreateDefaultExamTypes(context.Background())
 
 	return &ExamsHandlerImpl{
+		storage:      storage,
 		service:      service,
 		usersService: usersService,
 		authService:  authService,
+		auditService: audit.NewAuditService(audit.NewAuditRepo(storage)),
 	}
 }
 
@@ -84,21 +109,40 @@ func (h *ExamsHandlerImpl) AddRoutes(g *echo.Group) {
 	privateGroup.DELETE("/register/:examID", h.Unregister)
 	privateGroup.GET("/allocation/:examID", h.Allocation)
 	privateGroup.GET("/registration_status/:examID", h.RegistrationStatus)
+	privateGroup.GET("/results", h.MyResults)
+	privateGroup.POST("/waitlist/:examID", h.JoinWaitlist)
+	privateGroup.DELETE("/waitlist/:examID", h.LeaveWaitlist)
 
 	// admin endpoints
 	adminGroup := privateGroup.Group("/admin")
-	usersMiddlewareService.AddAdminMiddleware(adminGroup, roles.Role{WriteGeneral: true})
-
-	adminGroup.GET("", h.List)
-	adminGroup.POST("", h.Create)
-	adminGroup.DELETE("/:examID", h.Delete)
-	adminGroup.GET("/types", h.ListTypes)
-	adminGroup.GET("/registrations/:examID/download", h.DownloadRegistrations)
+	usersMiddlewareService.AddAdminMiddleware(adminGroup)
+
+	canRead := usersMiddlewareService.RequirePermission(roles.PermissionExamsRead)
+	canCreate := usersMiddlewareService.RequirePermission(roles.PermissionExamsCreate)
+	canManage := usersMiddlewareService.RequirePermission(roles.PermissionExamsManage)
+	canReadResults := usersMiddlewareService.RequirePermission(roles.PermissionExamsResultsRead)
+	canWriteResults := usersMiddlewareService.RequirePermission(roles.PermissionExamsResultsWrite)
+	canPublishResults := usersMiddlewareService.RequirePermission(roles.PermissionExamsResultsPublish)
+
+	adminGroup.GET("", h.List, canRead)
+	adminGroup.POST("", h.Create, canCreate)
+	adminGroup.DELETE("/:examID", h.Delete, canManage)
+	adminGroup.PUT("/:examID/capacity", h.UpdateCapacity, canManage)
+	adminGroup.GET("/waitlist/:examID", h.ListWaitlist, canRead)
+	adminGroup.GET("/types", h.ListTypes, canRead)
+	adminGroup.GET("/registrations/:examID/download", h.DownloadRegistrations, canRead)
+	adminGroup.GET("/results/:examID", h.ListResults, canReadResults)
+	adminGroup.POST("/results/:examID", h.RecordResult, canWriteResults)
+	adminGroup.PUT("/results/:examID/:userID", h.UpdateResult, canWriteResults)
+	adminGroup.POST("/results/:examID/bulk", h.SubmitResults, canWriteResults)
+	adminGroup.POST("/results/:examID/import", h.ImportResults, canWriteResults)
+	adminGroup.POST("/results/:examID/publish", h.PublishResults, canPublishResults)
+	adminGroup.DELETE("/results/:examID/publish", h.UnpublishResults, canPublishResults)
 }
 
 func (h *ExamsHandlerImpl) History(c echo.Context) error {
 	user := c.Get("currentUser").(*users.User)
-	exams, err := h.service.History(user)
+	exams, err := h.service.History(c.Request().Context(), user)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -108,7 +152,7 @@ func (h *ExamsHandlerImpl) History(c echo.Context) error {
 
 func (h *ExamsHandlerImpl) Available(c echo.Context) error {
 	user := c.Get("currentUser").(*users.User)
-	exams, err := h.service.Available(user)
+	exams, err := h.service.Available(c.Request().Context(), user)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -123,7 +167,7 @@ func (h *ExamsHandlerImpl) Register(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid exam ID")
 	}
 
-	if err := h.service.Register(user, examID); err != nil {
+	if err := h.service.Register(c.Request().Context(), user, examID); err != nil {
 		return mapServiceError(err)
 	}
 
@@ -137,7 +181,7 @@ func (h *ExamsHandlerImpl) Unregister(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid exam ID")
 	}
 
-	if err := h.service.Unregister(user, examID); err != nil {
+	if err := h.service.Unregister(c.Request().Context(), user, examID); err != nil {
 		return mapServiceError(err)
 	}
 
@@ -145,12 +189,13 @@ func (h *ExamsHandlerImpl) Unregister(c echo.Context) error {
 }
 
 func (h *ExamsHandlerImpl) Allocation(c echo.Context) error {
+	user := c.Get("currentUser").(*users.User)
 	examID, err := parseUintParam(c, "examID")
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid exam ID")
 	}
 
-	allocation, err := h.service.Allocation(examID)
+	allocation, err := h.service.Allocation(c.Request().Context(), user, examID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -158,12 +203,65 @@ func (h *ExamsHandlerImpl) Allocation(c echo.Context) error {
 	return c.JSON(http.StatusOK, allocation)
 }
 
+func (h *ExamsHandlerImpl) JoinWaitlist(c echo.Context) error {
+	user := c.Get("currentUser").(*users.User)
+	examID, err := parseUintParam(c, "examID")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid exam ID")
+	}
+
+	if err := h.service.JoinWaitlist(c.Request().Context(), user, examID); err != nil {
+		return mapServiceError(err)
+	}
+
+	return c.NoContent(http.StatusCreated)
+}
+
+func (h *ExamsHandlerImpl) LeaveWaitlist(c echo.Context) error {
+	user := c.Get("currentUser").(*users.User)
+	examID, err := parseUintParam(c, "examID")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid exam ID")
+	}
+
+	if err := h.service.LeaveWaitlist(c.Request().Context(), user, examID); err != nil {
+		return mapServiceError(err)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// List lists exams, latest first by default. The filters are grade, type_id,
+// from and to as dates bounding the start with the end inclusive, and
+// location.
 func (h *ExamsHandlerImpl) List(c echo.Context) error {
-	exams, err := h.service.List()
+	filter := &ExamFilter{Location: c.QueryParam("location")}
+
+	var to time.Time
+	err := echo.QueryParamsBinder(c).
+		Uint("grade", &filter.Grade).
+		Uint("type_id", &filter.TypeID).
+		Time("from", &filter.From, time.DateOnly).
+		Time("to", &to, time.DateOnly).
+		BindError()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if !to.IsZero() {
+		filter.To = to.AddDate(0, 0, 1)
+	}
+
+	page, err := listing.ParsePage(c, sortableColumns, "-start")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	exams, total, err := h.service.List(c.Request().Context(), filter, page)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
+	listing.SetHeaders(c, page, total)
 	return c.JSON(http.StatusOK, exams)
 }
 
@@ -177,7 +275,26 @@ func (h *ExamsHandlerImpl) Create(c echo.Context) error {
 		return err
 	}
 
-	err := h.service.Create(exam)
+	ctx := c.Request().Context()
+	err := h.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		if err := h.service.WithTx(tx).Create(ctx, exam); err != nil {
+			return err
+		}
+
+		return h.auditService.WithTx(tx).Log(c, audit.Event{
+			Action:     audit.ActionExamCreate,
+			TargetType: audit.TargetExam,
+			TargetID:   exam.ID,
+			Diff: map[string]audit.Change{
+				"start":    {New: exam.Start},
+				"end":      {New: exam.End},
+				"location": {New: exam.Location},
+				"capacity": {New: exam.Capacity},
+				"grade":    {New: exam.Grade},
+				"type_id":  {New: exam.ExamTypeID},
+			},
+		})
+	})
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -186,20 +303,106 @@ func (h *ExamsHandlerImpl) Create(c echo.Context) error {
 }
 
 func (h *ExamsHandlerImpl) Delete(c echo.Context) error {
+	ctx := c.Request().Context()
+
 	examID, err := parseUintParam(c, "examID")
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid exam ID")
 	}
 
-	if err := h.service.Delete(examID); err != nil {
+	exam, err := h.service.GetByID(ctx, examID)
+	if err != nil {
+		return mapServiceError(err)
+	}
+
+	err = h.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		if err := h.service.WithTx(tx).Delete(ctx, examID); err != nil {
+			return err
+		}
+
+		return h.auditService.WithTx(tx).Log(c, audit.Event{
+			Action:     audit.ActionExamDelete,
+			TargetType: audit.TargetExam,
+			TargetID:   examID,
+			Diff: map[string]audit.Change{
+				"start":    {Old: exam.Start},
+				"end":      {Old: exam.End},
+				"location": {Old: exam.Location},
+				"capacity": {Old: exam.Capacity},
+				"grade":    {Old: exam.Grade},
+				"type_id":  {Old: exam.ExamTypeID},
+			},
+		})
+	})
+	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
 	return c.NoContent(http.StatusOK)
 }
 
+func (h *ExamsHandlerImpl) UpdateCapacity(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	examID, err := parseUintParam(c, "examID")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid exam ID")
+	}
+
+	capacityRequest := new(struct {
+		Capacity uint `json:"capacity" validate:"required"`
+	})
+
+	if err := c.Bind(capacityRequest); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(capacityRequest); err != nil {
+		return err
+	}
+
+	exam, err := h.service.GetByID(ctx, examID)
+	if err != nil {
+		return mapServiceError(err)
+	}
+
+	err = h.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		if err := h.service.WithTx(tx).UpdateCapacity(ctx, examID, capacityRequest.Capacity); err != nil {
+			return err
+		}
+
+		return h.auditService.WithTx(tx).Log(c, audit.Event{
+			Action:     audit.ActionExamUpdateCapacity,
+			TargetType: audit.TargetExam,
+			TargetID:   examID,
+			Diff: map[string]audit.Change{
+				"capacity": {Old: exam.Capacity, New: capacityRequest.Capacity},
+			},
+		})
+	})
+	if err != nil {
+		return mapServiceError(err)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *ExamsHandlerImpl) ListWaitlist(c echo.Context) error {
+	examID, err := parseUintParam(c, "examID")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid exam ID")
+	}
+
+	entries, err := h.service.ListWaitlist(c.Request().Context(), examID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, entries)
+}
+
 func (h *ExamsHandlerImpl) ListTypes(c echo.Context) error {
-	types, err := h.service.ListTypes()
+	types, err := h.service.ListTypes(c.Request().Context())
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -214,7 +417,7 @@ func (h *ExamsHandlerImpl) RegistrationStatus(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid exam ID")
 	}
 
-	registeredToExam, registeredToSameType, err := h.service.RegistrationStatus(user, examID)
+	registeredToExam, registeredToSameType, err := h.service.RegistrationStatus(c.Request().Context(), user, examID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -231,7 +434,7 @@ func (h *ExamsHandlerImpl) DownloadRegistrations(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid exam ID")
 	}
 
-	registrations, err := h.service.GetRegistrations(examID)
+	registrations, err := h.service.GetRegistrations(c.Request().Context(), examID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -241,10 +444,11 @@ func (h *ExamsHandlerImpl) DownloadRegistrations(c echo.Context) error {
 	// Write UTF-8 BOM
 	csvData.Write([]byte{0xEF, 0xBB, 0xBF})
 	writer := csv.NewWriter(&csvData)
-	// Write header
+	// Write header, the empty result columns are filled in by the examiners
+	// and the file is uploaded back to ImportResults
 	writer.Write([]string{
 		"№",
-		"ID",
+		importColumnID,
 		"Фамилия",
 		"Имя",
 		"Отчество",
@@ -252,6 +456,9 @@ func (h *ExamsHandlerImpl) DownloadRegistrations(c echo.Context) error {
 		"Фамилия родителя",
 		"Имя родителя",
 		"Отчество родителя",
+		importColumnResult,
+		importColumnPoints,
+		importColumnMaxPoints,
 	})
 	// Write data with line numbers
 	for i, reg := range registrations {
@@ -265,24 +472,297 @@ func (h *ExamsHandlerImpl) DownloadRegistrations(c echo.Context) error {
 			reg.ParentLastName,
 			reg.ParentFirstName,
 			reg.ParentPatronymic,
+			"",
+			"",
+			"",
 		})
 	}
 	writer.Flush()
 
+	// Personal data is only handed out once the download is recorded
+	err = h.auditService.Log(c, audit.Event{
+		Action:     audit.ActionExamDownload,
+		TargetType: audit.TargetExam,
+		TargetID:   examID,
+		Diff:       map[string]int{"rows": len(registrations)},
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
 	return c.Blob(http.StatusOK, "text/csv; charset=utf-8", csvData.Bytes())
 }
 
+func (h *ExamsHandlerImpl) MyResults(c echo.Context) error {
+	user := c.Get("currentUser").(*users.User)
+	results, err := h.service.MyResults(c.Request().Context(), user)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
+
+func (h *ExamsHandlerImpl) ListResults(c echo.Context) error {
+	examID, err := parseUintParam(c, "examID")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid exam ID")
+	}
+
+	results, err := h.service.ListResults(c.Request().Context(), examID)
+	if err != nil {
+		return mapServiceError(err)
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
+
+func (h *ExamsHandlerImpl) RecordResult(c echo.Context) error {
+	examID, err := parseUintParam(c, "examID")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid exam ID")
+	}
+
+	input := new(ResultInput)
+	if err := c.Bind(input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(input); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	var result *ExamResult
+	err = h.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		var err error
+		result, err = h.service.WithTx(tx).RecordResult(ctx, examID, input)
+		if err != nil {
+			return err
+		}
+
+		return h.auditService.WithTx(tx).Log(c, resultsEvent(examID, []*ResultInput{input}))
+	})
+	if err != nil {
+		return mapServiceError(err)
+	}
+
+	return c.JSON(http.StatusCreated, result)
+}
+
+func (h *ExamsHandlerImpl) UpdateResult(c echo.Context) error {
+	examID, err := parseUintParam(c, "examID")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid exam ID")
+	}
+
+	userID, err := parseUintParam(c, "userID")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user ID")
+	}
+
+	input := new(ResultInput)
+	if err := c.Bind(input); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	input.UserID = userID
+
+	if err := c.Validate(input); err != nil {
+		return err
+	}
+
+	ctx := c.Request().Context()
+
+	var result *ExamResult
+	err = h.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		var err error
+		result, err = h.service.WithTx(tx).UpdateResult(ctx, examID, input)
+		if err != nil {
+			return err
+		}
+
+		return h.auditService.WithTx(tx).Log(c, resultsEvent(examID, []*ResultInput{input}))
+	})
+	if err != nil {
+		return mapServiceError(err)
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+func (h *ExamsHandlerImpl) SubmitResults(c echo.Context) error {
+	examID, err := parseUintParam(c, "examID")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid exam ID")
+	}
+
+	var inputs []*ResultInput
+	if err := c.Bind(&inputs); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	for _, input := range inputs {
+		if err := c.Validate(input); err != nil {
+			return err
+		}
+	}
+
+	ctx := c.Request().Context()
+
+	var results []*ExamResult
+	err = h.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		var err error
+		results, err = h.service.WithTx(tx).SubmitResults(ctx, examID, inputs)
+		if err != nil {
+			return err
+		}
+
+		return h.auditService.WithTx(tx).Log(c, resultsEvent(examID, inputs))
+	})
+	if err != nil {
+		return mapServiceError(err)
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
+
+func (h *ExamsHandlerImpl) PublishResults(c echo.Context) error {
+	return h.setResultsPublished(c, true)
+}
+
+func (h *ExamsHandlerImpl) UnpublishResults(c echo.Context) error {
+	return h.setResultsPublished(c, false)
+}
+
+func (h *ExamsHandlerImpl) setResultsPublished(c echo.Context, published bool) error {
+	examID, err := parseUintParam(c, "examID")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid exam ID")
+	}
+
+	action := audit.ActionExamResultsPublish
+	if !published {
+		action = audit.ActionExamResultsHide
+	}
+
+	ctx := c.Request().Context()
+	err = h.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		if err := h.service.WithTx(tx).PublishResults(ctx, examID, published); err != nil {
+			return err
+		}
+
+		return h.auditService.WithTx(tx).Log(c, audit.Event{
+			Action:     action,
+			TargetType: audit.TargetExam,
+			TargetID:   examID,
+			Diff: map[string]audit.Change{
+				"results_published": {Old: !published, New: published},
+			},
+		})
+	})
+	if err != nil {
+		return mapServiceError(err)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *ExamsHandlerImpl) ImportResults(c echo.Context) error {
+	examID, err := parseUintParam(c, "examID")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid exam ID")
+	}
+
+	dryRun := c.QueryParam("dry_run") == "true"
+
+	var maxPoints float64
+	if value := c.QueryParam("max_points"); value != "" {
+		maxPoints, err = strconv.ParseFloat(value, 32)
+		if err != nil || maxPoints < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid max points")
+		}
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "results file is required")
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	defer file.Close()
+
+	ctx := c.Request().Context()
+
+	var report *ImportReport
+	err = h.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		var err error
+		report, err = h.service.WithTx(tx).ImportResults(ctx, examID, file, float32(maxPoints), dryRun)
+		if err != nil || dryRun || report.HasIssues() {
+			return err
+		}
+
+		return h.auditService.WithTx(tx).Log(c, audit.Event{
+			Action:     audit.ActionExamResultsImport,
+			TargetType: audit.TargetExam,
+			TargetID:   examID,
+			Diff: map[string]any{
+				"file":    fileHeader.Filename,
+				"rows":    report.Rows,
+				"created": report.Created,
+			},
+		})
+	})
+	if err != nil {
+		return mapServiceError(err)
+	}
+
+	// Nothing is written when the file has issues, let the client know
+	if !dryRun && report.HasIssues() {
+		return c.JSON(http.StatusUnprocessableEntity, report)
+	}
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// resultsEvent records the results as they were submitted, keyed by user ID
+func resultsEvent(examID uint, inputs []*ResultInput) audit.Event {
+	diff := make(map[string]audit.Change, len(inputs))
+	for _, input := range inputs {
+		diff[strconv.FormatUint(uint64(input.UserID), 10)] = audit.Change{New: input}
+	}
+
+	return audit.Event{
+		Action:     audit.ActionExamResultsWrite,
+		TargetType: audit.TargetExam,
+		TargetID:   examID,
+		Diff:       diff,
+	}
+}
+
 func parseUintParam(c echo.Context, param string) (uint, error) {
 	value64, err := strconv.ParseUint(c.Param(param), 10, 32)
 	return uint(value64), err
 }
 
 func mapServiceError(err error) *echo.HTTPError {
-	switch err {
-	case ErrAlreadyRegistered, ErrInvalidGrade, ErrExamFull, ErrInvalidExamOrder:
+	switch {
+	case errors.Is(err, ErrAlreadyRegistered), errors.Is(err, ErrInvalidGrade),
+		errors.Is(err, ErrExamFull), errors.Is(err, ErrInvalidExamOrder),
+		errors.Is(err, ErrDismissed), errors.Is(err, ErrExamNotFull), errors.Is(err, ErrSameTypeRegistered):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrNotRegistered), errors.Is(err, ErrPointsNotAllowed),
+		errors.Is(err, ErrInvalidPoints), errors.Is(err, ErrInvalidImportFile):
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
-	case ErrNotRegistered:
+	case errors.Is(err, ErrNotWaitlisted):
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrResultExists), errors.Is(err, ErrAlreadyWaitlisted):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, ErrResultNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
 	default:
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
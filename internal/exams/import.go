@@ -0,0 +1,290 @@
+package exams
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidImportFile = errors.New("invalid results file")
+
+// Column titles recognised in the imported CSV. The file is expected to be
+// the one produced by DownloadRegistrations with the result columns filled in,
+// so every other column is ignored. Only CSV is accepted: spreadsheets saved
+// as XLSX have to be exported to CSV first, reading XLSX would need a
+// dependency for a format the download does not produce.
+const (
+	importColumnID        = "ID"
+	importColumnResult    = "Результат"
+	importColumnPoints    = "Баллы"
+	importColumnMaxPoints = "Максимум"
+)
+
+var importResultValues = map[string]string{
+	"PASSED":    "PASSED",
+	"FAILED":    "FAILED",
+	"ABSENT":    "ABSENT",
+	"СДАЛ":      "PASSED",
+	"НЕ СДАЛ":   "FAILED",
+	"НЕЯВКА":    "ABSENT",
+	"НЕ ЯВИЛСЯ": "ABSENT",
+}
+
+type ImportIssue struct {
+	Row    int    `json:"row"`
+	UserID string `json:"user_id"`
+	Reason string `json:"reason"`
+}
+
+type ImportReport struct {
+	DryRun         bool           `json:"dry_run"`
+	Rows           int            `json:"rows"`
+	Valid          int            `json:"valid"`
+	Created        int            `json:"created"`
+	UnknownIDs     []*ImportIssue `json:"unknown_ids"`
+	Unregistered   []*ImportIssue `json:"unregistered"`
+	PointsExceeded []*ImportIssue `json:"points_exceeded"`
+	Duplicates     []*ImportIssue `json:"duplicates"`
+	Invalid        []*ImportIssue `json:"invalid"`
+}
+
+func (r *ImportReport) HasIssues() bool {
+	return len(r.UnknownIDs) > 0 ||
+		len(r.Unregistered) > 0 ||
+		len(r.PointsExceeded) > 0 ||
+		len(r.Duplicates) > 0 ||
+		len(r.Invalid) > 0
+}
+
+type importRow struct {
+	line      int
+	rawID     string
+	userID    uint
+	result    string
+	points    string
+	maxPoints string
+}
+
+func (s *ExamsServiceImpl) ImportResults(ctx context.Context, examID uint, file io.Reader, defaultMaxPoints float32, dryRun bool) (*ImportReport, error) {
+	exam, err := s.repo.GetByID(ctx, examID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := parseImportFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{
+		DryRun:         dryRun,
+		Rows:           len(rows),
+		UnknownIDs:     []*ImportIssue{},
+		Unregistered:   []*ImportIssue{},
+		PointsExceeded: []*ImportIssue{},
+		Duplicates:     []*ImportIssue{},
+		Invalid:        []*ImportIssue{},
+	}
+
+	// Parse IDs first so that users can be looked up in one query
+	var userIDs []uint
+	for _, row := range rows {
+		id, err := strconv.ParseUint(row.rawID, 10, 32)
+		if err != nil {
+			continue
+		}
+		row.userID = uint(id)
+		userIDs = append(userIDs, row.userID)
+	}
+
+	existingUsers, err := s.repo.ExistingUserIDs(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	registered, err := s.repo.RegisteredUserIDs(ctx, examID)
+	if err != nil {
+		return nil, err
+	}
+	withResults, err := s.repo.ResultUserIDs(ctx, examID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Max points only make sense for exam types that have points
+	if !exam.ExamType.HasPoints {
+		defaultMaxPoints = 0
+	}
+
+	results := make([]*ExamResult, 0, len(rows))
+	seen := make(map[uint]bool, len(rows))
+	for _, row := range rows {
+		issue := &ImportIssue{Row: row.line, UserID: row.rawID}
+
+		switch {
+		case row.userID == 0:
+			issue.Reason = "invalid user ID"
+			report.Invalid = append(report.Invalid, issue)
+			continue
+		case !existingUsers[row.userID]:
+			issue.Reason = "user not found"
+			report.UnknownIDs = append(report.UnknownIDs, issue)
+			continue
+		case seen[row.userID]:
+			issue.Reason = "user ID is repeated in the file"
+			report.Duplicates = append(report.Duplicates, issue)
+			continue
+		case withResults[row.userID]:
+			seen[row.userID] = true
+			issue.Reason = ErrResultExists.Error()
+			report.Duplicates = append(report.Duplicates, issue)
+			continue
+		case !registered[row.userID]:
+			seen[row.userID] = true
+			issue.Reason = ErrNotRegistered.Error()
+			report.Unregistered = append(report.Unregistered, issue)
+			continue
+		}
+		seen[row.userID] = true
+
+		input, err := row.toInput(defaultMaxPoints)
+		if err != nil {
+			issue.Reason = err.Error()
+			report.Invalid = append(report.Invalid, issue)
+			continue
+		}
+
+		if exam.ExamType.HasPoints && input.Result != "ABSENT" && input.MaxPoints > 0 && input.Points > input.MaxPoints {
+			issue.Reason = fmt.Sprintf("points %g exceed max points %g", input.Points, input.MaxPoints)
+			report.PointsExceeded = append(report.PointsExceeded, issue)
+			continue
+		}
+
+		result, err := newResult(exam, input)
+		if err != nil {
+			issue.Reason = err.Error()
+			report.Invalid = append(report.Invalid, issue)
+			continue
+		}
+
+		results = append(results, result)
+	}
+	report.Valid = len(results)
+
+	if dryRun || report.HasIssues() {
+		return report, nil
+	}
+
+	if err := s.repo.CreateResults(ctx, results); err != nil {
+		return nil, err
+	}
+	report.Created = len(results)
+
+	return report, nil
+}
+
+func (row *importRow) toInput(defaultMaxPoints float32) (*ResultInput, error) {
+	result, ok := importResultValues[strings.ToUpper(strings.TrimSpace(row.result))]
+	if !ok {
+		return nil, fmt.Errorf("unknown result %q", row.result)
+	}
+
+	points, err := parsePoints(row.points, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid points %q", row.points)
+	}
+
+	maxPoints, err := parsePoints(row.maxPoints, defaultMaxPoints)
+	if err != nil {
+		return nil, fmt.Errorf("invalid max points %q", row.maxPoints)
+	}
+
+	return &ResultInput{
+		UserID:    row.userID,
+		Result:    result,
+		Points:    points,
+		MaxPoints: maxPoints,
+	}, nil
+}
+
+func parsePoints(value string, fallback float32) (float32, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return fallback, nil
+	}
+
+	// Spreadsheets in the Russian locale use a decimal comma
+	points, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", "."), 32)
+	if err != nil {
+		return 0, err
+	}
+
+	return float32(points), nil
+}
+
+func parseImportFile(file io.Reader) ([]*importRow, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	// Strip UTF-8 BOM
+	data = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+
+	// XLSX files are zip archives, tell the user instead of failing on the header
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return nil, errors.Join(ErrInvalidImportFile, errors.New("XLSX is not supported, save the sheet as CSV"))
+	}
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Join(ErrInvalidImportFile, err)
+	}
+	if len(records) == 0 {
+		return nil, errors.Join(ErrInvalidImportFile, errors.New("file is empty"))
+	}
+
+	columns := make(map[string]int)
+	for i, title := range records[0] {
+		columns[strings.TrimSpace(title)] = i
+	}
+	for _, required := range []string{importColumnID, importColumnResult} {
+		if _, ok := columns[required]; !ok {
+			return nil, errors.Join(ErrInvalidImportFile, fmt.Errorf("column %q is missing", required))
+		}
+	}
+
+	cell := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rows []*importRow
+	for i, record := range records[1:] {
+		row := &importRow{
+			line:      i + 2, // 1-based and after the header
+			rawID:     cell(record, importColumnID),
+			result:    cell(record, importColumnResult),
+			points:    cell(record, importColumnPoints),
+			maxPoints: cell(record, importColumnMaxPoints),
+		}
+
+		// Skip blank lines that spreadsheets like to leave at the end
+		if row.rawID == "" && row.result == "" && row.points == "" {
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
@@ -0,0 +1,66 @@
+package exams_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/L2SH-Dev/admissions/internal/exams"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImportFile(t *testing.T) {
+	// The header of DownloadRegistrations with a BOM, reordered cells and a trailing blank line
+	file := "\xEF\xBB\xBF№,ID,Фамилия,Имя,Отчество,Телефон,Фамилия родителя,Имя родителя,Отчество родителя,Результат,Баллы,Максимум\n" +
+		"1,12,Иванов,Иван,,+79990000000,Иванова,Мария,,сдал,\"7,5\",10\n" +
+		"2,13,Петров,Пётр,,+79990000001,Петрова,Анна,,Неявка,,\n" +
+		",,,,,,,,,,,\n"
+
+	rows, err := exams.ParseImportFile(strings.NewReader(file))
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, 2, rows[0].Line)
+	assert.Equal(t, "12", rows[0].RawID)
+	assert.Equal(t, 3, rows[1].Line)
+
+	input, err := rows[0].ToInput(20)
+	require.NoError(t, err)
+	assert.Equal(t, &exams.ResultInput{UserID: 12, Result: "PASSED", Points: 7.5, MaxPoints: 10}, input)
+
+	// Empty max points fall back to the default
+	input, err = rows[1].ToInput(20)
+	require.NoError(t, err)
+	assert.Equal(t, &exams.ResultInput{UserID: 13, Result: "ABSENT", Points: 0, MaxPoints: 20}, input)
+}
+
+func TestParseImportFileInvalid(t *testing.T) {
+	cases := map[string]string{
+		"empty":          "",
+		"missing result": "ID,Баллы\n1,5\n",
+		"missing ID":     "Результат\nPASSED\n",
+		"xlsx":           "PK\x03\x04\x14\x00\x06\x00",
+		"broken quotes":  "ID,Результат\n1,\"PASSED\n",
+	}
+	for name, file := range cases {
+		t.Run(name, func(t *testing.T) {
+			_, err := exams.ParseImportFile(strings.NewReader(file))
+			assert.ErrorIs(t, err, exams.ErrInvalidImportFile)
+		})
+	}
+}
+
+func TestImportRowToInputInvalid(t *testing.T) {
+	file := "ID,Результат,Баллы,Максимум\n" +
+		"1,пересдача,5,10\n" +
+		"2,PASSED,пять,10\n" +
+		"3,PASSED,5,много\n"
+
+	rows, err := exams.ParseImportFile(strings.NewReader(file))
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+
+	for _, row := range rows {
+		_, err := row.ToInput(0)
+		assert.Error(t, err, "row %d", row.Line)
+	}
+}
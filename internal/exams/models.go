@@ -9,10 +9,19 @@ import (
 )
 
 var (
-	ErrAlreadyRegistered = errors.New("user is already registered to the exam")
-	ErrInvalidGrade      = errors.New("user's grade does not match exam grade")
-	ErrExamFull          = errors.New("exam capacity has been reached")
-	ErrInvalidExamOrder  = errors.New("exam is not the next required exam type")
+	ErrAlreadyRegistered  = errors.New("user is already registered to the exam")
+	ErrInvalidGrade       = errors.New("user's grade does not match exam grade")
+	ErrExamFull           = errors.New("exam capacity has been reached")
+	ErrInvalidExamOrder   = errors.New("exam is not the next required exam type")
+	ErrDismissed          = errors.New("user has been dismissed from the admissions")
+	ErrResultExists       = errors.New("result for this user and exam already exists")
+	ErrResultNotFound     = errors.New("result for this user and exam not found")
+	ErrPointsNotAllowed   = errors.New("exam type does not have points")
+	ErrInvalidPoints      = errors.New("points must be between 0 and max points")
+	ErrExamNotFull        = errors.New("exam has free seats, register instead of joining the waitlist")
+	ErrAlreadyWaitlisted  = errors.New("user is already on the waitlist for the exam")
+	ErrNotWaitlisted      = errors.New("user is not on the waitlist for the exam")
+	ErrSameTypeRegistered = errors.New("user is already registered to an exam of the same type")
 )
 
 type Exam struct {
@@ -24,6 +33,8 @@ type Exam struct {
 	Grade      uint      `json:"grade" gorm:"not null" validate:"required,min=6,max=11"`
 	ExamTypeID uint      `json:"type_id" gorm:"not null" validate:"required"`
 	ExamType   ExamType  `json:"type" gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+
+	ResultsPublished bool `json:"results_published" gorm:"not null;default:false"`
 }
 
 type ExamType struct {
@@ -36,17 +47,25 @@ type ExamType struct {
 
 type ExamRegistration struct {
 	gorm.Model
-	ExamID uint       `json:"-" gorm:"not null;index"`
+	ExamID uint       `json:"-" gorm:"not null;index;uniqueIndex:idx_exam_registrations_exam_user,where:deleted_at IS NULL"`
+	Exam   Exam       `json:"exam" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	UserID uint       `json:"-" gorm:"not null;index;uniqueIndex:idx_exam_registrations_exam_user,where:deleted_at IS NULL"`
+	User   users.User `json:"user" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+type ExamWaitlistEntry struct {
+	gorm.Model
+	ExamID uint       `json:"-" gorm:"not null;index;uniqueIndex:idx_exam_waitlist_exam_user,where:deleted_at IS NULL"`
 	Exam   Exam       `json:"exam" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	UserID uint       `json:"-" gorm:"not null;index"`
+	UserID uint       `json:"-" gorm:"not null;index;uniqueIndex:idx_exam_waitlist_exam_user,where:deleted_at IS NULL"`
 	User   users.User `json:"user" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 }
 
 type ExamResult struct {
 	gorm.Model
-	ExamID    uint       `json:"-" gorm:"not null;index"`
+	ExamID    uint       `json:"-" gorm:"not null;index;uniqueIndex:idx_exam_results_exam_user,where:deleted_at IS NULL"`
 	Exam      Exam       `json:"exam" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
-	UserID    uint       `json:"-" gorm:"not null;index"`
+	UserID    uint       `json:"-" gorm:"not null;index;uniqueIndex:idx_exam_results_exam_user,where:deleted_at IS NULL"`
 	User      users.User `json:"user" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
 	Result    string     `json:"result" gorm:"not null" validate:"required,oneof=PASSED FAILED ABSENT"`
 	Dismissed bool       `json:"dismissed" gorm:"not null"`
@@ -54,6 +73,13 @@ type ExamResult struct {
 	MaxPoints float32    `json:"max_points" gorm:"not null"`
 }
 
+type ResultInput struct {
+	UserID    uint    `json:"user_id" validate:"required"`
+	Result    string  `json:"result" validate:"required,oneof=PASSED FAILED ABSENT"`
+	Points    float32 `json:"points" validate:"min=0"`
+	MaxPoints float32 `json:"max_points" validate:"min=0"`
+}
+
 func (e *Exam) BeforeDelete(tx *gorm.DB) error {
 	if e.ID == 0 {
 		return nil
@@ -67,5 +93,9 @@ func (e *Exam) BeforeDelete(tx *gorm.DB) error {
 		return err
 	}
 
+	if err := tx.Model(&ExamWaitlistEntry{}).Where("exam_id = ?", e.ID).Delete(&ExamWaitlistEntry{}).Error; err != nil {
+		return err
+	}
+
 	return nil
 }
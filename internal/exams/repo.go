@@ -1,28 +1,57 @@
 package exams
 
 import (
+	"context"
 	"errors"
 
 	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/listing"
+	"github.com/L2SH-Dev/admissions/internal/users"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type ExamsRepo interface {
-	Create(exam *Exam) error
-	Delete(examID uint) error
-	CreateExamType(examType *ExamType) error
-	List() ([]*Exam, error)
-	GetByID(examID uint) (*Exam, error)
-	CreateRegistration(userID, examID uint) error
-	IsRegistered(userID, examID uint) (bool, error)
-	CountRegistrations(examID uint) (uint, error)
-	ListTypes() ([]*ExamType, error)
-	TypeExistsByTitle(title string) (bool, error)
-	History(userID uint) ([]*Exam, error)
-	Available(userID uint, grade uint) ([]*Exam, error)
-	RegistrationStatus(userID uint, examID uint) (bool, bool, error)
-	GetNextExamTypeOrder(userID uint) (int, error)
-	GetRegistrations(examID uint) ([]*ExamRegistration, error)
-	DeleteRegistration(userID, examID uint) error
+	Create(ctx context.Context, exam *Exam) error
+	Delete(ctx context.Context, examID uint) error
+	UpdateCapacity(ctx context.Context, examID uint, capacity uint) error
+	CreateExamType(ctx context.Context, examType *ExamType) error
+	List(ctx context.Context, filter *ExamFilter, page listing.Page) ([]*Exam, int64, error)
+	GetByID(ctx context.Context, examID uint) (*Exam, error)
+	LockByID(ctx context.Context, examID uint) (*Exam, error)
+	ListAll(ctx context.Context) ([]*Exam, error)
+	CreateMissing(ctx context.Context, exams []*Exam) (int, error)
+	CreateRegistration(ctx context.Context, userID, examID uint) error
+	IsRegistered(ctx context.Context, userID, examID uint) (bool, error)
+	CountRegistrations(ctx context.Context, examID uint) (uint, error)
+	ListTypes(ctx context.Context) ([]*ExamType, error)
+	TypeExistsByTitle(ctx context.Context, title string) (bool, error)
+	History(ctx context.Context, userID uint) ([]*Exam, error)
+	Available(ctx context.Context, userID uint, grade uint) ([]*Exam, error)
+	RegistrationStatus(ctx context.Context, userID uint, examID uint) (bool, bool, error)
+	GetNextExamTypeOrder(ctx context.Context, userID uint) (int, error)
+	GetRegistrations(ctx context.Context, examID uint) ([]*ExamRegistration, error)
+	DeleteRegistration(ctx context.Context, userID, examID uint) error
+	IsDismissed(ctx context.Context, userID uint) (bool, error)
+	AddToWaitlist(ctx context.Context, userID, examID uint) error
+	RemoveFromWaitlist(ctx context.Context, userID, examID uint) error
+	IsWaitlisted(ctx context.Context, userID, examID uint) (bool, error)
+	ListWaitlist(ctx context.Context, examID uint) ([]*ExamWaitlistEntry, error)
+	CountWaitlist(ctx context.Context, examID uint) (uint, error)
+	WaitlistPosition(ctx context.Context, userID, examID uint) (uint, error)
+	CreateResult(ctx context.Context, result *ExamResult) error
+	UpdateResult(ctx context.Context, result *ExamResult) error
+	GetResult(ctx context.Context, userID, examID uint) (*ExamResult, error)
+	ResultExists(ctx context.Context, userID, examID uint) (bool, error)
+	SaveResults(ctx context.Context, results []*ExamResult) error
+	CreateResults(ctx context.Context, results []*ExamResult) error
+	ExistingUserIDs(ctx context.Context, userIDs []uint) (map[uint]bool, error)
+	RegisteredUserIDs(ctx context.Context, examID uint) (map[uint]bool, error)
+	ResultUserIDs(ctx context.Context, examID uint) (map[uint]bool, error)
+	ListResults(ctx context.Context, examID uint) ([]*ExamResult, error)
+	ListPublishedResults(ctx context.Context, userID uint) ([]*ExamResult, error)
+	SetResultsPublished(ctx context.Context, examID uint, published bool) error
+	WithTx(tx datastore.Storage) ExamsRepo
 }
 
 type ExamsRepoImpl struct {
@@ -30,14 +59,15 @@ type ExamsRepoImpl struct {
 }
 
 func NewExamsRepo(storage datastore.Storage) ExamsRepo {
-	if err := storage.DB().AutoMigrate(&Exam{}, &ExamType{}, &ExamRegistration{}, &ExamResult{}); err != nil {
-		panic(err)
-	}
 	return &ExamsRepoImpl{storage: storage}
 }
 
-func (r *ExamsRepoImpl) Create(exam *Exam) error {
-	err := r.storage.DB().Create(exam).Error
+func (r *ExamsRepoImpl) WithTx(tx datastore.Storage) ExamsRepo {
+	return &ExamsRepoImpl{storage: tx}
+}
+
+func (r *ExamsRepoImpl) Create(ctx context.Context, exam *Exam) error {
+	err := r.storage.DB().WithContext(ctx).Create(exam).Error
 	if err != nil {
 		return err
 	}
@@ -49,8 +79,8 @@ func (r *ExamsRepoImpl) Create(exam *Exam) error {
 	return nil
 }
 
-func (r *ExamsRepoImpl) Delete(examID uint) error {
-	err := r.storage.DB().Delete(&Exam{}, examID).Error
+func (r *ExamsRepoImpl) Delete(ctx context.Context, examID uint) error {
+	err := r.storage.DB().WithContext(ctx).Delete(&Exam{}, examID).Error
 	if err != nil {
 		return err
 	}
@@ -58,8 +88,20 @@ func (r *ExamsRepoImpl) Delete(examID uint) error {
 	return nil
 }
 
-func (r *ExamsRepoImpl) CreateExamType(examType *ExamType) error {
-	err := r.storage.DB().Create(examType).Error
+func (r *ExamsRepoImpl) UpdateCapacity(ctx context.Context, examID uint, capacity uint) error {
+	result := r.storage.DB().WithContext(ctx).Model(&Exam{}).Where("id = ?", examID).Update("capacity", capacity)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *ExamsRepoImpl) CreateExamType(ctx context.Context, examType *ExamType) error {
+	err := r.storage.DB().WithContext(ctx).Create(examType).Error
 	if err != nil {
 		return err
 	}
@@ -71,19 +113,39 @@ func (r *ExamsRepoImpl) CreateExamType(examType *ExamType) error {
 	return nil
 }
 
-func (r *ExamsRepoImpl) List() ([]*Exam, error) {
+// List returns one page of the exams matching the filter and the number of
+// all matching exams
+func (r *ExamsRepoImpl) List(ctx context.Context, filter *ExamFilter, page listing.Page) ([]*Exam, int64, error) {
+	query := filter.apply(r.storage.DB().WithContext(ctx).Model(&Exam{}))
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
 	var exams []*Exam
-	err := r.storage.DB().Preload("ExamType").Order("start DESC").Find(&exams).Error
+	if err := page.Apply(query).Preload("ExamType").Find(&exams).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return exams, total, nil
+}
+
+func (r *ExamsRepoImpl) GetByID(ctx context.Context, examID uint) (*Exam, error) {
+	var exam Exam
+	err := r.storage.DB().WithContext(ctx).Preload("ExamType").First(&exam, examID).Error
 	if err != nil {
 		return nil, err
 	}
 
-	return exams, nil
+	return &exam, nil
 }
 
-func (r *ExamsRepoImpl) GetByID(examID uint) (*Exam, error) {
+// LockByID reads the exam and locks its row until the end of the
+// transaction, registrations to the exam wait for it
+func (r *ExamsRepoImpl) LockByID(ctx context.Context, examID uint) (*Exam, error) {
 	var exam Exam
-	err := r.storage.DB().Preload("ExamType").First(&exam, examID).Error
+	err := r.storage.DB().WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).Preload("ExamType").First(&exam, examID).Error
 	if err != nil {
 		return nil, err
 	}
@@ -91,23 +153,94 @@ func (r *ExamsRepoImpl) GetByID(examID uint) (*Exam, error) {
 	return &exam, nil
 }
 
-func (r *ExamsRepoImpl) CreateRegistration(userID, examID uint) error {
-	reg := &ExamRegistration{UserID: userID, ExamID: examID}
-	err := r.storage.DB().Create(reg).Error
+func (r *ExamsRepoImpl) ListAll(ctx context.Context) ([]*Exam, error) {
+	var exams []*Exam
+	err := r.storage.DB().WithContext(ctx).Preload("ExamType").Order("start, id").Find(&exams).Error
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if reg.ID == 0 {
-		return errors.New("exam registration creation failed: registration ID is not set")
+	return exams, nil
+}
+
+// CreateMissing creates the exams that do not exist yet in one transaction.
+// An exam exists if one of the same type and grade starts at the same time
+// and place.
+func (r *ExamsRepoImpl) CreateMissing(ctx context.Context, exams []*Exam) (int, error) {
+	created := 0
+	err := r.storage.DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, exam := range exams {
+			var count int64
+			err := tx.Model(&Exam{}).
+				Where("exam_type_id = ? AND grade = ? AND start = ? AND location = ?", exam.ExamTypeID, exam.Grade, exam.Start, exam.Location).
+				Count(&count).Error
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+
+			if err := tx.Create(exam).Error; err != nil {
+				return err
+			}
+			created++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	return created, nil
+}
+
+// CreateRegistration registers the user to the exam enforcing the exam
+// capacity and registration uniqueness atomically. The exam row is locked for
+// the duration of the transaction, so concurrent registrations to the same
+// exam are serialized and can't overbook it.
+func (r *ExamsRepoImpl) CreateRegistration(ctx context.Context, userID, examID uint) error {
+	return r.storage.DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var exam Exam
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&exam, examID).Error
+		if err != nil {
+			return err
+		}
+
+		var registered int64
+		err = tx.Model(&ExamRegistration{}).Where("user_id = ? AND exam_id = ?", userID, examID).Count(&registered).Error
+		if err != nil {
+			return err
+		}
+		if registered > 0 {
+			return ErrAlreadyRegistered
+		}
+
+		var occupied int64
+		err = tx.Model(&ExamRegistration{}).Where("exam_id = ?", examID).Count(&occupied).Error
+		if err != nil {
+			return err
+		}
+		if uint(occupied) >= exam.Capacity {
+			return ErrExamFull
+		}
+
+		reg := &ExamRegistration{UserID: userID, ExamID: examID}
+		if err := tx.Create(reg).Error; err != nil {
+			return err
+		}
+
+		if reg.ID == 0 {
+			return errors.New("exam registration creation failed: registration ID is not set")
+		}
+
+		return nil
+	})
 }
 
-func (r *ExamsRepoImpl) IsRegistered(userID, examID uint) (bool, error) {
+func (r *ExamsRepoImpl) IsRegistered(ctx context.Context, userID, examID uint) (bool, error) {
 	var count int64
-	err := r.storage.DB().Model(&ExamRegistration{}).Where("user_id = ? AND exam_id = ?", userID, examID).Count(&count).Error
+	err := r.storage.DB().WithContext(ctx).Model(&ExamRegistration{}).Where("user_id = ? AND exam_id = ?", userID, examID).Count(&count).Error
 	if err != nil {
 		return false, err
 	}
@@ -115,9 +248,9 @@ func (r *ExamsRepoImpl) IsRegistered(userID, examID uint) (bool, error) {
 	return count > 0, nil
 }
 
-func (r *ExamsRepoImpl) CountRegistrations(examID uint) (uint, error) {
+func (r *ExamsRepoImpl) CountRegistrations(ctx context.Context, examID uint) (uint, error) {
 	var count int64
-	err := r.storage.DB().Model(&ExamRegistration{}).Where("exam_id = ?", examID).Count(&count).Error
+	err := r.storage.DB().WithContext(ctx).Model(&ExamRegistration{}).Where("exam_id = ?", examID).Count(&count).Error
 	if err != nil {
 		return 0, err
 	}
@@ -125,9 +258,9 @@ func (r *ExamsRepoImpl) CountRegistrations(examID uint) (uint, error) {
 	return uint(count), nil
 }
 
-func (r *ExamsRepoImpl) ListTypes() ([]*ExamType, error) {
+func (r *ExamsRepoImpl) ListTypes(ctx context.Context) ([]*ExamType, error) {
 	var types []*ExamType
-	err := r.storage.DB().Find(&types).Error
+	err := r.storage.DB().WithContext(ctx).Find(&types).Error
 	if err != nil {
 		return nil, err
 	}
@@ -135,9 +268,9 @@ func (r *ExamsRepoImpl) ListTypes() ([]*ExamType, error) {
 	return types, nil
 }
 
-func (r *ExamsRepoImpl) TypeExistsByTitle(title string) (bool, error) {
+func (r *ExamsRepoImpl) TypeExistsByTitle(ctx context.Context, title string) (bool, error) {
 	var count int64
-	err := r.storage.DB().Model(&ExamType{}).Where("title = ?", title).Count(&count).Error
+	err := r.storage.DB().WithContext(ctx).Model(&ExamType{}).Where("title = ?", title).Count(&count).Error
 	if err != nil {
 		return false, err
 	}
@@ -145,9 +278,9 @@ func (r *ExamsRepoImpl) TypeExistsByTitle(title string) (bool, error) {
 	return count > 0, nil
 }
 
-func (r *ExamsRepoImpl) History(userID uint) ([]*Exam, error) {
+func (r *ExamsRepoImpl) History(ctx context.Context, userID uint) ([]*Exam, error) {
 	var exams []*Exam
-	err := r.storage.DB().
+	err := r.storage.DB().WithContext(ctx).
 		Preload("ExamType").
 		Joins("JOIN exam_registrations ON exams.id = exam_registrations.exam_id").
 		Where("exam_registrations.user_id = ? AND exams.end < NOW()", userID).
@@ -159,9 +292,9 @@ func (r *ExamsRepoImpl) History(userID uint) ([]*Exam, error) {
 	return exams, nil
 }
 
-func (r *ExamsRepoImpl) Available(userID uint, grade uint) ([]*Exam, error) {
+func (r *ExamsRepoImpl) Available(ctx context.Context, userID uint, grade uint) ([]*Exam, error) {
 	// Get the next required exam type order
-	nextOrder, err := r.GetNextExamTypeOrder(userID)
+	nextOrder, err := r.GetNextExamTypeOrder(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -173,7 +306,7 @@ func (r *ExamsRepoImpl) Available(userID uint, grade uint) ([]*Exam, error) {
 
 	// Retrieve available exams matching the criteria
 	var exams []*Exam
-	err = r.storage.DB().
+	err = r.storage.DB().WithContext(ctx).
 		Preload("ExamType").
 		Joins("JOIN exam_types ON exams.exam_type_id = exam_types.id").
 		Where(`exams.grade = ? AND exams.start > NOW() AND exam_types."order" = ?`, grade, nextOrder).
@@ -185,22 +318,22 @@ func (r *ExamsRepoImpl) Available(userID uint, grade uint) ([]*Exam, error) {
 	return exams, nil
 }
 
-func (r *ExamsRepoImpl) RegistrationStatus(userID uint, examID uint) (bool, bool, error) {
+func (r *ExamsRepoImpl) RegistrationStatus(ctx context.Context, userID uint, examID uint) (bool, bool, error) {
 	// Check if the user is registered to the specified exam
-	registeredToExam, err := r.IsRegistered(userID, examID)
+	registeredToExam, err := r.IsRegistered(ctx, userID, examID)
 	if err != nil {
 		return false, false, err
 	}
 
 	// Get the exam type ID for the specified exam
-	exam, err := r.GetByID(examID)
+	exam, err := r.GetByID(ctx, examID)
 	if err != nil {
 		return false, false, err
 	}
 
 	// Check if the user is registered to another exam with the same exam type
 	var count int64
-	err = r.storage.DB().
+	err = r.storage.DB().WithContext(ctx).
 		Model(&ExamRegistration{}).
 		Joins("JOIN exams ON exam_registrations.exam_id = exams.id").
 		Where("exam_registrations.user_id = ? AND exams.exam_type_id = ? AND exams.id != ?", userID, exam.ExamTypeID, examID).
@@ -214,10 +347,10 @@ func (r *ExamsRepoImpl) RegistrationStatus(userID uint, examID uint) (bool, bool
 	return registeredToExam, registeredToSameType, nil
 }
 
-func (r *ExamsRepoImpl) GetNextExamTypeOrder(userID uint) (int, error) {
+func (r *ExamsRepoImpl) GetNextExamTypeOrder(ctx context.Context, userID uint) (int, error) {
 	// Get the highest exam type order the user has passed
 	var lastOrder int
-	err := r.storage.DB().
+	err := r.storage.DB().WithContext(ctx).
 		Model(&ExamResult{}).
 		Select("COALESCE(MAX(exam_types.order), 0)").
 		Joins("JOIN exams ON exam_results.exam_id = exams.id").
@@ -230,7 +363,7 @@ func (r *ExamsRepoImpl) GetNextExamTypeOrder(userID uint) (int, error) {
 
 	// Get the next exam type order
 	var nextOrder int
-	err = r.storage.DB().
+	err = r.storage.DB().WithContext(ctx).
 		Model(&ExamType{}).
 		Select(`MIN("order")`).
 		Where(`"order" > ?`, lastOrder).
@@ -247,9 +380,9 @@ func (r *ExamsRepoImpl) GetNextExamTypeOrder(userID uint) (int, error) {
 	return nextOrder, nil
 }
 
-func (r *ExamsRepoImpl) GetRegistrations(examID uint) ([]*ExamRegistration, error) {
+func (r *ExamsRepoImpl) GetRegistrations(ctx context.Context, examID uint) ([]*ExamRegistration, error) {
 	var registrations []*ExamRegistration
-	err := r.storage.DB().
+	err := r.storage.DB().WithContext(ctx).
 		Preload("User").
 		Where("exam_id = ?", examID).
 		Find(&registrations).Error
@@ -259,8 +392,250 @@ func (r *ExamsRepoImpl) GetRegistrations(examID uint) ([]*ExamRegistration, erro
 	return registrations, nil
 }
 
-func (r *ExamsRepoImpl) DeleteRegistration(userID, examID uint) error {
-	return r.storage.DB().
+func (r *ExamsRepoImpl) DeleteRegistration(ctx context.Context, userID, examID uint) error {
+	return r.storage.DB().WithContext(ctx).
 		Where("user_id = ? AND exam_id = ?", userID, examID).
 		Delete(&ExamRegistration{}).Error
 }
+
+func (r *ExamsRepoImpl) IsDismissed(ctx context.Context, userID uint) (bool, error) {
+	var count int64
+	err := r.storage.DB().WithContext(ctx).Model(&ExamResult{}).Where("user_id = ? AND dismissed = ?", userID, true).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *ExamsRepoImpl) AddToWaitlist(ctx context.Context, userID, examID uint) error {
+	entry := &ExamWaitlistEntry{UserID: userID, ExamID: examID}
+	err := r.storage.DB().WithContext(ctx).Create(entry).Error
+	if err != nil {
+		return err
+	}
+
+	if entry.ID == 0 {
+		return errors.New("waitlist entry creation failed: entry ID is not set")
+	}
+
+	return nil
+}
+
+func (r *ExamsRepoImpl) RemoveFromWaitlist(ctx context.Context, userID, examID uint) error {
+	return r.storage.DB().WithContext(ctx).
+		Where("user_id = ? AND exam_id = ?", userID, examID).
+		Delete(&ExamWaitlistEntry{}).Error
+}
+
+func (r *ExamsRepoImpl) IsWaitlisted(ctx context.Context, userID, examID uint) (bool, error) {
+	var count int64
+	err := r.storage.DB().WithContext(ctx).Model(&ExamWaitlistEntry{}).Where("user_id = ? AND exam_id = ?", userID, examID).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *ExamsRepoImpl) ListWaitlist(ctx context.Context, examID uint) ([]*ExamWaitlistEntry, error) {
+	var entries []*ExamWaitlistEntry
+	err := r.storage.DB().WithContext(ctx).
+		Preload("User").
+		Where("exam_id = ?", examID).
+		Order("id").
+		Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (r *ExamsRepoImpl) CountWaitlist(ctx context.Context, examID uint) (uint, error) {
+	var count int64
+	err := r.storage.DB().WithContext(ctx).Model(&ExamWaitlistEntry{}).Where("exam_id = ?", examID).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return uint(count), nil
+}
+
+func (r *ExamsRepoImpl) WaitlistPosition(ctx context.Context, userID, examID uint) (uint, error) {
+	var entry ExamWaitlistEntry
+	err := r.storage.DB().WithContext(ctx).Where("user_id = ? AND exam_id = ?", userID, examID).First(&entry).Error
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	// Entries are served in insertion order
+	var count int64
+	err = r.storage.DB().WithContext(ctx).Model(&ExamWaitlistEntry{}).Where("exam_id = ? AND id <= ?", examID, entry.ID).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return uint(count), nil
+}
+
+func (r *ExamsRepoImpl) CreateResult(ctx context.Context, result *ExamResult) error {
+	err := r.storage.DB().WithContext(ctx).Create(result).Error
+	if err != nil {
+		return err
+	}
+
+	if result.ID == 0 {
+		return errors.New("exam result creation failed: result ID is not set")
+	}
+
+	return nil
+}
+
+func (r *ExamsRepoImpl) UpdateResult(ctx context.Context, result *ExamResult) error {
+	return r.storage.DB().WithContext(ctx).
+		Model(result).
+		Select("Result", "Dismissed", "Points", "MaxPoints").
+		Updates(result).Error
+}
+
+func (r *ExamsRepoImpl) GetResult(ctx context.Context, userID, examID uint) (*ExamResult, error) {
+	var result ExamResult
+	err := r.storage.DB().WithContext(ctx).
+		Preload("User").
+		Where("user_id = ? AND exam_id = ?", userID, examID).
+		First(&result).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (r *ExamsRepoImpl) ResultExists(ctx context.Context, userID, examID uint) (bool, error) {
+	var count int64
+	err := r.storage.DB().WithContext(ctx).Model(&ExamResult{}).Where("user_id = ? AND exam_id = ?", userID, examID).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *ExamsRepoImpl) SaveResults(ctx context.Context, results []*ExamResult) error {
+	return r.storage.DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, result := range results {
+			var existing ExamResult
+			err := tx.Where("user_id = ? AND exam_id = ?", result.UserID, result.ExamID).First(&existing).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+
+			if err == nil {
+				result.ID = existing.ID
+				result.CreatedAt = existing.CreatedAt
+				err = tx.Model(result).Select("Result", "Dismissed", "Points", "MaxPoints").Updates(result).Error
+			} else {
+				err = tx.Create(result).Error
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *ExamsRepoImpl) CreateResults(ctx context.Context, results []*ExamResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	return r.storage.DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&results).Error
+	})
+}
+
+func (r *ExamsRepoImpl) ExistingUserIDs(ctx context.Context, userIDs []uint) (map[uint]bool, error) {
+	var ids []uint
+	if len(userIDs) > 0 {
+		err := r.storage.DB().WithContext(ctx).Model(&users.User{}).Where("id IN ?", userIDs).Pluck("id", &ids).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return toSet(ids), nil
+}
+
+func (r *ExamsRepoImpl) RegisteredUserIDs(ctx context.Context, examID uint) (map[uint]bool, error) {
+	var ids []uint
+	err := r.storage.DB().WithContext(ctx).Model(&ExamRegistration{}).Where("exam_id = ?", examID).Pluck("user_id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return toSet(ids), nil
+}
+
+func (r *ExamsRepoImpl) ResultUserIDs(ctx context.Context, examID uint) (map[uint]bool, error) {
+	var ids []uint
+	err := r.storage.DB().WithContext(ctx).Model(&ExamResult{}).Where("exam_id = ?", examID).Pluck("user_id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return toSet(ids), nil
+}
+
+func toSet(ids []uint) map[uint]bool {
+	set := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+func (r *ExamsRepoImpl) ListResults(ctx context.Context, examID uint) ([]*ExamResult, error) {
+	var results []*ExamResult
+	err := r.storage.DB().WithContext(ctx).
+		Preload("User").
+		Where("exam_id = ?", examID).
+		Order("user_id").
+		Find(&results).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func (r *ExamsRepoImpl) ListPublishedResults(ctx context.Context, userID uint) ([]*ExamResult, error) {
+	var results []*ExamResult
+	err := r.storage.DB().WithContext(ctx).
+		Preload("Exam.ExamType").
+		Joins("JOIN exams ON exam_results.exam_id = exams.id").
+		Where("exam_results.user_id = ? AND exams.results_published = ?", userID, true).
+		Order("exams.start").
+		Find(&results).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func (r *ExamsRepoImpl) SetResultsPublished(ctx context.Context, examID uint, published bool) error {
+	result := r.storage.DB().WithContext(ctx).Model(&Exam{}).Where("id = ?", examID).Update("results_published", published)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package exams
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidSchedule = errors.New("invalid exam schedule")
+
+// ScheduleEntry is an exam in a dumped schedule. The type is referenced by
+// title, so a schedule can be moved between databases.
+type ScheduleEntry struct {
+	Type     string    `json:"type"`
+	Grade    uint      `json:"grade"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Location string    `json:"location"`
+	Capacity uint      `json:"capacity"`
+}
+
+// DumpSchedule lists all exams ordered by start
+func (s *ExamsServiceImpl) DumpSchedule(ctx context.Context) ([]*ScheduleEntry, error) {
+	exams, err := s.repo.ListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*ScheduleEntry, 0, len(exams))
+	for _, exam := range exams {
+		entries = append(entries, &ScheduleEntry{
+			Type:     exam.ExamType.Title,
+			Grade:    exam.Grade,
+			Start:    exam.Start,
+			End:      exam.End,
+			Location: exam.Location,
+			Capacity: exam.Capacity,
+		})
+	}
+
+	return entries, nil
+}
+
+// ImportSchedule creates the exams of the schedule and returns how many
+// were created. Exams of the same type and grade starting at the same time
+// and place already exist and are skipped, so a schedule can be imported
+// again. Nothing is created if any entry is invalid.
+func (s *ExamsServiceImpl) ImportSchedule(ctx context.Context, entries []*ScheduleEntry) (int, error) {
+	types, err := s.repo.ListTypes(ctx)
+	if err != nil {
+		return 0, err
+	}
+	typeIDs := make(map[string]uint, len(types))
+	for _, examType := range types {
+		typeIDs[examType.Title] = examType.ID
+	}
+
+	var (
+		exams  = make([]*Exam, 0, len(entries))
+		issues []error
+	)
+	for i, entry := range entries {
+		typeID, ok := typeIDs[entry.Type]
+		switch {
+		case !ok:
+			issues = append(issues, fmt.Errorf("entry %d: unknown exam type %q", i+1, entry.Type))
+		case entry.Grade < 6 || entry.Grade > 11:
+			issues = append(issues, fmt.Errorf("entry %d: grade %d is out of range", i+1, entry.Grade))
+		case entry.Start.IsZero() || (!entry.End.IsZero() && !entry.End.After(entry.Start)):
+			issues = append(issues, fmt.Errorf("entry %d: invalid start and end", i+1))
+		case entry.Location == "" || entry.Capacity == 0:
+			issues = append(issues, fmt.Errorf("entry %d: location and capacity are required", i+1))
+		default:
+			exams = append(exams, &Exam{
+				Start:      entry.Start,
+				End:        entry.End,
+				Location:   entry.Location,
+				Capacity:   entry.Capacity,
+				Grade:      entry.Grade,
+				ExamTypeID: typeID,
+			})
+		}
+	}
+	if len(issues) > 0 {
+		return 0, errors.Join(append([]error{ErrInvalidSchedule}, issues...)...)
+	}
+
+	return s.repo.CreateMissing(ctx, exams)
+}
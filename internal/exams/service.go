@@ -1,12 +1,19 @@
 package exams
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/listing"
+	"github.com/L2SH-Dev/admissions/internal/mailing"
 	"github.com/L2SH-Dev/admissions/internal/regdata"
 	"github.com/L2SH-Dev/admissions/internal/users"
 	"github.com/spf13/viper"
+	"gorm.io/gorm"
 )
 
 var (
@@ -15,52 +22,105 @@ var (
 )
 
 type allocation struct {
-	Capacity uint `json:"capacity"`
-	Occupied uint `json:"occupied"`
+	Capacity   uint `json:"capacity"`
+	Occupied   uint `json:"occupied"`
+	Waitlisted uint `json:"waitlisted"`
+	// Position of the current user in the waitlist, 0 if not waitlisted
+	Position uint `json:"position"`
 }
 
 type ExamsService interface {
-	Create(exam *Exam) error
-	Delete(examID uint) error
-	CreateDefaultExamTypes() error
-	List() ([]*Exam, error)
-	Register(user *users.User, examID uint) error
-	Unregister(user *users.User, examID uint) error
-	ListTypes() ([]*ExamType, error)
-	Allocation(examID uint) (*allocation, error)
-	History(user *users.User) ([]*Exam, error)
-	Available(user *users.User) ([]*Exam, error)
-	RegistrationStatus(user *users.User, examID uint) (bool, bool, error)
-	GetRegistrations(examID uint) ([]*regdata.RegistrationData, error)
+	Create(ctx context.Context, exam *Exam) error
+	Delete(ctx context.Context, examID uint) error
+	UpdateCapacity(ctx context.Context, examID uint, capacity uint) error
+	CreateDefaultExamTypes(ctx context.Context) error
+	List(ctx context.Context, filter *ExamFilter, page listing.Page) ([]*Exam, int64, error)
+	GetByID(ctx context.Context, examID uint) (*Exam, error)
+	Register(ctx context.Context, user *users.User, examID uint) error
+	Unregister(ctx context.Context, user *users.User, examID uint) error
+	ListTypes(ctx context.Context) ([]*ExamType, error)
+	Allocation(ctx context.Context, user *users.User, examID uint) (*allocation, error)
+	JoinWaitlist(ctx context.Context, user *users.User, examID uint) error
+	LeaveWaitlist(ctx context.Context, user *users.User, examID uint) error
+	ListWaitlist(ctx context.Context, examID uint) ([]*ExamWaitlistEntry, error)
+	History(ctx context.Context, user *users.User) ([]*Exam, error)
+	Available(ctx context.Context, user *users.User) ([]*Exam, error)
+	RegistrationStatus(ctx context.Context, user *users.User, examID uint) (bool, bool, error)
+	GetRegistrations(ctx context.Context, examID uint) ([]*regdata.RegistrationData, error)
+	RecordResult(ctx context.Context, examID uint, input *ResultInput) (*ExamResult, error)
+	UpdateResult(ctx context.Context, examID uint, input *ResultInput) (*ExamResult, error)
+	SubmitResults(ctx context.Context, examID uint, inputs []*ResultInput) ([]*ExamResult, error)
+	ListResults(ctx context.Context, examID uint) ([]*ExamResult, error)
+	PublishResults(ctx context.Context, examID uint, published bool) error
+	MyResults(ctx context.Context, user *users.User) ([]*ExamResult, error)
+	ImportResults(ctx context.Context, examID uint, file io.Reader, defaultMaxPoints float32, dryRun bool) (*ImportReport, error)
+	DumpSchedule(ctx context.Context) ([]*ScheduleEntry, error)
+	ImportSchedule(ctx context.Context, entries []*ScheduleEntry) (int, error)
+	WithTx(tx datastore.Storage) ExamsService
 }
 
 type ExamsServiceImpl struct {
+	storage        datastore.Storage
 	repo           ExamsRepo
 	regDataService regdata.RegistrationDataService
+	mailingService mailing.MailingService
 }
 
-func NewExamsService(repo ExamsRepo, regDataService regdata.RegistrationDataService) ExamsService {
-	return &ExamsServiceImpl{repo: repo, regDataService: regDataService}
+func NewExamsService(storage datastore.Storage, repo ExamsRepo, regDataService regdata.RegistrationDataService, mailingService mailing.MailingService) ExamsService {
+	return &ExamsServiceImpl{
+		storage:        storage,
+		repo:           repo,
+		regDataService: regDataService,
+		mailingService: mailingService,
+	}
+}
+
+// WithTx returns the service with all of its dependencies bound to the
+// transaction of tx
+func (s *ExamsServiceImpl) WithTx(tx datastore.Storage) ExamsService {
+	return s.withTx(tx)
+}
+
+func (s *ExamsServiceImpl) withTx(tx datastore.Storage) *ExamsServiceImpl {
+	return &ExamsServiceImpl{
+		storage:        tx,
+		repo:           s.repo.WithTx(tx),
+		regDataService: s.regDataService.WithTx(tx),
+		mailingService: s.mailingService.WithTx(tx),
+	}
 }
 
-func (s *ExamsServiceImpl) Create(exam *Exam) error {
-	return s.repo.Create(exam)
+func (s *ExamsServiceImpl) Create(ctx context.Context, exam *Exam) error {
+	return s.repo.Create(ctx, exam)
 }
 
-func (s *ExamsServiceImpl) Delete(examID uint) error {
-	return s.repo.Delete(examID)
+func (s *ExamsServiceImpl) Delete(ctx context.Context, examID uint) error {
+	return s.repo.Delete(ctx, examID)
+}
+
+func (s *ExamsServiceImpl) UpdateCapacity(ctx context.Context, examID uint, capacity uint) error {
+	if err := s.repo.UpdateCapacity(ctx, examID, capacity); err != nil {
+		return err
+	}
+
+	// Raised capacity frees seats for waitlisted users
+	if err := s.promoteWaitlisted(ctx, examID); err != nil {
+		slog.ErrorContext(ctx, "Failed to promote waitlisted users", slog.Any("exam_id", examID), slog.Any("err", err))
+	}
+
+	return nil
 }
 
-func (s *ExamsServiceImpl) CreateDefaultExamTypes() error {
+func (s *ExamsServiceImpl) CreateDefaultExamTypes(ctx context.Context) error {
 	examTypesConfig := viper.Get("exams.types").([]interface{})
 
 	for _, examTypeData := range examTypesConfig {
 		data := examTypeData.(map[string]interface{})
 
 		title := data["title"].(string)
-		exists, err := s.repo.TypeExistsByTitle(title)
+		exists, err := s.repo.TypeExistsByTitle(ctx, title)
 		if err != nil {
-			slog.Warn("Failed to check if exam type exists by title", slog.Any("title", title), slog.Any("err", err))
+			slog.WarnContext(ctx, "Failed to check if exam type exists by title", slog.Any("title", title), slog.Any("err", err))
 			continue
 		}
 
@@ -75,7 +135,7 @@ func (s *ExamsServiceImpl) CreateDefaultExamTypes() error {
 			HasPoints:  data["has_points"].(bool),
 		}
 
-		err = s.repo.CreateExamType(&examType)
+		err = s.repo.CreateExamType(ctx, &examType)
 		if err != nil {
 			return err
 		}
@@ -84,69 +144,208 @@ func (s *ExamsServiceImpl) CreateDefaultExamTypes() error {
 	return nil
 }
 
-func (s *ExamsServiceImpl) List() ([]*Exam, error) {
-	return s.repo.List()
+func (s *ExamsServiceImpl) List(ctx context.Context, filter *ExamFilter, page listing.Page) ([]*Exam, int64, error) {
+	return s.repo.List(ctx, filter, page)
+}
+
+func (s *ExamsServiceImpl) GetByID(ctx context.Context, examID uint) (*Exam, error) {
+	return s.repo.GetByID(ctx, examID)
 }
 
-func (s *ExamsServiceImpl) Register(user *users.User, examID uint) error {
-	exam, err := s.repo.GetByID(examID)
+// Register checks and creates the registration with the exam locked, so
+// that concurrent registrations of the user cannot break the order of exams
+// and the capacity is checked against committed registrations only
+func (s *ExamsServiceImpl) Register(ctx context.Context, user *users.User, examID uint) error {
+	return s.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		txService := s.withTx(tx)
+
+		exam, err := txService.repo.LockByID(ctx, examID)
+		if err != nil {
+			return err
+		}
+
+		// Check if the user is allowed to register
+		if err := txService.canRegister(ctx, user, exam); err != nil {
+			return err
+		}
+
+		return txService.repo.CreateRegistration(ctx, user.ID, exam.ID)
+	})
+}
+
+// Unregister deletes the registration and gives the freed seat to the next
+// waitlisted user in one transaction with the exam locked, so that the seat
+// is not lost if the promotion fails
+func (s *ExamsServiceImpl) Unregister(ctx context.Context, user *users.User, examID uint) error {
+	return s.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		txService := s.withTx(tx)
+
+		exam, err := txService.repo.LockByID(ctx, examID)
+		if err != nil {
+			return err
+		}
+
+		// Check if the user is registered to the exam
+		registered, err := txService.repo.IsRegistered(ctx, user.ID, exam.ID)
+		if err != nil {
+			return err
+		}
+		if !registered {
+			return ErrNotRegistered
+		}
+
+		// Delete the registration
+		if err := txService.repo.DeleteRegistration(ctx, user.ID, exam.ID); err != nil {
+			return err
+		}
+
+		// Give the freed seat to the next waitlisted user
+		return txService.promoteWaitlisted(ctx, exam.ID)
+	})
+}
+
+func (s *ExamsServiceImpl) JoinWaitlist(ctx context.Context, user *users.User, examID uint) error {
+	exam, err := s.repo.GetByID(ctx, examID)
 	if err != nil {
 		return err
 	}
 
-	// Check if the user is allowed to register
-	if err := s.canRegister(user, exam); err != nil {
+	// Only users that would be able to register if there was a free seat
+	// can join the waitlist
+	err = s.canRegister(ctx, user, exam)
+	if err == nil {
+		return ErrExamNotFull
+	} else if !errors.Is(err, ErrExamFull) {
 		return err
 	}
 
-	return s.repo.CreateRegistration(user.ID, exam.ID)
+	waitlisted, err := s.repo.IsWaitlisted(ctx, user.ID, examID)
+	if err != nil {
+		return err
+	}
+	if waitlisted {
+		return ErrAlreadyWaitlisted
+	}
+
+	return s.repo.AddToWaitlist(ctx, user.ID, examID)
 }
 
-func (s *ExamsServiceImpl) Unregister(user *users.User, examID uint) error {
-	// Check if the user is registered to the exam
-	registered, err := s.repo.IsRegistered(user.ID, examID)
+func (s *ExamsServiceImpl) LeaveWaitlist(ctx context.Context, user *users.User, examID uint) error {
+	waitlisted, err := s.repo.IsWaitlisted(ctx, user.ID, examID)
 	if err != nil {
 		return err
 	}
-	if !registered {
-		return ErrNotRegistered
+	if !waitlisted {
+		return ErrNotWaitlisted
+	}
+
+	return s.repo.RemoveFromWaitlist(ctx, user.ID, examID)
+}
+
+func (s *ExamsServiceImpl) ListWaitlist(ctx context.Context, examID uint) ([]*ExamWaitlistEntry, error) {
+	return s.repo.ListWaitlist(ctx, examID)
+}
+
+// promoteWaitlisted registers waitlisted users in queue order while the exam
+// has free seats. Users that are no longer eligible keep their place and are
+// skipped.
+func (s *ExamsServiceImpl) promoteWaitlisted(ctx context.Context, examID uint) error {
+	exam, err := s.repo.GetByID(ctx, examID)
+	if err != nil {
+		return err
+	}
+
+	entries, err := s.repo.ListWaitlist(ctx, examID)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		err := s.canRegister(ctx, &entry.User, exam)
+		if errors.Is(err, ErrExamFull) {
+			return nil
+		} else if err != nil {
+			slog.DebugContext(ctx, "Skipping ineligible waitlisted user", slog.Any("user_id", entry.UserID), slog.Any("err", err))
+			continue
+		}
+
+		// The user leaves the waitlist and is notified only if the seat is
+		// taken, a failure keeps the user waitlisted
+		err = s.storage.WithTx(ctx, func(tx datastore.Storage) error {
+			txService := s.withTx(tx)
+			if err := txService.repo.CreateRegistration(ctx, entry.UserID, examID); err != nil {
+				return err
+			}
+			if err := txService.repo.RemoveFromWaitlist(ctx, entry.UserID, examID); err != nil {
+				return err
+			}
+
+			txService.notifyPromotion(ctx, &entry.User, exam)
+			return nil
+		})
+		if errors.Is(err, ErrExamFull) {
+			// Someone took the seat in the meantime
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ExamsServiceImpl) notifyPromotion(ctx context.Context, user *users.User, exam *Exam) {
+	regData, err := s.regDataService.GetByID(ctx, user.RegistrationDataID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get registration data of promoted user", slog.Any("user_id", user.ID), slog.Any("err", err))
+		return
+	}
+
+	err = s.mailingService.SendWaitlistPromotion(ctx, regData.Email, exam.ExamType.Title, exam.Location, exam.Start)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to send waitlist promotion", slog.Any("email", regData.Email), slog.Any("err", err))
 	}
-	// Delete the registration
-	return s.repo.DeleteRegistration(user.ID, examID)
 }
 
-func (s *ExamsServiceImpl) canRegister(user *users.User, exam *Exam) error {
-	// Check if the user is already registered to the exam
-	registered, err := s.repo.IsRegistered(user.ID, exam.ID)
+// canRegister checks whether the user may take a seat on the exam. The
+// capacity is checked last, so ErrExamFull means that the user is eligible
+// and only lacks a free seat.
+func (s *ExamsServiceImpl) canRegister(ctx context.Context, user *users.User, exam *Exam) error {
+	// Check if the user is already registered to the exam or to another
+	// exam of the same type
+	registered, registeredToSameType, err := s.repo.RegistrationStatus(ctx, user.ID, exam.ID)
 	if err != nil {
 		return err
 	}
 	if registered {
 		return ErrAlreadyRegistered
 	}
+	if registeredToSameType {
+		return ErrSameTypeRegistered
+	}
 
-	// Retrieve the user's registration data
-	regData, err := s.regDataService.GetByID(user.RegistrationDataID)
+	// Check if the user has been dismissed by a previous exam
+	dismissed, err := s.repo.IsDismissed(ctx, user.ID)
 	if err != nil {
 		return err
 	}
-
-	// Check if the user's grade matches the exam's grade
-	if regData.Grade != exam.Grade {
-		return ErrInvalidGrade
+	if dismissed {
+		return ErrDismissed
 	}
 
-	// Check if the exam capacity has not been exceeded
-	currentRegistrations, err := s.repo.CountRegistrations(exam.ID)
+	// Retrieve the user's registration data
+	regData, err := s.regDataService.GetByID(ctx, user.RegistrationDataID)
 	if err != nil {
 		return err
 	}
-	if currentRegistrations >= exam.Capacity {
-		return ErrExamFull
+
+	// Check if the user's grade matches the exam's grade
+	if regData.Grade != exam.Grade {
+		return ErrInvalidGrade
 	}
 
 	// Get the next required exam type order for the user
-	nextOrder, err := s.repo.GetNextExamTypeOrder(user.ID)
+	nextOrder, err := s.repo.GetNextExamTypeOrder(ctx, user.ID)
 	if err != nil {
 		return err
 	}
@@ -156,57 +355,89 @@ func (s *ExamsServiceImpl) canRegister(user *users.User, exam *Exam) error {
 		return ErrInvalidExamOrder
 	}
 
+	// Check if the exam capacity has not been exceeded
+	currentRegistrations, err := s.repo.CountRegistrations(ctx, exam.ID)
+	if err != nil {
+		return err
+	}
+	if currentRegistrations >= exam.Capacity {
+		return ErrExamFull
+	}
+
 	return nil
 }
 
-func (s *ExamsServiceImpl) ListTypes() ([]*ExamType, error) {
-	return s.repo.ListTypes()
+func (s *ExamsServiceImpl) ListTypes(ctx context.Context) ([]*ExamType, error) {
+	return s.repo.ListTypes(ctx)
 }
 
-func (s *ExamsServiceImpl) Allocation(examID uint) (*allocation, error) {
-	exam, err := s.repo.GetByID(examID)
+func (s *ExamsServiceImpl) Allocation(ctx context.Context, user *users.User, examID uint) (*allocation, error) {
+	exam, err := s.repo.GetByID(ctx, examID)
+	if err != nil {
+		return nil, err
+	}
+
+	occupied, err := s.repo.CountRegistrations(ctx, examID)
+	if err != nil {
+		return nil, err
+	}
+
+	waitlisted, err := s.repo.CountWaitlist(ctx, examID)
 	if err != nil {
 		return nil, err
 	}
 
-	occupied, err := s.repo.CountRegistrations(examID)
+	position, err := s.repo.WaitlistPosition(ctx, user.ID, examID)
 	if err != nil {
 		return nil, err
 	}
 
-	return &allocation{Capacity: exam.Capacity, Occupied: occupied}, nil
+	return &allocation{
+		Capacity:   exam.Capacity,
+		Occupied:   occupied,
+		Waitlisted: waitlisted,
+		Position:   position,
+	}, nil
 }
 
-func (s *ExamsServiceImpl) History(user *users.User) ([]*Exam, error) {
-	return s.repo.History(user.ID)
+func (s *ExamsServiceImpl) History(ctx context.Context, user *users.User) ([]*Exam, error) {
+	return s.repo.History(ctx, user.ID)
 }
 
-func (s *ExamsServiceImpl) Available(user *users.User) ([]*Exam, error) {
-	regData, err := s.regDataService.GetByID(user.RegistrationDataID)
+func (s *ExamsServiceImpl) Available(ctx context.Context, user *users.User) ([]*Exam, error) {
+	dismissed, err := s.repo.IsDismissed(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if dismissed {
+		return []*Exam{}, nil
+	}
+
+	regData, err := s.regDataService.GetByID(ctx, user.RegistrationDataID)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.repo.Available(user.ID, regData.Grade)
+	return s.repo.Available(ctx, user.ID, regData.Grade)
 }
 
-func (s *ExamsServiceImpl) RegistrationStatus(user *users.User, examID uint) (bool, bool, error) {
-	registeredToExam, registeredToSameType, err := s.repo.RegistrationStatus(user.ID, examID)
+func (s *ExamsServiceImpl) RegistrationStatus(ctx context.Context, user *users.User, examID uint) (bool, bool, error) {
+	registeredToExam, registeredToSameType, err := s.repo.RegistrationStatus(ctx, user.ID, examID)
 	if err != nil {
 		return false, false, err
 	}
 	return registeredToExam, registeredToSameType, nil
 }
 
-func (s *ExamsServiceImpl) GetRegistrations(examID uint) ([]*regdata.RegistrationData, error) {
-	regs, err := s.repo.GetRegistrations(examID)
+func (s *ExamsServiceImpl) GetRegistrations(ctx context.Context, examID uint) ([]*regdata.RegistrationData, error) {
+	regs, err := s.repo.GetRegistrations(ctx, examID)
 	if err != nil {
 		return nil, err
 	}
 
 	var regData []*regdata.RegistrationData
 	for _, reg := range regs {
-		data, err := s.regDataService.GetByID(reg.User.RegistrationDataID)
+		data, err := s.regDataService.GetByID(ctx, reg.User.RegistrationDataID)
 		if err != nil {
 			return nil, err
 		}
@@ -215,3 +446,141 @@ func (s *ExamsServiceImpl) GetRegistrations(examID uint) ([]*regdata.Registratio
 
 	return regData, nil
 }
+
+func (s *ExamsServiceImpl) RecordResult(ctx context.Context, examID uint, input *ResultInput) (*ExamResult, error) {
+	exam, err := s.repo.GetByID(ctx, examID)
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := s.repo.ResultExists(ctx, input.UserID, examID)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrResultExists
+	}
+
+	result, err := s.buildResult(ctx, exam, input)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CreateResult(ctx, result); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetResult(ctx, input.UserID, examID)
+}
+
+func (s *ExamsServiceImpl) UpdateResult(ctx context.Context, examID uint, input *ResultInput) (*ExamResult, error) {
+	exam, err := s.repo.GetByID(ctx, examID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.repo.GetResult(ctx, input.UserID, examID)
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrResultNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	result, err := s.buildResult(ctx, exam, input)
+	if err != nil {
+		return nil, err
+	}
+	result.ID = existing.ID
+
+	if err := s.repo.UpdateResult(ctx, result); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetResult(ctx, input.UserID, examID)
+}
+
+func (s *ExamsServiceImpl) SubmitResults(ctx context.Context, examID uint, inputs []*ResultInput) ([]*ExamResult, error) {
+	exam, err := s.repo.GetByID(ctx, examID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the whole batch before writing anything
+	results := make([]*ExamResult, 0, len(inputs))
+	seen := make(map[uint]bool, len(inputs))
+	for _, input := range inputs {
+		if seen[input.UserID] {
+			return nil, fmt.Errorf("user %d: %w", input.UserID, ErrResultExists)
+		}
+		seen[input.UserID] = true
+
+		result, err := s.buildResult(ctx, exam, input)
+		if err != nil {
+			return nil, fmt.Errorf("user %d: %w", input.UserID, err)
+		}
+		results = append(results, result)
+	}
+
+	if err := s.repo.SaveResults(ctx, results); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListResults(ctx, examID)
+}
+
+func (s *ExamsServiceImpl) ListResults(ctx context.Context, examID uint) ([]*ExamResult, error) {
+	if _, err := s.repo.GetByID(ctx, examID); err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListResults(ctx, examID)
+}
+
+func (s *ExamsServiceImpl) PublishResults(ctx context.Context, examID uint, published bool) error {
+	return s.repo.SetResultsPublished(ctx, examID, published)
+}
+
+func (s *ExamsServiceImpl) MyResults(ctx context.Context, user *users.User) ([]*ExamResult, error) {
+	return s.repo.ListPublishedResults(ctx, user.ID)
+}
+
+// buildResult validates the input against the exam type and the exam's
+// registrations and returns a result ready to be stored.
+func (s *ExamsServiceImpl) buildResult(ctx context.Context, exam *Exam, input *ResultInput) (*ExamResult, error) {
+	registered, err := s.repo.IsRegistered(ctx, input.UserID, exam.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !registered {
+		return nil, ErrNotRegistered
+	}
+
+	return newResult(exam, input)
+}
+
+// newResult checks the points against the exam type and computes dismissal.
+func newResult(exam *Exam, input *ResultInput) (*ExamResult, error) {
+	if !exam.ExamType.HasPoints && (input.Points != 0 || input.MaxPoints != 0) {
+		return nil, ErrPointsNotAllowed
+	}
+
+	if exam.ExamType.HasPoints && input.Result != "ABSENT" {
+		if input.MaxPoints <= 0 || input.Points < 0 || input.Points > input.MaxPoints {
+			return nil, ErrInvalidPoints
+		}
+	}
+
+	points := input.Points
+	if input.Result == "ABSENT" {
+		points = 0
+	}
+
+	return &ExamResult{
+		ExamID:    exam.ID,
+		UserID:    input.UserID,
+		Result:    input.Result,
+		Dismissed: exam.ExamType.Dismissing && input.Result != "PASSED",
+		Points:    points,
+		MaxPoints: input.MaxPoints,
+	}, nil
+}
@@ -0,0 +1,673 @@
+package exams_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/exams"
+	"github.com/L2SH-Dev/admissions/internal/listing"
+	"github.com/L2SH-Dev/admissions/internal/mailing"
+	"github.com/L2SH-Dev/admissions/internal/migrations"
+	"github.com/L2SH-Dev/admissions/internal/regdata"
+	"github.com/L2SH-Dev/admissions/internal/users"
+	"github.com/L2SH-Dev/admissions/internal/users/auth"
+	"github.com/L2SH-Dev/admissions/internal/users/auth/passwords"
+	"github.com/L2SH-Dev/admissions/internal/users/roles"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+var (
+	storage datastore.MockStorage
+)
+
+func TestMain(m *testing.M) {
+	viper.Set("secrets.jwt_key", "test_key")
+	viper.Set("users.default_role", "user")
+	viper.Set("users.roles", []string{"admin", "user"})
+	viper.Set("users.roles.user.permissions.admin", false)
+	viper.Set("users.roles.user.permissions.write_general", false)
+	viper.Set("users.roles.user.permissions.ai_access", false)
+	viper.Set("users.roles.admin.permissions.admin", true)
+	viper.Set("users.roles.admin.permissions.write_general", true)
+	viper.Set("users.roles.admin.permissions.ai_access", false)
+
+	s, cleanup := datastore.InitMockStorage()
+	storage = s
+
+	code := m.Run()
+
+	cleanup()
+	os.Exit(code)
+}
+
+type testEnv struct {
+	service        exams.ExamsService
+	repo           exams.ExamsRepo
+	usersService   users.UsersService
+	regDataService regdata.RegistrationDataService
+}
+
+func setupTestService(t *testing.T) *testEnv {
+	t.Cleanup(func() {
+		err := storage.Flush()
+		assert.NoError(t, err)
+	})
+
+	_, err := migrations.Up(storage.DB())
+	require.NoError(t, err)
+
+	rolesRepo := roles.NewRolesRepo(storage)
+	rolesService := roles.NewRolesService(rolesRepo)
+	usersRepo := users.NewUsersRepo(storage)
+	usersService := users.NewUsersService(usersRepo, rolesService)
+
+	passwordsRepo := passwords.NewPasswordsRepo(storage)
+	passwordsService := passwords.NewPasswordsService(passwordsRepo)
+	authRepo := auth.NewAuthRepo(storage)
+	authService := auth.NewAuthService(authRepo, passwordsService)
+
+	mailingService := mailing.NewMailingService(mailing.NewFileMailer(filepath.Join(t.TempDir(), "mail.mbox"), "noreply@example.com"))
+
+	regDataRepo := regdata.NewRegistrationDataRepo(storage)
+	regDataService := regdata.NewRegistrationDataService(storage, regDataRepo, usersService, authService, passwordsService, mailingService)
+
+	repo := exams.NewExamsRepo(storage)
+
+	return &testEnv{
+		service:        exams.NewExamsService(storage, repo, regDataService, mailingService),
+		repo:           repo,
+		usersService:   usersService,
+		regDataService: regDataService,
+	}
+}
+
+func (env *testEnv) createExam(t *testing.T, capacity uint) *exams.Exam {
+	ctx := context.Background()
+	examType := &exams.ExamType{Title: "письменная математика", Order: 1, Dismissing: true, HasPoints: true}
+	require.NoError(t, env.repo.CreateExamType(ctx, examType))
+
+	exam := &exams.Exam{
+		Start:      time.Now().Add(24 * time.Hour),
+		End:        time.Now().Add(26 * time.Hour),
+		Location:   "Test Location",
+		Capacity:   capacity,
+		Grade:      9,
+		ExamTypeID: examType.ID,
+	}
+	require.NoError(t, env.service.Create(ctx, exam))
+
+	return exam
+}
+
+func (env *testEnv) createApplicants(t *testing.T, count int) []*users.User {
+	ctx := context.Background()
+	applicants := make([]*users.User, 0, count)
+	for i := 0; i < count; i++ {
+		data := &regdata.RegistrationData{
+			Email:           fmt.Sprintf("test%d@example.com", i),
+			EmailVerified:   true,
+			FirstName:       fmt.Sprintf("Test%d", i),
+			LastName:        "User",
+			Gender:          "M",
+			BirthDate:       time.Date(2010, 1, 1, 0, 0, 0, 0, time.UTC),
+			Grade:           9,
+			OldSchool:       "Test School",
+			ParentFirstName: "Parent",
+			ParentLastName:  "Test",
+			ParentPhone:     "+79999999999",
+		}
+		require.NoError(t, env.regDataService.Create(ctx, data))
+
+		user, err := env.usersService.Create(ctx, data.ID, fmt.Sprintf("t.user-%05d", data.ID))
+		require.NoError(t, err)
+		applicants = append(applicants, user)
+	}
+
+	return applicants
+}
+
+func TestRegisterConcurrent(t *testing.T) {
+	ctx := context.Background()
+	env := setupTestService(t)
+
+	// Postgres caps the number of connections, keep the pool below it
+	sqlDB, err := storage.DB().DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(20)
+
+	const capacity = 5
+	exam := env.createExam(t, capacity)
+	applicants := env.createApplicants(t, 200)
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+		full      int
+	)
+	start := make(chan struct{})
+	for _, applicant := range applicants {
+		wg.Add(1)
+		go func(user *users.User) {
+			defer wg.Done()
+			<-start
+
+			err := env.service.Register(ctx, user, exam.ID)
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch err {
+			case nil:
+				succeeded++
+			case exams.ErrExamFull:
+				full++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(applicant)
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, capacity, succeeded)
+	assert.Equal(t, len(applicants)-capacity, full)
+
+	occupied, err := env.repo.CountRegistrations(ctx, exam.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint(capacity), occupied)
+}
+
+func TestRegisterConcurrentSameUser(t *testing.T) {
+	ctx := context.Background()
+	env := setupTestService(t)
+
+	sqlDB, err := storage.DB().DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(20)
+
+	exam := env.createExam(t, 10)
+	user := env.createApplicants(t, 1)[0]
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	start := make(chan struct{})
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+
+			err := env.service.Register(ctx, user, exam.ID)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil {
+				succeeded++
+			} else {
+				assert.ErrorIs(t, err, exams.ErrAlreadyRegistered)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, 1, succeeded)
+
+	occupied, err := env.repo.CountRegistrations(ctx, exam.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), occupied)
+}
+
+func TestUnregisterPromotesWaitlisted(t *testing.T) {
+	ctx := context.Background()
+	env := setupTestService(t)
+
+	exam := env.createExam(t, 1)
+	applicants := env.createApplicants(t, 3)
+
+	require.NoError(t, env.service.Register(ctx, applicants[0], exam.ID))
+	assert.ErrorIs(t, env.service.Register(ctx, applicants[1], exam.ID), exams.ErrExamFull)
+
+	require.NoError(t, env.service.JoinWaitlist(ctx, applicants[1], exam.ID))
+	require.NoError(t, env.service.JoinWaitlist(ctx, applicants[2], exam.ID))
+	assert.ErrorIs(t, env.service.JoinWaitlist(ctx, applicants[2], exam.ID), exams.ErrAlreadyWaitlisted)
+
+	allocation, err := env.service.Allocation(ctx, applicants[2], exam.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), allocation.Waitlisted)
+	assert.Equal(t, uint(2), allocation.Position)
+
+	require.NoError(t, env.service.Unregister(ctx, applicants[0], exam.ID))
+
+	registered, err := env.repo.IsRegistered(ctx, applicants[1].ID, exam.ID)
+	require.NoError(t, err)
+	assert.True(t, registered)
+
+	allocation, err = env.service.Allocation(ctx, applicants[2], exam.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), allocation.Occupied)
+	assert.Equal(t, uint(1), allocation.Waitlisted)
+	assert.Equal(t, uint(1), allocation.Position)
+}
+
+func TestWaitlist(t *testing.T) {
+	ctx := context.Background()
+	env := setupTestService(t)
+
+	exam := env.createExam(t, 1)
+	applicants := env.createApplicants(t, 4)
+
+	// The waitlist is only for exams without free seats
+	assert.ErrorIs(t, env.service.JoinWaitlist(ctx, applicants[1], exam.ID), exams.ErrExamNotFull)
+
+	require.NoError(t, env.service.Register(ctx, applicants[0], exam.ID))
+	assert.ErrorIs(t, env.service.JoinWaitlist(ctx, applicants[0], exam.ID), exams.ErrAlreadyRegistered)
+
+	for _, applicant := range applicants[1:] {
+		require.NoError(t, env.service.JoinWaitlist(ctx, applicant, exam.ID))
+	}
+
+	for i, applicant := range applicants {
+		allocation, err := env.service.Allocation(ctx, applicant, exam.ID)
+		require.NoError(t, err)
+		assert.Equal(t, uint(1), allocation.Occupied)
+		assert.Equal(t, uint(3), allocation.Waitlisted)
+		assert.Equal(t, uint(i), allocation.Position)
+	}
+
+	// Leaving moves the rest of the queue up
+	require.NoError(t, env.service.LeaveWaitlist(ctx, applicants[1], exam.ID))
+	assert.ErrorIs(t, env.service.LeaveWaitlist(ctx, applicants[1], exam.ID), exams.ErrNotWaitlisted)
+	assert.ErrorIs(t, env.service.LeaveWaitlist(ctx, applicants[0], exam.ID), exams.ErrNotWaitlisted)
+
+	allocation, err := env.service.Allocation(ctx, applicants[1], exam.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), allocation.Waitlisted)
+	assert.Zero(t, allocation.Position)
+
+	allocation, err = env.service.Allocation(ctx, applicants[3], exam.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), allocation.Position)
+
+	entries, err := env.service.ListWaitlist(ctx, exam.ID)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, applicants[2].ID, entries[0].UserID)
+	assert.Equal(t, applicants[3].ID, entries[1].UserID)
+
+	// A raised capacity promotes the head of the queue
+	require.NoError(t, env.service.UpdateCapacity(ctx, exam.ID, 2))
+
+	registered, err := env.repo.IsRegistered(ctx, applicants[2].ID, exam.ID)
+	require.NoError(t, err)
+	assert.True(t, registered)
+
+	allocation, err = env.service.Allocation(ctx, applicants[3], exam.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), allocation.Occupied)
+	assert.Equal(t, uint(1), allocation.Waitlisted)
+	assert.Equal(t, uint(1), allocation.Position)
+}
+
+func TestWaitlistRequiresEligibility(t *testing.T) {
+	ctx := context.Background()
+	env := setupTestService(t)
+
+	first := env.createExam(t, 10)
+	applicants := env.createApplicants(t, 2)
+
+	oral := &exams.ExamType{Title: "устная математика", Order: 2, Dismissing: true}
+	require.NoError(t, env.repo.CreateExamType(ctx, oral))
+
+	newExam := func(examTypeID uint) *exams.Exam {
+		exam := &exams.Exam{
+			Start:      first.Start.Add(24 * time.Hour),
+			Location:   "Test Location",
+			Capacity:   1,
+			Grade:      9,
+			ExamTypeID: examTypeID,
+		}
+		require.NoError(t, env.service.Create(ctx, exam))
+		require.NoError(t, env.repo.CreateRegistration(ctx, applicants[1].ID, exam.ID))
+		return exam
+	}
+
+	// The second exam type cannot be taken before the first one, however
+	// full the exam is
+	fullOral := newExam(oral.ID)
+	assert.ErrorIs(t, env.service.JoinWaitlist(ctx, applicants[0], fullOral.ID), exams.ErrInvalidExamOrder)
+
+	// Nor can two exams of the same type be taken
+	require.NoError(t, env.service.Register(ctx, applicants[0], first.ID))
+	fullWritten := newExam(first.ExamTypeID)
+	assert.ErrorIs(t, env.service.JoinWaitlist(ctx, applicants[0], fullWritten.ID), exams.ErrSameTypeRegistered)
+
+	for _, exam := range []*exams.Exam{fullOral, fullWritten} {
+		entries, err := env.service.ListWaitlist(ctx, exam.ID)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+	}
+}
+
+func TestRegistrationDataLockedAfterExamStart(t *testing.T) {
+	ctx := context.Background()
+	env := setupTestService(t)
+
+	exam := env.createExam(t, 10)
+	user := env.createApplicants(t, 1)[0]
+	require.NoError(t, env.service.Register(ctx, user, exam.ID))
+
+	fields := map[string]json.RawMessage{"parent_phone": json.RawMessage(`"+79990000000"`)}
+	_, _, err := env.regDataService.UpdateByApplicant(ctx, user, fields)
+	require.NoError(t, err)
+
+	// Move the exam to the past
+	err = storage.DB().Model(&exams.Exam{}).Where("id = ?", exam.ID).Update("start", time.Now().Add(-time.Hour)).Error
+	require.NoError(t, err)
+
+	_, _, err = env.regDataService.UpdateByApplicant(ctx, user, fields)
+	assert.ErrorIs(t, err, regdata.ErrEditingLocked)
+}
+
+func TestListFiltered(t *testing.T) {
+	ctx := context.Background()
+	env := setupTestService(t)
+
+	first := env.createExam(t, 10)
+	for i, grade := range []uint{8, 9} {
+		exam := &exams.Exam{
+			Start:      first.Start.Add(time.Duration(i+1) * 24 * time.Hour),
+			Location:   "Актовый зал",
+			Capacity:   5,
+			Grade:      grade,
+			ExamTypeID: first.ExamTypeID,
+		}
+		require.NoError(t, env.service.Create(ctx, exam))
+	}
+
+	page := listing.Page{Number: 1, Limit: 2, Sort: "start", Desc: true}
+	list, total, err := env.service.List(ctx, &exams.ExamFilter{}, page)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	require.Len(t, list, 2)
+	assert.True(t, list[0].Start.After(list[1].Start))
+	assert.Equal(t, "письменная математика", list[0].ExamType.Title)
+
+	page.Number = 2
+	list, _, err = env.service.List(ctx, &exams.ExamFilter{}, page)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, first.ID, list[0].ID)
+
+	page.Number = 1
+	list, total, err = env.service.List(ctx, &exams.ExamFilter{Grade: 9, Location: "зал"}, page)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	require.Len(t, list, 1)
+	assert.Equal(t, uint(9), list[0].Grade)
+
+	_, total, err = env.service.List(ctx, &exams.ExamFilter{From: first.Start.Add(time.Hour)}, page)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+}
+
+func TestScheduleRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	env := setupTestService(t)
+
+	first := env.createExam(t, 10)
+	second := &exams.Exam{
+		Start:      first.Start.Add(48 * time.Hour),
+		Location:   "Актовый зал",
+		Capacity:   5,
+		Grade:      8,
+		ExamTypeID: first.ExamTypeID,
+	}
+	require.NoError(t, env.service.Create(ctx, second))
+
+	schedule, err := env.service.DumpSchedule(ctx)
+	require.NoError(t, err)
+	require.Len(t, schedule, 2)
+	assert.Equal(t, "письменная математика", schedule[0].Type)
+	assert.Equal(t, first.Location, schedule[0].Location)
+
+	// Exams that exist are skipped
+	created, err := env.service.ImportSchedule(ctx, schedule)
+	require.NoError(t, err)
+	assert.Equal(t, 0, created)
+
+	schedule = append(schedule, &exams.ScheduleEntry{
+		Type:     "письменная математика",
+		Grade:    7,
+		Start:    first.Start.Add(72 * time.Hour),
+		Location: "Кабинет 5",
+		Capacity: 20,
+	})
+	created, err = env.service.ImportSchedule(ctx, schedule)
+	require.NoError(t, err)
+	assert.Equal(t, 1, created)
+
+	// An invalid entry fails the whole import
+	schedule = append(schedule,
+		&exams.ScheduleEntry{Type: "письменная математика", Grade: 6, Start: first.Start.Add(96 * time.Hour), Location: "Кабинет 6", Capacity: 20},
+		&exams.ScheduleEntry{Type: "танцы", Grade: 6, Start: first.Start, Location: "Зал", Capacity: 20},
+	)
+	_, err = env.service.ImportSchedule(ctx, schedule)
+	assert.ErrorIs(t, err, exams.ErrInvalidSchedule)
+
+	dumped, err := env.service.DumpSchedule(ctx)
+	require.NoError(t, err)
+	assert.Len(t, dumped, 3)
+}
+
+func TestRecordResult(t *testing.T) {
+	ctx := context.Background()
+	env := setupTestService(t)
+
+	exam := env.createExam(t, 10)
+	applicants := env.createApplicants(t, 2)
+	require.NoError(t, env.service.Register(ctx, applicants[0], exam.ID))
+
+	// Results are only accepted for registered applicants
+	_, err := env.service.RecordResult(ctx, exam.ID, &exams.ResultInput{UserID: applicants[1].ID, Result: "PASSED", Points: 5, MaxPoints: 10})
+	assert.ErrorIs(t, err, exams.ErrNotRegistered)
+
+	_, err = env.service.RecordResult(ctx, exam.ID, &exams.ResultInput{UserID: applicants[0].ID, Result: "PASSED", Points: 11, MaxPoints: 10})
+	assert.ErrorIs(t, err, exams.ErrInvalidPoints)
+
+	_, err = env.service.RecordResult(ctx, exam.ID, &exams.ResultInput{UserID: applicants[0].ID, Result: "PASSED", Points: 5})
+	assert.ErrorIs(t, err, exams.ErrInvalidPoints)
+
+	result, err := env.service.RecordResult(ctx, exam.ID, &exams.ResultInput{UserID: applicants[0].ID, Result: "FAILED", Points: 3, MaxPoints: 10})
+	require.NoError(t, err)
+	assert.True(t, result.Dismissed)
+	assert.Equal(t, float32(3), result.Points)
+
+	_, err = env.service.RecordResult(ctx, exam.ID, &exams.ResultInput{UserID: applicants[0].ID, Result: "PASSED", Points: 5, MaxPoints: 10})
+	assert.ErrorIs(t, err, exams.ErrResultExists)
+
+	dismissed, err := env.repo.IsDismissed(ctx, applicants[0].ID)
+	require.NoError(t, err)
+	assert.True(t, dismissed)
+
+	// Correcting the result lifts the dismissal
+	result, err = env.service.UpdateResult(ctx, exam.ID, &exams.ResultInput{UserID: applicants[0].ID, Result: "PASSED", Points: 8, MaxPoints: 10})
+	require.NoError(t, err)
+	assert.False(t, result.Dismissed)
+
+	_, err = env.service.UpdateResult(ctx, exam.ID, &exams.ResultInput{UserID: applicants[1].ID, Result: "PASSED", Points: 8, MaxPoints: 10})
+	assert.ErrorIs(t, err, exams.ErrResultNotFound)
+}
+
+func TestRecordResultWithoutPoints(t *testing.T) {
+	ctx := context.Background()
+	env := setupTestService(t)
+
+	examType := &exams.ExamType{Title: "собеседование", Order: 1}
+	require.NoError(t, env.repo.CreateExamType(ctx, examType))
+	exam := &exams.Exam{
+		Start:      time.Now().Add(24 * time.Hour),
+		Location:   "Кабинет 5",
+		Capacity:   10,
+		Grade:      9,
+		ExamTypeID: examType.ID,
+	}
+	require.NoError(t, env.service.Create(ctx, exam))
+
+	user := env.createApplicants(t, 1)[0]
+	require.NoError(t, env.service.Register(ctx, user, exam.ID))
+
+	_, err := env.service.RecordResult(ctx, exam.ID, &exams.ResultInput{UserID: user.ID, Result: "PASSED", Points: 5, MaxPoints: 10})
+	assert.ErrorIs(t, err, exams.ErrPointsNotAllowed)
+
+	// Failing a non-dismissing exam does not dismiss the applicant
+	result, err := env.service.RecordResult(ctx, exam.ID, &exams.ResultInput{UserID: user.ID, Result: "FAILED"})
+	require.NoError(t, err)
+	assert.False(t, result.Dismissed)
+}
+
+func TestMyResultsHiddenUntilPublished(t *testing.T) {
+	ctx := context.Background()
+	env := setupTestService(t)
+
+	exam := env.createExam(t, 10)
+	user := env.createApplicants(t, 1)[0]
+	require.NoError(t, env.service.Register(ctx, user, exam.ID))
+
+	_, err := env.service.RecordResult(ctx, exam.ID, &exams.ResultInput{UserID: user.ID, Result: "PASSED", Points: 7, MaxPoints: 10})
+	require.NoError(t, err)
+
+	results, err := env.service.MyResults(ctx, user)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	require.NoError(t, env.service.PublishResults(ctx, exam.ID, true))
+
+	results, err = env.service.MyResults(ctx, user)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "PASSED", results[0].Result)
+	assert.Equal(t, float32(7), results[0].Points)
+
+	require.NoError(t, env.service.PublishResults(ctx, exam.ID, false))
+
+	results, err = env.service.MyResults(ctx, user)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	assert.ErrorIs(t, env.service.PublishResults(ctx, exam.ID+1, true), gorm.ErrRecordNotFound)
+}
+
+func TestNextExamTypeOrderAfterResult(t *testing.T) {
+	ctx := context.Background()
+	env := setupTestService(t)
+
+	exam := env.createExam(t, 10)
+	next := &exams.ExamType{Title: "устная математика", Order: 2, Dismissing: true, HasPoints: true}
+	require.NoError(t, env.repo.CreateExamType(ctx, next))
+
+	user := env.createApplicants(t, 1)[0]
+	require.NoError(t, env.service.Register(ctx, user, exam.ID))
+
+	order, err := env.repo.GetNextExamTypeOrder(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, order)
+
+	_, err = env.service.RecordResult(ctx, exam.ID, &exams.ResultInput{UserID: user.ID, Result: "PASSED", Points: 9, MaxPoints: 10})
+	require.NoError(t, err)
+
+	order, err = env.repo.GetNextExamTypeOrder(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, order)
+}
+
+func TestListResultsExamNotFound(t *testing.T) {
+	ctx := context.Background()
+	env := setupTestService(t)
+
+	exam := env.createExam(t, 10)
+
+	results, err := env.service.ListResults(ctx, exam.ID)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	_, err = env.service.ListResults(ctx, exam.ID+1)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+}
+
+func TestImportResultsDryRun(t *testing.T) {
+	ctx := context.Background()
+	env := setupTestService(t)
+
+	exam := env.createExam(t, 10)
+	applicants := env.createApplicants(t, 4)
+	for _, applicant := range applicants[:3] {
+		require.NoError(t, env.service.Register(ctx, applicant, exam.ID))
+	}
+
+	file := fmt.Sprintf("ID,Результат,Баллы,Максимум\n"+
+		"%d,СДАЛ,8,10\n"+ // valid
+		"%d,СДАЛ,12,10\n"+ // points above max
+		"%d,НЕ СДАЛ,2,10\n"+ // not registered
+		"%d,СДАЛ,9,10\n"+ // repeated
+		"999999,СДАЛ,5,10\n"+ // unknown
+		"abc,СДАЛ,5,10\n", // invalid
+		applicants[0].ID, applicants[1].ID, applicants[3].ID, applicants[0].ID)
+
+	report, err := env.service.ImportResults(ctx, exam.ID, strings.NewReader(file), 0, true)
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 6, report.Rows)
+	assert.Equal(t, 1, report.Valid)
+	assert.Equal(t, 0, report.Created)
+	require.Len(t, report.PointsExceeded, 1)
+	assert.Equal(t, 3, report.PointsExceeded[0].Row)
+	require.Len(t, report.Unregistered, 1)
+	assert.Equal(t, 4, report.Unregistered[0].Row)
+	require.Len(t, report.Duplicates, 1)
+	assert.Equal(t, 5, report.Duplicates[0].Row)
+	require.Len(t, report.UnknownIDs, 1)
+	assert.Equal(t, "999999", report.UnknownIDs[0].UserID)
+	require.Len(t, report.Invalid, 1)
+	assert.Equal(t, "abc", report.Invalid[0].UserID)
+
+	// A file with issues is not written even without dry run
+	report, err = env.service.ImportResults(ctx, exam.ID, strings.NewReader(file), 0, false)
+	require.NoError(t, err)
+	assert.True(t, report.HasIssues())
+	assert.Equal(t, 0, report.Created)
+
+	results, err := env.service.ListResults(ctx, exam.ID)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	// Default max points apply to rows without them
+	file = fmt.Sprintf("ID,Результат,Баллы\n%d,СДАЛ,8\n%d,неявка,\n", applicants[0].ID, applicants[1].ID)
+	report, err = env.service.ImportResults(ctx, exam.ID, strings.NewReader(file), 10, false)
+	require.NoError(t, err)
+	assert.False(t, report.HasIssues())
+	assert.Equal(t, 2, report.Created)
+
+	results, err = env.service.ListResults(ctx, exam.ID)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	// Rows for applicants that already have a result are reported as duplicates
+	report, err = env.service.ImportResults(ctx, exam.ID, strings.NewReader(file), 10, true)
+	require.NoError(t, err)
+	assert.Len(t, report.Duplicates, 2)
+}
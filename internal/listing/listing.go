@@ -0,0 +1,95 @@
+package listing
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInvalidPage = errors.New("invalid page parameters")
+
+// Headers describing the whole list a page was taken from
+const (
+	HeaderTotalCount = "X-Total-Count"
+	HeaderPage       = "X-Page"
+	HeaderPerPage    = "X-Per-Page"
+)
+
+// Page selects a slice of a sorted list. Pages are numbered from 1.
+type Page struct {
+	Number int
+	Limit  int
+	Sort   string
+	Desc   bool
+}
+
+// ParsePage reads the page, limit and sort query parameters. Sort is a
+// column name, prefixed with "-" for descending order, and must be one of
+// the sortable columns. The default sort applies when none is given.
+func ParsePage(c echo.Context, sortable []string, defaultSort string) (Page, error) {
+	page := Page{
+		Number: 1,
+		Limit:  viper.GetInt("server.pagination.default_limit"),
+	}
+
+	if value := c.QueryParam("page"); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			return Page{}, errors.Join(ErrInvalidPage, fmt.Errorf("page %q", value))
+		}
+		page.Number = number
+	}
+
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > viper.GetInt("server.pagination.max_limit") {
+			return Page{}, errors.Join(ErrInvalidPage, fmt.Errorf("limit %q", value))
+		}
+		page.Limit = limit
+	}
+
+	sort := c.QueryParam("sort")
+	if sort == "" {
+		sort = defaultSort
+	}
+	page.Desc = strings.HasPrefix(sort, "-")
+	page.Sort = strings.TrimPrefix(sort, "-")
+	if !slices.Contains(sortable, page.Sort) {
+		return Page{}, errors.Join(ErrInvalidPage, fmt.Errorf("cannot sort by %q", page.Sort))
+	}
+
+	return page, nil
+}
+
+// Apply orders and limits the query. Rows are ordered by ID after the sort
+// column so that pages do not overlap when the sort column has ties.
+func (p Page) Apply(query *gorm.DB) *gorm.DB {
+	return query.
+		Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: p.Sort}, Desc: p.Desc}).
+		Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: "id"}, Desc: p.Desc}).
+		Offset((p.Number - 1) * p.Limit).
+		Limit(p.Limit)
+}
+
+// SetHeaders reports the total count of the list along with the page
+func SetHeaders(c echo.Context, page Page, total int64) {
+	header := c.Response().Header()
+	header.Set(HeaderTotalCount, strconv.FormatInt(total, 10))
+	header.Set(HeaderPage, strconv.Itoa(page.Number))
+	header.Set(HeaderPerPage, strconv.Itoa(page.Limit))
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Contains is an ILIKE pattern matching the value anywhere, wildcards in the
+// value are taken literally
+func Contains(value string) string {
+	return "%" + likeEscaper.Replace(strings.TrimSpace(value)) + "%"
+}
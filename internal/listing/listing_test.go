@@ -0,0 +1,57 @@
+package listing_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/L2SH-Dev/admissions/internal/listing"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newContext(query string) (echo.Context, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	rec := httptest.NewRecorder()
+	return echo.New().NewContext(req, rec), rec
+}
+
+func TestParsePage(t *testing.T) {
+	viper.Set("server.pagination.default_limit", 50)
+	viper.Set("server.pagination.max_limit", 100)
+	t.Cleanup(viper.Reset)
+
+	sortable := []string{"id", "created_at"}
+
+	c, _ := newContext("")
+	page, err := listing.ParsePage(c, sortable, "-created_at")
+	require.NoError(t, err)
+	assert.Equal(t, listing.Page{Number: 1, Limit: 50, Sort: "created_at", Desc: true}, page)
+
+	c, _ = newContext("page=3&limit=20&sort=id")
+	page, err = listing.ParsePage(c, sortable, "-created_at")
+	require.NoError(t, err)
+	assert.Equal(t, listing.Page{Number: 3, Limit: 20, Sort: "id"}, page)
+
+	for _, query := range []string{"page=0", "page=x", "limit=0", "limit=101", "sort=password", "sort=-id%20DESC"} {
+		c, _ = newContext(query)
+		_, err = listing.ParsePage(c, sortable, "id")
+		assert.ErrorIs(t, err, listing.ErrInvalidPage, query)
+	}
+}
+
+func TestSetHeaders(t *testing.T) {
+	c, rec := newContext("")
+	listing.SetHeaders(c, listing.Page{Number: 2, Limit: 20}, 45)
+
+	assert.Equal(t, "45", rec.Header().Get(listing.HeaderTotalCount))
+	assert.Equal(t, "2", rec.Header().Get(listing.HeaderPage))
+	assert.Equal(t, "20", rec.Header().Get(listing.HeaderPerPage))
+}
+
+func TestContains(t *testing.T) {
+	assert.Equal(t, "%school%", listing.Contains(" school "))
+	assert.Equal(t, `%50\%\_off%`, listing.Contains("50%_off"))
+}
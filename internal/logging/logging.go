@@ -1,13 +1,12 @@
 package logging
 
 import (
-	"context"
+	"log/slog"
 	"os"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/spf13/viper"
-	"golang.org/x/exp/slog"
 )
 
 func Init() {
@@ -21,13 +20,21 @@ func Init() {
 		handler = slog.NewJSONHandler(os.Stdout, opts)
 	}
 
-	logger := slog.New(handler)
+	logger := slog.New(NewContextHandler(handler))
 	slog.SetDefault(logger)
 
 	slog.Info("Logging initialized", slog.String("level", opts.Level.Level().String()))
 }
 
 func AddMiddleware(e *echo.Echo) {
+	// The ID is taken from the X-Request-ID header set by the proxy or
+	// generated, and is added to everything logged with the request context
+	e.Use(middleware.RequestIDWithConfig(middleware.RequestIDConfig{
+		RequestIDHandler: func(c echo.Context, requestID string) {
+			c.SetRequest(c.Request().WithContext(WithRequestID(c.Request().Context(), requestID)))
+		},
+	}))
+
 	e.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
 		LogStatus:   true,
 		LogURI:      true,
@@ -35,12 +42,12 @@ func AddMiddleware(e *echo.Echo) {
 		HandleError: true, // forwards error to the global error handler, so it can decide appropriate status code
 		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
 			if v.Error == nil {
-				slog.LogAttrs(context.Background(), slog.LevelInfo, "REQUEST",
+				slog.LogAttrs(c.Request().Context(), slog.LevelInfo, "REQUEST",
 					slog.String("uri", v.URI),
 					slog.Int("status", v.Status),
 				)
 			} else {
-				slog.LogAttrs(context.Background(), slog.LevelError, "REQUEST_ERROR",
+				slog.LogAttrs(c.Request().Context(), slog.LevelError, "REQUEST_ERROR",
 					slog.String("uri", v.URI),
 					slog.Int("status", v.Status),
 					slog.String("err", v.Error.Error()),
@@ -0,0 +1,76 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/L2SH-Dev/admissions/internal/logging"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTest(t *testing.T) (*echo.Echo, *bytes.Buffer) {
+	logs := &bytes.Buffer{}
+	previous := slog.Default()
+	slog.SetDefault(slog.New(logging.NewContextHandler(slog.NewJSONHandler(logs, nil))))
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+	})
+
+	e := echo.New()
+	logging.AddMiddleware(e)
+	e.GET("/", func(c echo.Context) error {
+		slog.InfoContext(c.Request().Context(), "handling")
+		return c.NoContent(http.StatusOK)
+	})
+
+	return e, logs
+}
+
+// requestIDs returns the request ID of every logged line
+func requestIDs(t *testing.T, logs *bytes.Buffer) []string {
+	var ids []string
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		id, _ := record["request_id"].(string)
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func TestRequestID(t *testing.T) {
+	e, logs := setupTest(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderXRequestID, "from-proxy")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, "from-proxy", rec.Header().Get(echo.HeaderXRequestID))
+	assert.Equal(t, []string{"from-proxy", "from-proxy"}, requestIDs(t, logs))
+}
+
+func TestRequestID_Generated(t *testing.T) {
+	e, logs := setupTest(t)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	requestID := rec.Header().Get(echo.HeaderXRequestID)
+	require.NotEmpty(t, requestID)
+	assert.Equal(t, []string{requestID, requestID}, requestIDs(t, logs))
+}
+
+func TestRequestID_OutsideRequest(t *testing.T) {
+	_, logs := setupTest(t)
+
+	slog.Info("starting")
+	assert.Equal(t, []string{""}, requestIDs(t, logs))
+}
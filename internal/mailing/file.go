@@ -0,0 +1,54 @@
+package mailing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/mail"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileMailer appends emails to a local mbox file instead of sending them.
+// It is meant for development and tests.
+type FileMailer struct {
+	path string
+	from string
+	mu   sync.Mutex
+}
+
+func NewFileMailer(path, from string) Mailer {
+	return &FileMailer{path: path, from: from}
+}
+
+func (m *FileMailer) Send(_ context.Context, message *Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open mail file: %w", err)
+	}
+	defer file.Close()
+
+	sender := "MAILER-DAEMON"
+	if address, err := mail.ParseAddress(m.from); err == nil {
+		sender = address.Address
+	}
+
+	// mbox separator line followed by the message with body lines starting
+	// with "From " quoted, so they are not taken for separators
+	if _, err := fmt.Fprintf(file, "From %s %s\n", sender, time.Now().Format(time.ANSIC)); err != nil {
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+	body := bytes.ReplaceAll(buildMIME(m.from, message), []byte("\nFrom "), []byte("\n>From "))
+	if _, err := file.Write(body); err != nil {
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+	if _, err := file.WriteString("\n"); err != nil {
+		return fmt.Errorf("failed to write mail file: %w", err)
+	}
+
+	return nil
+}
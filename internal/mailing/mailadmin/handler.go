@@ -0,0 +1,122 @@
+package mailadmin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/mailing"
+	"github.com/L2SH-Dev/admissions/internal/server"
+	"github.com/L2SH-Dev/admissions/internal/users"
+	"github.com/L2SH-Dev/admissions/internal/users/auth"
+	"github.com/L2SH-Dev/admissions/internal/users/auth/passwords"
+	"github.com/L2SH-Dev/admissions/internal/users/roles"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
+)
+
+// MailingAdminHandler lets admins preview the emails and look after the
+// outbox. It lives apart from the mailing package because it depends on
+// users, which in turn sends emails.
+type MailingAdminHandler interface {
+	server.Handler
+	ListTemplates(c echo.Context) error
+	Preview(c echo.Context) error
+	ListFailed(c echo.Context) error
+	Resend(c echo.Context) error
+}
+
+type MailingAdminHandlerImpl struct {
+	outboxRepo   mailing.OutboxRepo
+	usersService users.UsersService
+	authService  auth.AuthService
+}
+
+func NewMailingAdminHandler(storage datastore.Storage) server.Handler {
+	rolesRepo := roles.NewRolesRepo(storage)
+	rolesService := roles.NewRolesService(rolesRepo)
+	usersRepo := users.NewUsersRepo(storage)
+	usersService := users.NewUsersService(usersRepo, rolesService)
+
+	passwordsRepo := passwords.NewPasswordsRepo(storage)
+	passwordsService := passwords.NewPasswordsService(passwordsRepo)
+	authRepo := auth.NewAuthRepo(storage)
+	authService := auth.NewAuthService(authRepo, passwordsService)
+
+	return &MailingAdminHandlerImpl{
+		outboxRepo:   mailing.NewOutboxRepo(storage),
+		usersService: usersService,
+		authService:  authService,
+	}
+}
+
+func (h *MailingAdminHandlerImpl) AddRoutes(g *echo.Group) {
+	adminGroup := g.Group("/mailing/admin")
+
+	usersMiddlewareService := users.NewUsersMiddlewareService(h.usersService, h.authService)
+	usersMiddlewareService.AddAuthMiddleware(adminGroup, viper.GetString("secrets.jwt_key"))
+	usersMiddlewareService.AddUserPreloadMiddleware(adminGroup)
+	usersMiddlewareService.AddAdminMiddleware(adminGroup)
+
+	canView := usersMiddlewareService.RequirePermission(roles.PermissionMailingView)
+	canResend := usersMiddlewareService.RequirePermission(roles.PermissionMailingResend)
+
+	adminGroup.GET("/templates", h.ListTemplates, canView)
+	adminGroup.GET("/templates/:name", h.Preview, canView)
+	adminGroup.GET("/outbox/failed", h.ListFailed, canView)
+	adminGroup.POST("/outbox/:id/resend", h.Resend, canResend)
+}
+
+func (h *MailingAdminHandlerImpl) ListTemplates(c echo.Context) error {
+	return c.JSON(http.StatusOK, mailing.TemplateNames())
+}
+
+// Preview returns the rendered message as JSON, or only its HTML or text
+// part if requested with ?format=html or ?format=text
+func (h *MailingAdminHandlerImpl) Preview(c echo.Context) error {
+	message, err := mailing.Preview(c.Param("name"))
+	if err != nil && errors.Is(err, mailing.ErrUnknownTemplate) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	switch c.QueryParam("format") {
+	case "html":
+		return c.HTML(http.StatusOK, message.HTML)
+	case "text":
+		return c.String(http.StatusOK, message.Text)
+	case "":
+		return c.JSON(http.StatusOK, message)
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "format must be html or text")
+	}
+}
+
+func (h *MailingAdminHandlerImpl) ListFailed(c echo.Context) error {
+	messages, err := h.outboxRepo.ListFailed(c.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, messages)
+}
+
+func (h *MailingAdminHandlerImpl) Resend(c echo.Context) error {
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid message ID")
+	}
+
+	err = h.outboxRepo.Resend(c.Request().Context(), uint(messageID))
+	if err != nil && errors.Is(err, mailing.ErrOutboxMessageNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil && errors.Is(err, mailing.ErrOutboxMessageScrubbed) {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,130 @@
+package mailing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/spf13/viper"
+)
+
+// Names of the emails sent by the application, each has its templates in
+// the templates directory
+const (
+	TemplateVerification      = "verification"
+	TemplateCredentials       = "credentials"
+	TemplateRejection         = "rejection"
+	TemplatePasswordReset     = "password_reset"
+	TemplateWaitlistPromotion = "waitlist_promotion"
+)
+
+type Message struct {
+	To       string `json:"to"`
+	Template string `json:"template"`
+	Subject  string `json:"subject"`
+	Text     string `json:"text"`
+	HTML     string `json:"html"`
+}
+
+type Mailer interface {
+	Send(ctx context.Context, message *Message) error
+}
+
+// TxMailer is a mailer that stores messages in the database, so that they
+// are queued in the transaction of the action sending them
+type TxMailer interface {
+	Mailer
+	WithTx(tx datastore.Storage) Mailer
+}
+
+// NewMailer creates the mailer selected by mailing.provider in the config
+func NewMailer() Mailer {
+	if !viper.GetBool("mailing.enabled") {
+		return &disabledMailer{}
+	}
+
+	switch provider := viper.GetString("mailing.provider"); provider {
+	case "", "notisend":
+		return NewNotiSendMailer(
+			viper.GetString("mailing.notisend.api_base"),
+			viper.GetString("secrets.mail_api_key"),
+			viper.GetString("mailing.from"),
+		)
+	case "smtp":
+		return NewSMTPMailer(
+			viper.GetString("mailing.smtp.host"),
+			viper.GetInt("mailing.smtp.port"),
+			viper.GetString("mailing.smtp.username"),
+			viper.GetString("secrets.smtp_password"),
+			viper.GetString("mailing.from"),
+		)
+	case "file":
+		return NewFileMailer(viper.GetString("mailing.file.path"), viper.GetString("mailing.from"))
+	default:
+		panic(fmt.Sprintf("unknown mailing provider: %s", provider))
+	}
+}
+
+type disabledMailer struct{}
+
+func (m *disabledMailer) Send(_ context.Context, _ *Message) error {
+	return nil
+}
+
+// buildMIME formats the message as an email with plain text and, if the
+// message has it, HTML alternatives
+func buildMIME(from string, message *Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", encodeAddress(from))
+	fmt.Fprintf(&b, "To: %s\r\n", message.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	if message.HTML == "" {
+		writePart(&b, "text/plain", message.Text)
+		return b.Bytes()
+	}
+
+	var parts bytes.Buffer
+	writer := multipart.NewWriter(&parts)
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", writer.Boundary())
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain", message.Text},
+		{"text/html", message.HTML},
+	} {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType+"; charset=utf-8")
+		header.Set("Content-Transfer-Encoding", "8bit")
+		w, _ := writer.CreatePart(header)
+		_, _ = w.Write([]byte(part.content))
+	}
+	_ = writer.Close()
+
+	b.Write(parts.Bytes())
+	return b.Bytes()
+}
+
+func writePart(b *bytes.Buffer, contentType, content string) {
+	fmt.Fprintf(b, "Content-Type: %s; charset=utf-8\r\n", contentType)
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(content)
+	b.WriteString("\r\n")
+}
+
+// encodeAddress encodes the display name, which is usually in Russian
+func encodeAddress(address string) string {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return address
+	}
+	return parsed.String()
+}
@@ -0,0 +1,126 @@
+package mailing_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/L2SH-Dev/admissions/internal/mailing"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMailer(t *testing.T) {
+	ctx := context.Background()
+	mailbox := filepath.Join(t.TempDir(), "mail.mbox")
+	mailer := mailing.NewFileMailer(mailbox, "Admissions <noreply@example.com>")
+
+	err := mailer.Send(ctx, &mailing.Message{
+		To:      "first@example.com",
+		Subject: "Первое письмо",
+		Text:    "Hello\nFrom the body\n",
+	})
+	require.NoError(t, err)
+
+	err = mailer.Send(ctx, &mailing.Message{
+		To:      "second@example.com",
+		Subject: "Второе письмо",
+		Text:    "Bye\n",
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(mailbox)
+	require.NoError(t, err)
+	mail := string(data)
+
+	// Two mbox separators and a quoted "From " line in the body
+	assert.Equal(t, 2, strings.Count(mail, "From noreply@example.com "))
+	assert.Contains(t, mail, ">From the body")
+	assert.Contains(t, mail, "To: first@example.com")
+	assert.Contains(t, mail, "To: second@example.com")
+	assert.Contains(t, mail, "Subject: =?utf-8?q?")
+	assert.NotContains(t, mail, "multipart/alternative")
+}
+
+func TestFileMailer_HTML(t *testing.T) {
+	ctx := context.Background()
+	mailbox := filepath.Join(t.TempDir(), "mail.mbox")
+	mailer := mailing.NewFileMailer(mailbox, "noreply@example.com")
+
+	err := mailer.Send(ctx, &mailing.Message{
+		To:      "test@example.com",
+		Subject: "Письмо",
+		Text:    "Текст",
+		HTML:    "<p>Текст</p>",
+	})
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(mailbox)
+	require.NoError(t, err)
+	mail := string(data)
+
+	assert.Contains(t, mail, "Content-Type: multipart/alternative")
+	assert.Contains(t, mail, "Content-Type: text/plain; charset=utf-8")
+	assert.Contains(t, mail, "Content-Type: text/html; charset=utf-8")
+	assert.Contains(t, mail, "<p>Текст</p>")
+}
+
+func TestNotiSendMailer(t *testing.T) {
+	ctx := context.Background()
+	var (
+		path string
+		body map[string]interface{}
+		auth string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		auth = r.Header.Get("Authorization")
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	mailer := mailing.NewNotiSendMailer(server.URL, "test_key", "Приёмная комиссия <noreply@example.com>")
+
+	err := mailer.Send(ctx, &mailing.Message{
+		To:      "test@example.com",
+		Subject: "Тема",
+		Text:    "Текст",
+		HTML:    "<p>Текст</p>",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "/email/messages", path)
+	assert.Equal(t, "Bearer test_key", auth)
+	assert.Equal(t, "test@example.com", body["to"])
+	assert.Equal(t, "noreply@example.com", body["from_email"])
+	assert.Equal(t, "Приёмная комиссия", body["from_name"])
+	assert.Equal(t, "Тема", body["subject"])
+	assert.Equal(t, "<p>Текст</p>", body["html"])
+}
+
+func TestNewMailer(t *testing.T) {
+	ctx := context.Background()
+	t.Cleanup(viper.Reset)
+
+	viper.Set("mailing.enabled", false)
+	assert.NoError(t, mailing.NewMailer().Send(ctx, &mailing.Message{To: "test@example.com"}))
+
+	mailbox := filepath.Join(t.TempDir(), "mail.mbox")
+	viper.Set("mailing.enabled", true)
+	viper.Set("mailing.provider", "file")
+	viper.Set("mailing.file.path", mailbox)
+	viper.Set("mailing.from", "noreply@example.com")
+	assert.IsType(t, &mailing.FileMailer{}, mailing.NewMailer())
+
+	viper.Set("mailing.provider", "smtp")
+	assert.IsType(t, &mailing.SMTPMailer{}, mailing.NewMailer())
+
+	viper.Set("mailing.provider", "pigeon")
+	assert.Panics(t, func() { mailing.NewMailer() })
+}
@@ -1,20 +1,15 @@
 package mailing
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
+	"time"
+	_ "time/tzdata"
 
+	"github.com/L2SH-Dev/admissions/internal/datastore"
 	"github.com/spf13/viper"
 )
 
-type emailRequest struct {
-	To      string      `json:"to"`
-	Payment string      `json:"payment"`
-	Params  interface{} `json:"params"`
-}
-
 type verificationParams struct {
 	Email            string `json:"email"`
 	VerificationLink string `json:"verification_link"`
@@ -32,87 +27,155 @@ type rejectionParams struct {
 	Reason string `json:"reason"`
 }
 
-func SendVerificationEmail(email string, token string) error {
-	domain := viper.GetString("server.domain")
+type passwordResetParams struct {
+	Email     string `json:"email"`
+	Login     string `json:"login"`
+	ResetLink string `json:"reset_link"`
+}
 
-	params := &verificationParams{
-		Email:            email,
-		VerificationLink: fmt.Sprintf("%s/verification?token=%s", domain, token),
-	}
+type waitlistPromotionParams struct {
+	Email     string `json:"email"`
+	ExamTitle string `json:"exam_title"`
+	ExamStart string `json:"exam_start"`
+	Location  string `json:"location"`
+	ExamsLink string `json:"exams_link"`
+}
 
-	request := &emailRequest{
-		To:      email,
-		Payment: "credit",
-		Params:  params,
-	}
+type MailingService interface {
+	SendVerificationEmail(ctx context.Context, email string, token string) error
+	SendLoginAndPassword(ctx context.Context, email, login, password string) error
+	SendRegistrationRejection(ctx context.Context, email, reason string) error
+	SendPasswordReset(ctx context.Context, email, login, token string) error
+	SendWaitlistPromotion(ctx context.Context, email, examTitle, location string, examStart time.Time) error
+	WithTx(tx datastore.Storage) MailingService
+}
 
-	return sendEmail("1350749", request)
+type MailingServiceImpl struct {
+	mailer Mailer
 }
 
-func SendLoginAndPassword(email, login, password string) error {
-	domain := viper.GetString("server.domain")
+func NewMailingService(mailer Mailer) MailingService {
+	return &MailingServiceImpl{mailer: mailer}
+}
 
-	params := &loginCredentialsParams{
-		Email:     email,
-		Login:     login,
-		Password:  password,
-		LoginLink: fmt.Sprintf("%s/login", domain),
+// WithTx returns the service queueing messages in the transaction of tx.
+// Mailers that send right away are not transactional, a message they sent
+// stays sent if the transaction is rolled back.
+func (s *MailingServiceImpl) WithTx(tx datastore.Storage) MailingService {
+	if mailer, ok := s.mailer.(TxMailer); ok {
+		return &MailingServiceImpl{mailer: mailer.WithTx(tx)}
 	}
+	return s
+}
 
-	request := &emailRequest{
-		To:      email,
-		Payment: "credit",
-		Params:  params,
+func (s *MailingServiceImpl) SendVerificationEmail(ctx context.Context, email string, token string) error {
+	message, err := VerificationMessage(email, token)
+	if err != nil {
+		return err
 	}
 
-	return sendEmail("1354145", request)
+	return s.mailer.Send(ctx, message)
 }
 
-func SendRegistrationRejection(email, reason string) error {
-	params := &rejectionParams{
-		Email:  email,
-		Reason: reason,
-	}
-
-	request := &emailRequest{
-		To:      email,
-		Payment: "credit",
-		Params:  params,
+func (s *MailingServiceImpl) SendLoginAndPassword(ctx context.Context, email, login, password string) error {
+	message, err := CredentialsMessage(email, login, password)
+	if err != nil {
+		return err
 	}
 
-	return sendEmail("1365773", request)
+	return s.mailer.Send(ctx, message)
 }
 
-func sendEmail(templateID string, request *emailRequest) error {
-	if !viper.GetBool("mailing.enabled") {
-		return nil
+func (s *MailingServiceImpl) SendRegistrationRejection(ctx context.Context, email, reason string) error {
+	message, err := RejectionMessage(email, reason)
+	if err != nil {
+		return err
 	}
 
-	apiBase := viper.GetString("mailing.api_base")
-	apiKey := viper.GetString("secrets.mail_api_key")
+	return s.mailer.Send(ctx, message)
+}
 
-	jsonBody, err := json.Marshal(request)
+func (s *MailingServiceImpl) SendPasswordReset(ctx context.Context, email, login, token string) error {
+	message, err := PasswordResetMessage(email, login, token)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request body: %w", err)
+		return err
 	}
 
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/email/templates/%s/messages", apiBase, templateID), bytes.NewBuffer(jsonBody))
+	return s.mailer.Send(ctx, message)
+}
+
+func (s *MailingServiceImpl) SendWaitlistPromotion(ctx context.Context, email, examTitle, location string, examStart time.Time) error {
+	message, err := WaitlistPromotionMessage(email, examTitle, location, examStart)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
+	return s.mailer.Send(ctx, message)
+}
+
+// The message builders below are used directly when an email has to be
+// queued together with other changes, see NewOutboxMessage
+
+func VerificationMessage(email, token string) (*Message, error) {
+	return render(TemplateVerification, email, &verificationParams{
+		Email:            email,
+		VerificationLink: link("/verification?token=" + token),
+	})
+}
+
+func CredentialsMessage(email, login, password string) (*Message, error) {
+	return render(TemplateCredentials, email, &loginCredentialsParams{
+		Email:     email,
+		Login:     login,
+		Password:  password,
+		LoginLink: link("/login"),
+	})
+}
+
+func RejectionMessage(email, reason string) (*Message, error) {
+	return render(TemplateRejection, email, &rejectionParams{
+		Email:  email,
+		Reason: reason,
+	})
+}
 
-	resp, err := http.DefaultClient.Do(req)
+func PasswordResetMessage(email, login, token string) (*Message, error) {
+	return render(TemplatePasswordReset, email, &passwordResetParams{
+		Email:     email,
+		Login:     login,
+		ResetLink: link("/password-reset?token=" + token),
+	})
+}
+
+func WaitlistPromotionMessage(email, examTitle, location string, examStart time.Time) (*Message, error) {
+	return render(TemplateWaitlistPromotion, email, &waitlistPromotionParams{
+		Email:     email,
+		ExamTitle: examTitle,
+		ExamStart: moscowTime(examStart),
+		Location:  location,
+		ExamsLink: link("/exams"),
+	})
+}
+
+func render(template, to string, params interface{}) (*Message, error) {
+	message, err := Render(template, to, params)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("failed to render %s email: %w", template, err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	return message, nil
+}
+
+func link(path string) string {
+	return viper.GetString("server.domain") + path
+}
+
+// moscowTime formats the time the way it is shown to applicants
+func moscowTime(t time.Time) string {
+	tz, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return t.Format("02.01.2006 15:04 MST")
 	}
 
-	return nil
+	return t.In(tz).Format("02.01.2006 15:04")
 }
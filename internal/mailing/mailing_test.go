@@ -0,0 +1,67 @@
+package mailing_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/mailing"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestService(t *testing.T) (mailing.MailingService, string) {
+	viper.Set("server.domain", "https://example.com")
+	t.Cleanup(viper.Reset)
+
+	mailbox := filepath.Join(t.TempDir(), "mail.mbox")
+	return mailing.NewMailingService(mailing.NewFileMailer(mailbox, "noreply@example.com")), mailbox
+}
+
+func readMailbox(t *testing.T, mailbox string) string {
+	data, err := os.ReadFile(mailbox)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestSendVerificationEmail(t *testing.T) {
+	ctx := context.Background()
+	service, mailbox := setupTestService(t)
+
+	err := service.SendVerificationEmail(ctx, "test@example.com", "token123")
+	require.NoError(t, err)
+
+	mail := readMailbox(t, mailbox)
+	assert.Contains(t, mail, "To: test@example.com")
+	assert.Contains(t, mail, "https://example.com/verification?token=token123")
+}
+
+func TestSendLoginAndPassword(t *testing.T) {
+	ctx := context.Background()
+	service, mailbox := setupTestService(t)
+
+	err := service.SendLoginAndPassword(ctx, "test@example.com", "t.user-00001", "Password$123")
+	require.NoError(t, err)
+
+	mail := readMailbox(t, mailbox)
+	assert.Contains(t, mail, "t.user-00001")
+	assert.Contains(t, mail, "Password$123")
+	assert.Contains(t, mail, "https://example.com/login")
+}
+
+func TestSendWaitlistPromotion(t *testing.T) {
+	ctx := context.Background()
+	service, mailbox := setupTestService(t)
+
+	start := time.Date(2025, 3, 1, 7, 0, 0, 0, time.UTC)
+	err := service.SendWaitlistPromotion(ctx, "test@example.com", "письменная математика", "Кабинет 101", start)
+	require.NoError(t, err)
+
+	mail := readMailbox(t, mailbox)
+	assert.Contains(t, mail, "письменная математика")
+	// Times are shown in Moscow time
+	assert.Contains(t, mail, "01.03.2025 10:00")
+}
@@ -0,0 +1,75 @@
+package mailing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+)
+
+// NotiSendMailer sends rendered emails through the NotiSend API
+type NotiSendMailer struct {
+	apiBase string
+	apiKey  string
+	from    string
+}
+
+func NewNotiSendMailer(apiBase, apiKey, from string) Mailer {
+	return &NotiSendMailer{
+		apiBase: apiBase,
+		apiKey:  apiKey,
+		from:    from,
+	}
+}
+
+type notiSendRequest struct {
+	FromEmail string `json:"from_email"`
+	FromName  string `json:"from_name,omitempty"`
+	To        string `json:"to"`
+	Subject   string `json:"subject"`
+	Text      string `json:"text"`
+	HTML      string `json:"html,omitempty"`
+	Payment   string `json:"payment"`
+}
+
+func (m *NotiSendMailer) Send(ctx context.Context, message *Message) error {
+	from, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return fmt.Errorf("invalid sender address: %w", err)
+	}
+
+	jsonBody, err := json.Marshal(&notiSendRequest{
+		FromEmail: from.Address,
+		FromName:  from.Name,
+		To:        message.To,
+		Subject:   message.Subject,
+		Text:      message.Text,
+		HTML:      message.HTML,
+		Payment:   "credit",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/email/messages", m.apiBase), bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
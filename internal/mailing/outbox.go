@@ -0,0 +1,233 @@
+package mailing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOutboxMessageNotFound = errors.New("failed outbox message not found")
+	ErrOutboxMessageScrubbed = errors.New("outbox message carried credentials and was dropped, repeat the action to send a new one")
+)
+
+type OutboxStatus string
+
+const (
+	OutboxPending OutboxStatus = "pending"
+	OutboxSent    OutboxStatus = "sent"
+	OutboxFailed  OutboxStatus = "failed"
+)
+
+// secretTemplates carry passwords or single-use links. Their content is
+// dropped once delivery is given up too, a new email is sent by repeating
+// the action rather than resending the old one.
+var secretTemplates = map[string]bool{
+	TemplateVerification:  true,
+	TemplateCredentials:   true,
+	TemplatePasswordReset: true,
+}
+
+// OutboxMessage is an email waiting to be delivered by the OutboxWorker.
+// The content is dropped once the message is sent, credentials emails
+// contain passwords.
+type OutboxMessage struct {
+	gorm.Model
+	To            string          `json:"to" gorm:"not null"`
+	Template      string          `json:"template" gorm:"not null"`
+	Subject       string          `json:"subject" gorm:"not null"`
+	Text          string          `json:"-"`
+	HTML          string          `json:"-"`
+	Status        OutboxStatus    `json:"status" gorm:"not null;index"`
+	Attempts      uint            `json:"attempts" gorm:"not null;default:0"`
+	NextAttemptAt time.Time       `json:"next_attempt_at" gorm:"not null;index"`
+	LastError     string          `json:"last_error"`
+	SentAt        *time.Time      `json:"sent_at"`
+	AttemptLog    []OutboxAttempt `json:"attempt_log" gorm:"foreignKey:MessageID;constraint:OnDelete:CASCADE"`
+}
+
+// OutboxAttempt records a single delivery attempt, Error is empty if the
+// message was sent
+type OutboxAttempt struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	MessageID uint      `json:"-" gorm:"index;not null"`
+	Error     string    `json:"error"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewOutboxMessage wraps the message for the outbox. Repos create it in
+// their own transactions to queue an email together with the change it
+// reports.
+func NewOutboxMessage(message *Message) *OutboxMessage {
+	return &OutboxMessage{
+		To:            message.To,
+		Template:      message.Template,
+		Subject:       message.Subject,
+		Text:          message.Text,
+		HTML:          message.HTML,
+		Status:        OutboxPending,
+		NextAttemptAt: time.Now(),
+	}
+}
+
+// Scrub drops the content of the message, the rest is kept as a record of
+// the delivery
+func (m *OutboxMessage) Scrub() {
+	m.Text = ""
+	m.HTML = ""
+}
+
+// Scrubbed reports whether the content was dropped
+func (m *OutboxMessage) Scrubbed() bool {
+	return m.Text == "" && m.HTML == ""
+}
+
+func (m *OutboxMessage) Message() *Message {
+	return &Message{
+		To:       m.To,
+		Template: m.Template,
+		Subject:  m.Subject,
+		Text:     m.Text,
+		HTML:     m.HTML,
+	}
+}
+
+type OutboxRepo interface {
+	Create(ctx context.Context, message *OutboxMessage) error
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*OutboxMessage, error)
+	SaveAttempt(ctx context.Context, message *OutboxMessage, attempt *OutboxAttempt) error
+	ListFailed(ctx context.Context) ([]*OutboxMessage, error)
+	Resend(ctx context.Context, id uint) error
+	WithTx(tx datastore.Storage) OutboxRepo
+}
+
+type OutboxRepoImpl struct {
+	storage datastore.Storage
+}
+
+func NewOutboxRepo(storage datastore.Storage) OutboxRepo {
+	return &OutboxRepoImpl{storage: storage}
+}
+
+func (r *OutboxRepoImpl) WithTx(tx datastore.Storage) OutboxRepo {
+	return &OutboxRepoImpl{storage: tx}
+}
+
+func (r *OutboxRepoImpl) Create(ctx context.Context, message *OutboxMessage) error {
+	return r.storage.DB().WithContext(ctx).Create(message).Error
+}
+
+// ClaimDue returns pending messages that are due and postpones them by the
+// lease, so that other instances do not pick them up while they are sent
+func (r *OutboxRepoImpl) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]*OutboxMessage, error) {
+	var messages []*OutboxMessage
+	err := r.storage.DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", OutboxPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&messages).Error
+		if err != nil || len(messages) == 0 {
+			return err
+		}
+
+		ids := make([]uint, 0, len(messages))
+		for _, message := range messages {
+			ids = append(ids, message.ID)
+		}
+
+		return tx.Model(&OutboxMessage{}).Where("id IN ?", ids).Update("next_attempt_at", now.Add(lease)).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// SaveAttempt stores the delivery state of the message along with the attempt
+func (r *OutboxRepoImpl) SaveAttempt(ctx context.Context, message *OutboxMessage, attempt *OutboxAttempt) error {
+	return r.storage.DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(message).
+			Select("status", "attempts", "next_attempt_at", "last_error", "sent_at", "text", "html").
+			Updates(message).Error
+		if err != nil {
+			return err
+		}
+
+		attempt.MessageID = message.ID
+		return tx.Create(attempt).Error
+	})
+}
+
+func (r *OutboxRepoImpl) ListFailed(ctx context.Context) ([]*OutboxMessage, error) {
+	var messages []*OutboxMessage
+	err := r.storage.DB().WithContext(ctx).
+		Preload("AttemptLog", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at")
+		}).
+		Where("status = ?", OutboxFailed).
+		Order("updated_at DESC").
+		Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// Resend queues a failed message again with a fresh retry budget. Messages
+// whose content was dropped cannot be resent.
+func (r *OutboxRepoImpl) Resend(ctx context.Context, id uint) error {
+	var message OutboxMessage
+	err := r.storage.DB().WithContext(ctx).
+		Where("id = ? AND status = ?", id, OutboxFailed).
+		First(&message).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrOutboxMessageNotFound
+	} else if err != nil {
+		return err
+	}
+	if message.Scrubbed() {
+		return ErrOutboxMessageScrubbed
+	}
+
+	result := r.storage.DB().WithContext(ctx).Model(&OutboxMessage{}).
+		Where("id = ? AND status = ?", id, OutboxFailed).
+		Updates(map[string]interface{}{
+			"status":          OutboxPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now(),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOutboxMessageNotFound
+	}
+
+	return nil
+}
+
+type outboxMailer struct {
+	repo OutboxRepo
+}
+
+// NewOutboxMailer queues the messages in the outbox instead of sending them
+// right away, the OutboxWorker delivers them with the actual mailer
+func NewOutboxMailer(repo OutboxRepo) Mailer {
+	return &outboxMailer{repo: repo}
+}
+
+func (m *outboxMailer) WithTx(tx datastore.Storage) Mailer {
+	return &outboxMailer{repo: m.repo.WithTx(tx)}
+}
+
+func (m *outboxMailer) Send(ctx context.Context, message *Message) error {
+	return m.repo.Create(ctx, NewOutboxMessage(message))
+}
@@ -0,0 +1,165 @@
+package mailing_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/mailing"
+	"github.com/L2SH-Dev/admissions/internal/migrations"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	storage datastore.MockStorage
+)
+
+func TestMain(m *testing.M) {
+	s, cleanup := datastore.InitMockStorage()
+	storage = s
+
+	code := m.Run()
+
+	cleanup()
+	os.Exit(code)
+}
+
+type failingMailer struct {
+	err error
+}
+
+func (m *failingMailer) Send(_ context.Context, _ *mailing.Message) error {
+	return m.err
+}
+
+func setupTestOutbox(t *testing.T) mailing.OutboxRepo {
+	viper.Set("server.domain", "https://example.com")
+	viper.Set("mailing.outbox.batch_size", 10)
+	viper.Set("mailing.outbox.max_attempts", 2)
+	// Retry right away so that the tests do not have to wait
+	viper.Set("mailing.outbox.base_delay", 0)
+	viper.Set("mailing.outbox.max_delay", 0)
+
+	t.Cleanup(func() {
+		viper.Reset()
+		err := storage.Flush()
+		assert.NoError(t, err)
+	})
+
+	_, err := migrations.Up(storage.DB())
+	require.NoError(t, err)
+
+	return mailing.NewOutboxRepo(storage)
+}
+
+func TestOutboxWorker_Delivers(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestOutbox(t)
+	mailbox := filepath.Join(t.TempDir(), "mail.mbox")
+
+	service := mailing.NewMailingService(mailing.NewOutboxMailer(repo))
+	require.NoError(t, service.SendLoginAndPassword(ctx, "test@example.com", "t.user-00001", "Password$123"))
+
+	// Nothing is sent until the worker runs
+	_, err := os.Stat(mailbox)
+	assert.True(t, os.IsNotExist(err))
+
+	worker := mailing.NewOutboxWorker(repo, mailing.NewFileMailer(mailbox, "noreply@example.com"))
+	delivered, err := worker.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Contains(t, readMailbox(t, mailbox), "Password$123")
+
+	delivered, err = worker.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, delivered)
+
+	// Credentials must not stay in the database after delivery
+	var message mailing.OutboxMessage
+	require.NoError(t, storage.DB().First(&message).Error)
+	assert.Equal(t, mailing.OutboxSent, message.Status)
+	assert.NotNil(t, message.SentAt)
+	assert.Empty(t, message.Text)
+	assert.Empty(t, message.HTML)
+}
+
+func TestOutboxWorker_ScrubsFailedCredentials(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestOutbox(t)
+
+	service := mailing.NewMailingService(mailing.NewOutboxMailer(repo))
+	require.NoError(t, service.SendLoginAndPassword(ctx, "test@example.com", "t.user-00001", "Password$123"))
+
+	worker := mailing.NewOutboxWorker(repo, &failingMailer{err: errors.New("connection refused")})
+
+	// The content is kept while the message is retried
+	_, err := worker.DeliverDue(ctx)
+	require.NoError(t, err)
+
+	var message mailing.OutboxMessage
+	require.NoError(t, storage.DB().First(&message).Error)
+	assert.Equal(t, mailing.OutboxPending, message.Status)
+	assert.Contains(t, message.Text, "Password$123")
+
+	_, err = worker.DeliverDue(ctx)
+	require.NoError(t, err)
+
+	// The password does not stay in the database once delivery is given up
+	failed, err := repo.ListFailed(ctx)
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+	assert.Equal(t, mailing.TemplateCredentials, failed[0].Template)
+	assert.Empty(t, failed[0].Text)
+	assert.Empty(t, failed[0].HTML)
+	assert.Len(t, failed[0].AttemptLog, 2)
+
+	assert.ErrorIs(t, repo.Resend(ctx, failed[0].ID), mailing.ErrOutboxMessageScrubbed)
+}
+
+func TestOutboxWorker_RetriesAndResend(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestOutbox(t)
+
+	service := mailing.NewMailingService(mailing.NewOutboxMailer(repo))
+	require.NoError(t, service.SendRegistrationRejection(ctx, "test@example.com", "Неверный класс"))
+
+	worker := mailing.NewOutboxWorker(repo, &failingMailer{err: errors.New("connection refused")})
+
+	// First failure is retried, the second one exhausts the attempts
+	for i := 0; i < 2; i++ {
+		delivered, err := worker.DeliverDue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, delivered)
+	}
+
+	delivered, err := worker.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, delivered)
+
+	failed, err := repo.ListFailed(ctx)
+	require.NoError(t, err)
+	require.Len(t, failed, 1)
+	assert.Equal(t, "test@example.com", failed[0].To)
+	assert.Equal(t, uint(2), failed[0].Attempts)
+	assert.Equal(t, "connection refused", failed[0].LastError)
+	assert.Len(t, failed[0].AttemptLog, 2)
+
+	require.NoError(t, repo.Resend(ctx, failed[0].ID))
+	assert.ErrorIs(t, repo.Resend(ctx, failed[0].ID), mailing.ErrOutboxMessageNotFound)
+
+	mailbox := filepath.Join(t.TempDir(), "mail.mbox")
+	worker = mailing.NewOutboxWorker(repo, mailing.NewFileMailer(mailbox, "noreply@example.com"))
+	delivered, err = worker.DeliverDue(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Contains(t, readMailbox(t, mailbox), "Неверный класс")
+
+	failed, err = repo.ListFailed(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, failed)
+}
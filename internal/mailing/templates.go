@@ -0,0 +1,121 @@
+package mailing
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+var ErrUnknownTemplate = errors.New("unknown email template")
+
+// Every email has a plain text template, which also defines the subject,
+// and an HTML template rendered inside the shared layout
+//
+//go:embed templates
+var templatesFS embed.FS
+
+type emailTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+var templateNames = []string{
+	TemplateVerification,
+	TemplateCredentials,
+	TemplateRejection,
+	TemplatePasswordReset,
+	TemplateWaitlistPromotion,
+}
+
+var templates = parseTemplates()
+
+func parseTemplates() map[string]*emailTemplate {
+	parsed := make(map[string]*emailTemplate, len(templateNames))
+	for _, name := range templateNames {
+		parsed[name] = &emailTemplate{
+			text: texttemplate.Must(texttemplate.ParseFS(templatesFS, "templates/"+name+".txt")),
+			html: htmltemplate.Must(htmltemplate.ParseFS(templatesFS, "templates/layout.html", "templates/"+name+".html")),
+		}
+	}
+	return parsed
+}
+
+// TemplateNames lists the emails the application can send
+func TemplateNames() []string {
+	return append([]string(nil), templateNames...)
+}
+
+// Render builds the message from the named template and its params
+func Render(name string, to string, params interface{}) (*Message, error) {
+	tmpl, ok := templates[name]
+	if !ok {
+		return nil, ErrUnknownTemplate
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", params); err != nil {
+		return nil, err
+	}
+	if err := tmpl.text.ExecuteTemplate(&text, name+".txt", params); err != nil {
+		return nil, err
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "layout.html", params); err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:       to,
+		Template: name,
+		Subject:  strings.TrimSpace(subject.String()),
+		Text:     strings.TrimLeft(text.String(), "\n"),
+		HTML:     html.String(),
+	}, nil
+}
+
+// Preview renders the named template with sample params
+func Preview(name string) (*Message, error) {
+	const email = "ivanov@example.com"
+
+	var params interface{}
+	switch name {
+	case TemplateVerification:
+		params = &verificationParams{
+			Email:            email,
+			VerificationLink: link("/verification?token=00000000-0000-0000-0000-000000000000"),
+		}
+	case TemplateCredentials:
+		params = &loginCredentialsParams{
+			Email:     email,
+			Login:     "i.ivanov-00042",
+			Password:  "Xq7#kLm2$pWz",
+			LoginLink: link("/login"),
+		}
+	case TemplateRejection:
+		params = &rejectionParams{
+			Email:  email,
+			Reason: "Указан неверный класс поступления",
+		}
+	case TemplatePasswordReset:
+		params = &passwordResetParams{
+			Email:     email,
+			Login:     "i.ivanov-00042",
+			ResetLink: link("/password-reset?token=00000000-0000-0000-0000-000000000000"),
+		}
+	case TemplateWaitlistPromotion:
+		params = &waitlistPromotionParams{
+			Email:     email,
+			ExamTitle: "письменная математика",
+			ExamStart: moscowTime(time.Date(2025, 3, 1, 7, 0, 0, 0, time.UTC)),
+			Location:  "Кабинет 101",
+			ExamsLink: link("/exams"),
+		}
+	default:
+		return nil, ErrUnknownTemplate
+	}
+
+	return Render(name, email, params)
+}
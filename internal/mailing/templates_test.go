@@ -0,0 +1,105 @@
+package mailing_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/mailing"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreview(t *testing.T) {
+	for _, name := range mailing.TemplateNames() {
+		t.Run(name, func(t *testing.T) {
+			message, err := mailing.Preview(name)
+			require.NoError(t, err)
+
+			assert.Equal(t, name, message.Template)
+			assert.NotEmpty(t, message.Subject)
+			assert.NotContains(t, message.Subject, "\n")
+			assert.NotEmpty(t, message.Text)
+			assert.Contains(t, message.HTML, "<!DOCTYPE html>")
+			assert.Contains(t, message.Text, "Здравствуйте!")
+			assert.Contains(t, message.HTML, "Здравствуйте!")
+		})
+	}
+
+	_, err := mailing.Preview("unknown")
+	assert.ErrorIs(t, err, mailing.ErrUnknownTemplate)
+}
+
+func TestRender_EscapesHTML(t *testing.T) {
+	message, err := mailing.Render(mailing.TemplateRejection, "test@example.com", map[string]string{
+		"Reason": "<script>alert(1)</script>",
+	})
+	require.NoError(t, err)
+
+	assert.Contains(t, message.Text, "<script>alert(1)</script>")
+	assert.NotContains(t, message.HTML, "<script>")
+	assert.Contains(t, message.HTML, "&lt;script&gt;")
+}
+
+// TestMessages renders every template through the builder the application
+// sends it with, so that a template and its params cannot drift apart
+func TestMessages(t *testing.T) {
+	viper.Set("server.domain", "https://example.com")
+	t.Cleanup(viper.Reset)
+
+	const email = "test@example.com"
+	start := time.Date(2025, 3, 1, 7, 0, 0, 0, time.UTC)
+
+	cases := map[string]struct {
+		build    func() (*mailing.Message, error)
+		contains []string
+	}{
+		mailing.TemplateVerification: {
+			build:    func() (*mailing.Message, error) { return mailing.VerificationMessage(email, "token123") },
+			contains: []string{"https://example.com/verification?token=token123"},
+		},
+		mailing.TemplateCredentials: {
+			build: func() (*mailing.Message, error) {
+				return mailing.CredentialsMessage(email, "t.user-00001", "Password$123")
+			},
+			contains: []string{"t.user-00001", "Password$123", "https://example.com/login"},
+		},
+		mailing.TemplateRejection: {
+			build: func() (*mailing.Message, error) {
+				return mailing.RejectionMessage(email, "Неверный класс")
+			},
+			contains: []string{"Неверный класс"},
+		},
+		mailing.TemplatePasswordReset: {
+			build: func() (*mailing.Message, error) {
+				return mailing.PasswordResetMessage(email, "t.user-00001", "token123")
+			},
+			contains: []string{"t.user-00001", "https://example.com/password-reset?token=token123"},
+		},
+		mailing.TemplateWaitlistPromotion: {
+			build: func() (*mailing.Message, error) {
+				return mailing.WaitlistPromotionMessage(email, "письменная математика", "Кабинет 101", start)
+			},
+			contains: []string{"письменная математика", "Кабинет 101", "01.03.2025 10:00", "https://example.com/exams"},
+		},
+	}
+	require.Len(t, cases, len(mailing.TemplateNames()))
+
+	for _, name := range mailing.TemplateNames() {
+		t.Run(name, func(t *testing.T) {
+			tc, ok := cases[name]
+			require.True(t, ok, "no case for the template")
+
+			message, err := tc.build()
+			require.NoError(t, err)
+
+			assert.Equal(t, name, message.Template)
+			assert.Equal(t, email, message.To)
+			assert.NotEmpty(t, message.Subject)
+			for _, value := range tc.contains {
+				assert.Contains(t, message.Text, value)
+				assert.Contains(t, message.HTML, value)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package mailing
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// deliveryLease is how long a claimed message is hidden from other workers
+// while it is being sent
+const deliveryLease = 5 * time.Minute
+
+// OutboxWorker delivers queued messages, retrying failed deliveries with
+// exponential backoff until mailing.outbox.max_attempts is reached
+type OutboxWorker struct {
+	repo   OutboxRepo
+	mailer Mailer
+}
+
+func NewOutboxWorker(repo OutboxRepo, mailer Mailer) *OutboxWorker {
+	return &OutboxWorker{
+		repo:   repo,
+		mailer: mailer,
+	}
+}
+
+// Run delivers due messages every mailing.outbox.poll_interval until the
+// context is done
+func (w *OutboxWorker) Run(ctx context.Context) {
+	ticker := time.NewTicker(viper.GetDuration("mailing.outbox.poll_interval"))
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.DeliverDue(ctx); err != nil {
+			slog.ErrorContext(ctx, "Failed to deliver outbox messages", slog.Any("err", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue sends one batch of due messages and returns its size
+func (w *OutboxWorker) DeliverDue(ctx context.Context) (int, error) {
+	messages, err := w.repo.ClaimDue(ctx, viper.GetInt("mailing.outbox.batch_size"), deliveryLease)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, message := range messages {
+		if err := w.deliver(ctx, message); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(messages), nil
+}
+
+func (w *OutboxWorker) deliver(ctx context.Context, message *OutboxMessage) error {
+	attempt := &OutboxAttempt{}
+	message.Attempts++
+
+	sendErr := w.mailer.Send(ctx, message.Message())
+	if sendErr == nil {
+		sentAt := time.Now()
+		message.Status = OutboxSent
+		message.SentAt = &sentAt
+		message.LastError = ""
+		message.Scrub()
+	} else {
+		attempt.Error = sendErr.Error()
+		message.LastError = sendErr.Error()
+
+		if message.Attempts >= viper.GetUint("mailing.outbox.max_attempts") {
+			message.Status = OutboxFailed
+			if secretTemplates[message.Template] {
+				message.Scrub()
+			}
+			slog.ErrorContext(ctx, "Giving up on outbox message", slog.Any("id", message.ID), slog.Any("to", message.To), slog.Any("err", sendErr))
+		} else {
+			message.NextAttemptAt = time.Now().Add(retryDelay(message.Attempts))
+			slog.WarnContext(ctx, "Failed to send outbox message, will retry", slog.Any("id", message.ID), slog.Any("to", message.To), slog.Any("err", sendErr))
+		}
+	}
+
+	return w.repo.SaveAttempt(ctx, message, attempt)
+}
+
+// retryDelay doubles the base delay after every failed attempt
+func retryDelay(attempts uint) time.Duration {
+	delay := viper.GetDuration("mailing.outbox.base_delay")
+	maxDelay := viper.GetDuration("mailing.outbox.max_delay")
+
+	for i := uint(1); i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxDelay)
+}
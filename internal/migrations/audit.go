@@ -0,0 +1,43 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Reject changes to the audit log in the database as well, the hooks on
+// audit.Entry do not apply to raw SQL
+var auditAppendOnlyStatements = []string{
+	`CREATE OR REPLACE FUNCTION audit_entries_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'audit log entries cannot be changed or deleted';
+	END;
+	$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS audit_entries_append_only ON audit_entries`,
+	`CREATE TRIGGER audit_entries_append_only
+		BEFORE UPDATE OR DELETE ON audit_entries
+		FOR EACH ROW EXECUTE FUNCTION audit_entries_append_only()`,
+	`DROP TRIGGER IF EXISTS audit_entries_no_truncate ON audit_entries`,
+	`CREATE TRIGGER audit_entries_no_truncate
+		BEFORE TRUNCATE ON audit_entries
+		FOR EACH STATEMENT EXECUTE FUNCTION audit_entries_append_only()`,
+}
+
+func auditAppendOnlyUp(tx *gorm.DB) error {
+	for _, statement := range auditAppendOnlyStatements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func auditAppendOnlyDown(tx *gorm.DB) error {
+	for _, statement := range []string{
+		`DROP TRIGGER IF EXISTS audit_entries_append_only ON audit_entries`,
+		`DROP TRIGGER IF EXISTS audit_entries_no_truncate ON audit_entries`,
+		`DROP FUNCTION IF EXISTS audit_entries_append_only()`,
+	} {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
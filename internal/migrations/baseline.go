@@ -0,0 +1,156 @@
+package migrations
+
+import (
+	"errors"
+
+	"github.com/L2SH-Dev/admissions/internal/migrations/baseline"
+	"gorm.io/gorm"
+)
+
+// baselineUp creates the schema the repositories used to migrate to on
+// their own, from the frozen copies of their models. Databases created that
+// way are brought to the same state: the steps below are the data fixes
+// those repositories ran before.
+func baselineUp(tx *gorm.DB) error {
+	migrator := tx.Migrator()
+	addingStatus := migrator.HasTable(&baseline.RegistrationData{}) && !migrator.HasColumn(&baseline.RegistrationData{}, "status")
+
+	if err := dropDuplicateExamRegistrations(tx); err != nil {
+		return err
+	}
+
+	if err := tx.AutoMigrate(baseline.Models()...); err != nil {
+		return err
+	}
+
+	if err := migrateLegacyRoleFlags(tx); err != nil {
+		return err
+	}
+
+	if addingStatus {
+		if err := backfillRegistrationStatus(tx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func baselineDown(tx *gorm.DB) error {
+	tables := append(baseline.Models(), "role_permissions")
+	return tx.Migrator().DropTable(tables...)
+}
+
+// dropDuplicateExamRegistrations soft deletes repeated registrations of a
+// user to the same exam, keeping the earliest one, so that the unique index
+// on exam registrations can be created on existing databases
+func dropDuplicateExamRegistrations(tx *gorm.DB) error {
+	if !tx.Migrator().HasTable(&baseline.ExamRegistration{}) {
+		return nil
+	}
+
+	return tx.Exec(`
+		UPDATE exam_registrations SET deleted_at = NOW()
+		WHERE deleted_at IS NULL AND id NOT IN (
+			SELECT MIN(id) FROM exam_registrations
+			WHERE deleted_at IS NULL
+			GROUP BY user_id, exam_id
+		)`).Error
+}
+
+// migrateLegacyRoleFlags moves roles created before named permissions
+// existed onto the new scheme and drops the old boolean columns
+func migrateLegacyRoleFlags(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&baseline.Role{}, "admin") {
+		return nil
+	}
+
+	var legacyRoles []struct {
+		ID           uint
+		Admin        bool
+		WriteGeneral bool
+		AIAccess     bool
+	}
+	err := tx.Table("roles").Select("id, admin, write_general, ai_access").Scan(&legacyRoles).Error
+	if err != nil {
+		return errors.Join(errors.New("failed to read legacy role flags"), err)
+	}
+
+	for _, legacy := range legacyRoles {
+		names := legacyPermissions(legacy.Admin, legacy.WriteGeneral, legacy.AIAccess)
+		if len(names) == 0 {
+			continue
+		}
+
+		permissions := make([]baseline.Permission, 0, len(names))
+		for _, name := range names {
+			var permission baseline.Permission
+			if err := tx.Where(baseline.Permission{Name: name}).FirstOrCreate(&permission).Error; err != nil {
+				return errors.Join(errors.New("failed to create permission"), err)
+			}
+			permissions = append(permissions, permission)
+		}
+
+		role := &baseline.Role{Model: gorm.Model{ID: legacy.ID}}
+		if err := tx.Model(role).Association("Permissions").Append(permissions); err != nil {
+			return errors.Join(errors.New("failed to migrate role permissions"), err)
+		}
+	}
+
+	for _, column := range []string{"admin", "write_general", "ai_access"} {
+		if err := tx.Migrator().DropColumn(&baseline.Role{}, column); err != nil {
+			return errors.Join(errors.New("failed to drop legacy role column"), err)
+		}
+	}
+
+	return nil
+}
+
+// backfillRegistrationStatus derives the status of registrations created
+// before it was stored: verified registrations are pending and those with a
+// user are accepted. Rejected registrations were deleted and stay so.
+func backfillRegistrationStatus(tx *gorm.DB) error {
+	err := tx.Model(&baseline.RegistrationData{}).
+		Where("email_verified = ?", true).
+		Update("status", "email_verified").Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&baseline.RegistrationData{}).
+		Where("EXISTS (SELECT 1 FROM users WHERE users.registration_data_id = registration_data.id AND users.deleted_at IS NULL)").
+		Update("status", "accepted").Error
+}
+
+// legacyPermissions maps the boolean flags roles used to have onto named
+// permissions, as they were named when the flags were dropped. Every admin
+// endpoint used to require both admin and general write access, so only
+// that combination grants access to them.
+func legacyPermissions(admin, writeGeneral, aiAccess bool) []string {
+	var permissions []string
+	if admin {
+		permissions = append(permissions, "admin.panel")
+	}
+
+	if admin && writeGeneral {
+		permissions = append(permissions,
+			"regdata.read",
+			"regdata.accept",
+			"exams.read",
+			"exams.create",
+			"exams.manage",
+			"exams.results.read",
+			"exams.results.write",
+			"exams.results.publish",
+			"roles.read",
+			"roles.manage",
+			"audit.read",
+		)
+	}
+
+	if aiAccess {
+		permissions = append(permissions, "ai.access")
+	}
+
+	return permissions
+}
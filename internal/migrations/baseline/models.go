@@ -0,0 +1,184 @@
+// Package baseline is a frozen copy of the models the baseline migration
+// creates the schema from. The application models keep changing, these must
+// not: a change to the schema is a new migration. Type and field names are
+// kept as they were, GORM derives table, column, index and constraint names
+// from them.
+package baseline
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Permission struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"unique;not null"`
+}
+
+type Role struct {
+	gorm.Model
+	Title       string       `gorm:"index;unique;not null"`
+	Permissions []Permission `gorm:"many2many:role_permissions"`
+}
+
+type Password struct {
+	gorm.Model
+	UserID    uint   `gorm:"index;unique;not null"`
+	Hash      []byte `gorm:"type:bytea;not null"`
+	Salt      []byte `gorm:"type:bytea;not null"`
+	Algorithm string `gorm:"not null"`
+}
+
+type User struct {
+	gorm.Model
+	Login              string   `gorm:"not null;unique"`
+	RegistrationDataID uint     `gorm:"unique;index;not null"`
+	RoleID             uint     `gorm:"not null"`
+	Role               Role     `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	Password           Password `gorm:"not null; constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+}
+
+type RoleGrant struct {
+	gorm.Model
+	UserID         uint `gorm:"index;not null"`
+	RoleID         uint `gorm:"not null"`
+	Role           Role
+	PreviousRoleID uint
+	GrantedByID    uint `gorm:"not null"`
+}
+
+type RegistrationData struct {
+	gorm.Model
+	Email            string `gorm:"not null"`
+	EmailVerified    bool   `gorm:"not null;default:false"`
+	Status           string `gorm:"not null;default:submitted;index"`
+	StatusChangedAt  time.Time
+	RejectionReason  string
+	RejectedByID     *uint
+	RejectedAt       *time.Time
+	FirstName        string `gorm:"not null"`
+	LastName         string `gorm:"not null"`
+	Patronymic       string
+	Gender           string    `gorm:"varchar(1)"`
+	BirthDate        time.Time `gorm:"not null"`
+	Grade            uint      `gorm:"not null"`
+	OldSchool        string    `gorm:"not null"`
+	ParentFirstName  string    `gorm:"not null"`
+	ParentLastName   string    `gorm:"not null"`
+	ParentPatronymic string
+	ParentPhone      string `gorm:"not null"`
+	JuneExam         bool   `gorm:"not null;default:false"`
+	VMSH             bool   `gorm:"not null;default:false"`
+	Source           string
+	MergedIntoID     *uint
+	User             User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+type RegistrationDataChange struct {
+	gorm.Model
+	RegistrationDataID uint   `gorm:"index;not null"`
+	ChangedByID        uint   `gorm:"not null"`
+	Field              string `gorm:"not null"`
+	OldValue           string
+	NewValue           string
+}
+
+type OutboxMessage struct {
+	gorm.Model
+	To            string `gorm:"not null"`
+	Template      string `gorm:"not null"`
+	Subject       string `gorm:"not null"`
+	Text          string
+	HTML          string
+	Status        string    `gorm:"not null;index"`
+	Attempts      uint      `gorm:"not null;default:0"`
+	NextAttemptAt time.Time `gorm:"not null;index"`
+	LastError     string
+	SentAt        *time.Time
+	AttemptLog    []OutboxAttempt `gorm:"foreignKey:MessageID;constraint:OnDelete:CASCADE"`
+}
+
+type OutboxAttempt struct {
+	ID        uint `gorm:"primarykey"`
+	MessageID uint `gorm:"index;not null"`
+	Error     string
+	CreatedAt time.Time
+}
+
+type Exam struct {
+	gorm.Model
+	Start            time.Time `gorm:"not null"`
+	End              time.Time
+	Location         string   `gorm:"not null"`
+	Capacity         uint     `gorm:"not null"`
+	Grade            uint     `gorm:"not null"`
+	ExamTypeID       uint     `gorm:"not null"`
+	ExamType         ExamType `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
+	ResultsPublished bool     `gorm:"not null;default:false"`
+}
+
+type ExamType struct {
+	gorm.Model
+	Title      string `gorm:"unique;index;not null"`
+	Order      int    `gorm:"not null"`
+	Dismissing bool   `gorm:"not null"`
+	HasPoints  bool   `gorm:"not null"`
+}
+
+type ExamRegistration struct {
+	gorm.Model
+	ExamID uint `gorm:"not null;index;uniqueIndex:idx_exam_registrations_exam_user,where:deleted_at IS NULL"`
+	Exam   Exam `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	UserID uint `gorm:"not null;index;uniqueIndex:idx_exam_registrations_exam_user,where:deleted_at IS NULL"`
+	User   User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+type ExamWaitlistEntry struct {
+	gorm.Model
+	ExamID uint `gorm:"not null;index;uniqueIndex:idx_exam_waitlist_exam_user,where:deleted_at IS NULL"`
+	Exam   Exam `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	UserID uint `gorm:"not null;index;uniqueIndex:idx_exam_waitlist_exam_user,where:deleted_at IS NULL"`
+	User   User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+type ExamResult struct {
+	gorm.Model
+	ExamID    uint    `gorm:"not null;index;uniqueIndex:idx_exam_results_exam_user,where:deleted_at IS NULL"`
+	Exam      Exam    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	UserID    uint    `gorm:"not null;index;uniqueIndex:idx_exam_results_exam_user,where:deleted_at IS NULL"`
+	User      User    `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+	Result    string  `gorm:"not null"`
+	Dismissed bool    `gorm:"not null"`
+	Points    float32 `gorm:"not null"`
+	MaxPoints float32 `gorm:"not null"`
+}
+
+type AuditEntry struct {
+	ID         uint      `gorm:"primarykey"`
+	CreatedAt  time.Time `gorm:"index;not null"`
+	ActorID    uint      `gorm:"index;not null"`
+	ActorRole  string    `gorm:"not null"`
+	Action     string    `gorm:"index;not null"`
+	TargetType string    `gorm:"index:idx_audit_entries_target;not null"`
+	TargetID   uint      `gorm:"index:idx_audit_entries_target"`
+	IP         string
+	Diff       []byte `gorm:"type:jsonb"`
+}
+
+func (AuditEntry) TableName() string {
+	return "audit_entries"
+}
+
+// Models lists the tables of the baseline
+func Models() []any {
+	return []any{
+		&Permission{}, &Role{},
+		&Password{},
+		&User{}, &RoleGrant{},
+		&RegistrationData{}, &RegistrationDataChange{},
+		&OutboxMessage{}, &OutboxAttempt{},
+		&Exam{}, &ExamType{}, &ExamRegistration{}, &ExamResult{}, &ExamWaitlistEntry{},
+		&AuditEntry{},
+	}
+}
@@ -0,0 +1,227 @@
+// Package migrations keeps the database schema in step with the code.
+// Migrations are applied in the order of their versions and every applied
+// one is recorded in the schema_migrations table.
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPending        = errors.New("database has pending migrations")
+	ErrUnknownVersion = errors.New("database has a migration unknown to this version")
+)
+
+// Key of the advisory lock taken while migrating, so that instances started
+// at the same time do not apply a migration twice
+const lockKey = 7_240_311
+
+// Migration changes the schema from the previous version. Up and Down run
+// in a transaction together with the update of schema_migrations.
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+type SchemaMigration struct {
+	Version   uint   `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"not null"`
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// MigrationStatus tells whether the migration has been applied. Migrations
+// recorded in the database but missing in the code are marked as unknown.
+type MigrationStatus struct {
+	Version   uint
+	Name      string
+	AppliedAt *time.Time
+	Unknown   bool
+}
+
+func applied(db *gorm.DB) (map[uint]*SchemaMigration, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, errors.Join(errors.New("failed to create schema migrations table"), err)
+	}
+
+	var records []*SchemaMigration
+	if err := db.Order("version").Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[uint]*SchemaMigration, len(records))
+	for _, record := range records {
+		byVersion[record.Version] = record
+	}
+	return byVersion, nil
+}
+
+// lock waits for migrations run by other instances. Migrations may rewrite
+// whole tables, database.statement_timeout doesn't apply to them.
+func lock(tx *gorm.DB) error {
+	if err := tx.Exec("SET LOCAL statement_timeout = 0").Error; err != nil {
+		return err
+	}
+	return tx.Exec("SELECT pg_advisory_xact_lock(?)", lockKey).Error
+}
+
+// Up applies the pending migrations in order and returns those applied.
+// Every migration is committed on its own, a failure keeps the earlier ones.
+func Up(db *gorm.DB) ([]*Migration, error) {
+	if _, err := applied(db); err != nil {
+		return nil, err
+	}
+
+	done := []*Migration{}
+	for _, migration := range all {
+		var ran bool
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lock(tx); err != nil {
+				return err
+			}
+
+			var count int64
+			if err := tx.Model(&SchemaMigration{}).Where("version = ?", migration.Version).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return nil
+			}
+
+			if err := migration.Up(tx); err != nil {
+				return err
+			}
+			ran = true
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %s failed: %w", migration, err)
+		}
+		if ran {
+			done = append(done, migration)
+		}
+	}
+
+	return done, nil
+}
+
+// Down reverts the latest applied migration and returns it, or nil if no
+// migration has been applied
+func Down(db *gorm.DB) (*Migration, error) {
+	if _, err := applied(db); err != nil {
+		return nil, err
+	}
+
+	var reverted *Migration
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lock(tx); err != nil {
+			return err
+		}
+
+		var latest SchemaMigration
+		err := tx.Order("version DESC").Limit(1).Find(&latest).Error
+		if err != nil {
+			return err
+		}
+		if latest.Version == 0 {
+			return nil
+		}
+
+		migration := find(latest.Version)
+		if migration == nil {
+			return errors.Join(ErrUnknownVersion, fmt.Errorf("version %d (%s)", latest.Version, latest.Name))
+		}
+
+		if err := migration.Down(tx); err != nil {
+			return fmt.Errorf("migration %s failed: %w", migration, err)
+		}
+		reverted = migration
+		return tx.Delete(&SchemaMigration{}, latest.Version).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return reverted, nil
+}
+
+// Status lists the known migrations along with unknown applied ones,
+// ordered by version
+func Status(db *gorm.DB) ([]*MigrationStatus, error) {
+	records, err := applied(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*MigrationStatus, 0, len(all))
+	for _, migration := range all {
+		status := &MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if record, ok := records[migration.Version]; ok {
+			status.AppliedAt = &record.AppliedAt
+			delete(records, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	for _, record := range records {
+		statuses = append(statuses, &MigrationStatus{
+			Version:   record.Version,
+			Name:      record.Name,
+			AppliedAt: &record.AppliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
+// Check fails with ErrPending if any migration has not been applied yet
+func Check(db *gorm.DB) error {
+	statuses, err := Status(db)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, fmt.Sprintf("%04d_%s", status.Version, status.Name))
+		}
+	}
+	if len(pending) > 0 {
+		return errors.Join(ErrPending, errors.New(strings.Join(pending, ", ")))
+	}
+
+	return nil
+}
+
+func find(version uint) *Migration {
+	for _, migration := range all {
+		if migration.Version == version {
+			return migration
+		}
+	}
+	return nil
+}
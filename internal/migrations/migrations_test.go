@@ -0,0 +1,164 @@
+package migrations_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/L2SH-Dev/admissions/internal/audit"
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/migrations"
+	"github.com/L2SH-Dev/admissions/internal/users"
+	"github.com/L2SH-Dev/admissions/internal/users/roles"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	storage datastore.MockStorage
+)
+
+func TestMain(m *testing.M) {
+	s, cleanup := datastore.InitMockStorage()
+	storage = s
+
+	code := m.Run()
+
+	cleanup()
+	os.Exit(code)
+}
+
+func setupTest(t *testing.T) {
+	t.Cleanup(func() {
+		err := storage.Flush()
+		assert.NoError(t, err)
+	})
+}
+
+func TestUpDown(t *testing.T) {
+	setupTest(t)
+	db := storage.DB()
+
+	assert.ErrorIs(t, migrations.Check(db), migrations.ErrPending)
+
+	applied, err := migrations.Up(db)
+	require.NoError(t, err)
+	require.NotEmpty(t, applied)
+	assert.Equal(t, uint(1), applied[0].Version)
+	assert.NoError(t, migrations.Check(db))
+	assert.True(t, db.Migrator().HasTable(&users.User{}))
+
+	// Applying again is a no-op
+	applied, err = migrations.Up(db)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	statuses, err := migrations.Status(db)
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.NotNil(t, status.AppliedAt, status.Name)
+		assert.False(t, status.Unknown)
+	}
+
+	latest := statuses[len(statuses)-1]
+	reverted, err := migrations.Down(db)
+	require.NoError(t, err)
+	require.NotNil(t, reverted)
+	assert.Equal(t, latest.Version, reverted.Version)
+	assert.ErrorIs(t, migrations.Check(db), migrations.ErrPending)
+
+	statuses, err = migrations.Status(db)
+	require.NoError(t, err)
+	assert.Nil(t, statuses[len(statuses)-1].AppliedAt)
+
+	for {
+		reverted, err := migrations.Down(db)
+		require.NoError(t, err)
+		if reverted == nil {
+			break
+		}
+	}
+	assert.False(t, db.Migrator().HasTable(&users.User{}))
+}
+
+func TestUnknownVersion(t *testing.T) {
+	setupTest(t)
+	db := storage.DB()
+
+	_, err := migrations.Up(db)
+	require.NoError(t, err)
+
+	// Applied by a newer version of the application
+	err = db.Create(&migrations.SchemaMigration{Version: 9999, Name: "from_the_future"}).Error
+	require.NoError(t, err)
+
+	statuses, err := migrations.Status(db)
+	require.NoError(t, err)
+	assert.True(t, statuses[len(statuses)-1].Unknown)
+	assert.NoError(t, migrations.Check(db))
+
+	_, err = migrations.Down(db)
+	assert.ErrorIs(t, err, migrations.ErrUnknownVersion)
+}
+
+func TestAuditAppendOnly(t *testing.T) {
+	setupTest(t)
+	db := storage.DB()
+
+	_, err := migrations.Up(db)
+	require.NoError(t, err)
+
+	require.NoError(t, db.Create(&audit.Entry{Action: audit.ActionRegDataAccept}).Error)
+	assert.Error(t, db.Exec("DELETE FROM audit_entries").Error)
+}
+
+func TestMigrateLegacyRoleFlags(t *testing.T) {
+	ctx := context.Background()
+	setupTest(t)
+	db := storage.DB()
+
+	// Roles table as created before named permissions existed
+	require.NoError(t, db.AutoMigrate(&roles.Permission{}, &roles.Role{}))
+	for _, column := range []string{"admin", "write_general", "ai_access"} {
+		err := db.Exec("ALTER TABLE roles ADD COLUMN " + column + " boolean DEFAULT false").Error
+		require.NoError(t, err)
+	}
+	err := db.Exec("INSERT INTO roles (title, admin, write_general, ai_access, created_at, updated_at) VALUES ('legacy_admin', true, true, false, NOW(), NOW()), ('legacy_interviewer', true, false, true, NOW(), NOW())").Error
+	require.NoError(t, err)
+
+	_, err = migrations.Up(db)
+	require.NoError(t, err)
+	assert.False(t, db.Migrator().HasColumn(&roles.Role{}, "admin"))
+
+	repo := roles.NewRolesRepo(storage)
+
+	admin, err := repo.GetRoleByTitle(ctx, "legacy_admin")
+	assert.NoError(t, err)
+	assert.True(t, admin.Has(roles.PermissionAdminPanel))
+	assert.True(t, admin.Has(roles.PermissionRegDataAccept))
+	assert.False(t, admin.Has(roles.PermissionAIAccess))
+
+	interviewer, err := repo.GetRoleByTitle(ctx, "legacy_interviewer")
+	assert.NoError(t, err)
+	assert.True(t, interviewer.Has(roles.PermissionAdminPanel))
+	assert.True(t, interviewer.Has(roles.PermissionAIAccess))
+	assert.False(t, interviewer.Has(roles.PermissionExamsResultsWrite))
+}
+
+func TestPermissionsSeeded(t *testing.T) {
+	ctx := context.Background()
+	setupTest(t)
+	db := storage.DB()
+
+	_, err := migrations.Up(db)
+	require.NoError(t, err)
+
+	// Every permission of the code has to be inserted by a migration
+	permissions, err := roles.NewRolesRepo(storage).ListPermissions(ctx)
+	require.NoError(t, err)
+	names := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		names = append(names, permission.Name)
+	}
+	assert.ElementsMatch(t, roles.AllPermissions, names)
+}
@@ -0,0 +1,59 @@
+package migrations
+
+import "gorm.io/gorm"
+
+// Permissions known when they moved from the startup of the roles repo to
+// a migration. A permission added later gets a migration inserting it.
+var seededPermissions = []string{
+	"admin.panel",
+	"regdata.read",
+	"regdata.accept",
+	"exams.read",
+	"exams.create",
+	"exams.manage",
+	"exams.results.read",
+	"exams.results.write",
+	"exams.results.publish",
+	"roles.read",
+	"roles.manage",
+	"audit.read",
+	"ai.access",
+}
+
+// Databases started before this migration already have the permissions
+func seedPermissionsUp(tx *gorm.DB) error {
+	return insertPermissions(tx, seededPermissions)
+}
+
+func seedPermissionsDown(tx *gorm.DB) error {
+	return deletePermissions(tx, seededPermissions)
+}
+
+// Permissions of the mailing admin, which used to require only admin.panel
+var mailingPermissions = []string{
+	"mailing.view",
+	"mailing.resend",
+}
+
+func mailingPermissionsUp(tx *gorm.DB) error {
+	return insertPermissions(tx, mailingPermissions)
+}
+
+func mailingPermissionsDown(tx *gorm.DB) error {
+	return deletePermissions(tx, mailingPermissions)
+}
+
+func insertPermissions(tx *gorm.DB, names []string) error {
+	for _, name := range names {
+		err := tx.Exec("INSERT INTO permissions (name) VALUES (?) ON CONFLICT (name) DO NOTHING", name).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Permissions granted to a role are kept, the roles would lose them otherwise
+func deletePermissions(tx *gorm.DB, names []string) error {
+	return tx.Exec(`DELETE FROM permissions WHERE name IN ? AND id NOT IN (SELECT permission_id FROM role_permissions)`, names).Error
+}
@@ -0,0 +1,11 @@
+package migrations
+
+// all lists the migrations in the order they are applied. Versions are
+// never reused or reordered once released, a change to the schema gets a
+// new migration at the end.
+var all = []*Migration{
+	{Version: 1, Name: "baseline", Up: baselineUp, Down: baselineDown},
+	{Version: 2, Name: "audit_append_only", Up: auditAppendOnlyUp, Down: auditAppendOnlyDown},
+	{Version: 3, Name: "seed_permissions", Up: seedPermissionsUp, Down: seedPermissionsDown},
+	{Version: 4, Name: "mailing_permissions", Up: mailingPermissionsUp, Down: mailingPermissionsDown},
+}
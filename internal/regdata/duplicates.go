@@ -0,0 +1,306 @@
+package regdata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/essentialkaos/translit/v3"
+	"github.com/spf13/viper"
+)
+
+var ErrCannotMerge = errors.New("registrations cannot be merged")
+
+// DuplicateCandidate is a registration that probably describes the same
+// applicant, with the score of the match between 0 and 1
+type DuplicateCandidate struct {
+	RegistrationID uint     `json:"registration_id"`
+	Score          float64  `json:"score"`
+	Reasons        []string `json:"reasons"`
+}
+
+// Weights of the matching attributes. Registrations with different names
+// are never duplicates, twins share everything else. With the default
+// threshold of 0.6 the full name has to be backed by the birth date or the
+// parent phone, a name with a different patronymic by the birth date or by
+// both the phone and the school.
+const (
+	weightFullName  = 0.4
+	weightShortName = 0.3
+	weightBirthDate = 0.3
+	weightPhone     = 0.2
+	weightSchool    = 0.1
+)
+
+// Spelling variants that romanizations of the same Russian name differ in,
+// applied to the ICAO transliteration. Doubled letters are collapsed after,
+// so "iuliia" and "yulia" both become "iulia".
+var nameVariants = strings.NewReplacer(
+	"kh", "h",
+	"ts", "c", "tz", "c",
+	"shch", "sh",
+	"x", "ks",
+	"y", "i", "j", "i",
+	"w", "v",
+)
+
+// nameKey reduces a name to a form that is the same for Cyrillic and
+// transliterated spellings, e.g. "Юлия" and "Yulia"
+func nameKey(name string) string {
+	name = strings.ToLower(strings.ReplaceAll(name, "ё", "е"))
+	name = translit.ICAO(name)
+
+	var b strings.Builder
+	for _, r := range name {
+		if r >= 'a' && r <= 'z' {
+			b.WriteRune(r)
+		}
+	}
+	key := nameVariants.Replace(b.String())
+
+	var collapsed []rune
+	for _, r := range key {
+		if len(collapsed) == 0 || collapsed[len(collapsed)-1] != r {
+			collapsed = append(collapsed, r)
+		}
+	}
+	return string(collapsed)
+}
+
+// phoneKey keeps only the digits, with the Russian trunk prefix 8 replaced
+// by the country code
+func phoneKey(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	digits := b.String()
+	if len(digits) == 11 && digits[0] == '8' {
+		digits = "7" + digits[1:]
+	}
+	return digits
+}
+
+// schoolKey drops quotes, punctuation and case, "Школа №57" matches "школа 57"
+func schoolKey(school string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(school) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func sameDate(a, b time.Time) bool {
+	ay, am, ad := a.UTC().Date()
+	by, bm, bd := b.UTC().Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// sameFirstName compares the first names whatever the script they are
+// spelled in
+func sameFirstName(a, b *RegistrationData) bool {
+	return nameKey(a.FirstName) != "" && nameKey(a.FirstName) == nameKey(b.FirstName)
+}
+
+// matchScore compares two registrations and explains the score. Without a
+// matching name the score is zero, siblings share the other attributes.
+func matchScore(a, b *RegistrationData) (float64, []string) {
+	var (
+		score   float64
+		reasons []string
+	)
+
+	if !sameFirstName(a, b) || nameKey(a.LastName) == "" || nameKey(a.LastName) != nameKey(b.LastName) {
+		return 0, nil
+	}
+
+	if nameKey(a.Patronymic) == nameKey(b.Patronymic) {
+		score += weightFullName
+		reasons = append(reasons, "full_name")
+	} else {
+		score += weightShortName
+		reasons = append(reasons, "name")
+	}
+
+	if sameDate(a.BirthDate, b.BirthDate) {
+		score += weightBirthDate
+		reasons = append(reasons, "birth_date")
+	}
+
+	if phoneKey(a.ParentPhone) != "" && phoneKey(a.ParentPhone) == phoneKey(b.ParentPhone) {
+		score += weightPhone
+		reasons = append(reasons, "parent_phone")
+	}
+
+	if schoolKey(a.OldSchool) != "" && schoolKey(a.OldSchool) == schoolKey(b.OldSchool) {
+		score += weightSchool
+		reasons = append(reasons, "old_school")
+	}
+
+	return score, reasons
+}
+
+// findDuplicates scores the candidates against the registration and returns
+// those above the threshold, best matches first
+func findDuplicates(regData *RegistrationData, candidates []*RegistrationData) []*DuplicateCandidate {
+	threshold := viper.GetFloat64("regdata.duplicates.threshold")
+
+	duplicates := []*DuplicateCandidate{}
+	for _, candidate := range candidates {
+		if candidate.ID == regData.ID {
+			continue
+		}
+
+		score, reasons := matchScore(regData, candidate)
+		if score < threshold {
+			continue
+		}
+
+		duplicates = append(duplicates, &DuplicateCandidate{
+			RegistrationID: candidate.ID,
+			// Rounded so that the sum of the weights reads well
+			Score:   float64(int(score*100+0.5)) / 100,
+			Reasons: reasons,
+		})
+	}
+
+	sort.SliceStable(duplicates, func(i, j int) bool {
+		return duplicates[i].Score > duplicates[j].Score
+	})
+
+	return duplicates
+}
+
+// FindDuplicates lists registrations that probably belong to the same
+// applicant. Only registrations sharing the birth date or the parent phone
+// are considered, and of those only the ones with the same name.
+func (s *RegistrationDataServiceImpl) FindDuplicates(ctx context.Context, id uint) ([]*DuplicateCandidate, error) {
+	regData, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates, err := s.repo.GetByBirthDatesOrPhones(ctx, []time.Time{regData.BirthDate}, []string{regData.ParentPhone})
+	if err != nil {
+		return nil, err
+	}
+
+	return findDuplicates(regData, candidates), nil
+}
+
+// markDuplicates fills in the suspected duplicates of every registration
+func (s *RegistrationDataServiceImpl) markDuplicates(ctx context.Context, registrations []*RegistrationData) error {
+	if len(registrations) == 0 {
+		return nil
+	}
+
+	birthDates := make([]time.Time, 0, len(registrations))
+	phones := make([]string, 0, len(registrations))
+	for _, regData := range registrations {
+		birthDates = append(birthDates, regData.BirthDate)
+		phones = append(phones, regData.ParentPhone)
+	}
+
+	candidates, err := s.repo.GetByBirthDatesOrPhones(ctx, birthDates, phones)
+	if err != nil {
+		return err
+	}
+
+	for _, regData := range registrations {
+		regData.Duplicates = findDuplicates(regData, candidates)
+	}
+
+	return nil
+}
+
+// Merge folds the duplicate into the kept registration. Details the kept
+// registration lacks are copied over and the duplicate is closed with a
+// reference to it. Only duplicates without a user account can be merged,
+// and only into a registration with the same first name, so that siblings
+// are not merged by mistake.
+func (s *RegistrationDataServiceImpl) Merge(ctx context.Context, keepID, duplicateID uint, actorID uint) (*RegistrationData, error) {
+	if keepID == duplicateID {
+		return nil, errors.Join(ErrCannotMerge, errors.New("registration cannot be merged into itself"))
+	}
+
+	kept, err := s.repo.GetByID(ctx, keepID)
+	if err != nil {
+		return nil, err
+	}
+	duplicate, err := s.repo.GetByID(ctx, duplicateID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(editableStatuses, kept.Status) {
+		return nil, errors.Join(ErrCannotMerge, fmt.Errorf("kept registration is %s", kept.Status))
+	}
+	switch duplicate.Status {
+	case StatusSubmitted, StatusEmailVerified, StatusRejected:
+	default:
+		return nil, errors.Join(ErrCannotMerge, fmt.Errorf("duplicate registration is %s", duplicate.Status))
+	}
+	if !sameFirstName(kept, duplicate) {
+		return nil, errors.Join(ErrCannotMerge, errors.New("first names differ"))
+	}
+
+	var (
+		columns []string
+		changes []*RegistrationDataChange
+	)
+	fill := func(field string, target *string, value string) {
+		if *target != "" || value == "" {
+			return
+		}
+		*target = value
+		columns = append(columns, field)
+		changes = append(changes, &RegistrationDataChange{
+			RegistrationDataID: kept.ID,
+			ChangedByID:        actorID,
+			Field:              field,
+			NewValue:           value,
+		})
+	}
+	fill("patronymic", &kept.Patronymic, duplicate.Patronymic)
+	fill("parent_patronymic", &kept.ParentPatronymic, duplicate.ParentPatronymic)
+	fill("source", &kept.Source, duplicate.Source)
+
+	enable := func(field string, target *bool, value bool) {
+		if *target || !value {
+			return
+		}
+		*target = true
+		columns = append(columns, field)
+		changes = append(changes, &RegistrationDataChange{
+			RegistrationDataID: kept.ID,
+			ChangedByID:        actorID,
+			Field:              field,
+			OldValue:           "false",
+			NewValue:           "true",
+		})
+	}
+	enable("june_exam", &kept.JuneExam, duplicate.JuneExam)
+	enable("vmsh", &kept.VMSH, duplicate.VMSH)
+
+	changes = append(changes, &RegistrationDataChange{
+		RegistrationDataID: kept.ID,
+		ChangedByID:        actorID,
+		Field:              "merged_from",
+		NewValue:           fmt.Sprint(duplicate.ID),
+	})
+
+	if err := s.repo.Merge(ctx, kept, columns, changes, duplicate, actorID); err != nil {
+		return nil, err
+	}
+
+	return kept, nil
+}
@@ -0,0 +1,218 @@
+package regdata
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/users"
+	"github.com/L2SH-Dev/admissions/internal/validation"
+)
+
+var (
+	ErrFieldNotEditable = errors.New("field cannot be changed")
+	ErrEditingLocked    = errors.New("registration data cannot be changed after exams have started")
+)
+
+// Fields applicants may change themselves, keyed by their JSON names which
+// are also the column names
+var applicantEditableFields = []string{
+	"email",
+	"patronymic",
+	"old_school",
+	"parent_first_name",
+	"parent_last_name",
+	"parent_patronymic",
+	"parent_phone",
+}
+
+// Staff may also correct the data applicants cannot change themselves
+var adminEditableFields = append([]string{
+	"first_name",
+	"last_name",
+	"gender",
+	"birth_date",
+	"grade",
+	"june_exam",
+	"vmsh",
+	"source",
+}, applicantEditableFields...)
+
+// UpdateByApplicant changes the applicant's own registration. Editing is
+// locked once any of the applicant's exams has started, and changing the
+// email requires verifying it again.
+func (s *RegistrationDataServiceImpl) UpdateByApplicant(ctx context.Context, user *users.User, fields map[string]json.RawMessage) (*RegistrationData, []*RegistrationDataChange, error) {
+	regData, err := s.repo.GetByID(ctx, user.RegistrationDataID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !slices.Contains(editableStatuses, regData.Status) {
+		return nil, nil, ErrStatusNotEditable
+	}
+
+	locked, err := s.repo.HasStartedExams(ctx, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if locked {
+		return nil, nil, ErrEditingLocked
+	}
+
+	return s.update(ctx, user.RegistrationDataID, fields, applicantEditableFields, user.ID)
+}
+
+// UpdateByAdmin corrects a registration on behalf of the applicant, the
+// changes are recorded with the admin's user ID
+func (s *RegistrationDataServiceImpl) UpdateByAdmin(ctx context.Context, id uint, fields map[string]json.RawMessage, actorID uint) (*RegistrationData, []*RegistrationDataChange, error) {
+	return s.update(ctx, id, fields, adminEditableFields, actorID)
+}
+
+func (s *RegistrationDataServiceImpl) GetChanges(ctx context.Context, registrationID uint) ([]*RegistrationDataChange, error) {
+	return s.repo.GetChanges(ctx, registrationID)
+}
+
+// update applies the fields to the registration and records every value
+// that actually changed
+func (s *RegistrationDataServiceImpl) update(ctx context.Context, id uint, fields map[string]json.RawMessage, editable []string, actorID uint) (*RegistrationData, []*RegistrationDataChange, error) {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		if !slices.Contains(editable, name) {
+			return nil, nil, errors.Join(ErrFieldNotEditable, fmt.Errorf("field %q", name))
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	current, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	updated := *current
+	patch, err := json.Marshal(fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := json.Unmarshal(patch, &updated); err != nil {
+		return nil, nil, errors.Join(ErrRegistrationDataInvalid, err)
+	}
+
+	validator := validation.NewCustomValidator()
+	if err := validator.Validate(&updated); err != nil {
+		return nil, nil, errors.Join(ErrRegistrationDataInvalid, err)
+	}
+
+	before, err := jsonFields(current)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := jsonFields(&updated)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		columns []string
+		changes []*RegistrationDataChange
+	)
+	for _, name := range names {
+		if bytes.Equal(before[name], after[name]) {
+			continue
+		}
+
+		columns = append(columns, name)
+		changes = append(changes, &RegistrationDataChange{
+			RegistrationDataID: id,
+			ChangedByID:        actorID,
+			Field:              name,
+			OldValue:           displayValue(before[name]),
+			NewValue:           displayValue(after[name]),
+		})
+	}
+
+	if len(changes) == 0 {
+		return current, changes, nil
+	}
+
+	// A new email has to be verified again
+	if slices.Contains(columns, "email") && updated.EmailVerified {
+		updated.EmailVerified = false
+		columns = append(columns, "email_verified")
+		changes = append(changes, &RegistrationDataChange{
+			RegistrationDataID: id,
+			ChangedByID:        actorID,
+			Field:              "email_verified",
+			OldValue:           "true",
+			NewValue:           "false",
+		})
+	}
+
+	// A registration waiting for review was only there because of the old
+	// email, it goes back to waiting for verification along with the update
+	resetStatus := !updated.EmailVerified && updated.Status == StatusEmailVerified
+
+	err = s.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		repo := s.repo.WithTx(tx)
+		if err := repo.Update(ctx, &updated, columns, changes); err != nil {
+			return err
+		}
+		if !resetStatus {
+			return nil
+		}
+		return repo.UpdateStatus(ctx, &updated, StatusSubmitted, actorID)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if resetStatus {
+		changes = append(changes, &RegistrationDataChange{
+			RegistrationDataID: id,
+			ChangedByID:        actorID,
+			Field:              "status",
+			OldValue:           string(StatusEmailVerified),
+			NewValue:           string(StatusSubmitted),
+		})
+	}
+
+	return &updated, changes, nil
+}
+
+func jsonFields(data *RegistrationData) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+
+	return fields, nil
+}
+
+// displayValue unquotes strings so that the history reads naturally
+func displayValue(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+// EmailChanged reports whether the changes include a new email, which then
+// has to be verified
+func EmailChanged(changes []*RegistrationDataChange) bool {
+	for _, change := range changes {
+		if change.Field == "email" {
+			return true
+		}
+	}
+	return false
+}
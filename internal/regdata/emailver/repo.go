@@ -5,16 +5,20 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/L2SH-Dev/admissions/internal/datastore"
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 	"github.com/spf13/viper"
 )
 
 type EmailVerificationRepo interface {
-	CreateVerificationToken(registrationID uint) (string, error)
-	GetRegistrationIDByToken(token string) (uint, error)
-	DeleteToken(token string) error
+	CreateVerificationToken(ctx context.Context, registrationID uint) (string, error)
+	GetRegistrationIDByToken(ctx context.Context, token string) (uint, error)
+	DeleteToken(ctx context.Context, token string) error
+	AcquireCooldown(ctx context.Context, key string, cooldown time.Duration) (time.Duration, error)
+	AddAttempt(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error)
 }
 
 type EmailVerificationRepoImpl struct {
@@ -25,18 +29,33 @@ func NewEmailVerificationRepo(storage datastore.Storage) EmailVerificationRepo {
 	return &EmailVerificationRepoImpl{storage: storage}
 }
 
-func (r *EmailVerificationRepoImpl) CreateVerificationToken(registrationID uint) (string, error) {
+// CreateVerificationToken issues a new token for the registration. Only the
+// latest token is valid, the one issued before is deleted.
+func (r *EmailVerificationRepoImpl) CreateVerificationToken(ctx context.Context, registrationID uint) (string, error) {
 	token := uuid.New().String()
 	if token == "" {
 		return "", errors.New("failed to generate verification token")
 	}
-	err := r.storage.Cache().Set(
-		context.Background(),
-		fmt.Sprintf("email-token:%s", token),
-		registrationID,
-		viper.GetDuration("auth.email_verification.token_lifetime"),
-	).Err()
 
+	lifetime := viper.GetDuration("auth.email_verification.token_lifetime")
+
+	previous, err := r.storage.Cache().SetArgs(
+		ctx,
+		fmt.Sprintf("email-verification:%d", registrationID),
+		token,
+		redis.SetArgs{TTL: lifetime, Get: true},
+	).Result()
+	if err != nil && err != redis.Nil {
+		return "", errors.New("failed to cache verification token")
+	}
+
+	_, err = r.storage.Cache().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if previous != "" {
+			pipe.Del(ctx, fmt.Sprintf("email-token:%s", previous))
+		}
+		pipe.Set(ctx, fmt.Sprintf("email-token:%s", token), registrationID, lifetime)
+		return nil
+	})
 	if err != nil {
 		return "", errors.New("failed to cache verification token")
 	}
@@ -44,9 +63,9 @@ func (r *EmailVerificationRepoImpl) CreateVerificationToken(registrationID uint)
 	return token, nil
 }
 
-func (r *EmailVerificationRepoImpl) GetRegistrationIDByToken(token string) (uint, error) {
+func (r *EmailVerificationRepoImpl) GetRegistrationIDByToken(ctx context.Context, token string) (uint, error) {
 	registrationIDString, err := r.storage.Cache().Get(
-		context.Background(),
+		ctx,
 		fmt.Sprintf("email-token:%s", token),
 	).Result()
 	if err != nil {
@@ -61,9 +80,9 @@ func (r *EmailVerificationRepoImpl) GetRegistrationIDByToken(token string) (uint
 	return uint(registrationID), nil
 }
 
-func (r *EmailVerificationRepoImpl) DeleteToken(token string) error {
+func (r *EmailVerificationRepoImpl) DeleteToken(ctx context.Context, token string) error {
 	err := r.storage.Cache().Del(
-		context.Background(),
+		ctx,
 		fmt.Sprintf("email-token:%s", token),
 	).Err()
 	if err != nil {
@@ -72,3 +91,46 @@ func (r *EmailVerificationRepoImpl) DeleteToken(token string) error {
 
 	return nil
 }
+
+// AcquireCooldown holds the key for the cooldown. It returns zero if the key
+// was free, otherwise the time left until it is released.
+func (r *EmailVerificationRepoImpl) AcquireCooldown(ctx context.Context, key string, cooldown time.Duration) (time.Duration, error) {
+	cooldownKey := fmt.Sprintf("email-resend-cooldown:%s", key)
+
+	acquired, err := r.storage.Cache().SetNX(ctx, cooldownKey, 1, cooldown).Result()
+	if err != nil {
+		return 0, errors.Join(errors.New("failed to acquire resend cooldown"), err)
+	}
+	if acquired {
+		return 0, nil
+	}
+
+	ttl, err := r.storage.Cache().PTTL(ctx, cooldownKey).Result()
+	if err != nil {
+		return 0, errors.Join(errors.New("failed to get resend cooldown"), err)
+	}
+
+	return max(ttl, 0), nil
+}
+
+// AddAttempt counts an attempt in a window starting with the first one and
+// returns the count along with the time left in the window
+func (r *EmailVerificationRepoImpl) AddAttempt(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	attemptsKey := fmt.Sprintf("email-resend-attempts:%s", key)
+
+	var (
+		count *redis.IntCmd
+		ttl   *redis.DurationCmd
+	)
+	_, err := r.storage.Cache().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		count = pipe.Incr(ctx, attemptsKey)
+		pipe.ExpireNX(ctx, attemptsKey, window)
+		ttl = pipe.PTTL(ctx, attemptsKey)
+		return nil
+	})
+	if err != nil {
+		return 0, 0, errors.Join(errors.New("failed to count resend attempt"), err)
+	}
+
+	return count.Val(), max(ttl.Val(), 0), nil
+}
@@ -39,9 +39,10 @@ func setupTestRepo(t *testing.T) emailver.EmailVerificationRepo {
 }
 
 func TestCreateVerificationToken(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
-	token, err := repo.CreateVerificationToken(1)
+	token, err := repo.CreateVerificationToken(ctx, 1)
 	require.NoError(t, err)
 	assert.NotEmpty(t, token)
 
@@ -61,15 +62,15 @@ func TestGetRegistrationIDByToken(t *testing.T) {
 	ctx := context.Background()
 
 	// Test with invalid token
-	_, err := repo.GetRegistrationIDByToken("invalid-token")
+	_, err := repo.GetRegistrationIDByToken(ctx, "invalid-token")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid or expired token")
 
 	// Test with valid token
-	token, err := repo.CreateVerificationToken(1)
+	token, err := repo.CreateVerificationToken(ctx, 1)
 	require.NoError(t, err)
 
-	registrationID, err := repo.GetRegistrationIDByToken(token)
+	registrationID, err := repo.GetRegistrationIDByToken(ctx, token)
 	require.NoError(t, err)
 	assert.Equal(t, uint(1), registrationID)
 
@@ -77,7 +78,7 @@ func TestGetRegistrationIDByToken(t *testing.T) {
 	err = storage.Cache().Del(ctx, fmt.Sprintf("email-token:%s", token)).Err()
 	require.NoError(t, err)
 
-	_, err = repo.GetRegistrationIDByToken(token)
+	_, err = repo.GetRegistrationIDByToken(ctx, token)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid or expired token")
 }
@@ -87,11 +88,11 @@ func TestDeleteToken(t *testing.T) {
 	ctx := context.Background()
 
 	// Create and verify token exists
-	token, err := repo.CreateVerificationToken(1)
+	token, err := repo.CreateVerificationToken(ctx, 1)
 	require.NoError(t, err)
 
 	// Delete token
-	err = repo.DeleteToken(token)
+	err = repo.DeleteToken(ctx, token)
 	require.NoError(t, err)
 
 	// Verify deletion
@@ -100,6 +101,6 @@ func TestDeleteToken(t *testing.T) {
 	assert.Equal(t, int64(0), exists)
 
 	// Test deleting non-existent token
-	err = repo.DeleteToken("non-existent-token")
+	err = repo.DeleteToken(ctx, "non-existent-token")
 	assert.NoError(t, err) // Should not error when deleting non-existent key
 }
@@ -1,27 +1,40 @@
 package emailver
 
-import "github.com/L2SH-Dev/admissions/internal/mailing"
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/mailing"
+	"github.com/spf13/viper"
+)
 
 type EmailVerificationService interface {
-	SendVerificationEmail(email string, registrationID uint) error
-	VerifyEmail(token string) (uint, error)
+	SendVerificationEmail(ctx context.Context, email string, registrationID uint) error
+	VerifyEmail(ctx context.Context, token string) (uint, error)
+	CheckResend(ctx context.Context, email, ip string) (time.Duration, error)
 }
 
 type EmailVerificationServiceImpl struct {
-	repo EmailVerificationRepo
+	repo           EmailVerificationRepo
+	mailingService mailing.MailingService
 }
 
-func NewEmailVerificationService(repo EmailVerificationRepo) EmailVerificationService {
-	return &EmailVerificationServiceImpl{repo: repo}
+func NewEmailVerificationService(repo EmailVerificationRepo, mailingService mailing.MailingService) EmailVerificationService {
+	return &EmailVerificationServiceImpl{
+		repo:           repo,
+		mailingService: mailingService,
+	}
 }
 
-func (s *EmailVerificationServiceImpl) SendVerificationEmail(email string, registrationID uint) error {
-	token, err := s.repo.CreateVerificationToken(registrationID)
+func (s *EmailVerificationServiceImpl) SendVerificationEmail(ctx context.Context, email string, registrationID uint) error {
+	token, err := s.repo.CreateVerificationToken(ctx, registrationID)
 	if err != nil {
 		return err
 	}
 
-	err = mailing.SendVerificationEmail(email, token)
+	err = s.mailingService.SendVerificationEmail(ctx, email, token)
 	if err != nil {
 		return err
 	}
@@ -29,15 +42,32 @@ func (s *EmailVerificationServiceImpl) SendVerificationEmail(email string, regis
 	return nil
 }
 
-func (s *EmailVerificationServiceImpl) VerifyEmail(token string) (uint, error) {
-	registrationID, err := s.repo.GetRegistrationIDByToken(token)
+func (s *EmailVerificationServiceImpl) VerifyEmail(ctx context.Context, token string) (uint, error) {
+	registrationID, err := s.repo.GetRegistrationIDByToken(ctx, token)
 	if err != nil {
 		return 0, err
 	}
-	err = s.repo.DeleteToken(token)
+	err = s.repo.DeleteToken(ctx, token)
 	if err != nil {
 		return 0, err
 	}
 
 	return registrationID, nil
 }
+
+// CheckResend returns how long the caller has to wait before another
+// verification email can be requested, zero if it can be sent right away.
+// The limits apply whether or not the email is registered, so they do not
+// reveal it.
+func (s *EmailVerificationServiceImpl) CheckResend(ctx context.Context, email, ip string) (time.Duration, error) {
+	attempts, windowLeft, err := s.repo.AddAttempt(ctx, fmt.Sprintf("ip:%s", ip), viper.GetDuration("auth.email_verification.resend_window"))
+	if err != nil {
+		return 0, err
+	}
+	if attempts > viper.GetInt64("auth.email_verification.resend_limit") {
+		return windowLeft, nil
+	}
+
+	emailKey := fmt.Sprintf("email:%s", strings.ToLower(strings.TrimSpace(email)))
+	return s.repo.AcquireCooldown(ctx, emailKey, viper.GetDuration("auth.email_verification.resend_cooldown"))
+}
@@ -3,21 +3,29 @@ package emailver_test
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/L2SH-Dev/admissions/internal/mailing"
 	"github.com/L2SH-Dev/admissions/internal/regdata/emailver"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func setupTestService(t *testing.T) emailver.EmailVerificationService {
+func setupTestService(t *testing.T) (emailver.EmailVerificationService, string) {
 	t.Cleanup(func() {
 		err := storage.Flush()
 		assert.NoError(t, err)
 	})
 
+	mailbox := filepath.Join(t.TempDir(), "mail.mbox")
+	mailingService := mailing.NewMailingService(mailing.NewFileMailer(mailbox, "noreply@example.com"))
+
 	repo := emailver.NewEmailVerificationRepo(storage)
-	return emailver.NewEmailVerificationService(repo)
+	return emailver.NewEmailVerificationService(repo, mailingService), mailbox
 }
 
 func getTokenFromRedis(t *testing.T, registrationID uint) string {
@@ -35,26 +43,34 @@ func getTokenFromRedis(t *testing.T, registrationID uint) string {
 }
 
 func TestSendVerificationEmail(t *testing.T) {
-	service := setupTestService(t)
+	ctx := context.Background()
+	service, mailbox := setupTestService(t)
 
-	err := service.SendVerificationEmail("test@example.com", 1)
+	err := service.SendVerificationEmail(ctx, "test@example.com", 1)
 	assert.NoError(t, err)
 
 	// Verify token was stored in Redis
 	token := getTokenFromRedis(t, 1)
 	assert.NotEmpty(t, token)
+
+	// Verify the email with the token was sent
+	mail, err := os.ReadFile(mailbox)
+	require.NoError(t, err)
+	assert.Contains(t, string(mail), "To: test@example.com")
+	assert.Contains(t, string(mail), token)
 }
 
 func TestVerifyEmail(t *testing.T) {
-	service := setupTestService(t)
+	ctx := context.Background()
+	service, _ := setupTestService(t)
 
 	// Create verification token
-	err := service.SendVerificationEmail("test@example.com", 1)
+	err := service.SendVerificationEmail(ctx, "test@example.com", 1)
 	require.NoError(t, err)
 	token := getTokenFromRedis(t, 1)
 
 	// Test verification with valid token
-	registrationID, err := service.VerifyEmail(token)
+	registrationID, err := service.VerifyEmail(ctx, token)
 	require.NoError(t, err)
 	assert.Equal(t, uint(1), registrationID)
 
@@ -64,6 +80,57 @@ func TestVerifyEmail(t *testing.T) {
 	assert.Equal(t, int64(0), exists)
 
 	// Test verification with invalid token
-	_, err = service.VerifyEmail("invalid-token")
+	_, err = service.VerifyEmail(ctx, "invalid-token")
 	assert.Error(t, err)
 }
+
+func TestResendInvalidatesPreviousToken(t *testing.T) {
+	ctx := context.Background()
+	service, _ := setupTestService(t)
+
+	require.NoError(t, service.SendVerificationEmail(ctx, "test@example.com", 1))
+	firstToken := getTokenFromRedis(t, 1)
+
+	require.NoError(t, service.SendVerificationEmail(ctx, "test@example.com", 1))
+	secondToken := getTokenFromRedis(t, 1)
+	assert.NotEqual(t, firstToken, secondToken)
+
+	_, err := service.VerifyEmail(ctx, firstToken)
+	assert.Error(t, err)
+
+	registrationID, err := service.VerifyEmail(ctx, secondToken)
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), registrationID)
+}
+
+func TestCheckResend(t *testing.T) {
+	ctx := context.Background()
+	service, _ := setupTestService(t)
+
+	viper.Set("auth.email_verification.resend_cooldown", "1m")
+	viper.Set("auth.email_verification.resend_limit", 3)
+	viper.Set("auth.email_verification.resend_window", "1h")
+
+	retryAfter, err := service.CheckResend(ctx, "test@example.com", "127.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+
+	// Same email, case does not matter
+	retryAfter, err = service.CheckResend(ctx, "Test@Example.com", "127.0.0.2")
+	require.NoError(t, err)
+	assert.Greater(t, retryAfter, time.Duration(0))
+	assert.LessOrEqual(t, retryAfter, time.Minute)
+
+	// Other emails from the same IP until the limit is reached
+	retryAfter, err = service.CheckResend(ctx, "other@example.com", "127.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+
+	retryAfter, err = service.CheckResend(ctx, "third@example.com", "127.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+
+	retryAfter, err = service.CheckResend(ctx, "fourth@example.com", "127.0.0.1")
+	require.NoError(t, err)
+	assert.Greater(t, retryAfter, time.Minute)
+}
@@ -0,0 +1,66 @@
+package regdata
+
+import (
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/listing"
+	"gorm.io/gorm"
+)
+
+// Columns the admin lists can be sorted by
+var sortableColumns = []string{
+	"id",
+	"created_at",
+	"status_changed_at",
+	"last_name",
+	"first_name",
+	"birth_date",
+	"grade",
+	"old_school",
+}
+
+// RegistrationFilter narrows down the admin lists, zero values match
+// everything. Text filters are case insensitive substrings, the search
+// looks at the names and the email.
+type RegistrationFilter struct {
+	Statuses      []Status
+	Grade         uint
+	EmailVerified *bool
+	CreatedFrom   time.Time
+	CreatedTo     time.Time
+	School        string
+	Source        string
+	Search        string
+}
+
+func (f *RegistrationFilter) apply(query *gorm.DB) *gorm.DB {
+	if len(f.Statuses) > 0 {
+		query = query.Where("status IN ?", f.Statuses)
+	}
+	if f.Grade != 0 {
+		query = query.Where("grade = ?", f.Grade)
+	}
+	if f.EmailVerified != nil {
+		query = query.Where("email_verified = ?", *f.EmailVerified)
+	}
+	if !f.CreatedFrom.IsZero() {
+		query = query.Where("created_at >= ?", f.CreatedFrom)
+	}
+	if !f.CreatedTo.IsZero() {
+		query = query.Where("created_at < ?", f.CreatedTo)
+	}
+	if f.School != "" {
+		query = query.Where("old_school ILIKE ?", listing.Contains(f.School))
+	}
+	if f.Source != "" {
+		query = query.Where("source ILIKE ?", listing.Contains(f.Source))
+	}
+	if f.Search != "" {
+		pattern := listing.Contains(f.Search)
+		query = query.Where(
+			"last_name ILIKE ? OR first_name ILIKE ? OR patronymic ILIKE ? OR email ILIKE ?",
+			pattern, pattern, pattern, pattern,
+		)
+	}
+	return query
+}
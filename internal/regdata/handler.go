@@ -2,14 +2,21 @@ package regdata
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 	_ "time/tzdata"
 
+	"github.com/L2SH-Dev/admissions/internal/audit"
 	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/listing"
 	"github.com/L2SH-Dev/admissions/internal/mailing"
 	"github.com/L2SH-Dev/admissions/internal/regdata/emailver"
 	"github.com/L2SH-Dev/admissions/internal/server"
@@ -19,32 +26,49 @@ import (
 	"github.com/L2SH-Dev/admissions/internal/users/roles"
 	"github.com/labstack/echo/v4"
 	"github.com/spf13/viper"
+	"gorm.io/gorm"
 )
 
 type RegistrationDataHandler interface {
 	server.Handler
 	Register(c echo.Context) error
 	VerifyEmail(c echo.Context) error
+	ResendVerification(c echo.Context) error
 
 	// Private endpoints
 	GetMine(c echo.Context) error
+	UpdateMine(c echo.Context) error
+	WithdrawMine(c echo.Context) error
+	GetMyChanges(c echo.Context) error
 
 	// Admin endpoints
 	Accept(c echo.Context) error
 	Reject(c echo.Context) error
+	RevertRejection(c echo.Context) error
 	ListPending(c echo.Context) error
+	Update(c echo.Context) error
+	ListChanges(c echo.Context) error
+	ChangeStatus(c echo.Context) error
+	ListByStatus(c echo.Context) error
+	ListStatuses(c echo.Context) error
+	ListDuplicates(c echo.Context) error
+	Merge(c echo.Context) error
 }
 
 type RegistrationDataHandlerImpl struct {
+	storage                  datastore.Storage
 	service                  RegistrationDataService
 	emailVerificationService emailver.EmailVerificationService
 	usersService             users.UsersService
 	authService              auth.AuthService
+	auditService             audit.AuditService
 }
 
 func NewRegistrationDataHandler(storage datastore.Storage) server.Handler {
+	mailingService := mailing.NewMailingService(mailing.NewOutboxMailer(mailing.NewOutboxRepo(storage)))
+
 	emailVerRepo := emailver.NewEmailVerificationRepo(storage)
-	emailVerService := emailver.NewEmailVerificationService(emailVerRepo)
+	emailVerService := emailver.NewEmailVerificationService(emailVerRepo, mailingService)
 
 	rolesRepo := roles.NewRolesRepo(storage)
 	rolesService := roles.NewRolesService(rolesRepo)
@@ -57,13 +81,15 @@ func NewRegistrationDataHandler(storage datastore.Storage) server.Handler {
 	authService := auth.NewAuthService(authRepo, passwordsService)
 
 	repo := NewRegistrationDataRepo(storage)
-	service := NewRegistrationDataService(repo, usersService, authService, passwordsService)
+	service := NewRegistrationDataService(storage, repo, usersService, authService, passwordsService, mailingService)
 
 	return &RegistrationDataHandlerImpl{
+		storage:                  storage,
 		service:                  service,
 		emailVerificationService: emailVerService,
 		usersService:             usersService,
 		authService:              authService,
+		auditService:             audit.NewAuditService(audit.NewAuditRepo(storage)),
 	}
 }
 
@@ -71,6 +97,7 @@ func (h *RegistrationDataHandlerImpl) AddRoutes(g *echo.Group) {
 	regDataGroup := g.Group("/regdata")
 	regDataGroup.POST("", h.Register)
 	regDataGroup.GET("/verify", h.VerifyEmail)
+	regDataGroup.POST("/verify/resend", h.ResendVerification)
 
 	// Private endpoints
 	privateGroup := regDataGroup.Group("")
@@ -81,19 +108,35 @@ func (h *RegistrationDataHandlerImpl) AddRoutes(g *echo.Group) {
 	usersMiddlewareService.AddUserPreloadMiddleware(privateGroup)
 
 	privateGroup.GET("/mine", h.GetMine)
+	privateGroup.PATCH("/mine", h.UpdateMine)
+	privateGroup.GET("/mine/changes", h.GetMyChanges)
+	privateGroup.POST("/mine/withdraw", h.WithdrawMine)
 
 	// Admin endpoints
 	adminGroup := privateGroup.Group("/admin")
-	usersMiddlewareService.AddAdminMiddleware(adminGroup, roles.Role{WriteGeneral: true})
-
-	adminGroup.POST("/accept/:id", h.Accept)
-	adminGroup.POST("/reject/:id", h.Reject)
-	adminGroup.GET("/pending", h.ListPending)
-	adminGroup.GET("/accepted", h.ListAccepted)
-	adminGroup.GET("/accepted/download", h.DownloadAcceptedRegistrations)
+	usersMiddlewareService.AddAdminMiddleware(adminGroup)
+
+	canRead := usersMiddlewareService.RequirePermission(roles.PermissionRegDataRead)
+	canAccept := usersMiddlewareService.RequirePermission(roles.PermissionRegDataAccept)
+
+	adminGroup.POST("/accept/:id", h.Accept, canAccept)
+	adminGroup.POST("/reject/:id", h.Reject, canAccept)
+	adminGroup.POST("/reject/:id/revert", h.RevertRejection, canAccept)
+	adminGroup.GET("/pending", h.ListPending, canRead)
+	adminGroup.PATCH("/:id", h.Update, canAccept)
+	adminGroup.GET("/:id/changes", h.ListChanges, canRead)
+	adminGroup.GET("/:id/duplicates", h.ListDuplicates, canRead)
+	adminGroup.POST("/:id/merge", h.Merge, canAccept)
+	adminGroup.POST("/:id/status", h.ChangeStatus, canAccept)
+	adminGroup.GET("/list", h.ListByStatus, canRead)
+	adminGroup.GET("/statuses", h.ListStatuses, canRead)
+	adminGroup.GET("/accepted", h.ListAccepted, canRead)
+	adminGroup.GET("/accepted/download", h.DownloadAcceptedRegistrations, canRead)
 }
 
 func (h *RegistrationDataHandlerImpl) Register(c echo.Context) error {
+	ctx := c.Request().Context()
+
 	data := new(RegistrationData)
 	if err := c.Bind(data); err != nil {
 		return err
@@ -103,7 +146,10 @@ func (h *RegistrationDataHandlerImpl) Register(c echo.Context) error {
 		return err
 	}
 
-	err := h.service.Create(data)
+	// Applicants verify their email by the link, whatever the body says
+	data.EmailVerified = false
+
+	err := h.service.Create(ctx, data)
 	if err != nil && errors.Is(err, ErrRegistrationDataInvalid) {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	} else if err != nil && errors.Is(err, ErrRegistrationDataExists) {
@@ -112,7 +158,7 @@ func (h *RegistrationDataHandlerImpl) Register(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
-	err = h.emailVerificationService.SendVerificationEmail(data.Email, data.ID)
+	err = h.emailVerificationService.SendVerificationEmail(ctx, data.Email, data.ID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -121,17 +167,19 @@ func (h *RegistrationDataHandlerImpl) Register(c echo.Context) error {
 }
 
 func (h *RegistrationDataHandlerImpl) VerifyEmail(c echo.Context) error {
+	ctx := c.Request().Context()
+
 	verificationToken := c.QueryParam("token")
 	if verificationToken == "" {
 		return echo.NewHTTPError(http.StatusBadRequest, "verification token is required")
 	}
 
-	registrationID, err := h.emailVerificationService.VerifyEmail(verificationToken)
+	registrationID, err := h.emailVerificationService.VerifyEmail(ctx, verificationToken)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	err = h.service.SetEmailVerified(registrationID)
+	err = h.service.SetEmailVerified(ctx, registrationID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -139,9 +187,50 @@ func (h *RegistrationDataHandlerImpl) VerifyEmail(c echo.Context) error {
 	return c.JSON(http.StatusOK, map[string]bool{"verified": true})
 }
 
+func (h *RegistrationDataHandlerImpl) ResendVerification(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	resendRequest := new(struct {
+		Email string `json:"email" validate:"required,email"`
+	})
+
+	if err := c.Bind(resendRequest); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(resendRequest); err != nil {
+		return err
+	}
+
+	retryAfter, err := h.emailVerificationService.CheckResend(ctx, resendRequest.Email, c.RealIP())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if retryAfter > 0 {
+		c.Response().Header().Set(echo.HeaderRetryAfter, server.RetryAfterSeconds(retryAfter))
+		return echo.NewHTTPError(http.StatusTooManyRequests, "too many requests, try again later")
+	}
+
+	registrations, err := h.service.GetUnverifiedByEmail(ctx, resendRequest.Email)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	// Siblings may share the parent's email, every registration gets its own link
+	for _, regData := range registrations {
+		err := h.emailVerificationService.SendVerificationEmail(ctx, regData.Email, regData.ID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to resend verification email", slog.Any("registration_id", regData.ID), slog.Any("err", err))
+		}
+	}
+
+	// Respond the same way whether the email is known or not
+	return c.NoContent(http.StatusAccepted)
+}
+
 func (h *RegistrationDataHandlerImpl) GetMine(c echo.Context) error {
 	user := c.Get("currentUser").(*users.User)
-	regData, err := h.service.GetByID(user.RegistrationDataID)
+	regData, err := h.service.GetByID(c.Request().Context(), user.RegistrationDataID)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -149,22 +238,112 @@ func (h *RegistrationDataHandlerImpl) GetMine(c echo.Context) error {
 	return c.JSON(http.StatusOK, regData)
 }
 
+func (h *RegistrationDataHandlerImpl) UpdateMine(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	user := c.Get("currentUser").(*users.User)
+
+	var fields map[string]json.RawMessage
+	if err := c.Bind(&fields); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	regData, changes, err := h.service.UpdateByApplicant(ctx, user, fields)
+	if err != nil {
+		return updateError(err)
+	}
+
+	if EmailChanged(changes) {
+		err = h.emailVerificationService.SendVerificationEmail(ctx, regData.Email, regData.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	return c.JSON(http.StatusOK, regData)
+}
+
+func (h *RegistrationDataHandlerImpl) WithdrawMine(c echo.Context) error {
+	user := c.Get("currentUser").(*users.User)
+	regData, err := h.service.ChangeStatus(c.Request().Context(), user.RegistrationDataID, StatusWithdrawn, user.ID)
+	if err != nil {
+		return statusError(err)
+	}
+
+	return c.JSON(http.StatusOK, regData)
+}
+
+func (h *RegistrationDataHandlerImpl) GetMyChanges(c echo.Context) error {
+	user := c.Get("currentUser").(*users.User)
+	changes, err := h.service.GetChanges(c.Request().Context(), user.RegistrationDataID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, changes)
+}
+
+func statusError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "registration data not found")
+	case errors.Is(err, ErrStatusTransition), errors.Is(err, ErrStatusOutOfSync), errors.Is(err, ErrCannotMerge):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+}
+
+func updateError(err error) error {
+	switch {
+	case errors.Is(err, ErrFieldNotEditable), errors.Is(err, ErrRegistrationDataInvalid):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrEditingLocked), errors.Is(err, ErrStatusNotEditable):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+}
+
 func (h *RegistrationDataHandlerImpl) Accept(c echo.Context) error {
+	ctx := c.Request().Context()
+
 	regDataID64, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid registration data ID")
 	}
 	regDataID := uint(regDataID64)
 
-	user, err := h.service.Accept(regDataID)
+	admin := c.Get("currentUser").(*users.User)
+
+	var user *users.User
+	err = h.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		var err error
+		user, err = h.service.WithTx(tx).Accept(ctx, regDataID, admin.ID)
+		if err != nil {
+			return err
+		}
+
+		return h.auditService.WithTx(tx).Log(c, audit.Event{
+			Action:     audit.ActionRegDataAccept,
+			TargetType: audit.TargetRegistration,
+			TargetID:   regDataID,
+			Diff: map[string]audit.Change{
+				"status": {Old: StatusEmailVerified, New: StatusAccepted},
+				"login":  {New: user.Login},
+			},
+		})
+	})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return statusError(err)
 	}
 
 	return c.JSON(http.StatusCreated, user)
 }
 
 func (h *RegistrationDataHandlerImpl) Reject(c echo.Context) error {
+	ctx := c.Request().Context()
+
 	regDataID64, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "invalid registration data ID")
@@ -183,43 +362,350 @@ func (h *RegistrationDataHandlerImpl) Reject(c echo.Context) error {
 		return err
 	}
 
-	regData, err := h.service.GetByID(regDataID)
+	before, err := h.service.GetByID(ctx, regDataID)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return statusError(err)
 	}
-	email := regData.Email
 
-	err = h.service.Reject(regDataID)
+	admin := c.Get("currentUser").(*users.User)
+	err = h.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		if err := h.service.WithTx(tx).Reject(ctx, regDataID, rejectRequest.Reason, admin.ID); err != nil {
+			return err
+		}
+
+		return h.auditService.WithTx(tx).Log(c, audit.Event{
+			Action:     audit.ActionRegDataReject,
+			TargetType: audit.TargetRegistration,
+			TargetID:   regDataID,
+			Diff: map[string]audit.Change{
+				"status":           {Old: before.Status, New: StatusRejected},
+				"rejection_reason": {Old: before.RejectionReason, New: rejectRequest.Reason},
+			},
+		})
+	})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return statusError(err)
 	}
 
-	err = mailing.SendRegistrationRejection(email, rejectRequest.Reason)
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *RegistrationDataHandlerImpl) RevertRejection(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	regDataID64, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid registration data ID")
 	}
 
-	return c.NoContent(http.StatusNoContent)
+	admin := c.Get("currentUser").(*users.User)
+
+	var regData *RegistrationData
+	err = h.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		var err error
+		regData, err = h.service.WithTx(tx).RevertRejection(ctx, uint(regDataID64), admin.ID)
+		if err != nil {
+			return err
+		}
+
+		return h.auditService.WithTx(tx).Log(c, audit.Event{
+			Action:     audit.ActionRegDataRevertRejection,
+			TargetType: audit.TargetRegistration,
+			TargetID:   regData.ID,
+			Diff: map[string]audit.Change{
+				"status": {Old: StatusRejected, New: regData.Status},
+			},
+		})
+	})
+	if err != nil {
+		return statusError(err)
+	}
+
+	return c.JSON(http.StatusOK, regData)
 }
 
-func (h *RegistrationDataHandlerImpl) ListPending(c echo.Context) error {
-	registrations, err := h.service.GetPending()
+func (h *RegistrationDataHandlerImpl) Update(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	regDataID64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid registration data ID")
+	}
+	regDataID := uint(regDataID64)
+
+	var fields map[string]json.RawMessage
+	if err := c.Bind(&fields); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	admin := c.Get("currentUser").(*users.User)
+
+	var (
+		regData *RegistrationData
+		changes []*RegistrationDataChange
+	)
+	err = h.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		var err error
+		regData, changes, err = h.service.WithTx(tx).UpdateByAdmin(ctx, regDataID, fields, admin.ID)
+		if err != nil || len(changes) == 0 {
+			return err
+		}
+
+		diff := make(map[string]audit.Change, len(changes))
+		for _, change := range changes {
+			diff[change.Field] = audit.Change{Old: change.OldValue, New: change.NewValue}
+		}
+
+		return h.auditService.WithTx(tx).Log(c, audit.Event{
+			Action:     audit.ActionRegDataUpdate,
+			TargetType: audit.TargetRegistration,
+			TargetID:   regDataID,
+			Diff:       diff,
+		})
+	})
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "registration data not found")
+	} else if err != nil {
+		return updateError(err)
+	}
+
+	if EmailChanged(changes) {
+		err = h.emailVerificationService.SendVerificationEmail(ctx, regData.Email, regData.ID)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	return c.JSON(http.StatusOK, regData)
+}
+
+func (h *RegistrationDataHandlerImpl) ListChanges(c echo.Context) error {
+	regDataID64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid registration data ID")
+	}
+
+	changes, err := h.service.GetChanges(c.Request().Context(), uint(regDataID64))
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
-	return c.JSON(http.StatusOK, registrations)
+
+	return c.JSON(http.StatusOK, changes)
 }
 
-func (h *RegistrationDataHandlerImpl) ListAccepted(c echo.Context) error {
-	registrations, err := h.service.GetAccepted()
+func (h *RegistrationDataHandlerImpl) ListDuplicates(c echo.Context) error {
+	regDataID64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid registration data ID")
+	}
+
+	duplicates, err := h.service.FindDuplicates(c.Request().Context(), uint(regDataID64))
+	if err != nil {
+		return statusError(err)
+	}
+
+	return c.JSON(http.StatusOK, duplicates)
+}
+
+// Merge folds the duplicate from the request body into the registration
+func (h *RegistrationDataHandlerImpl) Merge(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	regDataID64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid registration data ID")
+	}
+
+	mergeRequest := new(struct {
+		DuplicateID uint `json:"duplicate_id" validate:"required"`
+	})
+
+	if err := c.Bind(mergeRequest); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(mergeRequest); err != nil {
+		return err
+	}
+
+	admin := c.Get("currentUser").(*users.User)
+
+	var regData *RegistrationData
+	err = h.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		var err error
+		regData, err = h.service.WithTx(tx).Merge(ctx, uint(regDataID64), mergeRequest.DuplicateID, admin.ID)
+		if err != nil {
+			return err
+		}
+
+		return h.auditService.WithTx(tx).Log(c, audit.Event{
+			Action:     audit.ActionRegDataMerge,
+			TargetType: audit.TargetRegistration,
+			TargetID:   regData.ID,
+			Diff: map[string]audit.Change{
+				"merged_from": {New: mergeRequest.DuplicateID},
+			},
+		})
+	})
+	if err != nil {
+		return statusError(err)
+	}
+
+	return c.JSON(http.StatusOK, regData)
+}
+
+func (h *RegistrationDataHandlerImpl) ChangeStatus(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	regDataID64, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid registration data ID")
+	}
+
+	statusRequest := new(struct {
+		Status string `json:"status" validate:"required"`
+	})
+
+	if err := c.Bind(statusRequest); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(statusRequest); err != nil {
+		return err
+	}
+
+	status, err := ParseStatus(statusRequest.Status)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	before, err := h.service.GetByID(ctx, uint(regDataID64))
+	if err != nil {
+		return statusError(err)
+	}
+
+	admin := c.Get("currentUser").(*users.User)
+
+	var regData *RegistrationData
+	err = h.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		var err error
+		regData, err = h.service.WithTx(tx).ChangeStatus(ctx, uint(regDataID64), status, admin.ID)
+		if err != nil {
+			return err
+		}
+
+		return h.auditService.WithTx(tx).Log(c, audit.Event{
+			Action:     audit.ActionRegDataChangeStatus,
+			TargetType: audit.TargetRegistration,
+			TargetID:   regData.ID,
+			Diff: map[string]audit.Change{
+				"status": {Old: before.Status, New: regData.Status},
+			},
+		})
+	})
+	if err != nil {
+		return statusError(err)
+	}
+
+	return c.JSON(http.StatusOK, regData)
+}
+
+// parseFilter reads the list filters from the query: status as a comma
+// separated list, grade, email_verified, created_from and created_to as
+// dates with the end inclusive, school, source and the q search
+func parseFilter(c echo.Context) (*RegistrationFilter, error) {
+	filter := &RegistrationFilter{
+		School: c.QueryParam("school"),
+		Source: c.QueryParam("source"),
+		Search: c.QueryParam("q"),
+	}
+
+	for _, value := range strings.Split(c.QueryParam("status"), ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+
+		status, err := ParseStatus(value)
+		if err != nil {
+			return nil, err
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+
+	var createdTo time.Time
+	err := echo.QueryParamsBinder(c).
+		Uint("grade", &filter.Grade).
+		Time("created_from", &filter.CreatedFrom, time.DateOnly).
+		Time("created_to", &createdTo, time.DateOnly).
+		BindError()
+	if err != nil {
+		return nil, err
+	}
+	if !createdTo.IsZero() {
+		filter.CreatedTo = createdTo.AddDate(0, 0, 1)
+	}
+
+	if value := c.QueryParam("email_verified"); value != "" {
+		verified, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid email_verified %q", value)
+		}
+		filter.EmailVerified = &verified
+	}
+
+	return filter, nil
+}
+
+// listRegistrations parses the filter and the page and writes the list
+// with the total count in the headers
+func (h *RegistrationDataHandlerImpl) listRegistrations(
+	c echo.Context,
+	defaultSort string,
+	list func(ctx context.Context, filter *RegistrationFilter, page listing.Page) ([]*RegistrationData, int64, error),
+) error {
+	filter, err := parseFilter(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	page, err := listing.ParsePage(c, sortableColumns, defaultSort)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	registrations, total, err := list(c.Request().Context(), filter, page)
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
+
+	listing.SetHeaders(c, page, total)
 	return c.JSON(http.StatusOK, registrations)
 }
 
+// ListByStatus lists registrations in any of the statuses given as a comma
+// separated status query parameter, or all of them if it is empty
+func (h *RegistrationDataHandlerImpl) ListByStatus(c echo.Context) error {
+	return h.listRegistrations(c, "-status_changed_at", h.service.List)
+}
+
+func (h *RegistrationDataHandlerImpl) ListStatuses(c echo.Context) error {
+	return c.JSON(http.StatusOK, Transitions())
+}
+
+// ListPending lists verified registrations awaiting review, oldest first
+func (h *RegistrationDataHandlerImpl) ListPending(c echo.Context) error {
+	return h.listRegistrations(c, "created_at", h.service.GetPending)
+}
+
+func (h *RegistrationDataHandlerImpl) ListAccepted(c echo.Context) error {
+	return h.listRegistrations(c, "-status_changed_at", func(ctx context.Context, filter *RegistrationFilter, page listing.Page) ([]*RegistrationData, int64, error) {
+		filter.Statuses = acceptedStatuses
+		return h.service.List(ctx, filter, page)
+	})
+}
+
 func (h *RegistrationDataHandlerImpl) DownloadAcceptedRegistrations(c echo.Context) error {
-	registrations, err := h.service.GetAccepted()
+	registrations, err := h.service.GetAccepted(c.Request().Context())
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
@@ -281,5 +767,15 @@ func (h *RegistrationDataHandlerImpl) DownloadAcceptedRegistrations(c echo.Conte
 	}
 	writer.Flush()
 
+	// Personal data is only handed out once the download is recorded
+	err = h.auditService.Log(c, audit.Event{
+		Action:     audit.ActionRegDataDownload,
+		TargetType: audit.TargetRegistration,
+		Diff:       map[string]int{"rows": len(registrations)},
+	})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
 	return c.Blob(http.StatusOK, "text/csv; charset=utf-8", csvData.Bytes())
 }
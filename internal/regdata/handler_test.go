@@ -2,6 +2,7 @@ package regdata_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,10 +10,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/L2SH-Dev/admissions/internal/audit"
+	"github.com/L2SH-Dev/admissions/internal/listing"
+	"github.com/L2SH-Dev/admissions/internal/migrations"
 	"github.com/L2SH-Dev/admissions/internal/regdata"
+	"github.com/L2SH-Dev/admissions/internal/users"
 	"github.com/L2SH-Dev/admissions/internal/users/roles"
 	"github.com/L2SH-Dev/admissions/internal/validation"
 	"github.com/labstack/echo/v4"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -23,11 +29,18 @@ var (
 )
 
 func setupTestHandler(t *testing.T) {
+	ctx := context.Background()
 	t.Cleanup(func() {
 		err := storage.Flush()
 		assert.NoError(t, err)
 	})
 
+	_, err := migrations.Up(storage.DB())
+	require.NoError(t, err)
+
+	viper.Set("server.pagination.default_limit", 50)
+	viper.Set("server.pagination.max_limit", 500)
+
 	e = echo.New()
 	validation.AddValidation(e)
 	h = regdata.NewRegistrationDataHandler(storage).(regdata.RegistrationDataHandler)
@@ -35,10 +48,16 @@ func setupTestHandler(t *testing.T) {
 	// Create default roles for testing
 	rolesRepo := roles.NewRolesRepo(storage)
 	rolesService := roles.NewRolesService(rolesRepo)
-	err := rolesService.CreateDefaultRoles()
+	err = rolesService.CreateDefaultRoles(ctx)
 	require.NoError(t, err)
 }
 
+func testAdmin() *users.User {
+	admin := &users.User{}
+	admin.ID = 1
+	return admin
+}
+
 func TestRegister(t *testing.T) {
 	setupTestHandler(t)
 
@@ -168,6 +187,7 @@ func TestAccept(t *testing.T) {
 	c = e.NewContext(req, rec)
 	c.SetParamNames("id")
 	c.SetParamValues(fmt.Sprint(respData.ID))
+	c.Set("currentUser", testAdmin())
 
 	err = h.Accept(c)
 	assert.Error(t, err)
@@ -179,6 +199,7 @@ func TestAccept(t *testing.T) {
 	c = e.NewContext(req, rec)
 	c.SetParamNames("id")
 	c.SetParamValues("999")
+	c.Set("currentUser", testAdmin())
 
 	err = h.Accept(c)
 	assert.Error(t, err)
@@ -195,6 +216,59 @@ func TestAccept(t *testing.T) {
 	assert.Contains(t, err.Error(), "invalid registration data ID")
 }
 
+func TestRejectAudited(t *testing.T) {
+	ctx := context.Background()
+	setupTestHandler(t)
+
+	data := regdata.RegistrationData{
+		Email:           "test@example.com",
+		FirstName:       "Test",
+		LastName:        "User",
+		Gender:          "M",
+		BirthDate:       time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		Grade:           9,
+		OldSchool:       "Previous School",
+		ParentFirstName: "Parent",
+		ParentLastName:  "Test",
+		ParentPhone:     "+1234567890",
+		EmailVerified:   true,
+	}
+
+	jsonData, err := json.Marshal(data)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/regdata", bytes.NewBuffer(jsonData))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	require.NoError(t, h.Register(c))
+
+	var respData regdata.RegistrationData
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &respData))
+
+	req = httptest.NewRequest(http.MethodPost, "/regdata/admin/reject", bytes.NewBufferString(`{"reason": "Неверный класс"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderXRealIP, "10.1.2.3")
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+	c.SetParamNames("id")
+	c.SetParamValues(fmt.Sprint(respData.ID))
+	c.Set("currentUser", testAdmin())
+	require.NoError(t, h.Reject(c))
+
+	entries, _, err := audit.NewAuditRepo(storage).List(ctx, &audit.Filter{TargetType: audit.TargetRegistration}, testPage)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, audit.ActionRegDataReject, entries[0].Action)
+	assert.Equal(t, testAdmin().ID, entries[0].ActorID)
+	assert.Equal(t, respData.ID, entries[0].TargetID)
+	assert.Equal(t, "10.1.2.3", entries[0].IP)
+	assert.JSONEq(t, `{
+		"status": {"old": "email_verified", "new": "rejected"},
+		"rejection_reason": {"old": "", "new": "Неверный класс"}
+	}`, string(entries[0].Diff))
+}
+
 func TestListPending(t *testing.T) {
 	setupTestHandler(t)
 
@@ -235,4 +309,21 @@ func TestListPending(t *testing.T) {
 	require.NoError(t, err)
 	assert.Len(t, registrations, 1)
 	assert.Equal(t, data.Email, registrations[0].Email)
+	assert.Equal(t, "1", rec.Header().Get(listing.HeaderTotalCount))
+
+	// Filters and pages
+	req = httptest.NewRequest(http.MethodGet, "/regdata/admin/pending?grade=10&q=user", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+
+	assert.NoError(t, h.ListPending(c))
+	assert.Equal(t, "0", rec.Header().Get(listing.HeaderTotalCount))
+
+	req = httptest.NewRequest(http.MethodGet, "/regdata/admin/pending?sort=password", nil)
+	rec = httptest.NewRecorder()
+	c = e.NewContext(req, rec)
+
+	err = h.ListPending(c)
+	require.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, err.(*echo.HTTPError).Code)
 }
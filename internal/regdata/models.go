@@ -11,6 +11,11 @@ type RegistrationData struct {
 	gorm.Model
 	Email            string     `json:"email" gorm:"not null" validate:"required,email"`
 	EmailVerified    bool       `json:"email_verified" gorm:"not null;default:false"`
+	Status           Status     `json:"status" gorm:"not null;default:submitted;index"`
+	StatusChangedAt  time.Time  `json:"status_changed_at"`
+	RejectionReason  string     `json:"rejection_reason,omitempty"`
+	RejectedByID     *uint      `json:"rejected_by_id,omitempty"`
+	RejectedAt       *time.Time `json:"rejected_at,omitempty"`
 	FirstName        string     `json:"first_name" gorm:"not null" validate:"required"`
 	LastName         string     `json:"last_name" gorm:"not null" validate:"required"`
 	Patronymic       string     `json:"patronymic"`
@@ -25,7 +30,22 @@ type RegistrationData struct {
 	JuneExam         bool       `json:"june_exam" gorm:"not null;default:false"`
 	VMSH             bool       `json:"vmsh" gorm:"not null;default:false"`
 	Source           string     `json:"source"`
+	MergedIntoID     *uint      `json:"merged_into_id,omitempty"`
 	User             users.User `json:"user" gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+
+	// Suspected duplicates, filled in for admins reviewing registrations
+	Duplicates []*DuplicateCandidate `json:"duplicates,omitempty" gorm:"-"`
+}
+
+// RegistrationDataChange records an edit of a single field and who made it.
+// Values are kept in their JSON form.
+type RegistrationDataChange struct {
+	gorm.Model
+	RegistrationDataID uint   `json:"registration_data_id" gorm:"index;not null"`
+	ChangedByID        uint   `json:"changed_by_id" gorm:"not null"`
+	Field              string `json:"field" gorm:"not null"`
+	OldValue           string `json:"old_value"`
+	NewValue           string `json:"new_value"`
 }
 
 func (r *RegistrationData) BeforeDelete(tx *gorm.DB) error {
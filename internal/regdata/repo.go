@@ -1,20 +1,33 @@
 package regdata
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/listing"
 	"gorm.io/gorm"
 )
 
 type RegistrationDataRepo interface {
-	Create(data *RegistrationData) error
-	Delete(id uint) error
-	GetByID(id uint) (*RegistrationData, error)
-	ExistsByEmailNameAndGrade(email, name string, grade uint) (bool, error)
-	SetEmailVerified(registrationID uint) error
-	GetPending() ([]*RegistrationData, error)
-	GetAccepted() ([]*RegistrationData, error)
+	Create(ctx context.Context, data *RegistrationData) error
+	Reject(ctx context.Context, data *RegistrationData, reason string, actorID uint) error
+	RevertRejection(ctx context.Context, data *RegistrationData, actorID uint) error
+	UpdateStatus(ctx context.Context, data *RegistrationData, to Status, actorID uint) error
+	List(ctx context.Context, filter *RegistrationFilter, page listing.Page) ([]*RegistrationData, int64, error)
+	GetByID(ctx context.Context, id uint) (*RegistrationData, error)
+	ExistsByEmailNameAndGrade(ctx context.Context, email, name string, grade uint) (bool, error)
+	SetEmailVerified(ctx context.Context, registrationID uint) error
+	Update(ctx context.Context, data *RegistrationData, columns []string, changes []*RegistrationDataChange) error
+	GetChanges(ctx context.Context, registrationID uint) ([]*RegistrationDataChange, error)
+	HasStartedExams(ctx context.Context, userID uint) (bool, error)
+	GetUnverifiedByEmail(ctx context.Context, email string) ([]*RegistrationData, error)
+	GetByBirthDatesOrPhones(ctx context.Context, birthDates []time.Time, phones []string) ([]*RegistrationData, error)
+	Merge(ctx context.Context, kept *RegistrationData, columns []string, changes []*RegistrationDataChange, duplicate *RegistrationData, actorID uint) error
+	GetAccepted(ctx context.Context) ([]*RegistrationData, error)
+	WithTx(tx datastore.Storage) RegistrationDataRepo
 }
 
 type RegistrationDataRepoImpl struct {
@@ -22,36 +35,146 @@ type RegistrationDataRepoImpl struct {
 }
 
 func NewRegistrationDataRepo(storage datastore.Storage) RegistrationDataRepo {
-	if err := storage.DB().AutoMigrate(&RegistrationData{}); err != nil {
-		panic(err)
-	}
 	return &RegistrationDataRepoImpl{storage: storage}
 }
 
-func (r *RegistrationDataRepoImpl) Create(data *RegistrationData) error {
-	err := r.storage.DB().Create(data).Error
+func (r *RegistrationDataRepoImpl) WithTx(tx datastore.Storage) RegistrationDataRepo {
+	return &RegistrationDataRepoImpl{storage: tx}
+}
+
+func (r *RegistrationDataRepoImpl) Create(ctx context.Context, data *RegistrationData) error {
+	err := r.storage.DB().WithContext(ctx).Create(data).Error
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Reject marks the registration as rejected along with the reason
+func (r *RegistrationDataRepoImpl) Reject(ctx context.Context, data *RegistrationData, reason string, actorID uint) error {
+	return r.storage.DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := updateStatus(tx, data, StatusRejected, actorID); err != nil {
+			return err
+		}
+
+		rejectedAt := data.StatusChangedAt
+		return setRejection(tx, data, reason, &actorID, &rejectedAt, actorID)
+	})
+}
+
+// RevertRejection takes the registration back to review, or to waiting for
+// verification if the email has not been verified yet
+func (r *RegistrationDataRepoImpl) RevertRejection(ctx context.Context, data *RegistrationData, actorID uint) error {
+	to := StatusSubmitted
+	if data.EmailVerified {
+		to = StatusEmailVerified
+	}
+
+	return r.storage.DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := updateStatus(tx, data, to, actorID); err != nil {
+			return err
+		}
+
+		return setRejection(tx, data, "", nil, nil, actorID)
+	})
+}
+
+// setRejection stores the rejection details, the reason also goes to the
+// history since it is cleared when a rejection is reverted
+func setRejection(tx *gorm.DB, data *RegistrationData, reason string, rejectedByID *uint, rejectedAt *time.Time, actorID uint) error {
+	err := tx.Model(&RegistrationData{}).
+		Where("id = ?", data.ID).
+		Updates(map[string]interface{}{
+			"rejection_reason": reason,
+			"rejected_by_id":   rejectedByID,
+			"rejected_at":      rejectedAt,
+		}).Error
 	if err != nil {
 		return err
 	}
 
+	if data.RejectionReason != reason {
+		err = tx.Create(&RegistrationDataChange{
+			RegistrationDataID: data.ID,
+			ChangedByID:        actorID,
+			Field:              "rejection_reason",
+			OldValue:           data.RejectionReason,
+			NewValue:           reason,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	data.RejectionReason = reason
+	data.RejectedByID = rejectedByID
+	data.RejectedAt = rejectedAt
 	return nil
 }
 
-func (r *RegistrationDataRepoImpl) Delete(id uint) error {
-	result := r.storage.DB().Delete(&RegistrationData{}, id)
+// UpdateStatus moves the registration to the status and records the
+// transition in its history. Whether the transition is allowed is up to the
+// caller.
+func (r *RegistrationDataRepoImpl) UpdateStatus(ctx context.Context, data *RegistrationData, to Status, actorID uint) error {
+	return r.storage.DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return updateStatus(tx, data, to, actorID)
+	})
+}
+
+func updateStatus(tx *gorm.DB, data *RegistrationData, to Status, actorID uint) error {
+	now := time.Now()
+
+	// Only change the status the caller has seen
+	result := tx.Model(&RegistrationData{}).
+		Where("id = ? AND status = ?", data.ID, data.Status).
+		Updates(map[string]interface{}{
+			"status":            to,
+			"status_changed_at": now,
+		})
 	if result.Error != nil {
 		return result.Error
 	}
 	if result.RowsAffected == 0 {
-		return errors.New("record not found")
+		return ErrStatusOutOfSync
 	}
 
+	err := tx.Create(&RegistrationDataChange{
+		RegistrationDataID: data.ID,
+		ChangedByID:        actorID,
+		Field:              "status",
+		OldValue:           string(data.Status),
+		NewValue:           string(to),
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	data.Status = to
+	data.StatusChangedAt = now
 	return nil
 }
 
-func (r *RegistrationDataRepoImpl) GetByID(id uint) (*RegistrationData, error) {
+// List returns one page of the registrations matching the filter and the
+// number of all matching registrations
+func (r *RegistrationDataRepoImpl) List(ctx context.Context, filter *RegistrationFilter, page listing.Page) ([]*RegistrationData, int64, error) {
+	query := filter.apply(r.storage.DB().WithContext(ctx).Model(&RegistrationData{}))
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var registrations []*RegistrationData
+	if err := page.Apply(query).Preload("User").Find(&registrations).Error; err != nil {
+		return nil, 0, err
+	}
+	return registrations, total, nil
+}
+
+func (r *RegistrationDataRepoImpl) GetByID(ctx context.Context, id uint) (*RegistrationData, error) {
 	var data RegistrationData
-	err := r.storage.DB().First(&data, id).Error
+	err := r.storage.DB().WithContext(ctx).First(&data, id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -59,9 +182,13 @@ func (r *RegistrationDataRepoImpl) GetByID(id uint) (*RegistrationData, error) {
 	return &data, nil
 }
 
-func (r *RegistrationDataRepoImpl) ExistsByEmailNameAndGrade(email, name string, grade uint) (bool, error) {
+func (r *RegistrationDataRepoImpl) ExistsByEmailNameAndGrade(ctx context.Context, email, name string, grade uint) (bool, error) {
 	var data RegistrationData
-	err := r.storage.DB().Where("email = ? AND first_name = ? AND grade = ?", email, name, grade).First(&data).Error
+	// A rejected applicant may register again
+	err := r.storage.DB().WithContext(ctx).
+		Where("email = ? AND first_name = ? AND grade = ?", email, name, grade).
+		Where("status <> ?", StatusRejected).
+		First(&data).Error
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
 		return false, nil
 	} else if err != nil {
@@ -71,8 +198,8 @@ func (r *RegistrationDataRepoImpl) ExistsByEmailNameAndGrade(email, name string,
 	return true, nil
 }
 
-func (r *RegistrationDataRepoImpl) SetEmailVerified(registrationID uint) error {
-	result := r.storage.DB().Model(&RegistrationData{}).Where("id = ?", registrationID).Update("email_verified", true)
+func (r *RegistrationDataRepoImpl) SetEmailVerified(ctx context.Context, registrationID uint) error {
+	result := r.storage.DB().WithContext(ctx).Model(&RegistrationData{}).Where("id = ?", registrationID).Update("email_verified", true)
 	if result.Error != nil {
 		return result.Error
 	}
@@ -83,12 +210,57 @@ func (r *RegistrationDataRepoImpl) SetEmailVerified(registrationID uint) error {
 	return nil
 }
 
-func (r *RegistrationDataRepoImpl) GetPending() ([]*RegistrationData, error) {
+// Update saves the given columns of the registration together with the
+// history entries describing the change
+func (r *RegistrationDataRepoImpl) Update(ctx context.Context, data *RegistrationData, columns []string, changes []*RegistrationDataChange) error {
+	return r.storage.DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(data).Select(columns).Updates(data)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errors.New("record not found")
+		}
+
+		if len(changes) == 0 {
+			return nil
+		}
+		return tx.Create(&changes).Error
+	})
+}
+
+func (r *RegistrationDataRepoImpl) GetChanges(ctx context.Context, registrationID uint) ([]*RegistrationDataChange, error) {
+	var changes []*RegistrationDataChange
+	err := r.storage.DB().WithContext(ctx).
+		Where("registration_data_id = ?", registrationID).
+		Order("created_at DESC, id DESC").
+		Find(&changes).Error
+	if err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// HasStartedExams reports whether any exam the user is registered for has
+// already started
+func (r *RegistrationDataRepoImpl) HasStartedExams(ctx context.Context, userID uint) (bool, error) {
+	var count int64
+	err := r.storage.DB().WithContext(ctx).Table("exam_registrations").
+		Joins("JOIN exams ON exams.id = exam_registrations.exam_id AND exams.deleted_at IS NULL").
+		Where("exam_registrations.user_id = ? AND exam_registrations.deleted_at IS NULL AND exams.start <= ?", userID, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *RegistrationDataRepoImpl) GetUnverifiedByEmail(ctx context.Context, email string) ([]*RegistrationData, error) {
 	var registrations []*RegistrationData
-	// email_verified = true and no user has RegistrationDataID set to this record
-	err := r.storage.DB().Model(&RegistrationData{}).
-		Joins("LEFT JOIN users ON users.registration_data_id = registration_data.id").
-		Where("email_verified = ? AND users.id IS NULL", true).
+	err := r.storage.DB().WithContext(ctx).
+		Where("LOWER(email) = LOWER(?) AND email_verified = ?", email, false).
+		Where("status IN ?", editableStatuses).
 		Find(&registrations).Error
 	if err != nil {
 		return nil, err
@@ -96,10 +268,68 @@ func (r *RegistrationDataRepoImpl) GetPending() ([]*RegistrationData, error) {
 	return registrations, nil
 }
 
-func (r *RegistrationDataRepoImpl) GetAccepted() ([]*RegistrationData, error) {
+// GetByBirthDatesOrPhones returns the registrations that share any of the
+// birth dates or parent phones, the candidates for duplicate detection
+func (r *RegistrationDataRepoImpl) GetByBirthDatesOrPhones(ctx context.Context, birthDates []time.Time, phones []string) ([]*RegistrationData, error) {
+	var registrations []*RegistrationData
+	err := r.storage.DB().WithContext(ctx).Model(&RegistrationData{}).
+		Where("birth_date IN ? OR parent_phone IN ?", birthDates, phones).
+		Find(&registrations).Error
+	if err != nil {
+		return nil, err
+	}
+	return registrations, nil
+}
+
+// Merge saves the details taken over by the kept registration and closes
+// the duplicate with a reference to it. The duplicate is soft deleted so it
+// stays available for the history.
+func (r *RegistrationDataRepoImpl) Merge(ctx context.Context, kept *RegistrationData, columns []string, changes []*RegistrationDataChange, duplicate *RegistrationData, actorID uint) error {
+	return r.storage.DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if len(columns) > 0 {
+			result := tx.Model(kept).Select(columns).Updates(kept)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errors.New("record not found")
+			}
+		}
+
+		// Only merge the duplicate in the status the caller has seen
+		result := tx.Model(&RegistrationData{}).
+			Where("id = ? AND status = ?", duplicate.ID, duplicate.Status).
+			Update("merged_into_id", kept.ID)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrStatusOutOfSync
+		}
+
+		changes = append(changes, &RegistrationDataChange{
+			RegistrationDataID: duplicate.ID,
+			ChangedByID:        actorID,
+			Field:              "merged_into",
+			NewValue:           fmt.Sprint(kept.ID),
+		})
+		if err := tx.Create(&changes).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Delete(&RegistrationData{}, duplicate.ID).Error; err != nil {
+			return err
+		}
+
+		duplicate.MergedIntoID = &kept.ID
+		return nil
+	})
+}
+
+func (r *RegistrationDataRepoImpl) GetAccepted(ctx context.Context) ([]*RegistrationData, error) {
 	var registrations []*RegistrationData
-	err := r.storage.DB().Model(&RegistrationData{}).
-		Joins("JOIN users ON users.registration_data_id = registration_data.id").
+	err := r.storage.DB().WithContext(ctx).Model(&RegistrationData{}).
+		Where("status IN ?", acceptedStatuses).
 		Preload("User").
 		Find(&registrations).Error
 	if err != nil {
@@ -1,11 +1,15 @@
 package regdata_test
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/listing"
+	"github.com/L2SH-Dev/admissions/internal/migrations"
 	"github.com/L2SH-Dev/admissions/internal/regdata"
 	"github.com/L2SH-Dev/admissions/internal/users"
 	"github.com/spf13/viper"
@@ -49,12 +53,16 @@ func setupTestRepo(t *testing.T) regdata.RegistrationDataRepo {
 		assert.NoError(t, err)
 	})
 
+	_, err := migrations.Up(storage.DB())
+	require.NoError(t, err)
+
 	users.NewUsersRepo(storage)
 
 	return regdata.NewRegistrationDataRepo(storage)
 }
 
 func TestCreate(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	data := &regdata.RegistrationData{
@@ -70,12 +78,12 @@ func TestCreate(t *testing.T) {
 		ParentPhone:     "+1234567890",
 	}
 
-	err := repo.Create(data)
+	err := repo.Create(ctx, data)
 	assert.NoError(t, err)
 	assert.NotZero(t, data.ID)
 
 	// Verify data was created
-	result, err := repo.GetByID(data.ID)
+	result, err := repo.GetByID(ctx, data.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, data.Email, result.Email)
 	assert.Equal(t, data.FirstName, result.FirstName)
@@ -83,10 +91,11 @@ func TestCreate(t *testing.T) {
 }
 
 func TestGetByID(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	// Test getting non-existent record
-	_, err := repo.GetByID(999)
+	_, err := repo.GetByID(ctx, 999)
 	assert.Error(t, err)
 
 	// Create test data
@@ -102,11 +111,11 @@ func TestGetByID(t *testing.T) {
 		ParentLastName:  "Test",
 		ParentPhone:     "+1234567890",
 	}
-	err = repo.Create(data)
+	err = repo.Create(ctx, data)
 	require.NoError(t, err)
 
 	// Test getting existing record
-	result, err := repo.GetByID(data.ID)
+	result, err := repo.GetByID(ctx, data.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, data.Email, result.Email)
 	assert.Equal(t, data.FirstName, result.FirstName)
@@ -114,10 +123,11 @@ func TestGetByID(t *testing.T) {
 }
 
 func TestExistsByEmailNameAndGrade(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	// Test non-existent record
-	exists, err := repo.ExistsByEmailNameAndGrade("nonexistent@example.com", "Test", 9)
+	exists, err := repo.ExistsByEmailNameAndGrade(ctx, "nonexistent@example.com", "Test", 9)
 	assert.NoError(t, err)
 	assert.False(t, exists)
 
@@ -134,20 +144,21 @@ func TestExistsByEmailNameAndGrade(t *testing.T) {
 		ParentLastName:  "Test",
 		ParentPhone:     "+1234567890",
 	}
-	err = repo.Create(data)
+	err = repo.Create(ctx, data)
 	require.NoError(t, err)
 
 	// Test existing record
-	exists, err = repo.ExistsByEmailNameAndGrade(data.Email, data.FirstName, data.Grade)
+	exists, err = repo.ExistsByEmailNameAndGrade(ctx, data.Email, data.FirstName, data.Grade)
 	assert.NoError(t, err)
 	assert.True(t, exists)
 }
 
 func TestSetEmailVerified(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	// Test non-existent record
-	err := repo.SetEmailVerified(999)
+	err := repo.SetEmailVerified(ctx, 999)
 	assert.Error(t, err)
 
 	// Create test data
@@ -163,24 +174,30 @@ func TestSetEmailVerified(t *testing.T) {
 		ParentLastName:  "Test",
 		ParentPhone:     "+1234567890",
 	}
-	err = repo.Create(data)
+	err = repo.Create(ctx, data)
 	require.NoError(t, err)
 
 	// Test setting email verified
-	err = repo.SetEmailVerified(data.ID)
+	err = repo.SetEmailVerified(ctx, data.ID)
 	assert.NoError(t, err)
 
 	// Verify email was marked as verified
-	result, err := repo.GetByID(data.ID)
+	result, err := repo.GetByID(ctx, data.ID)
 	assert.NoError(t, err)
 	assert.True(t, result.EmailVerified)
 }
 
+// First page sorted by ID, large enough for every test
+var testPage = listing.Page{Number: 1, Limit: 50, Sort: "id"}
+
+var pendingFilter = &regdata.RegistrationFilter{Statuses: []regdata.Status{regdata.StatusEmailVerified}}
+
 func TestGetPending(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	// Test empty result
-	registrations, err := repo.GetPending()
+	registrations, _, err := repo.List(ctx, pendingFilter, testPage)
 	assert.NoError(t, err)
 	assert.Empty(t, registrations)
 
@@ -213,21 +230,76 @@ func TestGetPending(t *testing.T) {
 	}
 
 	for _, data := range testData {
-		err = repo.Create(data)
+		err = repo.Create(ctx, data)
 		require.NoError(t, err)
 	}
 
 	// Test getting pending records
-	registrations, err = repo.GetPending()
+	registrations, _, err = repo.List(ctx, pendingFilter, testPage)
 	assert.NoError(t, err)
 	assert.Empty(t, registrations)
 
 	// Verify email and test successful acceptance
-	err = repo.SetEmailVerified(testData[0].ID)
+	err = repo.SetEmailVerified(ctx, testData[0].ID)
 	require.NoError(t, err)
 
-	registrations, err = repo.GetPending()
+	registrations, _, err = repo.List(ctx, pendingFilter, testPage)
 	assert.NoError(t, err)
 	assert.Len(t, registrations, 1)
 	assert.Equal(t, testData[0].Email, registrations[0].Email)
 }
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	for i, name := range []string{"Иванов", "Петров", "Сидоров"} {
+		data := &regdata.RegistrationData{
+			Email:           fmt.Sprintf("test%d@example.com", i),
+			FirstName:       "Test",
+			LastName:        name,
+			Gender:          "M",
+			BirthDate:       time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+			Grade:           uint(8 + i%2),
+			OldSchool:       "Школа 57",
+			ParentFirstName: "Parent",
+			ParentLastName:  "Test",
+			ParentPhone:     fmt.Sprintf("+123456789%d", i),
+			Source:          "50%_off",
+		}
+		require.NoError(t, repo.Create(ctx, data))
+	}
+
+	registrations, total, err := repo.List(ctx, &regdata.RegistrationFilter{}, listing.Page{Number: 2, Limit: 2, Sort: "last_name", Desc: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	require.Len(t, registrations, 1)
+	assert.Equal(t, "Иванов", registrations[0].LastName)
+
+	registrations, total, err = repo.List(ctx, &regdata.RegistrationFilter{Grade: 8, Search: "ов"}, testPage)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	assert.Len(t, registrations, 2)
+
+	registrations, _, err = repo.List(ctx, &regdata.RegistrationFilter{Search: "Петр"}, testPage)
+	require.NoError(t, err)
+	require.Len(t, registrations, 1)
+	assert.Equal(t, "Петров", registrations[0].LastName)
+
+	// Wildcards are matched literally
+	_, total, err = repo.List(ctx, &regdata.RegistrationFilter{Source: "50%"}, testPage)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), total)
+	_, total, err = repo.List(ctx, &regdata.RegistrationFilter{Source: "5%off"}, testPage)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+
+	verified := true
+	_, total, err = repo.List(ctx, &regdata.RegistrationFilter{EmailVerified: &verified, School: "школа"}, testPage)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+
+	_, total, err = repo.List(ctx, &regdata.RegistrationFilter{CreatedFrom: time.Now().Add(time.Hour)}, testPage)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), total)
+}
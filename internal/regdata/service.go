@@ -1,11 +1,16 @@
 package regdata
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log/slog"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/listing"
 	"github.com/L2SH-Dev/admissions/internal/mailing"
 	"github.com/L2SH-Dev/admissions/internal/users"
 	"github.com/L2SH-Dev/admissions/internal/users/auth"
@@ -21,44 +26,73 @@ var (
 )
 
 type RegistrationDataService interface {
-	Create(data *RegistrationData) error
-	GetByID(id uint) (*RegistrationData, error)
-	SetEmailVerified(registrationID uint) error
-	Accept(id uint) (*users.User, error)
-	Reject(id uint) error
-	GetPending() ([]*RegistrationData, error)
-	GetAccepted() ([]*RegistrationData, error)
+	Create(ctx context.Context, data *RegistrationData) error
+	GetByID(ctx context.Context, id uint) (*RegistrationData, error)
+	SetEmailVerified(ctx context.Context, registrationID uint) error
+	GetUnverifiedByEmail(ctx context.Context, email string) ([]*RegistrationData, error)
+	UpdateByApplicant(ctx context.Context, user *users.User, fields map[string]json.RawMessage) (*RegistrationData, []*RegistrationDataChange, error)
+	UpdateByAdmin(ctx context.Context, id uint, fields map[string]json.RawMessage, actorID uint) (*RegistrationData, []*RegistrationDataChange, error)
+	GetChanges(ctx context.Context, registrationID uint) ([]*RegistrationDataChange, error)
+	Accept(ctx context.Context, id uint, actorID uint) (*users.User, error)
+	Reject(ctx context.Context, id uint, reason string, actorID uint) error
+	RevertRejection(ctx context.Context, id uint, actorID uint) (*RegistrationData, error)
+	ChangeStatus(ctx context.Context, id uint, to Status, actorID uint) (*RegistrationData, error)
+	List(ctx context.Context, filter *RegistrationFilter, page listing.Page) ([]*RegistrationData, int64, error)
+	GetPending(ctx context.Context, filter *RegistrationFilter, page listing.Page) ([]*RegistrationData, int64, error)
+	FindDuplicates(ctx context.Context, id uint) ([]*DuplicateCandidate, error)
+	Merge(ctx context.Context, keepID, duplicateID uint, actorID uint) (*RegistrationData, error)
+	GetAccepted(ctx context.Context) ([]*RegistrationData, error)
+	WithTx(tx datastore.Storage) RegistrationDataService
 }
 
 type RegistrationDataServiceImpl struct {
+	storage          datastore.Storage
 	repo             RegistrationDataRepo
 	usersService     users.UsersService
 	authService      auth.AuthService
 	passwordsService passwords.PasswordsService
+	mailingService   mailing.MailingService
 }
 
 func NewRegistrationDataService(
+	storage datastore.Storage,
 	repo RegistrationDataRepo,
 	usersService users.UsersService,
 	authService auth.AuthService,
 	passwordsService passwords.PasswordsService,
+	mailingService mailing.MailingService,
 ) RegistrationDataService {
 	return &RegistrationDataServiceImpl{
+		storage:          storage,
 		repo:             repo,
 		usersService:     usersService,
 		authService:      authService,
 		passwordsService: passwordsService,
+		mailingService:   mailingService,
 	}
 }
 
-func (s *RegistrationDataServiceImpl) Create(data *RegistrationData) error {
+// WithTx returns the service with all of its dependencies bound to the
+// transaction of tx
+func (s *RegistrationDataServiceImpl) WithTx(tx datastore.Storage) RegistrationDataService {
+	return &RegistrationDataServiceImpl{
+		storage:          tx,
+		repo:             s.repo.WithTx(tx),
+		usersService:     s.usersService.WithTx(tx),
+		authService:      s.authService.WithTx(tx),
+		passwordsService: s.passwordsService.WithTx(tx),
+		mailingService:   s.mailingService.WithTx(tx),
+	}
+}
+
+func (s *RegistrationDataServiceImpl) Create(ctx context.Context, data *RegistrationData) error {
 	validator := validation.NewCustomValidator()
 	err := validator.Validate(data)
 	if err != nil {
 		return errors.Join(ErrRegistrationDataInvalid, err)
 	}
 
-	exists, err := s.existsByEmailNameAndGrade(data.Email, data.FirstName, data.Grade)
+	exists, err := s.existsByEmailNameAndGrade(ctx, data.Email, data.FirstName, data.Grade)
 	if err != nil {
 		return err
 	}
@@ -66,19 +100,56 @@ func (s *RegistrationDataServiceImpl) Create(data *RegistrationData) error {
 		return ErrRegistrationDataExists
 	}
 
-	return s.repo.Create(data)
+	// The rest of the state is set by the service, not taken from the
+	// request the data was bound from
+	data.ID = 0
+	data.RejectionReason = ""
+	data.RejectedByID = nil
+	data.RejectedAt = nil
+	data.MergedIntoID = nil
+	data.User = users.User{}
+
+	// Registrations made by staff may be verified from the start, the
+	// public handler always clears EmailVerified
+	data.Status = StatusSubmitted
+	if data.EmailVerified {
+		data.Status = StatusEmailVerified
+	}
+	data.StatusChangedAt = time.Now()
+
+	return s.repo.Create(ctx, data)
 }
 
-func (s *RegistrationDataServiceImpl) GetByID(id uint) (*RegistrationData, error) {
-	return s.repo.GetByID(id)
+func (s *RegistrationDataServiceImpl) GetByID(ctx context.Context, id uint) (*RegistrationData, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// SetEmailVerified marks the email as verified and moves a new registration
+// on to review. Verification is done by the applicant, who has no user ID
+// yet, so the transition is recorded without one.
+func (s *RegistrationDataServiceImpl) SetEmailVerified(ctx context.Context, registrationID uint) error {
+	if err := s.repo.SetEmailVerified(ctx, registrationID); err != nil {
+		return err
+	}
+
+	regData, err := s.GetByID(ctx, registrationID)
+	if err != nil {
+		return err
+	}
+
+	if regData.Status != StatusSubmitted {
+		return nil
+	}
+
+	return s.repo.UpdateStatus(ctx, regData, StatusEmailVerified, 0)
 }
 
-func (s *RegistrationDataServiceImpl) SetEmailVerified(registrationID uint) error {
-	return s.repo.SetEmailVerified(registrationID)
+func (s *RegistrationDataServiceImpl) GetUnverifiedByEmail(ctx context.Context, email string) ([]*RegistrationData, error) {
+	return s.repo.GetUnverifiedByEmail(ctx, email)
 }
 
-func (s *RegistrationDataServiceImpl) Accept(id uint) (*users.User, error) {
-	regData, err := s.GetByID(id)
+func (s *RegistrationDataServiceImpl) Accept(ctx context.Context, id uint, actorID uint) (*users.User, error) {
+	regData, err := s.GetByID(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -87,47 +158,125 @@ func (s *RegistrationDataServiceImpl) Accept(id uint) (*users.User, error) {
 		return nil, ErrorEmailNotVerified
 	}
 
+	if !regData.Status.CanTransition(StatusAccepted) {
+		return nil, ErrStatusTransition
+	}
+
 	login := generateLogin(regData)
-	user, err := s.usersService.Create(id, login)
+	password := s.passwordsService.Generate()
+
+	// The user, the password, the email with them and the status are
+	// stored together, nothing is left behind if any of them fails
+	var user *users.User
+	err = s.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		var err error
+		user, err = s.usersService.WithTx(tx).Create(ctx, id, login)
+		if err != nil {
+			return err
+		}
+
+		if err := s.authService.WithTx(tx).Register(ctx, user.ID, password); err != nil {
+			return err
+		}
+
+		if err := s.mailingService.WithTx(tx).SendLoginAndPassword(ctx, regData.Email, login, password); err != nil {
+			return err
+		}
+
+		return s.repo.WithTx(tx).UpdateStatus(ctx, regData, StatusAccepted, actorID)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	password := s.passwordsService.Generate()
-	err = s.authService.Register(user.ID, password)
+	return user, nil
+}
+
+func (s *RegistrationDataServiceImpl) Reject(ctx context.Context, id uint, reason string, actorID uint) error {
+	regData, err := s.GetByID(ctx, id)
 	if err != nil {
-		slog.Info("Failed to register user, deleting user", slog.Any("user_id", user.ID))
-		delErr := s.usersService.Delete(user.ID)
-		if delErr != nil {
-			slog.Error("Failed to delete user", slog.Any("user_id", user.ID), slog.Any("err", err))
-			return nil, delErr
+		return err
+	}
+
+	if !regData.Status.CanTransition(StatusRejected) {
+		return ErrStatusTransition
+	}
+
+	// The notification is queued in the transaction of the rejection, so
+	// the email is sent if and only if the rejection is stored
+	return s.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		if err := s.repo.WithTx(tx).Reject(ctx, regData, reason, actorID); err != nil {
+			return err
 		}
+
+		return s.mailingService.WithTx(tx).SendRegistrationRejection(ctx, regData.Email, reason)
+	})
+}
+
+func (s *RegistrationDataServiceImpl) RevertRejection(ctx context.Context, id uint, actorID uint) (*RegistrationData, error) {
+	regData, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if regData.Status != StatusRejected {
+		return nil, errors.Join(ErrStatusTransition, errors.New("registration is not rejected"))
+	}
+
+	if err := s.repo.RevertRejection(ctx, regData, actorID); err != nil {
 		return nil, err
 	}
 
-	err = mailing.SendLoginAndPassword(regData.Email, login, password)
+	return regData, nil
+}
+
+// ChangeStatus moves the registration along the statuses that need nothing
+// but the change itself: withdrawal, enrollment and dismissal
+func (s *RegistrationDataServiceImpl) ChangeStatus(ctx context.Context, id uint, to Status, actorID uint) (*RegistrationData, error) {
+	regData, err := s.GetByID(ctx, id)
 	if err != nil {
-		slog.Error("Failed to send login and password", slog.Any("email", regData.Email), slog.Any("err", err))
 		return nil, err
 	}
 
-	return user, nil
+	if slices.Contains(dedicatedStatuses, to) || !regData.Status.CanTransition(to) {
+		return nil, errors.Join(ErrStatusTransition, fmt.Errorf("from %s to %s", regData.Status, to))
+	}
+
+	if err := s.repo.UpdateStatus(ctx, regData, to, actorID); err != nil {
+		return nil, err
+	}
+
+	return regData, nil
 }
 
-func (s *RegistrationDataServiceImpl) Reject(id uint) error {
-	return s.repo.Delete(id)
+func (s *RegistrationDataServiceImpl) List(ctx context.Context, filter *RegistrationFilter, page listing.Page) ([]*RegistrationData, int64, error) {
+	return s.repo.List(ctx, filter, page)
 }
 
-func (s *RegistrationDataServiceImpl) GetPending() ([]*RegistrationData, error) {
-	return s.repo.GetPending()
+// GetPending lists registrations awaiting review together with their
+// suspected duplicates. Statuses in the filter are ignored.
+func (s *RegistrationDataServiceImpl) GetPending(ctx context.Context, filter *RegistrationFilter, page listing.Page) ([]*RegistrationData, int64, error) {
+	pendingFilter := *filter
+	pendingFilter.Statuses = []Status{StatusEmailVerified}
+
+	registrations, total, err := s.repo.List(ctx, &pendingFilter, page)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := s.markDuplicates(ctx, registrations); err != nil {
+		return nil, 0, err
+	}
+
+	return registrations, total, nil
 }
 
-func (s *RegistrationDataServiceImpl) GetAccepted() ([]*RegistrationData, error) {
-	return s.repo.GetAccepted()
+func (s *RegistrationDataServiceImpl) GetAccepted(ctx context.Context) ([]*RegistrationData, error) {
+	return s.repo.GetAccepted(ctx)
 }
 
-func (s *RegistrationDataServiceImpl) existsByEmailNameAndGrade(email, name string, grade uint) (bool, error) {
-	return s.repo.ExistsByEmailNameAndGrade(email, name, grade)
+func (s *RegistrationDataServiceImpl) existsByEmailNameAndGrade(ctx context.Context, email, name string, grade uint) (bool, error) {
+	return s.repo.ExistsByEmailNameAndGrade(ctx, email, name, grade)
 }
 
 func generateLogin(regData *RegistrationData) string {
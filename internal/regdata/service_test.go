@@ -1,27 +1,43 @@
 package regdata_test
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/L2SH-Dev/admissions/internal/mailing"
+	"github.com/L2SH-Dev/admissions/internal/migrations"
 	"github.com/L2SH-Dev/admissions/internal/regdata"
 	"github.com/L2SH-Dev/admissions/internal/users"
 	"github.com/L2SH-Dev/admissions/internal/users/auth"
 	"github.com/L2SH-Dev/admissions/internal/users/auth/passwords"
 	"github.com/L2SH-Dev/admissions/internal/users/roles"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
 )
 
-func setupTestService(t *testing.T) regdata.RegistrationDataService {
+// User ID of the admin reviewing registrations in the tests
+const testAdminID = 42
+
+// setupTestServiceWithMailer creates the service sending emails with the
+// mailer, setupTestService queues them in the outbox
+func setupTestServiceWithMailer(t *testing.T, mailer mailing.Mailer) regdata.RegistrationDataService {
+	ctx := context.Background()
 	t.Cleanup(func() {
 		err := storage.Flush()
 		assert.NoError(t, err)
 	})
 
+	_, err := migrations.Up(storage.DB())
+	require.NoError(t, err)
+
 	rolesRepo := roles.NewRolesRepo(storage)
 	rolesService := roles.NewRolesService(rolesRepo)
-	err := rolesService.CreateDefaultRoles()
+	err = rolesService.CreateDefaultRoles(ctx)
 	require.NoError(t, err)
 
 	usersRepo := users.NewUsersRepo(storage)
@@ -32,11 +48,18 @@ func setupTestService(t *testing.T) regdata.RegistrationDataService {
 	authRepo := auth.NewAuthRepo(storage)
 	authService := auth.NewAuthService(authRepo, passwordsService)
 
+	mailingService := mailing.NewMailingService(mailer)
+
 	repo := regdata.NewRegistrationDataRepo(storage)
-	return regdata.NewRegistrationDataService(repo, usersService, authService, passwordsService)
+	return regdata.NewRegistrationDataService(storage, repo, usersService, authService, passwordsService, mailingService)
+}
+
+func setupTestService(t *testing.T) regdata.RegistrationDataService {
+	return setupTestServiceWithMailer(t, mailing.NewOutboxMailer(mailing.NewOutboxRepo(storage)))
 }
 
 func TestCreateService(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
 	// Test valid registration data
@@ -52,7 +75,7 @@ func TestCreateService(t *testing.T) {
 		ParentLastName:  "Test",
 		ParentPhone:     "+1234567890",
 	}
-	err := service.Create(data)
+	err := service.Create(ctx, data)
 	assert.NoError(t, err)
 	assert.NotZero(t, data.ID)
 
@@ -60,7 +83,7 @@ func TestCreateService(t *testing.T) {
 	invalidData := &regdata.RegistrationData{
 		Email: "test@example.com",
 	}
-	err = service.Create(invalidData)
+	err = service.Create(ctx, invalidData)
 	assert.ErrorIs(t, err, regdata.ErrRegistrationDataInvalid)
 
 	// Test duplicate registration data
@@ -76,15 +99,57 @@ func TestCreateService(t *testing.T) {
 		ParentLastName:  "Test",
 		ParentPhone:     "+1234567890",
 	}
-	err = service.Create(duplicateData)
+	err = service.Create(ctx, duplicateData)
 	assert.ErrorIs(t, err, regdata.ErrRegistrationDataExists)
 }
 
+func TestCreateIgnoresReviewState(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	// Bound from a request the way the public handler does
+	data := new(regdata.RegistrationData)
+	err := json.Unmarshal([]byte(`{
+		"email": "test@example.com",
+		"first_name": "Test",
+		"last_name": "User",
+		"gender": "M",
+		"birth_date": "2010-01-01T00:00:00Z",
+		"grade": 9,
+		"old_school": "Previous School",
+		"parent_first_name": "Parent",
+		"parent_last_name": "Test",
+		"parent_phone": "+79999999999",
+		"rejection_reason": "Duplicate",
+		"rejected_by_id": 42,
+		"rejected_at": "2025-01-01T00:00:00Z",
+		"merged_into_id": 7,
+		"user": {"login": "t.user-00001"}
+	}`), data)
+	require.NoError(t, err)
+
+	require.NoError(t, service.Create(ctx, data))
+
+	stored, err := service.GetByID(ctx, data.ID)
+	require.NoError(t, err)
+	assert.Equal(t, regdata.StatusSubmitted, stored.Status)
+	assert.Empty(t, stored.RejectionReason)
+	assert.Nil(t, stored.RejectedByID)
+	assert.Nil(t, stored.RejectedAt)
+	assert.Nil(t, stored.MergedIntoID)
+
+	// No account is created along with the registration
+	var count int64
+	require.NoError(t, storage.DB().Model(&users.User{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
 func TestGetByIDService(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
 	// Test getting non-existent record
-	_, err := service.GetByID(999)
+	_, err := service.GetByID(ctx, 999)
 	assert.Error(t, err)
 
 	// Create test data
@@ -100,17 +165,18 @@ func TestGetByIDService(t *testing.T) {
 		ParentLastName:  "Test",
 		ParentPhone:     "+1234567890",
 	}
-	err = service.Create(data)
+	err = service.Create(ctx, data)
 	require.NoError(t, err)
 
 	// Test getting existing record
-	result, err := service.GetByID(data.ID)
+	result, err := service.GetByID(ctx, data.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, data.Email, result.Email)
 	assert.Equal(t, data.FirstName, result.FirstName)
 }
 
 func TestSetEmailVerifiedService(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
 	// Create test data
@@ -126,28 +192,29 @@ func TestSetEmailVerifiedService(t *testing.T) {
 		ParentLastName:  "Test",
 		ParentPhone:     "+1234567890",
 	}
-	err := service.Create(data)
+	err := service.Create(ctx, data)
 	require.NoError(t, err)
 
 	// Test setting email verified
-	err = service.SetEmailVerified(data.ID)
+	err = service.SetEmailVerified(ctx, data.ID)
 	assert.NoError(t, err)
 
 	// Verify email was marked as verified
-	result, err := service.GetByID(data.ID)
+	result, err := service.GetByID(ctx, data.ID)
 	assert.NoError(t, err)
 	assert.True(t, result.EmailVerified)
 
 	// Test setting non-existent record
-	err = service.SetEmailVerified(999)
+	err = service.SetEmailVerified(ctx, 999)
 	assert.Error(t, err)
 }
 
 func TestAcceptService(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
 	// Test accepting non-existent registration
-	_, err := service.Accept(999)
+	_, err := service.Accept(ctx, 999, testAdminID)
 	assert.Error(t, err)
 
 	// Create test data
@@ -163,29 +230,71 @@ func TestAcceptService(t *testing.T) {
 		ParentLastName:  "Test",
 		ParentPhone:     "+1234567890",
 	}
-	err = service.Create(data)
+	err = service.Create(ctx, data)
 	require.NoError(t, err)
 
 	// Test accepting unverified email
-	_, err = service.Accept(data.ID)
+	_, err = service.Accept(ctx, data.ID, testAdminID)
 	assert.ErrorIs(t, err, regdata.ErrorEmailNotVerified)
 
 	// Verify email and test successful acceptance
-	err = service.SetEmailVerified(data.ID)
+	err = service.SetEmailVerified(ctx, data.ID)
 	require.NoError(t, err)
 
-	user, err := service.Accept(data.ID)
+	user, err := service.Accept(ctx, data.ID, testAdminID)
 	assert.NoError(t, err)
 	assert.NotNil(t, user)
 	assert.Equal(t, data.ID, user.RegistrationDataID)
 	assert.Equal(t, "t.user-00001", user.Login)
 }
 
+type failingMailer struct{}
+
+func (m *failingMailer) Send(_ context.Context, _ *mailing.Message) error {
+	return errors.New("mailer is down")
+}
+
+func TestAcceptAtomic(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestServiceWithMailer(t, &failingMailer{})
+
+	data := &regdata.RegistrationData{
+		Email:           "test@example.com",
+		EmailVerified:   true,
+		FirstName:       "Test",
+		LastName:        "User",
+		Gender:          "M",
+		BirthDate:       time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		Grade:           9,
+		OldSchool:       "Previous School",
+		ParentFirstName: "Parent",
+		ParentLastName:  "Test",
+		ParentPhone:     "+1234567890",
+	}
+	require.NoError(t, service.Create(ctx, data))
+
+	// The credentials cannot be sent, so neither the user nor the password
+	// are kept and the registration stays pending
+	_, err := service.Accept(ctx, data.ID, testAdminID)
+	assert.Error(t, err)
+
+	var count int64
+	require.NoError(t, storage.DB().Model(&users.User{}).Count(&count).Error)
+	assert.Zero(t, count)
+	require.NoError(t, storage.DB().Model(&passwords.Password{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	stored, err := service.GetByID(ctx, data.ID)
+	require.NoError(t, err)
+	assert.Equal(t, regdata.StatusEmailVerified, stored.Status)
+}
+
 func TestGetAllService(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
 	// Test empty result
-	registrations, err := service.GetPending()
+	registrations, _, err := service.GetPending(ctx, &regdata.RegistrationFilter{}, testPage)
 	assert.NoError(t, err)
 	assert.Empty(t, registrations)
 
@@ -218,21 +327,473 @@ func TestGetAllService(t *testing.T) {
 	}
 
 	for _, data := range testData {
-		err = service.Create(data)
+		err = service.Create(ctx, data)
 		require.NoError(t, err)
 	}
 
 	// Test getting pending records
-	registrations, err = service.GetPending()
+	registrations, _, err = service.GetPending(ctx, &regdata.RegistrationFilter{}, testPage)
 	assert.NoError(t, err)
 	assert.Empty(t, registrations)
 
 	// Verify email and test successful acceptance
-	err = service.SetEmailVerified(testData[0].ID)
+	err = service.SetEmailVerified(ctx, testData[0].ID)
 	require.NoError(t, err)
 
-	registrations, err = service.GetPending()
+	registrations, _, err = service.GetPending(ctx, &regdata.RegistrationFilter{}, testPage)
 	assert.NoError(t, err)
 	assert.Len(t, registrations, 1)
 	assert.Equal(t, testData[0].Email, registrations[0].Email)
 }
+
+func TestRejectService(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	data := &regdata.RegistrationData{
+		Email:           "test@example.com",
+		FirstName:       "Test",
+		LastName:        "User",
+		Gender:          "M",
+		BirthDate:       time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		Grade:           9,
+		OldSchool:       "Previous School",
+		ParentFirstName: "Parent",
+		ParentLastName:  "Test",
+		ParentPhone:     "+1234567890",
+	}
+	require.NoError(t, service.Create(ctx, data))
+
+	err := service.Reject(ctx, data.ID, "Неверный класс", testAdminID)
+	require.NoError(t, err)
+
+	// The registration is kept with the rejection details
+	rejected, err := service.GetByID(ctx, data.ID)
+	require.NoError(t, err)
+	assert.Equal(t, regdata.StatusRejected, rejected.Status)
+	assert.Equal(t, "Неверный класс", rejected.RejectionReason)
+	require.NotNil(t, rejected.RejectedByID)
+	assert.Equal(t, uint(testAdminID), *rejected.RejectedByID)
+	assert.NotNil(t, rejected.RejectedAt)
+
+	pending, _, err := service.GetPending(ctx, &regdata.RegistrationFilter{}, testPage)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// The rejection email is queued together with the status change
+	var messages []*mailing.OutboxMessage
+	require.NoError(t, storage.DB().Find(&messages).Error)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "test@example.com", messages[0].To)
+	assert.Equal(t, mailing.TemplateRejection, messages[0].Template)
+	assert.Equal(t, mailing.OutboxPending, messages[0].Status)
+
+	// Nothing is queued if the registration cannot be rejected
+	err = service.Reject(ctx, data.ID, "Неверный класс", testAdminID)
+	assert.ErrorIs(t, err, regdata.ErrStatusTransition)
+	require.NoError(t, storage.DB().Find(&messages).Error)
+	assert.Len(t, messages, 1)
+
+	reverted, err := service.RevertRejection(ctx, data.ID, testAdminID)
+	require.NoError(t, err)
+	assert.Equal(t, regdata.StatusSubmitted, reverted.Status)
+
+	stored, err := service.GetByID(ctx, data.ID)
+	require.NoError(t, err)
+	assert.Equal(t, regdata.StatusSubmitted, stored.Status)
+	assert.Empty(t, stored.RejectionReason)
+	assert.Nil(t, stored.RejectedByID)
+	assert.Nil(t, stored.RejectedAt)
+
+	// The reason stays in the history
+	history, err := service.GetChanges(ctx, data.ID)
+	require.NoError(t, err)
+	var reasons []string
+	for _, change := range history {
+		if change.Field == "rejection_reason" {
+			reasons = append(reasons, change.NewValue)
+		}
+	}
+	assert.Equal(t, []string{"", "Неверный класс"}, reasons)
+
+	_, err = service.RevertRejection(ctx, data.ID, testAdminID)
+	assert.ErrorIs(t, err, regdata.ErrStatusTransition)
+}
+
+func TestUpdateByApplicantService(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	data := &regdata.RegistrationData{
+		Email:           "test@example.com",
+		EmailVerified:   true,
+		FirstName:       "Test",
+		LastName:        "User",
+		Gender:          "M",
+		BirthDate:       time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		Grade:           9,
+		OldSchool:       "Previous School",
+		ParentFirstName: "Parent",
+		ParentLastName:  "Test",
+		ParentPhone:     "+1234567890",
+	}
+	require.NoError(t, service.Create(ctx, data))
+	user, err := service.Accept(ctx, data.ID, testAdminID)
+	require.NoError(t, err)
+
+	updated, changes, err := service.UpdateByApplicant(ctx, user, map[string]json.RawMessage{
+		"parent_phone": json.RawMessage(`"+79999999999"`),
+		"old_school":   json.RawMessage(`"Previous School"`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "+79999999999", updated.ParentPhone)
+	require.Len(t, changes, 1)
+	assert.Equal(t, "parent_phone", changes[0].Field)
+	assert.Equal(t, "+1234567890", changes[0].OldValue)
+	assert.Equal(t, "+79999999999", changes[0].NewValue)
+	assert.Equal(t, user.ID, changes[0].ChangedByID)
+
+	// Only whitelisted fields can be changed
+	_, _, err = service.UpdateByApplicant(ctx, user, map[string]json.RawMessage{
+		"grade": json.RawMessage(`10`),
+	})
+	assert.ErrorIs(t, err, regdata.ErrFieldNotEditable)
+
+	_, _, err = service.UpdateByApplicant(ctx, user, map[string]json.RawMessage{
+		"parent_phone": json.RawMessage(`"not a phone"`),
+	})
+	assert.ErrorIs(t, err, regdata.ErrRegistrationDataInvalid)
+
+	// A new email has to be verified again
+	updated, changes, err = service.UpdateByApplicant(ctx, user, map[string]json.RawMessage{
+		"email": json.RawMessage(`"new@example.com"`),
+	})
+	require.NoError(t, err)
+	assert.False(t, updated.EmailVerified)
+	assert.True(t, regdata.EmailChanged(changes))
+
+	stored, err := service.GetByID(ctx, data.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "new@example.com", stored.Email)
+	assert.Equal(t, "+79999999999", stored.ParentPhone)
+	assert.False(t, stored.EmailVerified)
+	assert.Equal(t, uint(9), stored.Grade)
+
+	history, err := service.GetChanges(ctx, data.ID)
+	require.NoError(t, err)
+	assert.Len(t, history, 3)
+}
+
+func TestUpdateEmailResetsVerificationService(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	data := &regdata.RegistrationData{
+		Email:           "test@example.com",
+		FirstName:       "Test",
+		LastName:        "User",
+		Gender:          "M",
+		BirthDate:       time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		Grade:           9,
+		OldSchool:       "Previous School",
+		ParentFirstName: "Parent",
+		ParentLastName:  "Test",
+		ParentPhone:     "+1234567890",
+	}
+	require.NoError(t, service.Create(ctx, data))
+	require.NoError(t, service.SetEmailVerified(ctx, data.ID))
+
+	updated, changes, err := service.UpdateByAdmin(ctx, data.ID, map[string]json.RawMessage{
+		"email": json.RawMessage(`"new@example.com"`),
+	}, testAdminID)
+	require.NoError(t, err)
+	assert.False(t, updated.EmailVerified)
+	assert.Equal(t, regdata.StatusSubmitted, updated.Status)
+	require.Len(t, changes, 3)
+	assert.Equal(t, "status", changes[2].Field)
+	assert.Equal(t, string(regdata.StatusEmailVerified), changes[2].OldValue)
+	assert.Equal(t, string(regdata.StatusSubmitted), changes[2].NewValue)
+
+	stored, err := service.GetByID(ctx, data.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.EmailVerified)
+	assert.Equal(t, regdata.StatusSubmitted, stored.Status)
+
+	history, err := service.GetChanges(ctx, data.ID)
+	require.NoError(t, err)
+	fields := make([]string, 0, len(history))
+	for _, change := range history {
+		fields = append(fields, change.Field)
+	}
+	assert.ElementsMatch(t, []string{"status", "email", "email_verified", "status"}, fields)
+
+	// The registration cannot be accepted until the new email is verified
+	_, err = service.Accept(ctx, data.ID, testAdminID)
+	assert.ErrorIs(t, err, regdata.ErrorEmailNotVerified)
+
+	require.NoError(t, service.SetEmailVerified(ctx, data.ID))
+	stored, err = service.GetByID(ctx, data.ID)
+	require.NoError(t, err)
+	assert.Equal(t, regdata.StatusEmailVerified, stored.Status)
+}
+
+func TestUpdateByAdminService(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	data := &regdata.RegistrationData{
+		Email:           "test@example.com",
+		FirstName:       "Test",
+		LastName:        "User",
+		Gender:          "M",
+		BirthDate:       time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		Grade:           9,
+		OldSchool:       "Previous School",
+		ParentFirstName: "Parent",
+		ParentLastName:  "Test",
+		ParentPhone:     "+1234567890",
+	}
+	require.NoError(t, service.Create(ctx, data))
+
+	updated, changes, err := service.UpdateByAdmin(ctx, data.ID, map[string]json.RawMessage{
+		"grade":      json.RawMessage(`10`),
+		"birth_date": json.RawMessage(`"2001-02-03T00:00:00Z"`),
+	}, testAdminID)
+	require.NoError(t, err)
+	assert.Equal(t, uint(10), updated.Grade)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "birth_date", changes[0].Field)
+	assert.Equal(t, "grade", changes[1].Field)
+	assert.Equal(t, "9", changes[1].OldValue)
+	assert.Equal(t, "10", changes[1].NewValue)
+
+	// Existing validation rules apply
+	_, _, err = service.UpdateByAdmin(ctx, data.ID, map[string]json.RawMessage{
+		"grade": json.RawMessage(`12`),
+	}, testAdminID)
+	assert.ErrorIs(t, err, regdata.ErrRegistrationDataInvalid)
+
+	_, _, err = service.UpdateByAdmin(ctx, data.ID, map[string]json.RawMessage{
+		"email_verified": json.RawMessage(`true`),
+	}, testAdminID)
+	assert.ErrorIs(t, err, regdata.ErrFieldNotEditable)
+
+	history, err := service.GetChanges(ctx, data.ID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	for _, change := range history {
+		assert.Equal(t, uint(testAdminID), change.ChangedByID)
+	}
+
+	stored, err := service.GetByID(ctx, data.ID)
+	require.NoError(t, err)
+	assert.Equal(t, uint(10), stored.Grade)
+	assert.Equal(t, time.Date(2001, 2, 3, 0, 0, 0, 0, time.UTC), stored.BirthDate.UTC())
+}
+
+func TestStatusTransitionsService(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	data := &regdata.RegistrationData{
+		Email:           "test@example.com",
+		FirstName:       "Test",
+		LastName:        "User",
+		Gender:          "M",
+		BirthDate:       time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		Grade:           9,
+		OldSchool:       "Previous School",
+		ParentFirstName: "Parent",
+		ParentLastName:  "Test",
+		ParentPhone:     "+1234567890",
+		Status:          regdata.StatusAccepted, // Ignored on creation
+	}
+	require.NoError(t, service.Create(ctx, data))
+	assert.Equal(t, regdata.StatusSubmitted, data.Status)
+
+	require.NoError(t, service.SetEmailVerified(ctx, data.ID))
+	pending, _, err := service.List(ctx, pendingFilter, testPage)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, data.ID, pending[0].ID)
+
+	// Acceptance has its own flow
+	_, err = service.ChangeStatus(ctx, data.ID, regdata.StatusAccepted, testAdminID)
+	assert.ErrorIs(t, err, regdata.ErrStatusTransition)
+
+	_, err = service.Accept(ctx, data.ID, testAdminID)
+	require.NoError(t, err)
+
+	enrolled, err := service.ChangeStatus(ctx, data.ID, regdata.StatusEnrolled, testAdminID)
+	require.NoError(t, err)
+	assert.Equal(t, regdata.StatusEnrolled, enrolled.Status)
+
+	// Enrolled applicants are still listed as accepted
+	accepted, err := service.GetAccepted(ctx)
+	require.NoError(t, err)
+	require.Len(t, accepted, 1)
+	assert.Equal(t, data.ID, accepted[0].ID)
+
+	err = service.Reject(ctx, data.ID, "Неверный класс", testAdminID)
+	assert.ErrorIs(t, err, regdata.ErrStatusTransition)
+
+	_, err = service.ChangeStatus(ctx, data.ID, regdata.StatusDismissed, testAdminID)
+	require.NoError(t, err)
+
+	// Dismissal is final
+	_, err = service.ChangeStatus(ctx, data.ID, regdata.StatusWithdrawn, testAdminID)
+	assert.ErrorIs(t, err, regdata.ErrStatusTransition)
+
+	history, err := service.GetChanges(ctx, data.ID)
+	require.NoError(t, err)
+	var transitions []string
+	for _, change := range history {
+		if change.Field == "status" {
+			transitions = append(transitions, change.OldValue+"->"+change.NewValue)
+		}
+	}
+	assert.Equal(t, []string{
+		"enrolled->dismissed",
+		"accepted->enrolled",
+		"email_verified->accepted",
+		"submitted->email_verified",
+	}, transitions)
+}
+
+func TestDuplicatesService(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+	viper.Set("regdata.duplicates.threshold", 0.6)
+
+	original := &regdata.RegistrationData{
+		Email:           "ivanov@example.com",
+		FirstName:       "Юлия",
+		LastName:        "Иванова",
+		Gender:          "F",
+		BirthDate:       time.Date(2010, 5, 17, 0, 0, 0, 0, time.UTC),
+		Grade:           8,
+		OldSchool:       "Школа №57",
+		ParentFirstName: "Пётр",
+		ParentLastName:  "Иванов",
+		ParentPhone:     "+79161234567",
+		JuneExam:        true,
+	}
+	require.NoError(t, service.Create(ctx, original))
+
+	// Registered again by the parent, transliterated and with more details
+	duplicate := &regdata.RegistrationData{
+		Email:            "parent@example.com",
+		FirstName:        "Yulia",
+		LastName:         "Ivanova",
+		Patronymic:       "Петровна",
+		Gender:           "F",
+		BirthDate:        time.Date(2010, 5, 17, 0, 0, 0, 0, time.UTC),
+		Grade:            8,
+		OldSchool:        "школа 57",
+		ParentFirstName:  "Пётр",
+		ParentLastName:   "Иванов",
+		ParentPatronymic: "Сергеевич",
+		ParentPhone:      "+79161234567",
+		VMSH:             true,
+	}
+	require.NoError(t, service.Create(ctx, duplicate))
+
+	// Same birth date, nothing else in common
+	other := &regdata.RegistrationData{
+		Email:           "other@example.com",
+		FirstName:       "Anna",
+		LastName:        "Smirnova",
+		Gender:          "F",
+		BirthDate:       time.Date(2010, 5, 17, 0, 0, 0, 0, time.UTC),
+		Grade:           8,
+		OldSchool:       "Лицей 2",
+		ParentFirstName: "Olga",
+		ParentLastName:  "Smirnova",
+		ParentPhone:     "+79997654321",
+	}
+	require.NoError(t, service.Create(ctx, other))
+
+	// A twin shares everything but the first name and is not a duplicate
+	twin := &regdata.RegistrationData{
+		Email:           "ivanov@example.com",
+		FirstName:       "Анна",
+		LastName:        "Иванова",
+		Gender:          "F",
+		BirthDate:       time.Date(2010, 5, 17, 0, 0, 0, 0, time.UTC),
+		Grade:           8,
+		OldSchool:       "Школа №57",
+		ParentFirstName: "Пётр",
+		ParentLastName:  "Иванов",
+		ParentPhone:     "+79161234567",
+	}
+	require.NoError(t, service.Create(ctx, twin))
+
+	for _, data := range []*regdata.RegistrationData{original, duplicate, other, twin} {
+		require.NoError(t, service.SetEmailVerified(ctx, data.ID))
+	}
+
+	candidates, err := service.FindDuplicates(ctx, original.ID)
+	require.NoError(t, err)
+	require.Len(t, candidates, 1)
+	assert.Equal(t, duplicate.ID, candidates[0].RegistrationID)
+	assert.Equal(t, 0.9, candidates[0].Score)
+	assert.Equal(t, []string{"name", "birth_date", "parent_phone", "old_school"}, candidates[0].Reasons)
+
+	candidates, err = service.FindDuplicates(ctx, twin.ID)
+	require.NoError(t, err)
+	assert.Empty(t, candidates)
+
+	pending, _, err := service.GetPending(ctx, &regdata.RegistrationFilter{}, testPage)
+	require.NoError(t, err)
+	require.Len(t, pending, 4)
+	for _, data := range pending {
+		switch data.ID {
+		case original.ID:
+			require.Len(t, data.Duplicates, 1)
+			assert.Equal(t, duplicate.ID, data.Duplicates[0].RegistrationID)
+		case duplicate.ID:
+			require.Len(t, data.Duplicates, 1)
+			assert.Equal(t, original.ID, data.Duplicates[0].RegistrationID)
+		default:
+			assert.Empty(t, data.Duplicates)
+		}
+	}
+
+	_, err = service.Merge(ctx, original.ID, original.ID, testAdminID)
+	assert.ErrorIs(t, err, regdata.ErrCannotMerge)
+
+	_, err = service.Merge(ctx, original.ID, twin.ID, testAdminID)
+	assert.ErrorIs(t, err, regdata.ErrCannotMerge)
+
+	merged, err := service.Merge(ctx, original.ID, duplicate.ID, testAdminID)
+	require.NoError(t, err)
+	assert.Equal(t, "Петровна", merged.Patronymic)
+	assert.Equal(t, "Сергеевич", merged.ParentPatronymic)
+	assert.True(t, merged.JuneExam)
+	assert.True(t, merged.VMSH)
+	// Details the kept registration already has are not overwritten
+	assert.Equal(t, "ivanov@example.com", merged.Email)
+
+	_, err = service.GetByID(ctx, duplicate.ID)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	history, err := service.GetChanges(ctx, original.ID)
+	require.NoError(t, err)
+	fields := make([]string, 0, len(history))
+	for _, change := range history {
+		fields = append(fields, change.Field)
+	}
+	assert.Contains(t, fields, "merged_from")
+	assert.Contains(t, fields, "patronymic")
+	assert.Contains(t, fields, "vmsh")
+
+	candidates, err = service.FindDuplicates(ctx, original.ID)
+	require.NoError(t, err)
+	assert.Empty(t, candidates)
+
+	// Accepted applicants have an account and cannot be merged away
+	_, err = service.Accept(ctx, other.ID, testAdminID)
+	require.NoError(t, err)
+	_, err = service.Merge(ctx, original.ID, other.ID, testAdminID)
+	assert.ErrorIs(t, err, regdata.ErrCannotMerge)
+}
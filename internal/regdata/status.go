@@ -0,0 +1,71 @@
+package regdata
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	ErrInvalidStatus     = errors.New("unknown registration status")
+	ErrStatusTransition  = errors.New("registration status cannot be changed this way")
+	ErrStatusOutOfSync   = errors.New("registration status was changed in the meantime")
+	ErrStatusNotEditable = errors.New("registration data cannot be changed in its current status")
+)
+
+type Status string
+
+const (
+	StatusSubmitted     Status = "submitted"
+	StatusEmailVerified Status = "email_verified"
+	StatusAccepted      Status = "accepted"
+	StatusRejected      Status = "rejected"
+	StatusWithdrawn     Status = "withdrawn"
+	StatusEnrolled      Status = "enrolled"
+	StatusDismissed     Status = "dismissed"
+)
+
+// transitions lists the statuses every status may change to. A rejection
+// can be reverted, withdrawn and dismissed applications are final.
+var transitions = map[Status][]Status{
+	StatusSubmitted:     {StatusEmailVerified, StatusRejected, StatusWithdrawn},
+	StatusEmailVerified: {StatusAccepted, StatusRejected, StatusWithdrawn},
+	StatusAccepted:      {StatusEnrolled, StatusDismissed, StatusWithdrawn},
+	StatusEnrolled:      {StatusDismissed, StatusWithdrawn},
+	StatusRejected:      {StatusSubmitted, StatusEmailVerified},
+	StatusWithdrawn:     {},
+	StatusDismissed:     {},
+}
+
+// Statuses set by their own flows rather than by a plain status change:
+// verification of the email, acceptance that creates the user account,
+// rejection that notifies the applicant and reverting a rejection
+var dedicatedStatuses = []Status{StatusSubmitted, StatusEmailVerified, StatusAccepted, StatusRejected}
+
+// Statuses of applicants that were accepted and still take part in the
+// admission, listed together as accepted
+var acceptedStatuses = []Status{StatusAccepted, StatusEnrolled}
+
+// Statuses in which applicants may still edit their data
+var editableStatuses = []Status{StatusSubmitted, StatusEmailVerified, StatusAccepted}
+
+func ParseStatus(value string) (Status, error) {
+	status := Status(value)
+	if _, ok := transitions[status]; !ok {
+		return "", errors.Join(ErrInvalidStatus, fmt.Errorf("status %q", value))
+	}
+	return status, nil
+}
+
+func (s Status) CanTransition(to Status) bool {
+	return slices.Contains(transitions[s], to)
+}
+
+// Transitions returns the allowed transitions of every status
+func Transitions() map[Status][]Status {
+	result := make(map[Status][]Status, len(transitions))
+	for from, to := range transitions {
+		result[from] = slices.Clone(to)
+	}
+	return result
+}
@@ -15,7 +15,6 @@ func LoadSecretsIntoViper() error {
 		"db_password",
 		"jwt_key",
 		"mail_api_key",
-		"admin_password",
 	}
 
 	for _, secretName := range secrets {
@@ -29,6 +28,18 @@ func LoadSecretsIntoViper() error {
 		slog.Debug("Loaded secret", slog.String("name", secretName))
 	}
 
+	// Secrets that only some configurations need
+	optionalSecrets := []string{
+		"smtp_password",
+	}
+
+	for _, secretName := range optionalSecrets {
+		if value := os.Getenv(toEnvVarName(secretName)); value != "" {
+			viper.Set("secrets."+secretName, value)
+			slog.Debug("Loaded secret", slog.String("name", secretName))
+		}
+	}
+
 	slog.Info("All secrets loaded into viper from environment variables")
 	return nil
 }
@@ -0,0 +1,48 @@
+package server_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/L2SH-Dev/admissions/internal/server"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func request(remoteAddr, forwardedFor string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+	req.Header.Set(echo.HeaderXRealIP, forwardedFor)
+	return req
+}
+
+func TestIPExtractor_Direct(t *testing.T) {
+	extract, err := server.NewIPExtractor(nil)
+	require.NoError(t, err)
+
+	// Headers sent by the client are ignored
+	assert.Equal(t, "203.0.113.7", extract(request("203.0.113.7:51234", "198.51.100.1")))
+	assert.Equal(t, "10.0.0.5", extract(request("10.0.0.5:51234", "198.51.100.1")))
+}
+
+func TestIPExtractor_TrustedProxies(t *testing.T) {
+	extract, err := server.NewIPExtractor([]string{"172.18.0.0/16"})
+	require.NoError(t, err)
+
+	// Through the proxy the client IP comes from the header
+	assert.Equal(t, "198.51.100.1", extract(request("172.18.0.2:51234", "198.51.100.1")))
+
+	// A client prepending its own entry gets the one the proxy appended
+	assert.Equal(t, "198.51.100.1", extract(request("172.18.0.2:51234", "6.6.6.6, 198.51.100.1")))
+
+	// Other private addresses are not trusted
+	assert.Equal(t, "10.0.0.5", extract(request("10.0.0.5:51234", "198.51.100.1")))
+}
+
+func TestIPExtractor_InvalidRange(t *testing.T) {
+	_, err := server.NewIPExtractor([]string{"not-a-cidr"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,13 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// RetryAfterSeconds formats the wait for the Retry-After header, rounded up
+// so that a client retrying on time is not turned away again
+func RetryAfterSeconds(retryAfter time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+}
@@ -0,0 +1,16 @@
+package server_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryAfterSeconds(t *testing.T) {
+	assert.Equal(t, "0", server.RetryAfterSeconds(0))
+	assert.Equal(t, "1", server.RetryAfterSeconds(200*time.Millisecond))
+	assert.Equal(t, "60", server.RetryAfterSeconds(time.Minute))
+	assert.Equal(t, "61", server.RetryAfterSeconds(time.Minute+time.Millisecond))
+}
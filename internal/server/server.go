@@ -1,10 +1,13 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/listing"
 	"github.com/L2SH-Dev/admissions/internal/logging"
 	"github.com/L2SH-Dev/admissions/internal/validation"
 	"github.com/labstack/echo/v4"
@@ -35,6 +38,12 @@ func NewServer(storage datastore.Storage) Server {
 		Storage: storage,
 	}
 
+	ipExtractor, err := NewIPExtractor(viper.GetStringSlice("server.trusted_proxies"))
+	if err != nil {
+		panic(err)
+	}
+	srv.Echo.IPExtractor = ipExtractor
+
 	srv.addGeneralMiddleware()
 	validation.AddValidation(srv.Echo)
 
@@ -71,6 +80,22 @@ func (s *server) addGeneralMiddleware() {
 	s.Echo.Use(middleware.Recover())
 	s.Echo.Use(middleware.Secure())
 
+	// The request context is passed down to the queries, they are cancelled
+	// once the timeout passes or the client disconnects
+	if timeout := viper.GetDuration("server.request_timeout"); timeout > 0 {
+		s.Echo.Use(middleware.ContextTimeoutWithConfig(middleware.ContextTimeoutConfig{
+			Timeout: timeout,
+			// Handlers wrap errors into HTTP errors, so the deadline is
+			// checked on the context rather than on the error
+			ErrorHandler: func(err error, c echo.Context) error {
+				if errors.Is(c.Request().Context().Err(), context.DeadlineExceeded) {
+					return echo.NewHTTPError(http.StatusServiceUnavailable, "request timed out")
+				}
+				return err
+			},
+		}))
+	}
+
 	s.Echo.Use(middleware.CSRFWithConfig(middleware.CSRFConfig{
 		TokenLookup:    "cookie:_csrf",
 		CookiePath:     "/",
@@ -92,6 +117,7 @@ func (s *server) addGeneralMiddleware() {
 			http.MethodGet,
 			http.MethodPost,
 			http.MethodPut,
+			http.MethodPatch,
 			http.MethodDelete,
 		},
 		AllowHeaders: []string{
@@ -100,6 +126,14 @@ func (s *server) addGeneralMiddleware() {
 			echo.HeaderAccept,
 			echo.HeaderAuthorization,
 		},
+		// Paginated lists describe the whole list in headers, the request ID
+		// lets the client report which request failed
+		ExposeHeaders: []string{
+			listing.HeaderTotalCount,
+			listing.HeaderPage,
+			listing.HeaderPerPage,
+			echo.HeaderXRequestID,
+		},
 		AllowCredentials: true,
 	}))
 }
@@ -12,15 +12,16 @@ import (
 var ErrInvalidToken = errors.New("invalid token")
 
 type JWTClaims struct {
-	UserID uint   `json:"user_id"`
-	UID    string `json:"uid"`
-	Type   string `json:"type"`
+	UserID    uint   `json:"user_id"`
+	SessionID string `json:"sid"`
+	UID       string `json:"uid"`
+	Type      string `json:"type"`
 	jwt.RegisteredClaims
 }
 
 type JWTService interface {
-	NewAccessToken(userID uint) (string, error)
-	NewRefreshToken(userID uint) (string, error)
+	NewAccessToken(userID uint, sessionID string) (string, error)
+	NewRefreshToken(userID uint, sessionID string) (string, error)
 	ParseToken(tokenString string) (*JWTClaims, error)
 }
 
@@ -30,13 +31,13 @@ func NewJWTService() JWTService {
 	return &JWTServiceImpl{}
 }
 
-func (s *JWTServiceImpl) NewAccessToken(userID uint) (string, error) {
-	claims := newAccessJWTClaims(userID)
+func (s *JWTServiceImpl) NewAccessToken(userID uint, sessionID string) (string, error) {
+	claims := newAccessJWTClaims(userID, sessionID)
 	return newSignedJWT(claims)
 }
 
-func (s *JWTServiceImpl) NewRefreshToken(userID uint) (string, error) {
-	claims := newRefreshJWTClaims(userID)
+func (s *JWTServiceImpl) NewRefreshToken(userID uint, sessionID string) (string, error) {
+	claims := newRefreshJWTClaims(userID, sessionID)
 	return newSignedJWT(claims)
 }
 
@@ -60,19 +61,20 @@ func newSignedJWT(claims jwt.Claims) (string, error) {
 	return token.SignedString([]byte(viper.GetString("secrets.jwt_key")))
 }
 
-func newAccessJWTClaims(userID uint) *JWTClaims {
-	return newJWTClaims(userID, "access", viper.GetDuration("auth.access_lifetime"))
+func newAccessJWTClaims(userID uint, sessionID string) *JWTClaims {
+	return newJWTClaims(userID, sessionID, "access", viper.GetDuration("auth.access_lifetime"))
 }
 
-func newRefreshJWTClaims(userID uint) *JWTClaims {
-	return newJWTClaims(userID, "refresh", viper.GetDuration("auth.refresh_lifetime"))
+func newRefreshJWTClaims(userID uint, sessionID string) *JWTClaims {
+	return newJWTClaims(userID, sessionID, "refresh", viper.GetDuration("auth.refresh_lifetime"))
 }
 
-func newJWTClaims(userID uint, tokenType string, lifetime time.Duration) *JWTClaims {
+func newJWTClaims(userID uint, sessionID string, tokenType string, lifetime time.Duration) *JWTClaims {
 	return &JWTClaims{
-		UserID: userID,
-		UID:    uuid.New().String(),
-		Type:   tokenType,
+		UserID:    userID,
+		SessionID: sessionID,
+		UID:       uuid.New().String(),
+		Type:      tokenType,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(lifetime)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -20,7 +20,7 @@ func setupTestJWTService(_ *testing.T) authjwt.JWTService {
 func TestNewAccessToken(t *testing.T) {
 	service := setupTestJWTService(t)
 
-	tokenString, err := service.NewAccessToken(1)
+	tokenString, err := service.NewAccessToken(1, "session")
 	assert.NoError(t, err)
 	assert.NotEmpty(t, tokenString)
 }
@@ -28,7 +28,7 @@ func TestNewAccessToken(t *testing.T) {
 func TestNewRefreshToken(t *testing.T) {
 	service := setupTestJWTService(t)
 
-	tokenString, err := service.NewRefreshToken(1)
+	tokenString, err := service.NewRefreshToken(1, "session")
 	assert.NoError(t, err)
 	assert.NotEmpty(t, tokenString)
 }
@@ -36,10 +36,10 @@ func TestNewRefreshToken(t *testing.T) {
 func TestParseToken(t *testing.T) {
 	service := setupTestJWTService(t)
 
-	accessTokenString, err := service.NewAccessToken(1)
+	accessTokenString, err := service.NewAccessToken(1, "session")
 	assert.NoError(t, err)
 
-	refreshTokenString, err := service.NewRefreshToken(1)
+	refreshTokenString, err := service.NewRefreshToken(1, "session")
 	assert.NoError(t, err)
 
 	accessTokenClaims, err := service.ParseToken(accessTokenString)
@@ -51,6 +51,9 @@ func TestParseToken(t *testing.T) {
 	assert.Equal(t, uint(1), accessTokenClaims.UserID)
 	assert.Equal(t, uint(1), refreshTokenClaims.UserID)
 
+	assert.Equal(t, "session", accessTokenClaims.SessionID)
+	assert.Equal(t, "session", refreshTokenClaims.SessionID)
+
 	assert.Equal(t, "access", accessTokenClaims.Type)
 	assert.Equal(t, "refresh", refreshTokenClaims.Type)
 
@@ -0,0 +1,116 @@
+package loginlimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/redis/go-redis/v9"
+)
+
+type LoginLimitRepo interface {
+	Attempt(ctx context.Context, key string, window time.Duration, delayFor func(attempts int64) time.Duration) (retryAfter, delay time.Duration, err error)
+	Refund(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+type LoginLimitRepoImpl struct {
+	storage datastore.Storage
+}
+
+func NewLoginLimitRepo(storage datastore.Storage) LoginLimitRepo {
+	return &LoginLimitRepoImpl{storage: storage}
+}
+
+func failuresKey(key string) string {
+	return fmt.Sprintf("login-failures:%s", key)
+}
+
+func lockKey(key string) string {
+	return fmt.Sprintf("login-lock:%s", key)
+}
+
+// attemptRetries is how many times an attempt is retried when a concurrent
+// attempt of the same key changes it first
+const attemptRetries = 5
+
+// Attempt counts an attempt of the key before its outcome is known, unless
+// the key is locked, in which case retryAfter is how long it stays locked.
+// The delay for the new count is returned and the key is locked for it in
+// the same transaction, so concurrent attempts can't all get past the
+// limit. The counter expires after the window passes since the first one.
+func (r *LoginLimitRepoImpl) Attempt(ctx context.Context, key string, window time.Duration, delayFor func(attempts int64) time.Duration) (time.Duration, time.Duration, error) {
+	var retryAfter, delay time.Duration
+	attempt := func(tx *redis.Tx) error {
+		retryAfter, delay = 0, 0
+
+		ttl, err := tx.PTTL(ctx, lockKey(key)).Result()
+		if err != nil {
+			return err
+		}
+		// Negative TTL means the lock doesn't exist
+		if ttl > 0 {
+			retryAfter = ttl
+			return nil
+		}
+
+		attempts, err := tx.Get(ctx, failuresKey(key)).Int64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		delay = delayFor(attempts + 1)
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Incr(ctx, failuresKey(key))
+			pipe.ExpireNX(ctx, failuresKey(key), window)
+			if delay > 0 {
+				pipe.Set(ctx, lockKey(key), 1, delay)
+			}
+			return nil
+		})
+		return err
+	}
+
+	for i := 0; i < attemptRetries; i++ {
+		err := r.storage.Cache().Watch(ctx, attempt, failuresKey(key), lockKey(key))
+		if err == nil {
+			return retryAfter, delay, nil
+		} else if !errors.Is(err, redis.TxFailedErr) {
+			return 0, 0, errors.Join(errors.New("failed to count login attempt"), err)
+		}
+	}
+
+	// Other attempts of the key keep winning the race, this one waits
+	return time.Second, 0, nil
+}
+
+// Refund takes back an attempt that turned out to be successful. A lock set
+// for it is kept.
+func (r *LoginLimitRepoImpl) Refund(ctx context.Context, key string) error {
+	err := r.storage.Cache().Eval(ctx, refundScript, []string{failuresKey(key)}).Err()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return errors.Join(errors.New("failed to refund login attempt"), err)
+	}
+
+	return nil
+}
+
+// refundScript decrements the counter only if it still exists, so that an
+// expired counter is not recreated without a TTL
+var refundScript = `
+if redis.call("EXISTS", KEYS[1]) == 1 and tonumber(redis.call("GET", KEYS[1])) > 0 then
+	return redis.call("DECR", KEYS[1])
+end
+return 0
+`
+
+func (r *LoginLimitRepoImpl) Reset(ctx context.Context, key string) error {
+	err := r.storage.Cache().Del(ctx, failuresKey(key), lockKey(key)).Err()
+	if err != nil {
+		return errors.Join(errors.New("failed to reset login failures"), err)
+	}
+
+	return nil
+}
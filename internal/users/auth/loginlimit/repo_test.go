@@ -0,0 +1,151 @@
+package loginlimit_test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/users/auth/loginlimit"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	storage datastore.MockStorage
+)
+
+func TestMain(m *testing.M) {
+	s, cleanup := datastore.InitMockStorage()
+	storage = s
+
+	viper.Set("auth.login_protection.window", "1h")
+	viper.Set("auth.login_protection.base_delay", "1s")
+	viper.Set("auth.login_protection.max_delay", "1m")
+	viper.Set("auth.login_protection.lockout_duration", "15m")
+	viper.Set("auth.login_protection.login.free_attempts", 3)
+	viper.Set("auth.login_protection.login.lockout_after", 10)
+	viper.Set("auth.login_protection.ip.free_attempts", 10)
+	viper.Set("auth.login_protection.ip.lockout_after", 50)
+
+	code := m.Run()
+
+	cleanup()
+	os.Exit(code)
+}
+
+func setupTestRepo(t *testing.T) loginlimit.LoginLimitRepo {
+	t.Cleanup(func() {
+		err := storage.Flush()
+		assert.NoError(t, err)
+	})
+
+	return loginlimit.NewLoginLimitRepo(storage)
+}
+
+// delayAfter locks the key from the given attempt on
+func delayAfter(free int64) func(attempts int64) time.Duration {
+	return func(attempts int64) time.Duration {
+		if attempts > free {
+			return time.Minute
+		}
+		return 0
+	}
+}
+
+func TestAttempt(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	for i := 0; i < 2; i++ {
+		retryAfter, delay, err := repo.Attempt(ctx, "login:test", time.Hour, delayAfter(2))
+		require.NoError(t, err)
+		assert.Zero(t, retryAfter)
+		assert.Zero(t, delay)
+	}
+
+	// The attempt that reaches the delay is made and locks the key
+	retryAfter, delay, err := repo.Attempt(ctx, "login:test", time.Hour, delayAfter(2))
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+	assert.Equal(t, time.Minute, delay)
+
+	retryAfter, _, err = repo.Attempt(ctx, "login:test", time.Hour, delayAfter(2))
+	require.NoError(t, err)
+	assert.True(t, retryAfter > 0 && retryAfter <= time.Minute)
+
+	// Attempts made while locked are not counted
+	failures, err := storage.Cache().Get(ctx, "login-failures:login:test").Int64()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), failures)
+}
+
+func TestAttempt_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	var (
+		wg      sync.WaitGroup
+		allowed atomic.Int64
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			retryAfter, _, err := repo.Attempt(ctx, "login:test", time.Hour, delayAfter(2))
+			assert.NoError(t, err)
+			if retryAfter == 0 {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// The free attempts and the one that locked the key
+	assert.LessOrEqual(t, allowed.Load(), int64(3))
+	assert.Positive(t, allowed.Load())
+}
+
+func TestRefund(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	for i := 0; i < 2; i++ {
+		_, _, err := repo.Attempt(ctx, "ip:10.0.0.1", time.Hour, delayAfter(2))
+		require.NoError(t, err)
+	}
+	require.NoError(t, repo.Refund(ctx, "ip:10.0.0.1"))
+
+	// The refunded attempt leaves room for another free one
+	_, delay, err := repo.Attempt(ctx, "ip:10.0.0.1", time.Hour, delayAfter(2))
+	require.NoError(t, err)
+	assert.Zero(t, delay)
+
+	// Refunding a key without attempts doesn't create a counter
+	require.NoError(t, repo.Refund(ctx, "ip:10.0.0.2"))
+	exists, err := storage.Cache().Exists(ctx, "login-failures:ip:10.0.0.2").Result()
+	require.NoError(t, err)
+	assert.Zero(t, exists)
+}
+
+func TestReset(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	for i := 0; i < 3; i++ {
+		_, _, err := repo.Attempt(ctx, "login:test", time.Hour, delayAfter(2))
+		require.NoError(t, err)
+	}
+
+	err := repo.Reset(ctx, "login:test")
+	require.NoError(t, err)
+
+	retryAfter, delay, err := repo.Attempt(ctx, "login:test", time.Hour, delayAfter(2))
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+	assert.Zero(t, delay)
+}
@@ -0,0 +1,109 @@
+package loginlimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// LoginLimitService throttles password guessing. Attempts are counted per
+// login and per client IP. After the free attempts every further failure
+// blocks the key for an exponentially growing delay, and reaching the
+// lockout threshold blocks it for the whole lockout duration.
+//
+// An attempt is counted as failed before the password is checked and taken
+// back on success, so a burst of parallel attempts is limited as well.
+type LoginLimitService interface {
+	Attempt(ctx context.Context, login, ip string) (retryAfter, delay time.Duration, err error)
+	RecordSuccess(ctx context.Context, login, ip string) error
+}
+
+type LoginLimitServiceImpl struct {
+	repo LoginLimitRepo
+}
+
+func NewLoginLimitService(repo LoginLimitRepo) LoginLimitService {
+	return &LoginLimitServiceImpl{repo: repo}
+}
+
+type scope struct {
+	name string
+	key  string
+}
+
+func scopes(login, ip string) []scope {
+	return []scope{
+		{name: "login", key: fmt.Sprintf("login:%s", strings.ToLower(strings.TrimSpace(login)))},
+		{name: "ip", key: fmt.Sprintf("ip:%s", ip)},
+	}
+}
+
+// Attempt counts a login attempt. If the caller has to wait, retryAfter is
+// how long and the attempt must not be made. Otherwise delay is what the
+// attempt imposes if it fails.
+func (s *LoginLimitServiceImpl) Attempt(ctx context.Context, login, ip string) (time.Duration, time.Duration, error) {
+	window := viper.GetDuration("auth.login_protection.window")
+
+	var (
+		counted []scope
+		delay   time.Duration
+	)
+	for _, sc := range scopes(login, ip) {
+		retryAfter, scopeDelay, err := s.repo.Attempt(ctx, sc.key, window, func(attempts int64) time.Duration {
+			return delayFor(sc.name, attempts)
+		})
+		if err == nil && retryAfter == 0 {
+			counted = append(counted, sc)
+			delay = max(delay, scopeDelay)
+			continue
+		}
+
+		// The attempt is not made, so it doesn't count in the other scopes
+		for _, c := range counted {
+			err = errors.Join(err, s.repo.Refund(ctx, c.key))
+		}
+		return retryAfter, 0, err
+	}
+
+	return 0, delay, nil
+}
+
+// RecordSuccess clears the failures of the login. The attempt is only taken
+// back from the IP counter, so that one known password doesn't reset the
+// budget for spraying others.
+func (s *LoginLimitServiceImpl) RecordSuccess(ctx context.Context, login, ip string) error {
+	sc := scopes(login, ip)
+	if err := s.repo.Reset(ctx, sc[0].key); err != nil {
+		return err
+	}
+
+	return s.repo.Refund(ctx, sc[1].key)
+}
+
+func delayFor(scopeName string, failures int64) time.Duration {
+	prefix := "auth.login_protection." + scopeName
+	freeAttempts := viper.GetInt64(prefix + ".free_attempts")
+	lockoutAfter := viper.GetInt64(prefix + ".lockout_after")
+
+	if lockoutAfter > 0 && failures >= lockoutAfter {
+		return viper.GetDuration("auth.login_protection.lockout_duration")
+	}
+
+	if failures <= freeAttempts {
+		return 0
+	}
+
+	baseDelay := viper.GetDuration("auth.login_protection.base_delay")
+	maxDelay := viper.GetDuration("auth.login_protection.max_delay")
+
+	delay := baseDelay
+	for i := freeAttempts + 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxDelay)
+}
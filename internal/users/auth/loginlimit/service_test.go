@@ -0,0 +1,113 @@
+package loginlimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/users/auth/loginlimit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestService(t *testing.T) loginlimit.LoginLimitService {
+	return loginlimit.NewLoginLimitService(setupTestRepo(t))
+}
+
+// unlock lets the next attempt through without waiting for the delay
+func unlock(t *testing.T, keys ...string) {
+	for _, key := range keys {
+		require.NoError(t, storage.Cache().Del(context.Background(), "login-lock:"+key).Err())
+	}
+}
+
+func TestAttempt_Backoff(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	// Free attempts don't impose a delay
+	for i := 0; i < 3; i++ {
+		retryAfter, delay, err := service.Attempt(ctx, "i.ivanov-00042", "10.0.0.1")
+		require.NoError(t, err)
+		assert.Zero(t, retryAfter)
+		assert.Zero(t, delay)
+	}
+
+	// Then the delay doubles with every failure
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		retryAfter, delay, err := service.Attempt(ctx, "i.ivanov-00042", "10.0.0.1")
+		require.NoError(t, err)
+		assert.Zero(t, retryAfter)
+		assert.Equal(t, expected, delay)
+
+		retryAfter, _, err = service.Attempt(ctx, "i.ivanov-00042", "10.0.0.2")
+		require.NoError(t, err)
+		assert.True(t, retryAfter > 0)
+
+		unlock(t, "login:i.ivanov-00042")
+	}
+
+	// Other logins from another IP are not affected
+	retryAfter, _, err := service.Attempt(ctx, "p.petrov-00043", "10.0.0.2")
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+}
+
+func TestAttempt_Lockout(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	var delay time.Duration
+	for i := 0; i < 10; i++ {
+		unlock(t, "login:i.ivanov-00042")
+
+		var err error
+		_, delay, err = service.Attempt(ctx, "I.Ivanov-00042", "10.0.0.1")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 15*time.Minute, delay)
+
+	// Logins are case-insensitive
+	retryAfter, _, err := service.Attempt(ctx, "i.ivanov-00042", "10.0.0.2")
+	require.NoError(t, err)
+	assert.True(t, retryAfter > time.Minute)
+}
+
+func TestAttempt_PerIP(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	// Spraying different logins from one IP
+	for i := 0; i < 11; i++ {
+		retryAfter, _, err := service.Attempt(ctx, "user-"+string(rune('a'+i)), "10.0.0.1")
+		require.NoError(t, err)
+		assert.Zero(t, retryAfter)
+	}
+
+	retryAfter, _, err := service.Attempt(ctx, "another-login", "10.0.0.1")
+	require.NoError(t, err)
+	assert.True(t, retryAfter > 0)
+
+	retryAfter, _, err = service.Attempt(ctx, "another-login", "10.0.0.2")
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+}
+
+func TestRecordSuccess(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	for i := 0; i < 5; i++ {
+		unlock(t, "login:i.ivanov-00042")
+		_, _, err := service.Attempt(ctx, "i.ivanov-00042", "10.0.0.1")
+		require.NoError(t, err)
+	}
+
+	err := service.RecordSuccess(ctx, "i.ivanov-00042", "10.0.0.1")
+	require.NoError(t, err)
+
+	retryAfter, delay, err := service.Attempt(ctx, "i.ivanov-00042", "10.0.0.2")
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+	assert.Zero(t, delay)
+}
@@ -34,9 +34,9 @@ func (s *AuthServiceImpl) validateJWTMiddleware() echo.MiddlewareFunc {
 				return echo.NewHTTPError(http.StatusUnauthorized, "invalid token type")
 			}
 
-			ok, err := s.IsTokenCached(claims)
+			ok, err := s.IsTokenCached(c.Request().Context(), claims)
 			if err != nil {
-				slog.Error("failed to check if token is cached", slog.Any("error", err))
+				slog.ErrorContext(c.Request().Context(), "failed to check if token is cached", slog.Any("error", err))
 				return echo.NewHTTPError(http.StatusInternalServerError, "failed to validate token")
 			}
 
@@ -44,9 +44,10 @@ func (s *AuthServiceImpl) validateJWTMiddleware() echo.MiddlewareFunc {
 				return echo.NewHTTPError(http.StatusUnauthorized, "token not found")
 			}
 
-			s.repo.ExtendTokenPairCacheExpiration(claims.UserID)
+			s.repo.ExtendTokenPairCacheExpiration(c.Request().Context(), claims)
 
 			c.Set("userId", claims.UserID)
+			c.Set("sessionId", claims.SessionID)
 
 			return next(c)
 		}
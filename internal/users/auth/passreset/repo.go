@@ -0,0 +1,132 @@
+package passreset
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+type PasswordResetRepo interface {
+	CreateResetToken(ctx context.Context, userID uint) (string, error)
+	ConsumeToken(ctx context.Context, token string) (uint, error)
+	RestoreToken(ctx context.Context, token string, userID uint) error
+	AcquireCooldown(ctx context.Context, key string, cooldown time.Duration) (time.Duration, error)
+	AddAttempt(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error)
+}
+
+type PasswordResetRepoImpl struct {
+	storage datastore.Storage
+}
+
+func NewPasswordResetRepo(storage datastore.Storage) PasswordResetRepo {
+	return &PasswordResetRepoImpl{storage: storage}
+}
+
+func (r *PasswordResetRepoImpl) CreateResetToken(ctx context.Context, userID uint) (string, error) {
+	token := uuid.New().String()
+	if token == "" {
+		return "", errors.New("failed to generate password reset token")
+	}
+	err := r.storage.Cache().Set(
+		ctx,
+		fmt.Sprintf("password-reset-token:%s", token),
+		userID,
+		viper.GetDuration("auth.password_reset.token_lifetime"),
+	).Err()
+
+	if err != nil {
+		return "", errors.New("failed to cache password reset token")
+	}
+
+	return token, nil
+}
+
+// ConsumeToken returns the user ID the token was issued for and deletes the
+// token in the same operation, so a token can be used only once.
+func (r *PasswordResetRepoImpl) ConsumeToken(ctx context.Context, token string) (uint, error) {
+	userIDString, err := r.storage.Cache().GetDel(
+		ctx,
+		fmt.Sprintf("password-reset-token:%s", token),
+	).Result()
+	if err == redis.Nil {
+		return 0, ErrInvalidToken
+	} else if err != nil {
+		return 0, errors.Join(errors.New("failed to get password reset token"), err)
+	}
+
+	userID, err := strconv.ParseUint(userIDString, 10, 32)
+	if err != nil {
+		return 0, errors.New("failed to parse user ID")
+	}
+
+	return uint(userID), nil
+}
+
+// RestoreToken puts a consumed token back for another lifetime, unless it
+// is already there, so that a reset that failed can be retried with the same
+// link
+func (r *PasswordResetRepoImpl) RestoreToken(ctx context.Context, token string, userID uint) error {
+	err := r.storage.Cache().SetNX(
+		ctx,
+		fmt.Sprintf("password-reset-token:%s", token),
+		userID,
+		viper.GetDuration("auth.password_reset.token_lifetime"),
+	).Err()
+	if err != nil {
+		return errors.Join(errors.New("failed to restore password reset token"), err)
+	}
+
+	return nil
+}
+
+// AcquireCooldown holds the key for the cooldown. It returns zero if the key
+// was free, otherwise the time left until it is released.
+func (r *PasswordResetRepoImpl) AcquireCooldown(ctx context.Context, key string, cooldown time.Duration) (time.Duration, error) {
+	cooldownKey := fmt.Sprintf("password-reset-cooldown:%s", key)
+
+	acquired, err := r.storage.Cache().SetNX(ctx, cooldownKey, 1, cooldown).Result()
+	if err != nil {
+		return 0, errors.Join(errors.New("failed to acquire password reset cooldown"), err)
+	}
+	if acquired {
+		return 0, nil
+	}
+
+	ttl, err := r.storage.Cache().PTTL(ctx, cooldownKey).Result()
+	if err != nil {
+		return 0, errors.Join(errors.New("failed to get password reset cooldown"), err)
+	}
+
+	return max(ttl, 0), nil
+}
+
+// AddAttempt counts an attempt in a window starting with the first one and
+// returns the count along with the time left in the window
+func (r *PasswordResetRepoImpl) AddAttempt(ctx context.Context, key string, window time.Duration) (int64, time.Duration, error) {
+	attemptsKey := fmt.Sprintf("password-reset-attempts:%s", key)
+
+	var (
+		count *redis.IntCmd
+		ttl   *redis.DurationCmd
+	)
+	_, err := r.storage.Cache().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		count = pipe.Incr(ctx, attemptsKey)
+		pipe.ExpireNX(ctx, attemptsKey, window)
+		ttl = pipe.PTTL(ctx, attemptsKey)
+		return nil
+	})
+	if err != nil {
+		return 0, 0, errors.Join(errors.New("failed to count password reset attempt"), err)
+	}
+
+	return count.Val(), max(ttl.Val(), 0), nil
+}
@@ -0,0 +1,97 @@
+package passreset_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/users/auth/passreset"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	storage datastore.MockStorage
+)
+
+func TestMain(m *testing.M) {
+	s, cleanup := datastore.InitMockStorage()
+	storage = s
+
+	viper.Set("auth.password_reset.token_lifetime", "15m")
+
+	code := m.Run()
+
+	cleanup()
+	os.Exit(code)
+}
+
+func setupTestRepo(t *testing.T) passreset.PasswordResetRepo {
+	t.Cleanup(func() {
+		err := storage.Flush()
+		assert.NoError(t, err)
+	})
+
+	return passreset.NewPasswordResetRepo(storage)
+}
+
+func TestCreateResetToken(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	token, err := repo.CreateResetToken(ctx, 1)
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+
+	// Verify token in Redis
+	val, err := storage.Cache().Get(context.Background(), fmt.Sprintf("password-reset-token:%s", token)).Result()
+	require.NoError(t, err)
+	assert.Equal(t, "1", val)
+
+	// Verify TTL was set
+	ttl, err := storage.Cache().TTL(context.Background(), fmt.Sprintf("password-reset-token:%s", token)).Result()
+	require.NoError(t, err)
+	assert.True(t, ttl > 0)
+}
+
+func TestConsumeToken(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	// Test with invalid token
+	_, err := repo.ConsumeToken(ctx, "invalid-token")
+	assert.ErrorIs(t, err, passreset.ErrInvalidToken)
+
+	// Test with valid token
+	token, err := repo.CreateResetToken(ctx, 1)
+	require.NoError(t, err)
+
+	userID, err := repo.ConsumeToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), userID)
+
+	// Token can only be used once
+	_, err = repo.ConsumeToken(ctx, token)
+	assert.ErrorIs(t, err, passreset.ErrInvalidToken)
+}
+
+func TestRestoreToken(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	token, err := repo.CreateResetToken(ctx, 1)
+	require.NoError(t, err)
+
+	_, err = repo.ConsumeToken(ctx, token)
+	require.NoError(t, err)
+
+	// A restored token can be used again
+	require.NoError(t, repo.RestoreToken(ctx, token, 1))
+
+	userID, err := repo.ConsumeToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), userID)
+}
@@ -0,0 +1,63 @@
+package passreset
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/mailing"
+	"github.com/spf13/viper"
+)
+
+type PasswordResetService interface {
+	SendResetEmail(ctx context.Context, email, login string, userID uint) error
+	ConsumeToken(ctx context.Context, token string) (uint, error)
+	RestoreToken(ctx context.Context, token string, userID uint) error
+	CheckRequest(ctx context.Context, email, ip string) (time.Duration, error)
+}
+
+type PasswordResetServiceImpl struct {
+	repo           PasswordResetRepo
+	mailingService mailing.MailingService
+}
+
+func NewPasswordResetService(repo PasswordResetRepo, mailingService mailing.MailingService) PasswordResetService {
+	return &PasswordResetServiceImpl{
+		repo:           repo,
+		mailingService: mailingService,
+	}
+}
+
+func (s *PasswordResetServiceImpl) SendResetEmail(ctx context.Context, email, login string, userID uint) error {
+	token, err := s.repo.CreateResetToken(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	return s.mailingService.SendPasswordReset(ctx, email, login, token)
+}
+
+func (s *PasswordResetServiceImpl) ConsumeToken(ctx context.Context, token string) (uint, error) {
+	return s.repo.ConsumeToken(ctx, token)
+}
+
+func (s *PasswordResetServiceImpl) RestoreToken(ctx context.Context, token string, userID uint) error {
+	return s.repo.RestoreToken(ctx, token, userID)
+}
+
+// CheckRequest returns how long the caller has to wait before another reset
+// link can be requested, zero if it can be sent right away. The limits
+// apply whether or not the email is registered, so they do not reveal it.
+func (s *PasswordResetServiceImpl) CheckRequest(ctx context.Context, email, ip string) (time.Duration, error) {
+	attempts, windowLeft, err := s.repo.AddAttempt(ctx, fmt.Sprintf("ip:%s", ip), viper.GetDuration("auth.password_reset.request_window"))
+	if err != nil {
+		return 0, err
+	}
+	if attempts > viper.GetInt64("auth.password_reset.request_limit") {
+		return windowLeft, nil
+	}
+
+	emailKey := fmt.Sprintf("email:%s", strings.ToLower(strings.TrimSpace(email)))
+	return s.repo.AcquireCooldown(ctx, emailKey, viper.GetDuration("auth.password_reset.request_cooldown"))
+}
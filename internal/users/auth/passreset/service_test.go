@@ -0,0 +1,91 @@
+package passreset_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/L2SH-Dev/admissions/internal/mailing"
+	"github.com/L2SH-Dev/admissions/internal/users/auth/passreset"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTestService(t *testing.T) (passreset.PasswordResetService, string) {
+	t.Cleanup(func() {
+		err := storage.Flush()
+		assert.NoError(t, err)
+	})
+
+	mailbox := filepath.Join(t.TempDir(), "mail.mbox")
+	mailingService := mailing.NewMailingService(mailing.NewFileMailer(mailbox, "noreply@example.com"))
+
+	repo := passreset.NewPasswordResetRepo(storage)
+	return passreset.NewPasswordResetService(repo, mailingService), mailbox
+}
+
+func getTokenFromRedis(t *testing.T) string {
+	keys, err := storage.Cache().Keys(context.Background(), "password-reset-token:*").Result()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+
+	return keys[0][len("password-reset-token:"):]
+}
+
+func TestSendResetEmail(t *testing.T) {
+	ctx := context.Background()
+	service, mailbox := setupTestService(t)
+
+	err := service.SendResetEmail(ctx, "test@example.com", "t.user-00001", 1)
+	assert.NoError(t, err)
+
+	token := getTokenFromRedis(t)
+	assert.NotEmpty(t, token)
+
+	mail, err := os.ReadFile(mailbox)
+	require.NoError(t, err)
+	assert.Contains(t, string(mail), "t.user-00001")
+	assert.Contains(t, string(mail), token)
+
+	userID, err := service.ConsumeToken(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), userID)
+
+	_, err = service.ConsumeToken(ctx, token)
+	assert.Error(t, err)
+}
+
+func TestCheckRequest(t *testing.T) {
+	ctx := context.Background()
+	service, _ := setupTestService(t)
+
+	viper.Set("auth.password_reset.request_cooldown", "1m")
+	viper.Set("auth.password_reset.request_limit", 3)
+	viper.Set("auth.password_reset.request_window", "1h")
+
+	retryAfter, err := service.CheckRequest(ctx, "test@example.com", "127.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+
+	// Same email, case does not matter
+	retryAfter, err = service.CheckRequest(ctx, "Test@Example.com", "127.0.0.2")
+	require.NoError(t, err)
+	assert.Greater(t, retryAfter, time.Duration(0))
+	assert.LessOrEqual(t, retryAfter, time.Minute)
+
+	// Other emails from the same IP until the limit is reached
+	retryAfter, err = service.CheckRequest(ctx, "other@example.com", "127.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+
+	retryAfter, err = service.CheckRequest(ctx, "third@example.com", "127.0.0.1")
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+
+	retryAfter, err = service.CheckRequest(ctx, "fourth@example.com", "127.0.0.1")
+	require.NoError(t, err)
+	assert.Greater(t, retryAfter, time.Minute)
+}
@@ -1,6 +1,7 @@
 package passwords
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -10,9 +11,11 @@ import (
 )
 
 type PasswordsRepo interface {
-	Create(userID uint, hashedPassword *crypto.HashedPassword) error
-	GetByUserID(userID uint) (*Password, error)
-	ExistsByUserID(userID uint) (bool, error)
+	Create(ctx context.Context, userID uint, hashedPassword *crypto.HashedPassword) error
+	Update(ctx context.Context, userID uint, hashedPassword *crypto.HashedPassword) error
+	GetByUserID(ctx context.Context, userID uint) (*Password, error)
+	ExistsByUserID(ctx context.Context, userID uint) (bool, error)
+	WithTx(tx datastore.Storage) PasswordsRepo
 }
 
 type PasswordsRepoImpl struct {
@@ -20,13 +23,14 @@ type PasswordsRepoImpl struct {
 }
 
 func NewPasswordsRepo(storage datastore.Storage) PasswordsRepo {
-	if err := storage.DB().AutoMigrate(&Password{}); err != nil {
-		panic(err)
-	}
 	return &PasswordsRepoImpl{storage: storage}
 }
 
-func (r *PasswordsRepoImpl) Create(userID uint, hashedPassword *crypto.HashedPassword) error {
+func (r *PasswordsRepoImpl) WithTx(tx datastore.Storage) PasswordsRepo {
+	return &PasswordsRepoImpl{storage: tx}
+}
+
+func (r *PasswordsRepoImpl) Create(ctx context.Context, userID uint, hashedPassword *crypto.HashedPassword) error {
 	record := Password{
 		UserID:    userID,
 		Hash:      hashedPassword.Hash,
@@ -34,16 +38,32 @@ func (r *PasswordsRepoImpl) Create(userID uint, hashedPassword *crypto.HashedPas
 		Algorithm: hashedPassword.Algorithm,
 	}
 
-	if err := r.storage.DB().Create(&record).Error; err != nil {
+	if err := r.storage.DB().WithContext(ctx).Create(&record).Error; err != nil {
 		return fmt.Errorf("failed to create password record: %w", err)
 	}
 
 	return nil
 }
 
-func (r *PasswordsRepoImpl) GetByUserID(userID uint) (*Password, error) {
+func (r *PasswordsRepoImpl) Update(ctx context.Context, userID uint, hashedPassword *crypto.HashedPassword) error {
+	result := r.storage.DB().WithContext(ctx).Model(&Password{}).Where("user_id = ?", userID).Updates(Password{
+		Hash:      hashedPassword.Hash,
+		Salt:      hashedPassword.Salt,
+		Algorithm: hashedPassword.Algorithm,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update password record: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("password not found for user ID %d", userID)
+	}
+
+	return nil
+}
+
+func (r *PasswordsRepoImpl) GetByUserID(ctx context.Context, userID uint) (*Password, error) {
 	var record Password
-	if err := r.storage.DB().Where("user_id = ?", userID).First(&record).Error; err != nil {
+	if err := r.storage.DB().WithContext(ctx).Where("user_id = ?", userID).First(&record).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return nil, fmt.Errorf("password not found for user ID %d", userID)
 		}
@@ -53,9 +73,9 @@ func (r *PasswordsRepoImpl) GetByUserID(userID uint) (*Password, error) {
 	return &record, nil
 }
 
-func (r *PasswordsRepoImpl) ExistsByUserID(userID uint) (bool, error) {
+func (r *PasswordsRepoImpl) ExistsByUserID(ctx context.Context, userID uint) (bool, error) {
 	var count int64
-	if err := r.storage.DB().Model(&Password{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+	if err := r.storage.DB().WithContext(ctx).Model(&Password{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
 		return false, fmt.Errorf("failed to check existence for user ID %d: %w", userID, err)
 	}
 	return count > 0, nil
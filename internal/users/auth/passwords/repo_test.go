@@ -1,10 +1,12 @@
 package passwords_test
 
 import (
+	"context"
 	"os"
 	"testing"
 
 	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/migrations"
 	"github.com/L2SH-Dev/admissions/internal/users/auth/passwords"
 	"github.com/L2SH-Dev/admissions/internal/users/auth/passwords/crypto"
 	"github.com/spf13/viper"
@@ -34,6 +36,9 @@ func setupTestRepo(t *testing.T) passwords.PasswordsRepo {
 		assert.NoError(t, err)
 	})
 
+	_, err := migrations.Up(storage.DB())
+	require.NoError(t, err)
+
 	return passwords.NewPasswordsRepo(storage)
 }
 
@@ -43,6 +48,7 @@ func TestNewPasswordsRepo(t *testing.T) {
 }
 
 func TestCreate(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	hashedPassword := &crypto.HashedPassword{
@@ -51,10 +57,10 @@ func TestCreate(t *testing.T) {
 		Algorithm: "argon2id",
 	}
 
-	err := repo.Create(1, hashedPassword)
+	err := repo.Create(ctx, 1, hashedPassword)
 	require.NoError(t, err)
 
-	record, err := repo.GetByUserID(1)
+	record, err := repo.GetByUserID(ctx, 1)
 	require.NoError(t, err)
 	assert.Equal(t, hashedPassword.Hash, record.Hash)
 	assert.Equal(t, hashedPassword.Salt, record.Salt)
@@ -62,6 +68,7 @@ func TestCreate(t *testing.T) {
 }
 
 func TestGetByUserID(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	hashedPassword := &crypto.HashedPassword{
@@ -70,10 +77,10 @@ func TestGetByUserID(t *testing.T) {
 		Algorithm: "argon2id",
 	}
 
-	err := repo.Create(1, hashedPassword)
+	err := repo.Create(ctx, 1, hashedPassword)
 	require.NoError(t, err)
 
-	record, err := repo.GetByUserID(1)
+	record, err := repo.GetByUserID(ctx, 1)
 	require.NoError(t, err)
 	assert.Equal(t, hashedPassword.Hash, record.Hash)
 	assert.Equal(t, hashedPassword.Salt, record.Salt)
@@ -81,6 +88,7 @@ func TestGetByUserID(t *testing.T) {
 }
 
 func TestExistsByUserID(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	hashedPassword := &crypto.HashedPassword{
@@ -89,14 +97,46 @@ func TestExistsByUserID(t *testing.T) {
 		Algorithm: "argon2id",
 	}
 
-	err := repo.Create(1, hashedPassword)
+	err := repo.Create(ctx, 1, hashedPassword)
 	require.NoError(t, err)
 
-	exists, err := repo.ExistsByUserID(1)
+	exists, err := repo.ExistsByUserID(ctx, 1)
 	require.NoError(t, err)
 	assert.True(t, exists)
 
-	exists, err = repo.ExistsByUserID(2)
+	exists, err = repo.ExistsByUserID(ctx, 2)
 	require.NoError(t, err)
 	assert.False(t, exists)
 }
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	hashedPassword := &crypto.HashedPassword{
+		Hash:      []byte("hashedpassword"),
+		Salt:      []byte("salt"),
+		Algorithm: "argon2id",
+	}
+
+	err := repo.Create(ctx, 1, hashedPassword)
+	require.NoError(t, err)
+
+	newHashedPassword := &crypto.HashedPassword{
+		Hash:      []byte("newhashedpassword"),
+		Salt:      []byte("newsalt"),
+		Algorithm: "argon2id",
+	}
+
+	err = repo.Update(ctx, 1, newHashedPassword)
+	require.NoError(t, err)
+
+	record, err := repo.GetByUserID(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, newHashedPassword.Hash, record.Hash)
+	assert.Equal(t, newHashedPassword.Salt, record.Salt)
+
+	// Updating a non-existent record fails
+	err = repo.Update(ctx, 2, newHashedPassword)
+	assert.Error(t, err)
+}
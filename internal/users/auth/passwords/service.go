@@ -1,11 +1,13 @@
 package passwords
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
 	"unicode"
 
+	"github.com/L2SH-Dev/admissions/internal/datastore"
 	"github.com/L2SH-Dev/admissions/internal/users/auth/passwords/crypto"
 	"github.com/spf13/viper"
 	"golang.org/x/exp/rand"
@@ -21,11 +23,13 @@ var (
 )
 
 type PasswordsService interface {
-	GetByUserID(userID uint) (*Password, error)
-	Create(userID uint, password string) error
+	GetByUserID(ctx context.Context, userID uint) (*Password, error)
+	Create(ctx context.Context, userID uint, password string) error
+	Update(ctx context.Context, userID uint, password string) error
 	Validate(password string) error
-	Verify(userID uint, password string) (bool, error)
+	Verify(ctx context.Context, userID uint, password string) (bool, error)
 	Generate() string
+	WithTx(tx datastore.Storage) PasswordsService
 }
 
 type PasswordsServiceImpl struct {
@@ -40,20 +44,24 @@ func NewPasswordsService(repo PasswordsRepo) PasswordsService {
 	}
 }
 
-func (s *PasswordsServiceImpl) GetByUserID(userID uint) (*Password, error) {
-	record, err := s.repo.GetByUserID(userID)
+func (s *PasswordsServiceImpl) WithTx(tx datastore.Storage) PasswordsService {
+	return &PasswordsServiceImpl{crypto: s.crypto, repo: s.repo.WithTx(tx)}
+}
+
+func (s *PasswordsServiceImpl) GetByUserID(ctx context.Context, userID uint) (*Password, error) {
+	record, err := s.repo.GetByUserID(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get password record: %w", err)
 	}
 	return record, nil
 }
 
-func (s *PasswordsServiceImpl) Create(userID uint, password string) error {
+func (s *PasswordsServiceImpl) Create(ctx context.Context, userID uint, password string) error {
 	if err := s.Validate(password); err != nil {
 		return fmt.Errorf("invalid password: %w", err)
 	}
 
-	exists, err := s.repo.ExistsByUserID(userID)
+	exists, err := s.repo.ExistsByUserID(ctx, userID)
 	if err != nil {
 		return fmt.Errorf("failed to check if password exists: %w", err)
 	}
@@ -66,7 +74,20 @@ func (s *PasswordsServiceImpl) Create(userID uint, password string) error {
 		return fmt.Errorf("failed to generate hash: %w", err)
 	}
 
-	return s.repo.Create(userID, hashedPassword)
+	return s.repo.Create(ctx, userID, hashedPassword)
+}
+
+func (s *PasswordsServiceImpl) Update(ctx context.Context, userID uint, password string) error {
+	if err := s.Validate(password); err != nil {
+		return fmt.Errorf("invalid password: %w", err)
+	}
+
+	hashedPassword, err := s.crypto.GenerateHash([]byte(password))
+	if err != nil {
+		return fmt.Errorf("failed to generate hash: %w", err)
+	}
+
+	return s.repo.Update(ctx, userID, hashedPassword)
 }
 
 func (s *PasswordsServiceImpl) Validate(password string) error {
@@ -110,8 +131,8 @@ func (s *PasswordsServiceImpl) Validate(password string) error {
 	return nil
 }
 
-func (s *PasswordsServiceImpl) Verify(userID uint, password string) (bool, error) {
-	record, err := s.GetByUserID(userID)
+func (s *PasswordsServiceImpl) Verify(ctx context.Context, userID uint, password string) (bool, error) {
+	record, err := s.GetByUserID(ctx, userID)
 	if err != nil {
 		return false, fmt.Errorf("failed to retrieve password: %w", err)
 	}
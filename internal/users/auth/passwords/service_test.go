@@ -1,6 +1,7 @@
 package passwords_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/L2SH-Dev/admissions/internal/users/auth/passwords"
@@ -20,12 +21,13 @@ func setupTestService(t *testing.T) passwords.PasswordsService {
 }
 
 func TestPasswordsService_Create(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	err := service.Create(1, "Valid1Password!")
+	err := service.Create(ctx, 1, "Valid1Password!")
 	require.NoError(t, err)
 
-	record, err := service.GetByUserID(1)
+	record, err := service.GetByUserID(ctx, 1)
 	require.NoError(t, err)
 	assert.NotNil(t, record)
 }
@@ -56,16 +58,39 @@ func TestPasswordsService_Validate(t *testing.T) {
 }
 
 func TestPasswordsService_Verify(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	err := service.Create(1, "Valid1Password!")
+	err := service.Create(ctx, 1, "Valid1Password!")
 	require.NoError(t, err)
 
-	match, err := service.Verify(1, "Valid1Password!")
+	match, err := service.Verify(ctx, 1, "Valid1Password!")
 	require.NoError(t, err)
 	assert.True(t, match)
 
-	match, err = service.Verify(1, "InvalidPassword!")
+	match, err = service.Verify(ctx, 1, "InvalidPassword!")
 	require.NoError(t, err)
 	assert.False(t, match)
 }
+
+func TestPasswordsService_Update(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	err := service.Create(ctx, 1, "Valid1Password!")
+	require.NoError(t, err)
+
+	err = service.Update(ctx, 1, "short")
+	assert.ErrorIs(t, err, passwords.ErrPasswordTooShort)
+
+	err = service.Update(ctx, 1, "New1Password!")
+	require.NoError(t, err)
+
+	match, err := service.Verify(ctx, 1, "Valid1Password!")
+	require.NoError(t, err)
+	assert.False(t, match)
+
+	match, err = service.Verify(ctx, 1, "New1Password!")
+	require.NoError(t, err)
+	assert.True(t, match)
+}
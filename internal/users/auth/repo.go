@@ -2,9 +2,11 @@ package auth
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"log/slog"
+	"sort"
+	"time"
 
 	"github.com/L2SH-Dev/admissions/internal/datastore"
 	"github.com/L2SH-Dev/admissions/internal/users/auth/authjwt"
@@ -12,13 +14,19 @@ import (
 	"github.com/spf13/viper"
 )
 
-var ErrInvalidTokenPair = errors.New("invalid token pair")
+var (
+	ErrInvalidTokenPair = errors.New("invalid token pair")
+	ErrSessionNotFound  = errors.New("session not found")
+)
 
 type AuthRepo interface {
-	CacheTokenPair(tokenPair *TokenPair) error
-	ExtendTokenPairCacheExpiration(userID uint)
-	IsTokenCached(claims *authjwt.JWTClaims) (bool, error)
-	DeleteTokenPair(userID uint)
+	CacheTokenPair(ctx context.Context, tokenPair *TokenPair, client *ClientInfo) error
+	RotateTokenPair(ctx context.Context, refreshClaims *authjwt.JWTClaims, tokenPair *TokenPair, client *ClientInfo) error
+	ExtendTokenPairCacheExpiration(ctx context.Context, claims *authjwt.JWTClaims)
+	IsTokenCached(ctx context.Context, claims *authjwt.JWTClaims) (bool, error)
+	ListSessions(ctx context.Context, userID uint) ([]*Session, error)
+	DeleteSession(ctx context.Context, userID uint, sessionID string) error
+	DeleteAllSessions(ctx context.Context, userID uint)
 }
 
 type TokenPair struct {
@@ -26,6 +34,21 @@ type TokenPair struct {
 	Refresh string `json:"refresh"`
 }
 
+// ClientInfo describes the device a session was started or refreshed from
+type ClientInfo struct {
+	Device string
+	IP     string
+}
+
+type Session struct {
+	ID        string    `json:"id"`
+	Device    string    `json:"device"`
+	IP        string    `json:"ip"`
+	CreatedAt time.Time `json:"created_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	Current   bool      `json:"current"`
+}
+
 type AuthRepoImpl struct {
 	storage    datastore.Storage
 	jwtService authjwt.JWTService
@@ -38,72 +61,237 @@ func NewAuthRepo(storage datastore.Storage) AuthRepo {
 	}
 }
 
-type tokenUIDPair struct {
-	AccessUID  string `json:"access_uid"`
-	RefreshUID string `json:"refresh_uid"`
+// Every session is a hash holding the UIDs of its current token pair along
+// with client details. The per-user set indexes the sessions so that they
+// can be listed and revoked together.
+func sessionKey(userID uint, sessionID string) string {
+	return fmt.Sprintf("session-%d-%s", userID, sessionID)
 }
 
-func (r *AuthRepoImpl) CacheTokenPair(tokenPair *TokenPair) error {
+func sessionsIndexKey(userID uint) string {
+	return fmt.Sprintf("sessions-%d", userID)
+}
+
+func (r *AuthRepoImpl) parseTokenPair(tokenPair *TokenPair) (*authjwt.JWTClaims, *authjwt.JWTClaims, error) {
 	accessClaims, err := r.jwtService.ParseToken(tokenPair.Access)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	refreshClaims, err := r.jwtService.ParseToken(tokenPair.Refresh)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	if accessClaims.UserID != refreshClaims.UserID {
-		return errors.Join(ErrInvalidTokenPair, errors.New("user IDs do not match"))
+		return nil, nil, errors.Join(ErrInvalidTokenPair, errors.New("user IDs do not match"))
+	}
+
+	if accessClaims.SessionID == "" || accessClaims.SessionID != refreshClaims.SessionID {
+		return nil, nil, errors.Join(ErrInvalidTokenPair, errors.New("session IDs do not match"))
+	}
+
+	return accessClaims, refreshClaims, nil
+}
+
+func (r *AuthRepoImpl) CacheTokenPair(ctx context.Context, tokenPair *TokenPair, client *ClientInfo) error {
+	accessClaims, refreshClaims, err := r.parseTokenPair(tokenPair)
+	if err != nil {
+		return err
 	}
 
-	cached := tokenUIDPair{
-		AccessUID:  accessClaims.UID,
-		RefreshUID: refreshClaims.UID,
+	if client == nil {
+		client = &ClientInfo{}
 	}
 
-	cacheJson, err := json.Marshal(cached)
+	userID := accessClaims.UserID
+	key := sessionKey(userID, accessClaims.SessionID)
+	now := time.Now().UTC().Format(time.RFC3339)
+	lifetime := viper.GetDuration("auth.auto_logout")
+
+	_, err = r.storage.Cache().TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key,
+			"access_uid", accessClaims.UID,
+			"refresh_uid", refreshClaims.UID,
+			"device", client.Device,
+			"ip", client.IP,
+			"last_seen", now,
+		)
+		pipe.HSetNX(ctx, key, "created_at", now)
+		pipe.Expire(ctx, key, lifetime)
+		pipe.SAdd(ctx, sessionsIndexKey(userID), accessClaims.SessionID)
+		pipe.Expire(ctx, sessionsIndexKey(userID), lifetime)
+		return nil
+	})
+	return err
+}
+
+// RotateTokenPair replaces the token pair of the session refreshClaims belong
+// to. It returns ErrSessionNotFound if the session was revoked or the refresh
+// token was already rotated.
+func (r *AuthRepoImpl) RotateTokenPair(ctx context.Context, refreshClaims *authjwt.JWTClaims, tokenPair *TokenPair, client *ClientInfo) error {
+	accessClaims, newRefreshClaims, err := r.parseTokenPair(tokenPair)
 	if err != nil {
 		return err
 	}
 
+	if accessClaims.UserID != refreshClaims.UserID || accessClaims.SessionID != refreshClaims.SessionID {
+		return errors.Join(ErrInvalidTokenPair, errors.New("token pair belongs to another session"))
+	}
+
+	if client == nil {
+		client = &ClientInfo{}
+	}
+
 	userID := accessClaims.UserID
-	return r.storage.Cache().Set(context.Background(), fmt.Sprintf("token-%d", userID), cacheJson, viper.GetDuration("auth.auto_logout")).Err()
+	keys := []string{sessionKey(userID, accessClaims.SessionID), sessionsIndexKey(userID)}
+	lifetime := viper.GetDuration("auth.auto_logout")
+
+	rotated, err := r.storage.Cache().Eval(ctx, rotateSessionScript, keys,
+		refreshClaims.UID,
+		accessClaims.UID,
+		newRefreshClaims.UID,
+		client.Device,
+		client.IP,
+		time.Now().UTC().Format(time.RFC3339),
+		lifetime.Milliseconds(),
+		accessClaims.SessionID,
+	).Int()
+	if err != nil {
+		return errors.Join(errors.New("failed to rotate token pair"), err)
+	}
+
+	if rotated == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
 }
 
-func (r *AuthRepoImpl) ExtendTokenPairCacheExpiration(userID uint) {
+// rotateSessionScript writes the new token pair only if the session still
+// holds the presented refresh token, so that a session revoked in the
+// meantime is not recreated and a refresh token is used only once
+var rotateSessionScript = `
+if redis.call("HGET", KEYS[1], "refresh_uid") ~= ARGV[1] then
+	return 0
+end
+redis.call("HSET", KEYS[1], "access_uid", ARGV[2], "refresh_uid", ARGV[3], "device", ARGV[4], "ip", ARGV[5], "last_seen", ARGV[6])
+redis.call("PEXPIRE", KEYS[1], ARGV[7])
+redis.call("SADD", KEYS[2], ARGV[8])
+redis.call("PEXPIRE", KEYS[2], ARGV[7])
+return 1
+`
+
+func (r *AuthRepoImpl) ExtendTokenPairCacheExpiration(ctx context.Context, claims *authjwt.JWTClaims) {
+	// The request may be over before the session is extended
+	ctx = context.WithoutCancel(ctx)
 	go func() {
-		r.storage.Cache().Expire(context.Background(), fmt.Sprintf("token-%d", userID), viper.GetDuration("auth.auto_logout"))
+		keys := []string{sessionKey(claims.UserID, claims.SessionID), sessionsIndexKey(claims.UserID)}
+		lifetime := viper.GetDuration("auth.auto_logout")
+
+		err := r.storage.Cache().Eval(ctx, extendSessionScript, keys, lifetime.Milliseconds(), time.Now().UTC().Format(time.RFC3339)).Err()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			slog.WarnContext(ctx, "Failed to extend session", slog.Any("user_id", claims.UserID), slog.Any("err", err))
+		}
 	}()
 }
 
-func (r *AuthRepoImpl) IsTokenCached(claims *authjwt.JWTClaims) (bool, error) {
-	cacheJson, err := r.storage.Cache().Get(context.Background(), fmt.Sprintf("token-%d", claims.UserID)).Result()
+// extendSessionScript touches the session only if it still exists, so that
+// a session revoked in the meantime is not recreated without its token UIDs
+// and a TTL
+var extendSessionScript = `
+if redis.call("PEXPIRE", KEYS[1], ARGV[1]) == 1 then
+	redis.call("HSET", KEYS[1], "last_seen", ARGV[2])
+	redis.call("PEXPIRE", KEYS[2], ARGV[1])
+	return 1
+end
+return 0
+`
+
+func (r *AuthRepoImpl) IsTokenCached(ctx context.Context, claims *authjwt.JWTClaims) (bool, error) {
+	var field string
+	switch claims.Type {
+	case "access":
+		field = "access_uid"
+	case "refresh":
+		field = "refresh_uid"
+	default:
+		return false, fmt.Errorf("invalid token type: %s", claims.Type)
+	}
+
+	if claims.SessionID == "" {
+		return false, nil // Tokens issued before sessions were introduced
+	}
+
+	cachedUID, err := r.storage.Cache().HGet(ctx, sessionKey(claims.UserID, claims.SessionID), field).Result()
 	if err == redis.Nil {
 		return false, nil // No such key in Redis cache
 	} else if err != nil {
 		return false, errors.Join(errors.New("failed to get token from cache"), err)
 	}
 
-	var cached tokenUIDPair
-	if err := json.Unmarshal([]byte(cacheJson), &cached); err != nil {
-		return false, errors.Join(errors.New("failed to unmarshal token from cache"), err)
+	return claims.UID == cachedUID, nil
+}
+
+func (r *AuthRepoImpl) ListSessions(ctx context.Context, userID uint) ([]*Session, error) {
+	sessionIDs, err := r.storage.Cache().SMembers(ctx, sessionsIndexKey(userID)).Result()
+	if err != nil {
+		return nil, errors.Join(errors.New("failed to list sessions"), err)
 	}
 
-	var cachedUID string
-	switch claims.Type {
-	case "access":
-		cachedUID = cached.AccessUID
-	case "refresh":
-		cachedUID = cached.RefreshUID
-	default:
-		return false, fmt.Errorf("invalid token type: %s", claims.Type)
+	sessions := make([]*Session, 0, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		fields, err := r.storage.Cache().HGetAll(ctx, sessionKey(userID, sessionID)).Result()
+		if err != nil {
+			return nil, errors.Join(errors.New("failed to get session"), err)
+		}
+
+		// Session expired, drop it from the index
+		if len(fields) == 0 {
+			r.storage.Cache().SRem(ctx, sessionsIndexKey(userID), sessionID)
+			continue
+		}
+
+		session := &Session{
+			ID:     sessionID,
+			Device: fields["device"],
+			IP:     fields["ip"],
+		}
+		session.CreatedAt, _ = time.Parse(time.RFC3339, fields["created_at"])
+		session.LastSeen, _ = time.Parse(time.RFC3339, fields["last_seen"])
+		sessions = append(sessions, session)
 	}
 
-	return claims.UID == cachedUID, nil
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+
+	return sessions, nil
+}
+
+func (r *AuthRepoImpl) DeleteSession(ctx context.Context, userID uint, sessionID string) error {
+	deleted, err := r.storage.Cache().Del(ctx, sessionKey(userID, sessionID)).Result()
+	if err != nil {
+		return errors.Join(errors.New("failed to delete session"), err)
+	}
+
+	r.storage.Cache().SRem(ctx, sessionsIndexKey(userID), sessionID)
+
+	if deleted == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
 }
 
-func (r *AuthRepoImpl) DeleteTokenPair(userID uint) {
-	r.storage.Cache().Del(context.Background(), fmt.Sprintf("token-%d", userID))
+func (r *AuthRepoImpl) DeleteAllSessions(ctx context.Context, userID uint) {
+	sessionIDs := r.storage.Cache().SMembers(ctx, sessionsIndexKey(userID)).Val()
+
+	keys := make([]string, 0, len(sessionIDs)+1)
+	for _, sessionID := range sessionIDs {
+		keys = append(keys, sessionKey(userID, sessionID))
+	}
+	keys = append(keys, sessionsIndexKey(userID))
+
+	r.storage.Cache().Del(ctx, keys...)
 }
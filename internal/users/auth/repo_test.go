@@ -1,8 +1,10 @@
 package auth_test
 
 import (
+	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/L2SH-Dev/admissions/internal/datastore"
 	"github.com/L2SH-Dev/admissions/internal/users/auth"
@@ -39,15 +41,53 @@ func setupTestRepo(t *testing.T) auth.AuthRepo {
 	return auth.NewAuthRepo(storage)
 }
 
+func newTestTokenPair(t *testing.T, userID uint, sessionID string) *auth.TokenPair {
+	jwtService := authjwt.NewJWTService()
+
+	access, err := jwtService.NewAccessToken(userID, sessionID)
+	assert.NoError(t, err)
+
+	refresh, err := jwtService.NewRefreshToken(userID, sessionID)
+	assert.NoError(t, err)
+
+	return &auth.TokenPair{
+		Access:  access,
+		Refresh: refresh,
+	}
+}
+
+func parseTestTokenPair(t *testing.T, pair *auth.TokenPair) (*authjwt.JWTClaims, *authjwt.JWTClaims) {
+	jwtService := authjwt.NewJWTService()
+
+	accessClaims, err := jwtService.ParseToken(pair.Access)
+	assert.NoError(t, err)
+
+	refreshClaims, err := jwtService.ParseToken(pair.Refresh)
+	assert.NoError(t, err)
+
+	return accessClaims, refreshClaims
+}
+
 func TestCacheTokenPair(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	pair := newTestTokenPair(t, 1, "session")
+
+	err := repo.CacheTokenPair(ctx, pair, &auth.ClientInfo{Device: "Firefox", IP: "127.0.0.1"})
+	assert.NoError(t, err)
+}
+
+func TestCacheTokenPair_InvalidTokenPair(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	jwtService := authjwt.NewJWTService()
 
-	access, err := jwtService.NewAccessToken(1)
+	access, err := jwtService.NewAccessToken(1, "session")
 	assert.NoError(t, err)
 
-	refresh, err := jwtService.NewRefreshToken(1)
+	refresh, err := jwtService.NewRefreshToken(2, "session")
 	assert.NoError(t, err)
 
 	pair := &auth.TokenPair{
@@ -55,19 +95,20 @@ func TestCacheTokenPair(t *testing.T) {
 		Refresh: refresh,
 	}
 
-	err = repo.CacheTokenPair(pair)
-	assert.NoError(t, err)
+	err = repo.CacheTokenPair(ctx, pair, nil)
+	assert.Error(t, err)
 }
 
-func TestCacheTokenPair_InvalidTokenPair(t *testing.T) {
+func TestCacheTokenPair_SessionMismatch(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	jwtService := authjwt.NewJWTService()
 
-	access, err := jwtService.NewAccessToken(1)
+	access, err := jwtService.NewAccessToken(1, "session")
 	assert.NoError(t, err)
 
-	refresh, err := jwtService.NewRefreshToken(2)
+	refresh, err := jwtService.NewRefreshToken(1, "other-session")
 	assert.NoError(t, err)
 
 	pair := &auth.TokenPair{
@@ -75,11 +116,12 @@ func TestCacheTokenPair_InvalidTokenPair(t *testing.T) {
 		Refresh: refresh,
 	}
 
-	err = repo.CacheTokenPair(pair)
-	assert.Error(t, err)
+	err = repo.CacheTokenPair(ctx, pair, nil)
+	assert.ErrorIs(t, err, auth.ErrInvalidTokenPair)
 }
 
 func TestCacheTokenPair_InvalidToken(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	pair := &auth.TokenPair{
@@ -87,143 +129,249 @@ func TestCacheTokenPair_InvalidToken(t *testing.T) {
 		Refresh: "invalid token",
 	}
 
-	err := repo.CacheTokenPair(pair)
+	err := repo.CacheTokenPair(ctx, pair, nil)
 	assert.Error(t, err)
 }
 
 func TestIsTokenCached(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
-	jwtService := authjwt.NewJWTService()
-
-	access, err := jwtService.NewAccessToken(1)
-	assert.NoError(t, err)
+	pair := newTestTokenPair(t, 1, "session")
 
-	refresh, err := jwtService.NewRefreshToken(1)
+	err := repo.CacheTokenPair(ctx, pair, nil)
 	assert.NoError(t, err)
 
-	pair := &auth.TokenPair{
-		Access:  access,
-		Refresh: refresh,
-	}
+	accessClaims, refreshClaims := parseTestTokenPair(t, pair)
 
-	err = repo.CacheTokenPair(pair)
-	assert.NoError(t, err)
-
-	accessClaims, err := jwtService.ParseToken(access)
-	assert.NoError(t, err)
-	cached, err := repo.IsTokenCached(accessClaims)
+	cached, err := repo.IsTokenCached(ctx, accessClaims)
 	assert.NoError(t, err)
 	assert.True(t, cached)
 
-	refreshClaims, err := jwtService.ParseToken(refresh)
-	assert.NoError(t, err)
-	cached, err = repo.IsTokenCached(refreshClaims)
+	cached, err = repo.IsTokenCached(ctx, refreshClaims)
 	assert.NoError(t, err)
 	assert.True(t, cached)
 }
 
 func TestIsTokenCached_NotCached(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
-	jwtService := authjwt.NewJWTService()
+	pair := newTestTokenPair(t, 1, "session")
+	accessClaims, _ := parseTestTokenPair(t, pair)
 
-	access, err := jwtService.NewAccessToken(1)
-	assert.NoError(t, err)
-
-	accessClaims, err := jwtService.ParseToken(access)
-	assert.NoError(t, err)
-	cached, err := repo.IsTokenCached(accessClaims)
+	cached, err := repo.IsTokenCached(ctx, accessClaims)
 	assert.NoError(t, err)
 	assert.False(t, cached)
 }
 
-func TestDeleteTokenPair(t *testing.T) {
+func TestIsTokenCached_MultipleSessions(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
-	jwtService := authjwt.NewJWTService()
+	laptop := newTestTokenPair(t, 1, "laptop")
+	phone := newTestTokenPair(t, 1, "phone")
+
+	assert.NoError(t, repo.CacheTokenPair(ctx, laptop, nil))
+	assert.NoError(t, repo.CacheTokenPair(ctx, phone, nil))
 
-	access, err := jwtService.NewAccessToken(1)
+	// Logging in on the phone keeps the laptop session alive
+	laptopClaims, _ := parseTestTokenPair(t, laptop)
+	cached, err := repo.IsTokenCached(ctx, laptopClaims)
 	assert.NoError(t, err)
+	assert.True(t, cached)
 
-	refresh, err := jwtService.NewRefreshToken(1)
+	phoneClaims, _ := parseTestTokenPair(t, phone)
+	cached, err = repo.IsTokenCached(ctx, phoneClaims)
 	assert.NoError(t, err)
+	assert.True(t, cached)
+}
 
-	pair := &auth.TokenPair{
-		Access:  access,
-		Refresh: refresh,
+func TestListSessions(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	assert.NoError(t, repo.CacheTokenPair(ctx, newTestTokenPair(t, 1, "laptop"), &auth.ClientInfo{Device: "Firefox", IP: "10.0.0.1"}))
+	assert.NoError(t, repo.CacheTokenPair(ctx, newTestTokenPair(t, 1, "phone"), &auth.ClientInfo{Device: "Safari", IP: "10.0.0.2"}))
+	assert.NoError(t, repo.CacheTokenPair(ctx, newTestTokenPair(t, 2, "other"), nil))
+
+	sessions, err := repo.ListSessions(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	devices := map[string]string{}
+	for _, session := range sessions {
+		devices[session.ID] = session.Device
+		assert.False(t, session.CreatedAt.IsZero())
+		assert.False(t, session.LastSeen.IsZero())
 	}
+	assert.Equal(t, "Firefox", devices["laptop"])
+	assert.Equal(t, "Safari", devices["phone"])
+}
 
-	err = repo.CacheTokenPair(pair)
+func TestDeleteSession(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	laptop := newTestTokenPair(t, 1, "laptop")
+	phone := newTestTokenPair(t, 1, "phone")
+
+	assert.NoError(t, repo.CacheTokenPair(ctx, laptop, nil))
+	assert.NoError(t, repo.CacheTokenPair(ctx, phone, nil))
+
+	err := repo.DeleteSession(ctx, 1, "laptop")
 	assert.NoError(t, err)
 
-	// Ensure tokens are cached
-	accessClaims, err := jwtService.ParseToken(access)
+	laptopClaims, _ := parseTestTokenPair(t, laptop)
+	cached, err := repo.IsTokenCached(ctx, laptopClaims)
 	assert.NoError(t, err)
-	cached, err := repo.IsTokenCached(accessClaims)
+	assert.False(t, cached)
+
+	phoneClaims, _ := parseTestTokenPair(t, phone)
+	cached, err = repo.IsTokenCached(ctx, phoneClaims)
 	assert.NoError(t, err)
 	assert.True(t, cached)
 
-	refreshClaims, err := jwtService.ParseToken(refresh)
-	assert.NoError(t, err)
-	cached, err = repo.IsTokenCached(refreshClaims)
+	err = repo.DeleteSession(ctx, 1, "laptop")
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+}
+
+func TestDeleteAllSessions(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	laptop := newTestTokenPair(t, 1, "laptop")
+	phone := newTestTokenPair(t, 1, "phone")
+
+	assert.NoError(t, repo.CacheTokenPair(ctx, laptop, nil))
+	assert.NoError(t, repo.CacheTokenPair(ctx, phone, nil))
+
+	// Ensure tokens are cached
+	accessClaims, refreshClaims := parseTestTokenPair(t, laptop)
+	cached, err := repo.IsTokenCached(ctx, accessClaims)
 	assert.NoError(t, err)
 	assert.True(t, cached)
 
-	// Delete token pair
-	repo.DeleteTokenPair(1)
+	repo.DeleteAllSessions(ctx, 1)
 
 	// Ensure tokens are no longer cached
-	cached, err = repo.IsTokenCached(accessClaims)
+	cached, err = repo.IsTokenCached(ctx, accessClaims)
 	assert.NoError(t, err)
 	assert.False(t, cached)
 
-	cached, err = repo.IsTokenCached(refreshClaims)
+	cached, err = repo.IsTokenCached(ctx, refreshClaims)
 	assert.NoError(t, err)
 	assert.False(t, cached)
+
+	phoneClaims, _ := parseTestTokenPair(t, phone)
+	cached, err = repo.IsTokenCached(ctx, phoneClaims)
+	assert.NoError(t, err)
+	assert.False(t, cached)
+
+	sessions, err := repo.ListSessions(ctx, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
 }
 
 func TestExtendTokenPairCacheExpiration(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
-	jwtService := authjwt.NewJWTService()
+	pair := newTestTokenPair(t, 1, "session")
 
-	access, err := jwtService.NewAccessToken(1)
+	err := repo.CacheTokenPair(ctx, pair, nil)
 	assert.NoError(t, err)
 
-	refresh, err := jwtService.NewRefreshToken(1)
+	// Ensure tokens are cached
+	accessClaims, refreshClaims := parseTestTokenPair(t, pair)
+	cached, err := repo.IsTokenCached(ctx, accessClaims)
 	assert.NoError(t, err)
+	assert.True(t, cached)
 
-	pair := &auth.TokenPair{
-		Access:  access,
-		Refresh: refresh,
-	}
+	// Extend token pair cache expiration
+	repo.ExtendTokenPairCacheExpiration(ctx, accessClaims)
 
-	err = repo.CacheTokenPair(pair)
+	// Ensure tokens are still cached after expiration extension
+	cached, err = repo.IsTokenCached(ctx, accessClaims)
 	assert.NoError(t, err)
+	assert.True(t, cached)
 
-	// Ensure tokens are cached
-	accessClaims, err := jwtService.ParseToken(access)
-	assert.NoError(t, err)
-	cached, err := repo.IsTokenCached(accessClaims)
+	cached, err = repo.IsTokenCached(ctx, refreshClaims)
 	assert.NoError(t, err)
 	assert.True(t, cached)
+}
+
+func TestExtendTokenPairCacheExpiration_RevokedSession(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	pair := newTestTokenPair(t, 1, "session")
+	assert.NoError(t, repo.CacheTokenPair(ctx, pair, nil))
+	accessClaims, _ := parseTestTokenPair(t, pair)
 
-	refreshClaims, err := jwtService.ParseToken(refresh)
+	assert.NoError(t, repo.DeleteSession(ctx, 1, "session"))
+	repo.ExtendTokenPairCacheExpiration(ctx, accessClaims)
+
+	// The revoked session is not recreated by the extension
+	assert.Never(t, func() bool {
+		exists, err := storage.Cache().Exists(ctx, "session-1-session").Result()
+		return err != nil || exists > 0
+	}, 200*time.Millisecond, 10*time.Millisecond)
+}
+
+func TestRotateTokenPair(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	pair := newTestTokenPair(t, 1, "session")
+	assert.NoError(t, repo.CacheTokenPair(ctx, pair, nil))
+	_, refreshClaims := parseTestTokenPair(t, pair)
+
+	rotated := newTestTokenPair(t, 1, "session")
+	err := repo.RotateTokenPair(ctx, refreshClaims, rotated, &auth.ClientInfo{Device: "Firefox", IP: "127.0.0.1"})
 	assert.NoError(t, err)
-	cached, err = repo.IsTokenCached(refreshClaims)
+
+	accessClaims, newRefreshClaims := parseTestTokenPair(t, rotated)
+	cached, err := repo.IsTokenCached(ctx, accessClaims)
 	assert.NoError(t, err)
 	assert.True(t, cached)
 
-	// Extend token pair cache expiration
-	repo.ExtendTokenPairCacheExpiration(1)
-
-	// Ensure tokens are still cached after expiration extension
-	cached, err = repo.IsTokenCached(accessClaims)
+	cached, err = repo.IsTokenCached(ctx, newRefreshClaims)
 	assert.NoError(t, err)
 	assert.True(t, cached)
 
-	cached, err = repo.IsTokenCached(refreshClaims)
+	// The old refresh token is used up
+	err = repo.RotateTokenPair(ctx, refreshClaims, newTestTokenPair(t, 1, "session"), nil)
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+}
+
+func TestRotateTokenPair_RevokedSession(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	pair := newTestTokenPair(t, 1, "session")
+	assert.NoError(t, repo.CacheTokenPair(ctx, pair, nil))
+	_, refreshClaims := parseTestTokenPair(t, pair)
+
+	assert.NoError(t, repo.DeleteSession(ctx, 1, "session"))
+
+	err := repo.RotateTokenPair(ctx, refreshClaims, newTestTokenPair(t, 1, "session"), nil)
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
+
+	// The revoked session is not recreated by the rotation
+	exists, err := storage.Cache().Exists(ctx, "session-1-session").Result()
 	assert.NoError(t, err)
-	assert.True(t, cached)
+	assert.Zero(t, exists)
+}
+
+func TestRotateTokenPair_OtherSession(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	pair := newTestTokenPair(t, 1, "session")
+	assert.NoError(t, repo.CacheTokenPair(ctx, pair, nil))
+	_, refreshClaims := parseTestTokenPair(t, pair)
+
+	err := repo.RotateTokenPair(ctx, refreshClaims, newTestTokenPair(t, 1, "other-session"), nil)
+	assert.ErrorIs(t, err, auth.ErrInvalidTokenPair)
 }
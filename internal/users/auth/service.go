@@ -1,10 +1,13 @@
 package auth
 
 import (
+	"context"
 	"errors"
 
+	"github.com/L2SH-Dev/admissions/internal/datastore"
 	"github.com/L2SH-Dev/admissions/internal/users/auth/authjwt"
 	"github.com/L2SH-Dev/admissions/internal/users/auth/passwords"
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 )
 
@@ -13,11 +16,17 @@ var ErrInvalidToken = errors.New("invalid token")
 type AuthService interface {
 	AddAuthMiddleware(g *echo.Group, jwtKey string)
 	ValidatePassword(password string) error
-	IsTokenCached(claims *authjwt.JWTClaims) (bool, error)
-	Register(userID uint, password string) error
-	Login(userID uint, password string) (*TokenPair, error)
-	Refresh(refreshToken string) (*TokenPair, error)
-	Logout(userID uint)
+	IsTokenCached(ctx context.Context, claims *authjwt.JWTClaims) (bool, error)
+	Register(ctx context.Context, userID uint, password string) error
+	UpdatePassword(ctx context.Context, userID uint, password string) error
+	ChangePassword(ctx context.Context, userID uint, currentPassword, newPassword string, client *ClientInfo) (*TokenPair, error)
+	Login(ctx context.Context, userID uint, password string, client *ClientInfo) (*TokenPair, error)
+	Refresh(ctx context.Context, refreshToken string, client *ClientInfo) (*TokenPair, error)
+	Logout(ctx context.Context, userID uint, sessionID string)
+	ListSessions(ctx context.Context, userID uint) ([]*Session, error)
+	RevokeSession(ctx context.Context, userID uint, sessionID string) error
+	RevokeAllSessions(ctx context.Context, userID uint)
+	WithTx(tx datastore.Storage) AuthService
 }
 
 type AuthServiceImpl struct {
@@ -36,20 +45,43 @@ func NewAuthService(repo AuthRepo, passwordsService passwords.PasswordsService)
 
 var ErrInvalidPassword = errors.New("invalid password")
 
+// WithTx returns the service storing passwords in the transaction of tx.
+// Sessions live in the cache and are not part of it.
+func (s *AuthServiceImpl) WithTx(tx datastore.Storage) AuthService {
+	return &AuthServiceImpl{
+		repo:             s.repo,
+		passwordsService: s.passwordsService.WithTx(tx),
+		jwtService:       s.jwtService,
+	}
+}
+
 func (s *AuthServiceImpl) ValidatePassword(password string) error {
 	return s.passwordsService.Validate(password)
 }
 
-func (s *AuthServiceImpl) IsTokenCached(claims *authjwt.JWTClaims) (bool, error) {
-	return s.repo.IsTokenCached(claims)
+func (s *AuthServiceImpl) IsTokenCached(ctx context.Context, claims *authjwt.JWTClaims) (bool, error) {
+	return s.repo.IsTokenCached(ctx, claims)
+}
+
+func (s *AuthServiceImpl) Register(ctx context.Context, userID uint, password string) error {
+	return s.passwordsService.Create(ctx, userID, password)
 }
 
-func (s *AuthServiceImpl) Register(userID uint, password string) error {
-	return s.passwordsService.Create(userID, password)
+// UpdatePassword stores a new password for the user and revokes all of the
+// user's sessions, so sessions started with the old password end.
+func (s *AuthServiceImpl) UpdatePassword(ctx context.Context, userID uint, password string) error {
+	if err := s.passwordsService.Update(ctx, userID, password); err != nil {
+		return err
+	}
+
+	s.repo.DeleteAllSessions(ctx, userID)
+	return nil
 }
 
-func (s *AuthServiceImpl) Login(userID uint, password string) (*TokenPair, error) {
-	ok, err := s.passwordsService.Verify(userID, password)
+// ChangePassword replaces the password after verifying the current one. All
+// sessions are logged out and a new session is started for the caller.
+func (s *AuthServiceImpl) ChangePassword(ctx context.Context, userID uint, currentPassword, newPassword string, client *ClientInfo) (*TokenPair, error) {
+	ok, err := s.passwordsService.Verify(ctx, userID, currentPassword)
 	if err != nil {
 		return nil, err
 	}
@@ -58,10 +90,28 @@ func (s *AuthServiceImpl) Login(userID uint, password string) (*TokenPair, error
 		return nil, ErrInvalidPassword
 	}
 
-	return s.generateTokenPair(userID)
+	if err := s.UpdatePassword(ctx, userID, newPassword); err != nil {
+		return nil, err
+	}
+
+	return s.generateTokenPair(ctx, userID, uuid.New().String(), client)
 }
 
-func (s *AuthServiceImpl) Refresh(refreshToken string) (*TokenPair, error) {
+func (s *AuthServiceImpl) Login(ctx context.Context, userID uint, password string, client *ClientInfo) (*TokenPair, error) {
+	ok, err := s.passwordsService.Verify(ctx, userID, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		return nil, ErrInvalidPassword
+	}
+
+	return s.generateTokenPair(ctx, userID, uuid.New().String(), client)
+}
+
+// Refresh rotates the token pair of the session the refresh token belongs to
+func (s *AuthServiceImpl) Refresh(ctx context.Context, refreshToken string, client *ClientInfo) (*TokenPair, error) {
 	claims, err := s.jwtService.ParseToken(refreshToken)
 	if err != nil {
 		return nil, err
@@ -71,42 +121,70 @@ func (s *AuthServiceImpl) Refresh(refreshToken string) (*TokenPair, error) {
 		return nil, errors.Join(ErrInvalidToken, errors.New("invalid token type"))
 	}
 
-	ok, err := s.IsTokenCached(claims)
+	if claims.SessionID == "" {
+		return nil, errors.Join(ErrInvalidToken, errors.New("token not found")) // Issued before sessions were introduced
+	}
+
+	tokenPair, err := s.newTokenPair(claims.UserID, claims.SessionID)
 	if err != nil {
 		return nil, err
 	}
 
-	if !ok {
+	// The session is checked and rotated at once, so a session revoked
+	// between the two is not recreated
+	err = s.repo.RotateTokenPair(ctx, claims, tokenPair, client)
+	if errors.Is(err, ErrSessionNotFound) {
 		return nil, errors.Join(ErrInvalidToken, errors.New("token not found"))
+	} else if err != nil {
+		return nil, errors.Join(errors.New("failed to rotate token pair"), err)
 	}
 
-	return s.generateTokenPair(claims.UserID)
+	return tokenPair, nil
+}
+
+func (s *AuthServiceImpl) Logout(ctx context.Context, userID uint, sessionID string) {
+	_ = s.repo.DeleteSession(ctx, userID, sessionID)
+}
+
+func (s *AuthServiceImpl) ListSessions(ctx context.Context, userID uint) ([]*Session, error) {
+	return s.repo.ListSessions(ctx, userID)
 }
 
-func (s *AuthServiceImpl) Logout(userID uint) {
-	s.repo.DeleteTokenPair(userID)
+func (s *AuthServiceImpl) RevokeSession(ctx context.Context, userID uint, sessionID string) error {
+	return s.repo.DeleteSession(ctx, userID, sessionID)
 }
 
-func (s *AuthServiceImpl) generateTokenPair(userID uint) (*TokenPair, error) {
-	accessToken, err := s.jwtService.NewAccessToken(userID)
+func (s *AuthServiceImpl) RevokeAllSessions(ctx context.Context, userID uint) {
+	s.repo.DeleteAllSessions(ctx, userID)
+}
+
+func (s *AuthServiceImpl) generateTokenPair(ctx context.Context, userID uint, sessionID string, client *ClientInfo) (*TokenPair, error) {
+	tokenPair, err := s.newTokenPair(userID, sessionID)
 	if err != nil {
 		return nil, err
 	}
 
-	refreshToken, err := s.jwtService.NewRefreshToken(userID)
+	err = s.repo.CacheTokenPair(ctx, tokenPair, client)
 	if err != nil {
-		return nil, err
+		return nil, errors.Join(errors.New("failed to cache token pair"), err)
 	}
 
-	tokenPair := &TokenPair{
-		Access:  accessToken,
-		Refresh: refreshToken,
+	return tokenPair, nil
+}
+
+func (s *AuthServiceImpl) newTokenPair(userID uint, sessionID string) (*TokenPair, error) {
+	accessToken, err := s.jwtService.NewAccessToken(userID, sessionID)
+	if err != nil {
+		return nil, err
 	}
 
-	err = s.repo.CacheTokenPair(tokenPair)
+	refreshToken, err := s.jwtService.NewRefreshToken(userID, sessionID)
 	if err != nil {
-		return nil, errors.Join(errors.New("failed to cache token pair"), err)
+		return nil, err
 	}
 
-	return tokenPair, nil
+	return &TokenPair{
+		Access:  accessToken,
+		Refresh: refreshToken,
+	}, nil
 }
@@ -1,6 +1,7 @@
 package auth_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/L2SH-Dev/admissions/internal/users/auth"
@@ -22,20 +23,28 @@ func setupTestService(t *testing.T) auth.AuthService {
 	return auth.NewAuthService(authRepo, passwordsService)
 }
 
+func parseAccessToken(t *testing.T, tokenPair *auth.TokenPair) *authjwt.JWTClaims {
+	claims, err := authjwt.NewJWTService().ParseToken(tokenPair.Access)
+	assert.NoError(t, err)
+	return claims
+}
+
 func TestAuthService_Register(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	err := service.Register(1, "Password$123")
+	err := service.Register(ctx, 1, "Password$123")
 	assert.NoError(t, err)
 }
 
 func TestAuthService_Login(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	err := service.Register(1, "Password$123")
+	err := service.Register(ctx, 1, "Password$123")
 	assert.NoError(t, err)
 
-	tokenPair, err := service.Login(1, "Password$123")
+	tokenPair, err := service.Login(ctx, 1, "Password$123", nil)
 	assert.NoError(t, err)
 	assert.NotNil(t, tokenPair)
 	assert.NotEmpty(t, tokenPair.Access)
@@ -43,27 +52,29 @@ func TestAuthService_Login(t *testing.T) {
 }
 
 func TestAuthService_Login_InvalidPassword(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	err := service.Register(1, "Password$123")
+	err := service.Register(ctx, 1, "Password$123")
 	assert.NoError(t, err)
 
-	tokenPair, err := service.Login(1, "WrongPassword")
+	tokenPair, err := service.Login(ctx, 1, "WrongPassword", nil)
 	assert.Error(t, err)
 	assert.Nil(t, tokenPair)
 }
 
 func TestAuthService_Refresh(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	err := service.Register(1, "Password$123")
+	err := service.Register(ctx, 1, "Password$123")
 	assert.NoError(t, err)
 
-	tokenPair, err := service.Login(1, "Password$123")
+	tokenPair, err := service.Login(ctx, 1, "Password$123", nil)
 	assert.NoError(t, err)
 	assert.NotNil(t, tokenPair)
 
-	newTokenPair, err := service.Refresh(tokenPair.Refresh)
+	newTokenPair, err := service.Refresh(ctx, tokenPair.Refresh, nil)
 	assert.NoError(t, err)
 	assert.NotNil(t, newTokenPair)
 	assert.NotEmpty(t, newTokenPair.Access)
@@ -71,26 +82,153 @@ func TestAuthService_Refresh(t *testing.T) {
 }
 
 func TestAuthService_Refresh_InvalidToken(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	newTokenPair, err := service.Refresh("invalid token")
+	newTokenPair, err := service.Refresh(ctx, "invalid token", nil)
 	assert.Error(t, err)
 	assert.Nil(t, newTokenPair)
 }
 
+func TestAuthService_Refresh_RevokedSession(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	err := service.Register(ctx, 1, "Password$123")
+	assert.NoError(t, err)
+
+	tokenPair, err := service.Login(ctx, 1, "Password$123", nil)
+	assert.NoError(t, err)
+
+	claims := parseAccessToken(t, tokenPair)
+	assert.NoError(t, service.RevokeSession(ctx, 1, claims.SessionID))
+
+	newTokenPair, err := service.Refresh(ctx, tokenPair.Refresh, nil)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+	assert.Nil(t, newTokenPair)
+
+	sessions, err := service.ListSessions(ctx, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
 func TestAuthService_Logout(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	err := service.Register(ctx, 1, "Password$123")
+	assert.NoError(t, err)
+
+	tokenPair, err := service.Login(ctx, 1, "Password$123", nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, tokenPair)
+
+	claims := parseAccessToken(t, tokenPair)
+	service.Logout(ctx, 1, claims.SessionID)
+
+	cached, err := service.IsTokenCached(ctx, claims)
+	assert.NoError(t, err)
+	assert.False(t, cached)
+}
+
+func TestAuthService_UpdatePassword(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	err := service.Register(ctx, 1, "Password$123")
+	assert.NoError(t, err)
+
+	tokenPair, err := service.Login(ctx, 1, "Password$123", nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, tokenPair)
+
+	err = service.UpdatePassword(ctx, 1, "NewPassword$123")
+	assert.NoError(t, err)
+
+	// Existing tokens are revoked
+	cached, err := service.IsTokenCached(ctx, parseAccessToken(t, tokenPair))
+	assert.NoError(t, err)
+	assert.False(t, cached)
+
+	_, err = service.Login(ctx, 1, "Password$123", nil)
+	assert.ErrorIs(t, err, auth.ErrInvalidPassword)
+
+	_, err = service.Login(ctx, 1, "NewPassword$123", nil)
+	assert.NoError(t, err)
+}
+
+func TestAuthService_ChangePassword(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	err := service.Register(1, "Password$123")
+	err := service.Register(ctx, 1, "Password$123")
+	assert.NoError(t, err)
+
+	oldTokenPair, err := service.Login(ctx, 1, "Password$123", nil)
 	assert.NoError(t, err)
 
-	tokenPair, err := service.Login(1, "Password$123")
+	// Wrong current password
+	_, err = service.ChangePassword(ctx, 1, "WrongPassword", "NewPassword$123", nil)
+	assert.ErrorIs(t, err, auth.ErrInvalidPassword)
+
+	tokenPair, err := service.ChangePassword(ctx, 1, "Password$123", "NewPassword$123", nil)
 	assert.NoError(t, err)
 	assert.NotNil(t, tokenPair)
+	assert.NotEqual(t, oldTokenPair.Access, tokenPair.Access)
+
+	// Old refresh token no longer works
+	_, err = service.Refresh(ctx, oldTokenPair.Refresh, nil)
+	assert.Error(t, err)
+
+	_, err = service.Login(ctx, 1, "NewPassword$123", nil)
+	assert.NoError(t, err)
+}
+
+func TestAuthService_Sessions(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	err := service.Register(ctx, 1, "Password$123")
+	assert.NoError(t, err)
+
+	laptop, err := service.Login(ctx, 1, "Password$123", &auth.ClientInfo{Device: "Firefox", IP: "10.0.0.1"})
+	assert.NoError(t, err)
+
+	phone, err := service.Login(ctx, 1, "Password$123", &auth.ClientInfo{Device: "Safari", IP: "10.0.0.2"})
+	assert.NoError(t, err)
+
+	sessions, err := service.ListSessions(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	// Refreshing keeps the session
+	laptop, err = service.Refresh(ctx, laptop.Refresh, &auth.ClientInfo{Device: "Firefox", IP: "10.0.0.3"})
+	assert.NoError(t, err)
+
+	sessions, err = service.ListSessions(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 2)
+
+	// Revoking one session leaves the other one alive
+	laptopClaims := parseAccessToken(t, laptop)
+	err = service.RevokeSession(ctx, 1, laptopClaims.SessionID)
+	assert.NoError(t, err)
+
+	cached, err := service.IsTokenCached(ctx, laptopClaims)
+	assert.NoError(t, err)
+	assert.False(t, cached)
+
+	phoneClaims := parseAccessToken(t, phone)
+	cached, err = service.IsTokenCached(ctx, phoneClaims)
+	assert.NoError(t, err)
+	assert.True(t, cached)
+
+	err = service.RevokeSession(ctx, 1, laptopClaims.SessionID)
+	assert.ErrorIs(t, err, auth.ErrSessionNotFound)
 
-	service.Logout(1)
+	service.RevokeAllSessions(ctx, 1)
 
-	claims, err := service.IsTokenCached(&authjwt.JWTClaims{UserID: 1, Type: "access"})
+	cached, err = service.IsTokenCached(ctx, phoneClaims)
 	assert.NoError(t, err)
-	assert.False(t, claims)
+	assert.False(t, cached)
 }
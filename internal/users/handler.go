@@ -2,12 +2,18 @@ package users
 
 import (
 	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/L2SH-Dev/admissions/internal/audit"
 	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/mailing"
 	"github.com/L2SH-Dev/admissions/internal/server"
 	"github.com/L2SH-Dev/admissions/internal/users/auth"
+	"github.com/L2SH-Dev/admissions/internal/users/auth/loginlimit"
+	"github.com/L2SH-Dev/admissions/internal/users/auth/passreset"
 	"github.com/L2SH-Dev/admissions/internal/users/auth/passwords"
 	"github.com/L2SH-Dev/admissions/internal/users/roles"
 	"github.com/labstack/echo/v4"
@@ -21,11 +27,29 @@ type UsersHandler interface {
 	Logout(c echo.Context) error
 	Refresh(c echo.Context) error
 	GetMe(c echo.Context) error
+	ForgotPassword(c echo.Context) error
+	ResetPassword(c echo.Context) error
+	ChangePassword(c echo.Context) error
+	ListSessions(c echo.Context) error
+	RevokeSession(c echo.Context) error
+	RevokeAllSessions(c echo.Context) error
+
+	// admin endpoints
+	ListRoles(c echo.Context) error
+	CreateRole(c echo.Context) error
+	ListPermissions(c echo.Context) error
+	SetRole(c echo.Context) error
+	ListRoleGrants(c echo.Context) error
 }
 
 type UsersHandlerImpl struct {
-	usersService UsersService
-	authService  auth.AuthService
+	storage              datastore.Storage
+	usersService         UsersService
+	rolesService         roles.RolesService
+	authService          auth.AuthService
+	passwordResetService passreset.PasswordResetService
+	loginLimitService    loginlimit.LoginLimitService
+	auditService         audit.AuditService
 }
 
 func NewUsersHandler(storage datastore.Storage) server.Handler {
@@ -40,9 +64,20 @@ func NewUsersHandler(storage datastore.Storage) server.Handler {
 	authRepo := auth.NewAuthRepo(storage)
 	authService := auth.NewAuthService(authRepo, passwordsService)
 
+	passwordResetRepo := passreset.NewPasswordResetRepo(storage)
+	passwordResetService := passreset.NewPasswordResetService(passwordResetRepo, mailing.NewMailingService(mailing.NewOutboxMailer(mailing.NewOutboxRepo(storage))))
+
+	loginLimitRepo := loginlimit.NewLoginLimitRepo(storage)
+	loginLimitService := loginlimit.NewLoginLimitService(loginLimitRepo)
+
 	return &UsersHandlerImpl{
-		usersService: usersService,
-		authService:  authService,
+		storage:              storage,
+		usersService:         usersService,
+		rolesService:         rolesService,
+		authService:          authService,
+		passwordResetService: passwordResetService,
+		loginLimitService:    loginLimitService,
+		auditService:         audit.NewAuditService(audit.NewAuditRepo(storage)),
 	}
 }
 
@@ -52,6 +87,8 @@ func (h *UsersHandlerImpl) AddRoutes(g *echo.Group) {
 	publicGroup := usersGroup.Group("")
 	publicGroup.POST("/login", h.Login)
 	publicGroup.GET("/refresh", h.Refresh)
+	publicGroup.POST("/password/forgot", h.ForgotPassword)
+	publicGroup.POST("/password/reset", h.ResetPassword)
 
 	restrictedGroup := usersGroup.Group("")
 
@@ -61,9 +98,27 @@ func (h *UsersHandlerImpl) AddRoutes(g *echo.Group) {
 
 	restrictedGroup.POST("/logout", h.Logout)
 	restrictedGroup.GET("/me", h.GetMe)
+	restrictedGroup.PUT("/password", h.ChangePassword)
+	restrictedGroup.GET("/sessions", h.ListSessions)
+	restrictedGroup.DELETE("/sessions/:sessionID", h.RevokeSession)
+	restrictedGroup.DELETE("/sessions", h.RevokeAllSessions)
+
+	adminGroup := restrictedGroup.Group("/admin")
+	middlewareService.AddAdminMiddleware(adminGroup)
+
+	canReadRoles := middlewareService.RequirePermission(roles.PermissionRolesRead)
+	canManageRoles := middlewareService.RequirePermission(roles.PermissionRolesManage)
+
+	adminGroup.GET("/roles", h.ListRoles, canReadRoles)
+	adminGroup.POST("/roles", h.CreateRole, canManageRoles)
+	adminGroup.GET("/permissions", h.ListPermissions, canReadRoles)
+	adminGroup.PUT("/:userID/role", h.SetRole, canManageRoles)
+	adminGroup.GET("/role_grants", h.ListRoleGrants, canReadRoles)
 }
 
 func (h *UsersHandlerImpl) Login(c echo.Context) error {
+	ctx := c.Request().Context()
+
 	loginRequest := new(struct {
 		Login    string `json:"login" validate:"required"`
 		Password string `json:"password" validate:"required"`
@@ -77,26 +132,53 @@ func (h *UsersHandlerImpl) Login(c echo.Context) error {
 		return err
 	}
 
-	user, err := h.usersService.GetByLogin(loginRequest.Login)
+	retryAfter, delay, err := h.loginLimitService.Attempt(ctx, loginRequest.Login, c.RealIP())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	} else if retryAfter > 0 {
+		return tooManyAttempts(c, retryAfter)
+	}
+
+	user, err := h.usersService.GetByLogin(ctx, loginRequest.Login)
 	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
-		return echo.NewHTTPError(http.StatusUnauthorized, "invalid login or password")
+		return loginFailed(c, delay)
 	} else if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
-	tokenPair, err := h.authService.Login(user.ID, loginRequest.Password)
+	tokenPair, err := h.authService.Login(ctx, user.ID, loginRequest.Password, clientInfo(c))
 	if err != nil && errors.Is(err, auth.ErrInvalidPassword) {
-		return echo.NewHTTPError(http.StatusUnauthorized, "invalid login or password")
+		return loginFailed(c, delay)
 	} else if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
+	if err := h.loginLimitService.RecordSuccess(ctx, loginRequest.Login, c.RealIP()); err != nil {
+		slog.ErrorContext(ctx, "Failed to reset login failures", slog.Any("user_id", user.ID), slog.Any("err", err))
+	}
+
 	return h.sendTokenPair(c, tokenPair)
 }
 
+// loginFailed responds the same way for unknown logins and wrong passwords,
+// so the response doesn't reveal which logins exist. The failure is already
+// counted by the attempt.
+func loginFailed(c echo.Context, delay time.Duration) error {
+	if delay > 0 {
+		c.Response().Header().Set(echo.HeaderRetryAfter, server.RetryAfterSeconds(delay))
+	}
+
+	return echo.NewHTTPError(http.StatusUnauthorized, "invalid login or password")
+}
+
+func tooManyAttempts(c echo.Context, retryAfter time.Duration) error {
+	c.Response().Header().Set(echo.HeaderRetryAfter, server.RetryAfterSeconds(retryAfter))
+	return echo.NewHTTPError(http.StatusTooManyRequests, "too many login attempts, try again later")
+}
+
 func (h *UsersHandlerImpl) Logout(c echo.Context) error {
 	user := c.Get("currentUser").(*User)
-	h.authService.Logout(user.ID)
+	h.authService.Logout(c.Request().Context(), user.ID, c.Get("sessionId").(string))
 	return c.JSON(http.StatusOK, "logged out")
 }
 
@@ -106,7 +188,7 @@ func (h *UsersHandlerImpl) Refresh(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusUnauthorized, "refresh token is required")
 	}
 
-	tokenPair, err := h.authService.Refresh(refreshRequestCookie.Value)
+	tokenPair, err := h.authService.Refresh(c.Request().Context(), refreshRequestCookie.Value, clientInfo(c))
 	if err != nil {
 		if errors.Is(err, auth.ErrInvalidToken) {
 			return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
@@ -123,6 +205,307 @@ func (h *UsersHandlerImpl) GetMe(c echo.Context) error {
 	return c.JSON(http.StatusOK, user)
 }
 
+func (h *UsersHandlerImpl) ForgotPassword(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	forgotRequest := new(struct {
+		Email string `json:"email" validate:"required,email"`
+	})
+
+	if err := c.Bind(forgotRequest); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(forgotRequest); err != nil {
+		return err
+	}
+
+	retryAfter, err := h.passwordResetService.CheckRequest(ctx, forgotRequest.Email, c.RealIP())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if retryAfter > 0 {
+		c.Response().Header().Set(echo.HeaderRetryAfter, server.RetryAfterSeconds(retryAfter))
+		return echo.NewHTTPError(http.StatusTooManyRequests, "too many requests, try again later")
+	}
+
+	accounts, err := h.usersService.ListByEmail(ctx, forgotRequest.Email)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	// Siblings may share the parent's email, send a link for every account
+	for _, user := range accounts {
+		err := h.passwordResetService.SendResetEmail(ctx, forgotRequest.Email, user.Login, user.ID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to send password reset email", slog.Any("user_id", user.ID), slog.Any("err", err))
+		}
+	}
+
+	// Respond the same way whether the email is known or not
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (h *UsersHandlerImpl) ResetPassword(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	resetRequest := new(struct {
+		Token    string `json:"token" validate:"required"`
+		Password string `json:"password" validate:"required"`
+	})
+
+	if err := c.Bind(resetRequest); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(resetRequest); err != nil {
+		return err
+	}
+
+	// Validate before consuming the token so that a weak password
+	// doesn't burn the link
+	if err := h.authService.ValidatePassword(resetRequest.Password); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	userID, err := h.passwordResetService.ConsumeToken(ctx, resetRequest.Token)
+	if err != nil && errors.Is(err, passreset.ErrInvalidToken) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	if err := h.authService.UpdatePassword(ctx, userID, resetRequest.Password); err != nil {
+		// The password was not changed, keep the link usable
+		if restoreErr := h.passwordResetService.RestoreToken(ctx, resetRequest.Token, userID); restoreErr != nil {
+			slog.ErrorContext(ctx, "Failed to restore password reset token", slog.Any("user_id", userID), slog.Any("err", restoreErr))
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *UsersHandlerImpl) ChangePassword(c echo.Context) error {
+	user := c.Get("currentUser").(*User)
+
+	changeRequest := new(struct {
+		CurrentPassword string `json:"current_password" validate:"required"`
+		NewPassword     string `json:"new_password" validate:"required"`
+	})
+
+	if err := c.Bind(changeRequest); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(changeRequest); err != nil {
+		return err
+	}
+
+	if err := h.authService.ValidatePassword(changeRequest.NewPassword); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	tokenPair, err := h.authService.ChangePassword(c.Request().Context(), user.ID, changeRequest.CurrentPassword, changeRequest.NewPassword, clientInfo(c))
+	if err != nil && errors.Is(err, auth.ErrInvalidPassword) {
+		return echo.NewHTTPError(http.StatusUnauthorized, "invalid current password")
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return h.sendTokenPair(c, tokenPair)
+}
+
+func (h *UsersHandlerImpl) ListSessions(c echo.Context) error {
+	user := c.Get("currentUser").(*User)
+
+	sessions, err := h.authService.ListSessions(c.Request().Context(), user.ID)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	currentSessionID := c.Get("sessionId").(string)
+	for _, session := range sessions {
+		session.Current = session.ID == currentSessionID
+	}
+
+	return c.JSON(http.StatusOK, sessions)
+}
+
+func (h *UsersHandlerImpl) RevokeSession(c echo.Context) error {
+	user := c.Get("currentUser").(*User)
+
+	err := h.authService.RevokeSession(c.Request().Context(), user.ID, c.Param("sessionID"))
+	if err != nil && errors.Is(err, auth.ErrSessionNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *UsersHandlerImpl) RevokeAllSessions(c echo.Context) error {
+	user := c.Get("currentUser").(*User)
+	h.authService.RevokeAllSessions(c.Request().Context(), user.ID)
+	return c.NoContent(http.StatusOK)
+}
+
+func (h *UsersHandlerImpl) ListRoles(c echo.Context) error {
+	rolesList, err := h.rolesService.ListRoles(c.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, rolesList)
+}
+
+func (h *UsersHandlerImpl) CreateRole(c echo.Context) error {
+	user := c.Get("currentUser").(*User)
+
+	roleRequest := new(struct {
+		Title       string   `json:"title" validate:"required,max=64"`
+		Permissions []string `json:"permissions"`
+	})
+
+	if err := c.Bind(roleRequest); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(roleRequest); err != nil {
+		return err
+	}
+
+	role := &roles.Role{Title: roleRequest.Title}
+	for _, name := range roleRequest.Permissions {
+		role.Permissions = append(role.Permissions, roles.Permission{Name: name})
+	}
+
+	if !user.Role.Covers(role) {
+		return echo.NewHTTPError(http.StatusForbidden, ErrInsufficientPermission.Error())
+	}
+
+	ctx := c.Request().Context()
+	err := h.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		if err := h.rolesService.WithTx(tx).CreateRole(ctx, role); err != nil {
+			return err
+		}
+
+		return h.auditService.WithTx(tx).Log(c, audit.Event{
+			Action:     audit.ActionRoleCreate,
+			TargetType: audit.TargetRole,
+			TargetID:   role.ID,
+			Diff: map[string]audit.Change{
+				"title":       {New: role.Title},
+				"permissions": {New: roleRequest.Permissions},
+			},
+		})
+	})
+	if err != nil && errors.Is(err, roles.ErrRoleExists) {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	} else if err != nil && errors.Is(err, roles.ErrUnknownPermission) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusCreated, role)
+}
+
+func (h *UsersHandlerImpl) ListPermissions(c echo.Context) error {
+	permissions, err := h.rolesService.ListPermissions(c.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, permissions)
+}
+
+func (h *UsersHandlerImpl) SetRole(c echo.Context) error {
+	ctx := c.Request().Context()
+
+	user := c.Get("currentUser").(*User)
+
+	userID, err := strconv.ParseUint(c.Param("userID"), 10, 32)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid user ID")
+	}
+
+	roleRequest := new(struct {
+		RoleID uint `json:"role_id" validate:"required"`
+	})
+
+	if err := c.Bind(roleRequest); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if err := c.Validate(roleRequest); err != nil {
+		return err
+	}
+
+	target, err := h.usersService.GetByID(ctx, uint(userID))
+	if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "user or role not found")
+	} else if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	var updated *User
+	err = h.storage.WithTx(ctx, func(tx datastore.Storage) error {
+		var err error
+		updated, err = h.usersService.WithTx(tx).SetRole(ctx, uint(userID), roleRequest.RoleID, user)
+		if err != nil {
+			return err
+		}
+
+		return h.auditService.WithTx(tx).Log(c, audit.Event{
+			Action:     audit.ActionRoleGrant,
+			TargetType: audit.TargetUser,
+			TargetID:   updated.ID,
+			Diff: map[string]audit.Change{
+				"role": {Old: target.Role.Title, New: updated.Role.Title},
+			},
+		})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrCannotChangeOwnRole), errors.Is(err, ErrInsufficientPermission):
+			return echo.NewHTTPError(http.StatusForbidden, err.Error())
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return echo.NewHTTPError(http.StatusNotFound, "user or role not found")
+		default:
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+	}
+
+	return c.JSON(http.StatusOK, updated)
+}
+
+func (h *UsersHandlerImpl) ListRoleGrants(c echo.Context) error {
+	var userID uint64
+	if param := c.QueryParam("user_id"); param != "" {
+		var err error
+		userID, err = strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid user ID")
+		}
+	}
+
+	grants, err := h.usersService.ListRoleGrants(c.Request().Context(), uint(userID))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, grants)
+}
+
+func clientInfo(c echo.Context) *auth.ClientInfo {
+	return &auth.ClientInfo{
+		Device: c.Request().UserAgent(),
+		IP:     c.RealIP(),
+	}
+}
+
 func (h *UsersHandlerImpl) sendTokenPair(c echo.Context, tokenPair *auth.TokenPair) error {
 	// set refresh token as a http-only cookie
 	cookie := new(http.Cookie)
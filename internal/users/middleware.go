@@ -2,6 +2,7 @@ package users
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/L2SH-Dev/admissions/internal/users/auth"
@@ -13,7 +14,8 @@ import (
 type UsersMiddlewareService interface {
 	AddAuthMiddleware(g *echo.Group, jwtKey string)
 	AddUserPreloadMiddleware(g *echo.Group)
-	AddAdminMiddleware(g *echo.Group, minimalRole roles.Role)
+	AddAdminMiddleware(g *echo.Group)
+	RequirePermission(permission string) echo.MiddlewareFunc
 }
 
 type UsersMiddlewareServiceImpl struct {
@@ -36,44 +38,39 @@ func (s *UsersMiddlewareServiceImpl) AddUserPreloadMiddleware(g *echo.Group) {
 	g.Use(s.preloadUserDataMiddleware())
 }
 
-func (s *UsersMiddlewareServiceImpl) AddAdminMiddleware(g *echo.Group, minimalRole roles.Role) {
-	g.Use(userAdminMiddleware(minimalRole))
+// AddAdminMiddleware restricts the group to users with access to the admin panel
+func (s *UsersMiddlewareServiceImpl) AddAdminMiddleware(g *echo.Group) {
+	g.Use(s.RequirePermission(roles.PermissionAdminPanel))
 }
 
-func (s *UsersMiddlewareServiceImpl) preloadUserDataMiddleware() echo.MiddlewareFunc {
+// RequirePermission returns a middleware for a single route that requires
+// the current user's role to grant the permission
+func (s *UsersMiddlewareServiceImpl) RequirePermission(permission string) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			userID := c.Get("userId").(uint)
-
-			userDetails, err := s.usersService.GetByID(userID)
-			if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
-				return echo.NewHTTPError(http.StatusNotFound, "user not found")
-			} else if err != nil {
-				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+			user := c.Get("currentUser").(*User)
+			if !user.Role.Has(permission) {
+				return echo.NewHTTPError(http.StatusForbidden, fmt.Sprintf("permission %s is required to access this endpoint", permission))
 			}
 
-			c.Set("currentUser", userDetails)
-
 			return next(c)
 		}
 	}
 }
 
-func userAdminMiddleware(minimalRole roles.Role) echo.MiddlewareFunc {
+func (s *UsersMiddlewareServiceImpl) preloadUserDataMiddleware() echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			user := c.Get("currentUser").(*User)
-			if !user.Role.Admin {
-				return echo.NewHTTPError(http.StatusForbidden, "only admins can access this endpoint")
-			}
+			userID := c.Get("userId").(uint)
 
-			if !user.Role.WriteGeneral && minimalRole.WriteGeneral {
-				return echo.NewHTTPError(http.StatusForbidden, "only admins with general write permissions can access this endpoint")
+			userDetails, err := s.usersService.GetByID(c.Request().Context(), userID)
+			if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
+				return echo.NewHTTPError(http.StatusNotFound, "user not found")
+			} else if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 			}
 
-			if !user.Role.AIAccess && minimalRole.AIAccess {
-				return echo.NewHTTPError(http.StatusForbidden, "only admins with AI access can access this endpoint")
-			}
+			c.Set("currentUser", userDetails)
 
 			return next(c)
 		}
@@ -15,6 +15,16 @@ type User struct {
 	Password           passwords.Password `json:"-" gorm:"not null; constraint:OnUpdate:CASCADE,OnDelete:SET NULL"`
 }
 
+// RoleGrant records a change of a user's role and the admin who made it
+type RoleGrant struct {
+	gorm.Model
+	UserID         uint       `json:"user_id" gorm:"index;not null"`
+	RoleID         uint       `json:"role_id" gorm:"not null"`
+	Role           roles.Role `json:"role"`
+	PreviousRoleID uint       `json:"previous_role_id"`
+	GrantedByID    uint       `json:"granted_by_id" gorm:"not null"`
+}
+
 func (u *User) BeforeDelete(tx *gorm.DB) error {
 	if u.ID == 0 {
 		return nil
@@ -38,6 +48,12 @@ func (u *User) BeforeDelete(tx *gorm.DB) error {
 		return err
 	}
 
+	// delete exam waitlist entries
+	// cant user ExamWaitlistEntry here because of circular dependency
+	if err := tx.Exec("DELETE FROM exam_waitlist_entries WHERE user_id = ?", u.ID).Error; err != nil {
+		return err
+	}
+
 	// delete exam results
 	// cant user ExamResult here because of circular dependency
 	if err := tx.Exec("DELETE FROM exam_results WHERE user_id = ?", u.ID).Error; err != nil {
@@ -46,3 +62,8 @@ func (u *User) BeforeDelete(tx *gorm.DB) error {
 
 	return nil
 }
+
+// AuditActor identifies the user in the audit log
+func (u *User) AuditActor() (uint, string) {
+	return u.ID, u.Role.Title
+}
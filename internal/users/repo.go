@@ -1,6 +1,7 @@
 package users
 
 import (
+	"context"
 	"errors"
 
 	"github.com/L2SH-Dev/admissions/internal/datastore"
@@ -8,12 +9,17 @@ import (
 )
 
 type UsersRepo interface {
-	Create(user *User) error
-	Delete(userID uint) error
-	GetByID(userID uint) (*User, error)
-	GetByRegistrationID(registrationID uint) (*User, error)
-	GetByLogin(login string) (*User, error)
-	ExistsByID(userID uint) (bool, error)
+	Create(ctx context.Context, user *User) error
+	Delete(ctx context.Context, userID uint) error
+	GetByID(ctx context.Context, userID uint) (*User, error)
+	GetByRegistrationID(ctx context.Context, registrationID uint) (*User, error)
+	GetByLogin(ctx context.Context, login string) (*User, error)
+	ListByEmail(ctx context.Context, email string) ([]*User, error)
+	ExistsByID(ctx context.Context, userID uint) (bool, error)
+	Count(ctx context.Context) (int64, error)
+	UpdateRole(ctx context.Context, userID uint, grant *RoleGrant) error
+	ListRoleGrants(ctx context.Context, userID uint) ([]*RoleGrant, error)
+	WithTx(tx datastore.Storage) UsersRepo
 }
 
 type UsersRepoImpl struct {
@@ -21,14 +27,15 @@ type UsersRepoImpl struct {
 }
 
 func NewUsersRepo(storage datastore.Storage) UsersRepo {
-	if err := storage.DB().AutoMigrate(&User{}); err != nil {
-		panic(err)
-	}
 	return &UsersRepoImpl{storage: storage}
 }
 
-func (r *UsersRepoImpl) Create(user *User) error {
-	err := r.storage.DB().Create(user).Error
+func (r *UsersRepoImpl) WithTx(tx datastore.Storage) UsersRepo {
+	return &UsersRepoImpl{storage: tx}
+}
+
+func (r *UsersRepoImpl) Create(ctx context.Context, user *User) error {
+	err := r.storage.DB().WithContext(ctx).Create(user).Error
 	if err != nil {
 		return errors.Join(errors.New("failed to create user"), err)
 	}
@@ -41,8 +48,8 @@ func (r *UsersRepoImpl) Create(user *User) error {
 	return nil
 }
 
-func (r *UsersRepoImpl) Delete(userID uint) error {
-	err := r.storage.DB().Delete(&User{}, userID).Error
+func (r *UsersRepoImpl) Delete(ctx context.Context, userID uint) error {
+	err := r.storage.DB().WithContext(ctx).Delete(&User{}, userID).Error
 	if err != nil {
 		return errors.Join(errors.New("failed to delete user"), err)
 	}
@@ -50,9 +57,9 @@ func (r *UsersRepoImpl) Delete(userID uint) error {
 	return nil
 }
 
-func (r *UsersRepoImpl) GetByID(userID uint) (*User, error) {
+func (r *UsersRepoImpl) GetByID(ctx context.Context, userID uint) (*User, error) {
 	var user User
-	err := r.storage.DB().Preload("Role").First(&user, userID).Error
+	err := r.storage.DB().WithContext(ctx).Preload("Role.Permissions").First(&user, userID).Error
 	if err != nil {
 		return nil, err
 	}
@@ -60,9 +67,9 @@ func (r *UsersRepoImpl) GetByID(userID uint) (*User, error) {
 	return &user, nil
 }
 
-func (r *UsersRepoImpl) GetByRegistrationID(registrationID uint) (*User, error) {
+func (r *UsersRepoImpl) GetByRegistrationID(ctx context.Context, registrationID uint) (*User, error) {
 	var user User
-	err := r.storage.DB().Where("registration_data_id = ?", registrationID).Preload("Role").First(&user).Error
+	err := r.storage.DB().WithContext(ctx).Where("registration_data_id = ?", registrationID).Preload("Role.Permissions").First(&user).Error
 	if err != nil {
 		return nil, err
 	}
@@ -70,9 +77,9 @@ func (r *UsersRepoImpl) GetByRegistrationID(registrationID uint) (*User, error)
 	return &user, nil
 }
 
-func (r *UsersRepoImpl) GetByLogin(login string) (*User, error) {
+func (r *UsersRepoImpl) GetByLogin(ctx context.Context, login string) (*User, error) {
 	var user User
-	err := r.storage.DB().Where("login = ?", login).Preload("Role").First(&user).Error
+	err := r.storage.DB().WithContext(ctx).Where("login = ?", login).Preload("Role.Permissions").First(&user).Error
 	if err != nil {
 		return nil, err
 	}
@@ -80,8 +87,32 @@ func (r *UsersRepoImpl) GetByLogin(login string) (*User, error) {
 	return &user, nil
 }
 
-func (r *UsersRepoImpl) ExistsByID(userID uint) (bool, error) {
-	user, err := r.GetByID(userID)
+func (r *UsersRepoImpl) ListByEmail(ctx context.Context, email string) ([]*User, error) {
+	var users []*User
+	// cant use RegistrationData here because of circular dependency
+	err := r.storage.DB().WithContext(ctx).
+		Joins("JOIN registration_data ON registration_data.id = users.registration_data_id").
+		Where("LOWER(registration_data.email) = LOWER(?) AND registration_data.deleted_at IS NULL", email).
+		Find(&users).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+func (r *UsersRepoImpl) Count(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.storage.DB().WithContext(ctx).Model(&User{}).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *UsersRepoImpl) ExistsByID(ctx context.Context, userID uint) (bool, error) {
+	user, err := r.GetByID(ctx, userID)
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return false, err
 	}
@@ -91,3 +122,39 @@ func (r *UsersRepoImpl) ExistsByID(userID uint) (bool, error) {
 
 	return true, nil
 }
+
+// UpdateRole changes the user's role and records the grant in one transaction
+func (r *UsersRepoImpl) UpdateRole(ctx context.Context, userID uint, grant *RoleGrant) error {
+	return r.storage.DB().WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&User{}).Where("id = ?", userID).Update("role_id", grant.RoleID)
+		if result.Error != nil {
+			return errors.Join(errors.New("failed to update user role"), result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		grant.UserID = userID
+		if err := tx.Create(grant).Error; err != nil {
+			return errors.Join(errors.New("failed to record role grant"), err)
+		}
+
+		return nil
+	})
+}
+
+// ListRoleGrants returns the grants of the user, or of all users if userID
+// is zero, newest first
+func (r *UsersRepoImpl) ListRoleGrants(ctx context.Context, userID uint) ([]*RoleGrant, error) {
+	query := r.storage.DB().WithContext(ctx).Preload("Role.Permissions").Order("id DESC")
+	if userID != 0 {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	var grants []*RoleGrant
+	if err := query.Find(&grants).Error; err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
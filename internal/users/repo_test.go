@@ -1,11 +1,15 @@
 package users_test
 
 import (
+	"context"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/mailing"
+	"github.com/L2SH-Dev/admissions/internal/migrations"
 	"github.com/L2SH-Dev/admissions/internal/regdata"
 	"github.com/L2SH-Dev/admissions/internal/users"
 	"github.com/L2SH-Dev/admissions/internal/users/auth"
@@ -13,6 +17,7 @@ import (
 	"github.com/L2SH-Dev/admissions/internal/users/roles"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -50,12 +55,16 @@ func TestMain(m *testing.M) {
 }
 
 func setupTestRepo(t *testing.T) users.UsersRepo {
+	ctx := context.Background()
 	t.Cleanup(func() {
 		err := storage.Flush()
 		assert.NoError(t, err)
 	})
 
-	roles.NewRolesService(roles.NewRolesRepo(storage)).CreateDefaultRoles()
+	_, err := migrations.Up(storage.DB())
+	require.NoError(t, err)
+
+	roles.NewRolesService(roles.NewRolesRepo(storage)).CreateDefaultRoles(ctx)
 
 	rolesRepo := roles.NewRolesRepo(storage)
 	rolesService := roles.NewRolesService(rolesRepo)
@@ -68,9 +77,10 @@ func setupTestRepo(t *testing.T) users.UsersRepo {
 	authService := auth.NewAuthService(authRepo, passwordsService)
 
 	repo := regdata.NewRegistrationDataRepo(storage)
+	mailingService := mailing.NewMailingService(mailing.NewFileMailer(filepath.Join(t.TempDir(), "mail.mbox"), "noreply@example.com"))
 
-	regdataService := regdata.NewRegistrationDataService(repo, usersService, authService, passwordsService)
-	err := regdataService.Create(&regdata.RegistrationData{
+	regdataService := regdata.NewRegistrationDataService(storage, repo, usersService, authService, passwordsService, mailingService)
+	err = regdataService.Create(ctx, &regdata.RegistrationData{
 		Email:           "test@mail.org",
 		FirstName:       "Test",
 		LastName:        "User",
@@ -83,7 +93,7 @@ func setupTestRepo(t *testing.T) users.UsersRepo {
 		ParentPhone:     "+79999999999",
 	})
 	assert.NoError(t, err)
-	err = regdataService.Create(&regdata.RegistrationData{
+	err = regdataService.Create(ctx, &regdata.RegistrationData{
 		Email:           "test2@mail.org",
 		FirstName:       "Test",
 		LastName:        "User2",
@@ -100,40 +110,43 @@ func setupTestRepo(t *testing.T) users.UsersRepo {
 }
 
 func TestCreateUser(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	user := &users.User{Login: "test_login", RoleID: 1, RegistrationDataID: 1}
-	err := repo.Create(user)
+	err := repo.Create(ctx, user)
 	assert.NoError(t, err)
 
-	exists, err := repo.ExistsByID(user.ID)
+	exists, err := repo.ExistsByID(ctx, user.ID)
 	assert.NoError(t, err)
 	assert.True(t, exists)
 }
 
 func TestDeleteUser(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	user := &users.User{Login: "test_login", RoleID: 1, RegistrationDataID: 1}
-	err := repo.Create(user)
+	err := repo.Create(ctx, user)
 	assert.NoError(t, err)
 
-	err = repo.Delete(user.ID)
+	err = repo.Delete(ctx, user.ID)
 	assert.NoError(t, err)
 
-	exists, err := repo.ExistsByID(user.ID)
+	exists, err := repo.ExistsByID(ctx, user.ID)
 	assert.NoError(t, err)
 	assert.False(t, exists)
 }
 
 func TestGetByID(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	user := &users.User{Login: "test_login", RoleID: 1, RegistrationDataID: 1}
-	err := repo.Create(user)
+	err := repo.Create(ctx, user)
 	assert.NoError(t, err)
 
-	result, err := repo.GetByID(user.ID)
+	result, err := repo.GetByID(ctx, user.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, user.ID, result.ID)
 	assert.Equal(t, user.Login, result.Login)
@@ -144,29 +157,31 @@ func TestGetByID(t *testing.T) {
 }
 
 func TestUserExistsByID(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	user := &users.User{Login: "test_login", RoleID: 1, RegistrationDataID: 1}
-	err := repo.Create(user)
+	err := repo.Create(ctx, user)
 	assert.NoError(t, err)
 
-	exists, err := repo.ExistsByID(user.ID)
+	exists, err := repo.ExistsByID(ctx, user.ID)
 	assert.NoError(t, err)
 	assert.True(t, exists)
 
-	exists, err = repo.ExistsByID(999)
+	exists, err = repo.ExistsByID(ctx, 999)
 	assert.NoError(t, err)
 	assert.False(t, exists)
 }
 
 func TestGetByRegistrationID(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	user := &users.User{Login: "test_login", RoleID: 1, RegistrationDataID: 1}
-	err := repo.Create(user)
+	err := repo.Create(ctx, user)
 	assert.NoError(t, err)
 
-	result, err := repo.GetByRegistrationID(user.RegistrationDataID)
+	result, err := repo.GetByRegistrationID(ctx, user.RegistrationDataID)
 	assert.NoError(t, err)
 	assert.Equal(t, user.ID, result.ID)
 	assert.Equal(t, user.Login, result.Login)
@@ -177,13 +192,14 @@ func TestGetByRegistrationID(t *testing.T) {
 }
 
 func TestGetByLogin(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	user := &users.User{Login: "test_login", RoleID: 1, RegistrationDataID: 1}
-	err := repo.Create(user)
+	err := repo.Create(ctx, user)
 	assert.NoError(t, err)
 
-	result, err := repo.GetByLogin(user.Login)
+	result, err := repo.GetByLogin(ctx, user.Login)
 	assert.NoError(t, err)
 	assert.Equal(t, user.ID, result.ID)
 	assert.Equal(t, user.Login, result.Login)
@@ -1,13 +1,47 @@
 package roles
 
 import (
+	"encoding/json"
+
 	"gorm.io/gorm"
 )
 
+type Permission struct {
+	ID   uint   `gorm:"primarykey"`
+	Name string `gorm:"unique;not null"`
+}
+
+// Permissions are exposed by name only
+func (p Permission) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.Name)
+}
+
+func (p *Permission) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &p.Name)
+}
+
 type Role struct {
 	gorm.Model
-	Title        string `json:"title" gorm:"index;unique;not null"`
-	Admin        bool   `json:"admin" gorm:"default:false"`
-	WriteGeneral bool   `json:"write_general" gorm:"default:false"`
-	AIAccess     bool   `json:"ai_access" gorm:"default:false"`
+	Title       string       `json:"title" gorm:"index;unique;not null"`
+	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions"`
+}
+
+// Has reports whether the role grants the permission
+func (r *Role) Has(permission string) bool {
+	for _, p := range r.Permissions {
+		if p.Name == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether the role has every permission of the other role
+func (r *Role) Covers(other *Role) bool {
+	for _, p := range other.Permissions {
+		if !r.Has(p.Name) {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,78 @@
+package roles
+
+import "errors"
+
+var ErrUnknownPermission = errors.New("unknown permission")
+
+const (
+	PermissionAdminPanel          = "admin.panel"
+	PermissionRegDataRead         = "regdata.read"
+	PermissionRegDataAccept       = "regdata.accept"
+	PermissionExamsRead           = "exams.read"
+	PermissionExamsCreate         = "exams.create"
+	PermissionExamsManage         = "exams.manage"
+	PermissionExamsResultsRead    = "exams.results.read"
+	PermissionExamsResultsWrite   = "exams.results.write"
+	PermissionExamsResultsPublish = "exams.results.publish"
+	PermissionRolesRead           = "roles.read"
+	PermissionRolesManage         = "roles.manage"
+	PermissionAuditRead           = "audit.read"
+	PermissionMailingView         = "mailing.view"
+	PermissionMailingResend       = "mailing.resend"
+	PermissionAIAccess            = "ai.access"
+)
+
+// AllPermissions lists every permission known to the application. Roles
+// reference them in the database, a new permission needs a migration that
+// inserts it.
+var AllPermissions = []string{
+	PermissionAdminPanel,
+	PermissionRegDataRead,
+	PermissionRegDataAccept,
+	PermissionExamsRead,
+	PermissionExamsCreate,
+	PermissionExamsManage,
+	PermissionExamsResultsRead,
+	PermissionExamsResultsWrite,
+	PermissionExamsResultsPublish,
+	PermissionRolesRead,
+	PermissionRolesManage,
+	PermissionAuditRead,
+	PermissionMailingView,
+	PermissionMailingResend,
+	PermissionAIAccess,
+}
+
+// LegacyPermissions maps the boolean flags roles used to have onto named
+// permissions. Every admin endpoint used to require both admin and general
+// write access, so only that combination grants access to them.
+func LegacyPermissions(admin, writeGeneral, aiAccess bool) []string {
+	var permissions []string
+	if admin {
+		permissions = append(permissions, PermissionAdminPanel)
+	}
+
+	if admin && writeGeneral {
+		permissions = append(permissions,
+			PermissionRegDataRead,
+			PermissionRegDataAccept,
+			PermissionExamsRead,
+			PermissionExamsCreate,
+			PermissionExamsManage,
+			PermissionExamsResultsRead,
+			PermissionExamsResultsWrite,
+			PermissionExamsResultsPublish,
+			PermissionRolesRead,
+			PermissionRolesManage,
+			PermissionAuditRead,
+			PermissionMailingView,
+			PermissionMailingResend,
+		)
+	}
+
+	if aiAccess {
+		permissions = append(permissions, PermissionAIAccess)
+	}
+
+	return permissions
+}
@@ -1,6 +1,7 @@
 package roles
 
 import (
+	"context"
 	"errors"
 
 	"github.com/L2SH-Dev/admissions/internal/datastore"
@@ -8,9 +9,13 @@ import (
 )
 
 type RolesRepo interface {
-	CreateRole(role *Role) error
-	RoleExists(title string) (bool, error)
-	GetRoleByTitle(title string) (*Role, error)
+	CreateRole(ctx context.Context, role *Role) error
+	RoleExists(ctx context.Context, title string) (bool, error)
+	GetRoleByTitle(ctx context.Context, title string) (*Role, error)
+	GetRoleByID(ctx context.Context, roleID uint) (*Role, error)
+	ListRoles(ctx context.Context) ([]*Role, error)
+	ListPermissions(ctx context.Context) ([]Permission, error)
+	WithTx(tx datastore.Storage) RolesRepo
 }
 
 type RolesRepoImpl struct {
@@ -18,14 +23,49 @@ type RolesRepoImpl struct {
 }
 
 func NewRolesRepo(storage datastore.Storage) RolesRepo {
-	if err := storage.DB().AutoMigrate(&Role{}); err != nil {
-		panic(err)
-	}
 	return &RolesRepoImpl{storage: storage}
 }
 
-func (r *RolesRepoImpl) CreateRole(role *Role) error {
-	err := r.storage.DB().Create(role).Error
+func (r *RolesRepoImpl) WithTx(tx datastore.Storage) RolesRepo {
+	return &RolesRepoImpl{storage: tx}
+}
+
+func findPermissions(db *gorm.DB, names []string) ([]Permission, error) {
+	if len(names) == 0 {
+		return []Permission{}, nil
+	}
+
+	var permissions []Permission
+	if err := db.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+
+	if len(permissions) != len(names) {
+		return nil, ErrUnknownPermission
+	}
+
+	return permissions, nil
+}
+
+// CreateRole stores the role. Permissions are referenced by name and must
+// be among AllPermissions.
+func (r *RolesRepoImpl) CreateRole(ctx context.Context, role *Role) error {
+	names := make([]string, 0, len(role.Permissions))
+	seen := make(map[string]bool, len(role.Permissions))
+	for _, p := range role.Permissions {
+		if !seen[p.Name] {
+			seen[p.Name] = true
+			names = append(names, p.Name)
+		}
+	}
+
+	permissions, err := findPermissions(r.storage.DB().WithContext(ctx), names)
+	if err != nil {
+		return err
+	}
+	role.Permissions = permissions
+
+	err = r.storage.DB().WithContext(ctx).Create(role).Error
 	if err != nil {
 		return errors.Join(errors.New("failed to create role"), err)
 	}
@@ -33,9 +73,9 @@ func (r *RolesRepoImpl) CreateRole(role *Role) error {
 	return nil
 }
 
-func (r *RolesRepoImpl) RoleExists(title string) (bool, error) {
+func (r *RolesRepoImpl) RoleExists(ctx context.Context, title string) (bool, error) {
 	var role Role
-	err := r.storage.DB().Where("title = ?", title).First(&role).Error
+	err := r.storage.DB().WithContext(ctx).Where("title = ?", title).First(&role).Error
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return false, err
 	} else if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -45,12 +85,42 @@ func (r *RolesRepoImpl) RoleExists(title string) (bool, error) {
 	return true, nil
 }
 
-func (r *RolesRepoImpl) GetRoleByTitle(title string) (*Role, error) {
+func (r *RolesRepoImpl) GetRoleByTitle(ctx context.Context, title string) (*Role, error) {
 	var role Role
-	err := r.storage.DB().Where("title = ?", title).First(&role).Error
+	err := r.storage.DB().WithContext(ctx).Preload("Permissions").Where("title = ?", title).First(&role).Error
 	if err != nil {
 		return nil, err
 	}
 
 	return &role, nil
 }
+
+func (r *RolesRepoImpl) GetRoleByID(ctx context.Context, roleID uint) (*Role, error) {
+	var role Role
+	err := r.storage.DB().WithContext(ctx).Preload("Permissions").First(&role, roleID).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+func (r *RolesRepoImpl) ListRoles(ctx context.Context) ([]*Role, error) {
+	var roles []*Role
+	err := r.storage.DB().WithContext(ctx).Preload("Permissions").Order("id").Find(&roles).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (r *RolesRepoImpl) ListPermissions(ctx context.Context) ([]Permission, error) {
+	var permissions []Permission
+	err := r.storage.DB().WithContext(ctx).Order("id").Find(&permissions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
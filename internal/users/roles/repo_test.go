@@ -1,13 +1,16 @@
 package roles_test
 
 import (
+	"context"
 	"os"
 	"testing"
 
 	"github.com/L2SH-Dev/admissions/internal/datastore"
+	"github.com/L2SH-Dev/admissions/internal/migrations"
 	"github.com/L2SH-Dev/admissions/internal/users/roles"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var (
@@ -45,45 +48,122 @@ func setupTestRepo(t *testing.T) roles.RolesRepo {
 		assert.NoError(t, err)
 	})
 
+	_, err := migrations.Up(storage.DB())
+	require.NoError(t, err)
+
 	return roles.NewRolesRepo(storage)
 }
 
 func TestCreateRole(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	role := &roles.Role{Title: "test_role"}
-	err := repo.CreateRole(role)
+	err := repo.CreateRole(ctx, role)
 	assert.NoError(t, err)
 
-	exists, err := repo.RoleExists("test_role")
+	exists, err := repo.RoleExists(ctx, "test_role")
 	assert.NoError(t, err)
 	assert.True(t, exists)
 }
 
 func TestRoleExists(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	role := &roles.Role{Title: "test_role"}
-	err := repo.CreateRole(role)
+	err := repo.CreateRole(ctx, role)
 	assert.NoError(t, err)
 
-	exists, err := repo.RoleExists("test_role")
+	exists, err := repo.RoleExists(ctx, "test_role")
 	assert.NoError(t, err)
 	assert.True(t, exists)
 
-	exists, err = repo.RoleExists("non_existent_role")
+	exists, err = repo.RoleExists(ctx, "non_existent_role")
 	assert.NoError(t, err)
 	assert.False(t, exists)
 }
 
 func TestGetRoleByTitle(t *testing.T) {
+	ctx := context.Background()
 	repo := setupTestRepo(t)
 
 	role := &roles.Role{Title: "test_role"}
-	err := repo.CreateRole(role)
+	err := repo.CreateRole(ctx, role)
 	assert.NoError(t, err)
 
-	result, err := repo.GetRoleByTitle("test_role")
+	result, err := repo.GetRoleByTitle(ctx, "test_role")
 	assert.NoError(t, err)
 	assert.Equal(t, "test_role", result.Title)
 }
+
+func TestGetRoleByID(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	role := &roles.Role{Title: "test_role"}
+	err := repo.CreateRole(ctx, role)
+	assert.NoError(t, err)
+
+	result, err := repo.GetRoleByID(ctx, role.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "test_role", result.Title)
+}
+
+func TestListRoles(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	err := repo.CreateRole(ctx, &roles.Role{Title: "first_role"})
+	assert.NoError(t, err)
+
+	err = repo.CreateRole(ctx, &roles.Role{
+		Title:       "second_role",
+		Permissions: []roles.Permission{{Name: roles.PermissionAdminPanel}},
+	})
+	assert.NoError(t, err)
+
+	result, err := repo.ListRoles(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, "first_role", result[0].Title)
+	assert.Equal(t, "second_role", result[1].Title)
+	assert.True(t, result[1].Has(roles.PermissionAdminPanel))
+}
+
+func TestCreateRole_Permissions(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	role := &roles.Role{
+		Title: "results_clerk",
+		Permissions: []roles.Permission{
+			{Name: roles.PermissionAdminPanel},
+			{Name: roles.PermissionExamsResultsWrite},
+			{Name: roles.PermissionExamsResultsWrite},
+		},
+	}
+	err := repo.CreateRole(ctx, role)
+	assert.NoError(t, err)
+
+	result, err := repo.GetRoleByTitle(ctx, "results_clerk")
+	assert.NoError(t, err)
+	assert.Len(t, result.Permissions, 2)
+	assert.True(t, result.Has(roles.PermissionExamsResultsWrite))
+	assert.False(t, result.Has(roles.PermissionRegDataAccept))
+
+	err = repo.CreateRole(ctx, &roles.Role{
+		Title:       "broken",
+		Permissions: []roles.Permission{{Name: "no.such.permission"}},
+	})
+	assert.ErrorIs(t, err, roles.ErrUnknownPermission)
+}
+
+func TestListPermissions(t *testing.T) {
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+
+	permissions, err := repo.ListPermissions(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, permissions, len(roles.AllPermissions))
+}
@@ -1,16 +1,25 @@
 package roles
 
 import (
+	"context"
 	"errors"
+	"fmt"
 
+	"github.com/L2SH-Dev/admissions/internal/datastore"
 	"github.com/spf13/viper"
 )
 
+var ErrRoleExists = errors.New("role already exists")
+
 type RolesService interface {
-	CreateRole(role *Role) error
-	CreateDefaultRoles() error
-	RoleExists(title string) (bool, error)
-	GetRoleByTitle(title string) (*Role, error)
+	CreateRole(ctx context.Context, role *Role) error
+	CreateDefaultRoles(ctx context.Context) error
+	RoleExists(ctx context.Context, title string) (bool, error)
+	GetRoleByTitle(ctx context.Context, title string) (*Role, error)
+	GetRoleByID(ctx context.Context, roleID uint) (*Role, error)
+	ListRoles(ctx context.Context) ([]*Role, error)
+	ListPermissions(ctx context.Context) ([]Permission, error)
+	WithTx(tx datastore.Storage) RolesService
 }
 
 type RolesServiceImpl struct {
@@ -21,36 +30,40 @@ func NewRolesService(repo RolesRepo) RolesService {
 	return &RolesServiceImpl{repo: repo}
 }
 
-func (s *RolesServiceImpl) CreateRole(role *Role) error {
-	if exists, err := s.RoleExists(role.Title); err != nil {
+func (s *RolesServiceImpl) WithTx(tx datastore.Storage) RolesService {
+	return &RolesServiceImpl{repo: s.repo.WithTx(tx)}
+}
+
+func (s *RolesServiceImpl) CreateRole(ctx context.Context, role *Role) error {
+	if exists, err := s.RoleExists(ctx, role.Title); err != nil {
 		return errors.Join(errors.New("failed to check if role exists"), err)
 	} else if exists {
-		return errors.New("role already exists")
+		return ErrRoleExists
 	}
 
-	return s.repo.CreateRole(role)
+	return s.repo.CreateRole(ctx, role)
 }
 
-func (s *RolesServiceImpl) CreateDefaultRoles() error {
+func (s *RolesServiceImpl) CreateDefaultRoles(ctx context.Context) error {
 	rolesConfig := viper.GetStringMap("users.roles")
-
 	for roleTitle, roleData := range rolesConfig {
-		permissions := roleData.(map[string]interface{})["permissions"].(map[string]interface{})
+		names, err := configPermissions(roleData.(map[string]interface{})["permissions"])
+		if err != nil {
+			return fmt.Errorf("invalid permissions of role %s: %w", roleTitle, err)
+		}
 
-		role := Role{
-			Title:        roleTitle,
-			Admin:        permissions["admin"].(bool),
-			WriteGeneral: permissions["write_general"].(bool),
-			AIAccess:     permissions["ai_access"].(bool),
+		role := Role{Title: roleTitle}
+		for _, name := range names {
+			role.Permissions = append(role.Permissions, Permission{Name: name})
 		}
 
-		if exists, err := s.RoleExists(role.Title); err != nil {
+		if exists, err := s.RoleExists(ctx, role.Title); err != nil {
 			return errors.Join(errors.New("failed to check if role exists"), err)
 		} else if exists {
 			continue
 		}
 
-		err := s.repo.CreateRole(&role)
+		err = s.repo.CreateRole(ctx, &role)
 		if err != nil {
 			return errors.Join(errors.New("failed to create role"), err)
 		}
@@ -59,10 +72,49 @@ func (s *RolesServiceImpl) CreateDefaultRoles() error {
 	return nil
 }
 
-func (s *RolesServiceImpl) RoleExists(title string) (bool, error) {
-	return s.repo.RoleExists(title)
+// configPermissions reads role permissions from the config. They are either
+// a list of permission names or the legacy map of boolean flags.
+func configPermissions(value interface{}) ([]string, error) {
+	switch permissions := value.(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		names := make([]string, 0, len(permissions))
+		for _, p := range permissions {
+			name, ok := p.(string)
+			if !ok {
+				return nil, fmt.Errorf("permission %v is not a string", p)
+			}
+			names = append(names, name)
+		}
+		return names, nil
+	case map[string]interface{}:
+		flag := func(key string) bool {
+			value, _ := permissions[key].(bool)
+			return value
+		}
+		return LegacyPermissions(flag("admin"), flag("write_general"), flag("ai_access")), nil
+	default:
+		return nil, fmt.Errorf("unexpected permissions format %T", value)
+	}
+}
+
+func (s *RolesServiceImpl) RoleExists(ctx context.Context, title string) (bool, error) {
+	return s.repo.RoleExists(ctx, title)
+}
+
+func (s *RolesServiceImpl) GetRoleByTitle(ctx context.Context, title string) (*Role, error) {
+	return s.repo.GetRoleByTitle(ctx, title)
+}
+
+func (s *RolesServiceImpl) GetRoleByID(ctx context.Context, roleID uint) (*Role, error) {
+	return s.repo.GetRoleByID(ctx, roleID)
+}
+
+func (s *RolesServiceImpl) ListRoles(ctx context.Context) ([]*Role, error) {
+	return s.repo.ListRoles(ctx)
 }
 
-func (s *RolesServiceImpl) GetRoleByTitle(title string) (*Role, error) {
-	return s.repo.GetRoleByTitle(title)
+func (s *RolesServiceImpl) ListPermissions(ctx context.Context) ([]Permission, error) {
+	return s.repo.ListPermissions(ctx)
 }
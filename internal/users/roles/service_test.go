@@ -1,10 +1,13 @@
 package roles_test
 
 import (
+	"context"
 	"testing"
 
+	"github.com/L2SH-Dev/admissions/internal/migrations"
 	"github.com/L2SH-Dev/admissions/internal/users/roles"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func setupTestService(t *testing.T) roles.RolesService {
@@ -13,69 +16,121 @@ func setupTestService(t *testing.T) roles.RolesService {
 		assert.NoError(t, err)
 	})
 
+	_, err := migrations.Up(storage.DB())
+	require.NoError(t, err)
+
 	repo := roles.NewRolesRepo(storage)
 	return roles.NewRolesService(repo)
 }
 
 func TestCreateRoleService(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
 	role := &roles.Role{Title: "test_role"}
-	err := service.CreateRole(role)
+	err := service.CreateRole(ctx, role)
 	assert.NoError(t, err)
 
-	exists, err := service.RoleExists("test_role")
+	exists, err := service.RoleExists(ctx, "test_role")
 	assert.NoError(t, err)
 	assert.True(t, exists)
 }
 
 func TestCreateDefaultRolesService(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	err := service.CreateDefaultRoles()
+	err := service.CreateDefaultRoles(ctx)
 	assert.NoError(t, err)
 
-	adminExists, err := service.RoleExists("admin")
+	adminExists, err := service.RoleExists(ctx, "admin")
 	assert.NoError(t, err)
 	assert.True(t, adminExists)
 
-	userExists, err := service.RoleExists("user")
+	userExists, err := service.RoleExists(ctx, "user")
 	assert.NoError(t, err)
 	assert.True(t, userExists)
 
-	interviewerExists, err := service.RoleExists("interviewer")
+	interviewerExists, err := service.RoleExists(ctx, "interviewer")
 	assert.NoError(t, err)
 	assert.True(t, interviewerExists)
 
-	principalExists, err := service.RoleExists("principal")
+	principalExists, err := service.RoleExists(ctx, "principal")
 	assert.NoError(t, err)
 	assert.True(t, principalExists)
+
+	// Legacy flags from the config are mapped onto permissions
+	admin, err := service.GetRoleByTitle(ctx, "admin")
+	assert.NoError(t, err)
+	assert.True(t, admin.Has(roles.PermissionRegDataAccept))
+	assert.False(t, admin.Has(roles.PermissionAIAccess))
+
+	interviewer, err := service.GetRoleByTitle(ctx, "interviewer")
+	assert.NoError(t, err)
+	assert.True(t, interviewer.Has(roles.PermissionAdminPanel))
+	assert.False(t, interviewer.Has(roles.PermissionRegDataAccept))
+
+	user, err := service.GetRoleByTitle(ctx, "user")
+	assert.NoError(t, err)
+	assert.Empty(t, user.Permissions)
 }
 
 func TestRoleExistsService(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
 	role := &roles.Role{Title: "test_role"}
-	err := service.CreateRole(role)
+	err := service.CreateRole(ctx, role)
 	assert.NoError(t, err)
 
-	exists, err := service.RoleExists("test_role")
+	exists, err := service.RoleExists(ctx, "test_role")
 	assert.NoError(t, err)
 	assert.True(t, exists)
 
-	exists, err = service.RoleExists("non_existent_role")
+	exists, err = service.RoleExists(ctx, "non_existent_role")
 	assert.NoError(t, err)
 	assert.False(t, exists)
 }
 
 func TestGetRoleByTitleService(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
 	role := &roles.Role{Title: "test_role"}
-	err := service.CreateRole(role)
+	err := service.CreateRole(ctx, role)
 	assert.NoError(t, err)
 
-	result, err := service.GetRoleByTitle("test_role")
+	result, err := service.GetRoleByTitle(ctx, "test_role")
 	assert.NoError(t, err)
 	assert.Equal(t, "test_role", result.Title)
 }
+
+func TestCreateRoleExistsService(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+
+	err := service.CreateRole(ctx, &roles.Role{Title: "test_role"})
+	assert.NoError(t, err)
+
+	err = service.CreateRole(ctx, &roles.Role{Title: "test_role"})
+	assert.ErrorIs(t, err, roles.ErrRoleExists)
+}
+
+func TestRoleCovers(t *testing.T) {
+	permissions := func(names ...string) []roles.Permission {
+		result := make([]roles.Permission, 0, len(names))
+		for _, name := range names {
+			result = append(result, roles.Permission{Name: name})
+		}
+		return result
+	}
+
+	admin := &roles.Role{Permissions: permissions(roles.LegacyPermissions(true, true, false)...)}
+	interviewer := &roles.Role{Permissions: permissions(roles.LegacyPermissions(true, false, true)...)}
+	user := &roles.Role{}
+
+	assert.True(t, admin.Covers(admin))
+	assert.True(t, admin.Covers(user))
+	assert.False(t, admin.Covers(interviewer))
+	assert.False(t, user.Covers(admin))
+}
@@ -1,19 +1,27 @@
 package users
 
 import (
+	"context"
 	"errors"
+	"fmt"
 
+	"github.com/L2SH-Dev/admissions/internal/datastore"
 	"github.com/L2SH-Dev/admissions/internal/users/roles"
 	"github.com/spf13/viper"
 	"gorm.io/gorm"
 )
 
 type UsersService interface {
-	GetByID(userID uint) (*User, error)
-	GetByLogin(login string) (*User, error)
-	Create(registrationID uint, login string) (*User, error)
-	CreateDefaultAdmin(registrationID uint) (*User, error)
-	Delete(userID uint) error
+	GetByID(ctx context.Context, userID uint) (*User, error)
+	GetByLogin(ctx context.Context, login string) (*User, error)
+	ListByEmail(ctx context.Context, email string) ([]*User, error)
+	Count(ctx context.Context) (int64, error)
+	Create(ctx context.Context, registrationID uint, login string) (*User, error)
+	CreateWithRole(ctx context.Context, registrationID uint, login string, roleTitle string) (*User, error)
+	Delete(ctx context.Context, userID uint) error
+	SetRole(ctx context.Context, userID, roleID uint, grantedBy *User) (*User, error)
+	ListRoleGrants(ctx context.Context, userID uint) ([]*RoleGrant, error)
+	WithTx(tx datastore.Storage) UsersService
 }
 
 type UsersServiceImpl struct {
@@ -21,11 +29,15 @@ type UsersServiceImpl struct {
 	rolesService roles.RolesService
 }
 
-var ErrUserAlreadyExists = errors.New("user with the same email already exists")
+var (
+	ErrUserAlreadyExists      = errors.New("user with the same email already exists")
+	ErrCannotChangeOwnRole    = errors.New("cannot change own role")
+	ErrInsufficientPermission = errors.New("cannot grant or revoke permissions you don't have")
+)
 
 func NewUsersService(repo UsersRepo, rolesService roles.RolesService) UsersService {
 	service := &UsersServiceImpl{repo: repo, rolesService: rolesService}
-	err := rolesService.CreateDefaultRoles()
+	err := rolesService.CreateDefaultRoles(context.Background())
 	if err != nil {
 		panic(err)
 	}
@@ -33,17 +45,37 @@ func NewUsersService(repo UsersRepo, rolesService roles.RolesService) UsersServi
 	return service
 }
 
-func (s *UsersServiceImpl) GetByID(userID uint) (*User, error) {
-	return s.repo.GetByID(userID)
+// WithTx returns the service with its repo and roles bound to the
+// transaction of tx
+func (s *UsersServiceImpl) WithTx(tx datastore.Storage) UsersService {
+	return &UsersServiceImpl{repo: s.repo.WithTx(tx), rolesService: s.rolesService.WithTx(tx)}
+}
+
+func (s *UsersServiceImpl) GetByID(ctx context.Context, userID uint) (*User, error) {
+	return s.repo.GetByID(ctx, userID)
+}
+
+func (s *UsersServiceImpl) GetByLogin(ctx context.Context, login string) (*User, error) {
+	return s.repo.GetByLogin(ctx, login)
 }
 
-func (s *UsersServiceImpl) GetByLogin(login string) (*User, error) {
-	return s.repo.GetByLogin(login)
+func (s *UsersServiceImpl) ListByEmail(ctx context.Context, email string) ([]*User, error) {
+	return s.repo.ListByEmail(ctx, email)
 }
 
-func (s *UsersServiceImpl) Create(registrationID uint, login string) (*User, error) {
+func (s *UsersServiceImpl) Count(ctx context.Context) (int64, error) {
+	return s.repo.Count(ctx)
+}
+
+func (s *UsersServiceImpl) Create(ctx context.Context, registrationID uint, login string) (*User, error) {
+	return s.CreateWithRole(ctx, registrationID, login, viper.GetString("users.default_role"))
+}
+
+// CreateWithRole creates the user of the registration with the given role
+// instead of the default one, it is used for staff accounts
+func (s *UsersServiceImpl) CreateWithRole(ctx context.Context, registrationID uint, login string, roleTitle string) (*User, error) {
 	// Check if user with the same registration id already exists
-	user, err := s.repo.GetByRegistrationID(registrationID)
+	user, err := s.repo.GetByRegistrationID(ctx, registrationID)
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, errors.Join(errors.New("failed to get user by registration id"), err)
 	}
@@ -51,10 +83,9 @@ func (s *UsersServiceImpl) Create(registrationID uint, login string) (*User, err
 		return nil, ErrUserAlreadyExists
 	}
 
-	// Get default role
-	role, err := s.rolesService.GetRoleByTitle(viper.GetString("users.default_role"))
+	role, err := s.rolesService.GetRoleByTitle(ctx, roleTitle)
 	if err != nil {
-		return nil, errors.Join(errors.New("failed to get default role"), err)
+		return nil, errors.Join(fmt.Errorf("failed to get role %q", roleTitle), err)
 	}
 
 	// Create user object
@@ -65,13 +96,13 @@ func (s *UsersServiceImpl) Create(registrationID uint, login string) (*User, err
 	}
 
 	// Create user
-	err = s.repo.Create(newUser)
+	err = s.repo.Create(ctx, newUser)
 	if err != nil {
 		return nil, errors.Join(errors.New("failed to create user"), err)
 	}
 
 	// Verify that the user was created successfully
-	createdUser, err := s.repo.GetByID(newUser.ID)
+	createdUser, err := s.repo.GetByID(ctx, newUser.ID)
 	if err != nil {
 		return nil, errors.Join(errors.New("failed to retrieve created user"), err)
 	}
@@ -79,52 +110,55 @@ func (s *UsersServiceImpl) Create(registrationID uint, login string) (*User, err
 	return createdUser, nil
 }
 
-func (s *UsersServiceImpl) CreateDefaultAdmin(registrationID uint) (*User, error) {
-	// Check if user with the same registration id already exists
-	user, err := s.repo.GetByRegistrationID(registrationID)
-	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
-		return nil, errors.Join(errors.New("failed to get user by registration id"), err)
+func (s *UsersServiceImpl) Delete(ctx context.Context, userID uint) error {
+	exists, err := s.repo.ExistsByID(ctx, userID)
+	if err != nil {
+		return errors.Join(errors.New("failed to check if user exists"), err)
 	}
-	if user != nil {
-		return nil, ErrUserAlreadyExists
+	if exists {
+		return s.repo.Delete(ctx, userID)
 	}
 
-	// Get admin role
-	role, err := s.rolesService.GetRoleByTitle(viper.GetString("users.default_admin.role"))
-	if err != nil {
-		return nil, errors.Join(errors.New("failed to get default admin role"), err)
-	}
+	return nil
+}
 
-	// Create user object
-	newUser := &User{
-		Login:              viper.GetString("users.default_admin.login"),
-		RegistrationDataID: registrationID,
-		RoleID:             role.ID,
+// SetRole assigns the role to the user. Admins can't change their own role
+// and can only move users between roles whose permissions they hold.
+func (s *UsersServiceImpl) SetRole(ctx context.Context, userID, roleID uint, grantedBy *User) (*User, error) {
+	if userID == grantedBy.ID {
+		return nil, ErrCannotChangeOwnRole
 	}
 
-	// Create user
-	err = s.repo.Create(newUser)
+	user, err := s.repo.GetByID(ctx, userID)
 	if err != nil {
-		return nil, errors.Join(errors.New("failed to create user"), err)
+		return nil, err
 	}
 
-	// Verify that the user was created successfully
-	createdUser, err := s.repo.GetByID(newUser.ID)
+	role, err := s.rolesService.GetRoleByID(ctx, roleID)
 	if err != nil {
-		return nil, errors.Join(errors.New("failed to retrieve created user"), err)
+		return nil, err
 	}
 
-	return createdUser, nil
-}
+	if !grantedBy.Role.Covers(&user.Role) || !grantedBy.Role.Covers(role) {
+		return nil, ErrInsufficientPermission
+	}
 
-func (s *UsersServiceImpl) Delete(userID uint) error {
-	exists, err := s.repo.ExistsByID(userID)
-	if err != nil {
-		return errors.Join(errors.New("failed to check if user exists"), err)
+	if user.RoleID == role.ID {
+		return user, nil
 	}
-	if exists {
-		return s.repo.Delete(userID)
+
+	grant := &RoleGrant{
+		RoleID:         role.ID,
+		PreviousRoleID: user.RoleID,
+		GrantedByID:    grantedBy.ID,
+	}
+	if err := s.repo.UpdateRole(ctx, userID, grant); err != nil {
+		return nil, err
 	}
 
-	return nil
+	return s.repo.GetByID(ctx, userID)
+}
+
+func (s *UsersServiceImpl) ListRoleGrants(ctx context.Context, userID uint) ([]*RoleGrant, error) {
+	return s.repo.ListRoleGrants(ctx, userID)
 }
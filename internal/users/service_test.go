@@ -1,6 +1,7 @@
 package users_test
 
 import (
+	"context"
 	"testing"
 
 	"github.com/L2SH-Dev/admissions/internal/users"
@@ -21,14 +22,15 @@ func setupTestService(t *testing.T) users.UsersService {
 }
 
 func TestUsersService_CreateUser(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	createdUser, err := service.Create(1, "test_login")
+	createdUser, err := service.Create(ctx, 1, "test_login")
 	assert.NoError(t, err)
 	assert.Equal(t, "test_login", createdUser.Login)
 
 	// Check if user was created
-	user, err := service.GetByLogin("test_login")
+	user, err := service.GetByLogin(ctx, "test_login")
 	assert.NoError(t, err)
 	assert.Equal(t, "test_login", user.Login)
 
@@ -36,85 +38,150 @@ func TestUsersService_CreateUser(t *testing.T) {
 	assert.Equal(t, "user", user.Role.Title)
 
 	// Create second user
-	_, err = service.Create(2, "test2_login")
+	_, err = service.Create(ctx, 2, "test2_login")
 	assert.NoError(t, err)
 }
 
 func TestUsersService_CreateUserLoginExists(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	_, err := service.Create(1, "test_login")
+	_, err := service.Create(ctx, 1, "test_login")
 	assert.NoError(t, err)
 
-	_, err = service.Create(2, "test_login")
+	_, err = service.Create(ctx, 2, "test_login")
 	assert.Error(t, err)
 }
 
 func TestUsersService_CreateUserRegistrationDataExists(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	_, err := service.Create(1, "test_login")
+	_, err := service.Create(ctx, 1, "test_login")
 	assert.NoError(t, err)
 
-	_, err = service.Create(1, "test2_login")
+	_, err = service.Create(ctx, 1, "test2_login")
 	assert.Error(t, err)
 }
 
 func TestUsersService_DeleteUser(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	createdUser, err := service.Create(1, "test_login")
+	createdUser, err := service.Create(ctx, 1, "test_login")
 	assert.NoError(t, err)
 
-	err = service.Delete(createdUser.ID)
+	err = service.Delete(ctx, createdUser.ID)
 	assert.NoError(t, err)
 
-	_, err = service.GetByLogin("test_login")
+	_, err = service.GetByLogin(ctx, "test_login")
 	assert.Error(t, err)
 	assert.Equal(t, gorm.ErrRecordNotFound, err)
 }
 
 func TestUsersService_GetByID(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	createdUser, err := service.Create(1, "test_login")
+	createdUser, err := service.Create(ctx, 1, "test_login")
 	assert.NoError(t, err)
 
-	user, err := service.GetByID(createdUser.ID)
+	user, err := service.GetByID(ctx, createdUser.ID)
 	assert.NoError(t, err)
 	assert.Equal(t, "test_login", user.Login)
 }
 
 func TestUsersService_GetByIDNotFound(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	_, err := service.Create(1, "test_login")
+	_, err := service.Create(ctx, 1, "test_login")
 	assert.NoError(t, err)
 
-	_, err = service.GetByID(999)
+	_, err = service.GetByID(ctx, 999)
 	assert.Error(t, err)
 	assert.Equal(t, gorm.ErrRecordNotFound, err)
 }
 
 func TestUsersService_GetByLogin(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	createdUser, err := service.Create(1, "test_login")
+	createdUser, err := service.Create(ctx, 1, "test_login")
 	assert.NoError(t, err)
 
-	user, err := service.GetByLogin("test_login")
+	user, err := service.GetByLogin(ctx, "test_login")
 	assert.NoError(t, err)
 	assert.Equal(t, createdUser.ID, user.ID)
 	assert.Equal(t, "test_login", user.Login)
 }
 
 func TestUsersService_GetByLoginNotFound(t *testing.T) {
+	ctx := context.Background()
 	service := setupTestService(t)
 
-	_, err := service.Create(1, "test_login")
+	_, err := service.Create(ctx, 1, "test_login")
 	assert.NoError(t, err)
 
-	_, err = service.GetByLogin("not_found")
+	_, err = service.GetByLogin(ctx, "not_found")
 	assert.Error(t, err)
 	assert.Equal(t, gorm.ErrRecordNotFound, err)
 }
+
+func TestUsersService_SetRole(t *testing.T) {
+	ctx := context.Background()
+	service := setupTestService(t)
+	rolesService := roles.NewRolesService(roles.NewRolesRepo(storage))
+
+	adminRole, err := rolesService.GetRoleByTitle(ctx, "admin")
+	assert.NoError(t, err)
+	interviewerRole, err := rolesService.GetRoleByTitle(ctx, "interviewer")
+	assert.NoError(t, err)
+	principalRole, err := rolesService.GetRoleByTitle(ctx, "principal")
+	assert.NoError(t, err)
+
+	admin, err := service.Create(ctx, 1, "admin_login")
+	assert.NoError(t, err)
+	principal, err := service.Create(ctx, 2, "principal_login")
+	assert.NoError(t, err)
+	user, err := service.Create(ctx, 3, "user_login")
+	assert.NoError(t, err)
+
+	// Bootstrap the principal directly through the repo
+	repo := users.NewUsersRepo(storage)
+	err = repo.UpdateRole(ctx, principal.ID, &users.RoleGrant{RoleID: principalRole.ID, PreviousRoleID: principal.RoleID})
+	assert.NoError(t, err)
+	principal, err = service.GetByID(ctx, principal.ID)
+	assert.NoError(t, err)
+
+	// Principal makes the admin
+	admin, err = service.SetRole(ctx, admin.ID, adminRole.ID, principal)
+	assert.NoError(t, err)
+	assert.Equal(t, "admin", admin.Role.Title)
+
+	// Admin can't grant AI access it doesn't have
+	_, err = service.SetRole(ctx, user.ID, interviewerRole.ID, admin)
+	assert.ErrorIs(t, err, users.ErrInsufficientPermission)
+
+	// Nor change its own role
+	_, err = service.SetRole(ctx, admin.ID, principalRole.ID, admin)
+	assert.ErrorIs(t, err, users.ErrCannotChangeOwnRole)
+
+	user, err = service.SetRole(ctx, user.ID, interviewerRole.ID, principal)
+	assert.NoError(t, err)
+	assert.Equal(t, "interviewer", user.Role.Title)
+
+	_, err = service.SetRole(ctx, user.ID, 9999, principal)
+	assert.ErrorIs(t, err, gorm.ErrRecordNotFound)
+
+	grants, err := service.ListRoleGrants(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Len(t, grants, 1)
+	assert.Equal(t, interviewerRole.ID, grants[0].RoleID)
+	assert.Equal(t, principal.ID, grants[0].GrantedByID)
+	assert.Equal(t, "interviewer", grants[0].Role.Title)
+
+	grants, err = service.ListRoleGrants(ctx, 0)
+	assert.NoError(t, err)
+	assert.Len(t, grants, 3)
+}
@@ -0,0 +1,40 @@
+import { instance, ListParams } from '@/api/api.config'
+
+const AuditService = {
+  list: async (params?: AuditListParams) =>
+    await instance.get('/audit/admin', { params }),
+  download: async (params?: AuditListParams) =>
+    await instance.get('/audit/admin/download', {
+      params,
+      responseType: 'blob',
+    }),
+}
+
+export default AuditService
+
+// Dates are formatted as YYYY-MM-DD
+export interface AuditListParams extends ListParams {
+  actor_id?: number
+  action?: string
+  target_type?: string
+  target_id?: number
+  from?: string
+  to?: string
+}
+
+export interface AuditChange {
+  old: unknown
+  new: unknown
+}
+
+export interface AuditEntry {
+  id: number
+  created_at: string
+  actor_id: number
+  actor_role: string
+  action: string
+  target_type: string
+  target_id: number
+  ip: string
+  diff: Record<string, AuditChange> | Record<string, unknown> | null
+}
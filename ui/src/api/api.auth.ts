@@ -6,6 +6,19 @@ const AuthService = {
   refresh: async () => await instance.get('/users/refresh'),
   logout: async () => await instance.post('/users/logout'),
   me: async () => await instance.get('/users/me'),
+  sessions: async () => await instance.get('/users/sessions'),
+  revokeSession: async (sessionID: string) =>
+    await instance.delete(`/users/sessions/${sessionID}`),
+  revokeAllSessions: async () => await instance.delete('/users/sessions'),
+  forgotPassword: async (email: string) =>
+    await instance.post('/users/password/forgot', { email }),
+  changePassword: async (currentPassword: string, newPassword: string) =>
+    await instance.put('/users/password', {
+      current_password: currentPassword,
+      new_password: newPassword,
+    }),
+  resetPassword: async (token: string, password: string) =>
+    await instance.post('/users/password/reset', { token, password }),
 }
 
 export default AuthService
@@ -36,3 +36,11 @@ instance.interceptors.response.use(
     throw error
   }
 )
+
+// Admin lists are paginated, the total count comes in the X-Total-Count
+// header. Sort is a column name, prefixed with "-" for descending order.
+export interface ListParams {
+  page?: number
+  limit?: number
+  sort?: string
+}
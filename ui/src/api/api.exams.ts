@@ -1,7 +1,8 @@
-import { instance } from './api.config'
+import { instance, ListParams } from './api.config'
 
 const ExamsService = {
-  list: async () => await instance.get('/exams/admin'),
+  list: async (params?: ExamListParams) =>
+    await instance.get('/exams/admin', { params }),
   create: async (exam: ExamRequest) =>
     await instance.post('/exams/admin', exam),
   delete: async (examId: number) =>
@@ -14,6 +15,10 @@ const ExamsService = {
     await instance.post(`/exams/register/${examId}`),
   unregister: async (examId: number) =>
     await instance.delete(`/exams/register/${examId}`),
+  joinWaitlist: async (examId: number) =>
+    await instance.post(`/exams/waitlist/${examId}`),
+  leaveWaitlist: async (examId: number) =>
+    await instance.delete(`/exams/waitlist/${examId}`),
   registrationStatus: async (examId: number) =>
     await instance.get(`/exams/registration_status/${examId}`),
   history: async () => await instance.get('/exams/history'),
@@ -25,6 +30,15 @@ const ExamsService = {
 
 export default ExamsService
 
+// Dates are formatted as YYYY-MM-DD and bound the start of the exam
+export interface ExamListParams extends ListParams {
+  grade?: number
+  type_id?: number
+  from?: string
+  to?: string
+  location?: string
+}
+
 export interface Exam {
   ID: number
   CreatedAt: string
@@ -59,4 +73,6 @@ export interface ExamType {
 export interface Allocation {
   capacity: number
   occupied: number
+  waitlisted: number
+  position: number
 }
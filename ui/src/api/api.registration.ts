@@ -1,17 +1,47 @@
-import { instance } from '@/api/api.config'
+import { instance, ListParams } from '@/api/api.config'
 
 const RegistrationService = {
   accept: async (registrationId: number) =>
     await instance.post(`/regdata/admin/accept/${registrationId}`),
   reject: async (registrationId: number, reason: string) =>
     await instance.post(`/regdata/admin/reject/${registrationId}`, { reason }),
-  list: async () => await instance.get('/regdata/admin/pending'),
+  revertRejection: async (registrationId: number) =>
+    await instance.post(`/regdata/admin/reject/${registrationId}/revert`),
+  list: async (params?: RegistrationListParams) =>
+    await instance.get('/regdata/admin/pending', { params }),
+  listByStatus: async (
+    statuses: RegistrationStatus[],
+    params?: RegistrationListParams
+  ) =>
+    await instance.get('/regdata/admin/list', {
+      params: { ...params, status: statuses.join(',') },
+    }),
+  statuses: async () => await instance.get('/regdata/admin/statuses'),
+  changeStatus: async (registrationId: number, status: RegistrationStatus) =>
+    await instance.post(`/regdata/admin/${registrationId}/status`, { status }),
+  update: async (registrationId: number, fields: Partial<RegistrationRequest>) =>
+    await instance.patch(`/regdata/admin/${registrationId}`, fields),
+  changes: async (registrationId: number) =>
+    await instance.get(`/regdata/admin/${registrationId}/changes`),
+  duplicates: async (registrationId: number) =>
+    await instance.get(`/regdata/admin/${registrationId}/duplicates`),
+  merge: async (registrationId: number, duplicateId: number) =>
+    await instance.post(`/regdata/admin/${registrationId}/merge`, {
+      duplicate_id: duplicateId,
+    }),
   mine: async () => await instance.get('/regdata/mine'),
+  updateMine: async (fields: Partial<RegistrationRequest>) =>
+    await instance.patch('/regdata/mine', fields),
+  myChanges: async () => await instance.get('/regdata/mine/changes'),
+  withdraw: async () => await instance.post('/regdata/mine/withdraw'),
   register: async (registration: RegistrationRequest) =>
     await instance.post('/regdata', registration),
   verify: async (token: string) =>
     await instance.get(`/regdata/verify?token=${token}`),
-  accepted: async () => await instance.get('/regdata/admin/accepted'),
+  resendVerification: async (email: string) =>
+    await instance.post('/regdata/verify/resend', { email }),
+  accepted: async (params?: RegistrationListParams) =>
+    await instance.get('/regdata/admin/accepted', { params }),
   downloadAccepted: async () =>
     await instance.get('/regdata/admin/accepted/download', {
       responseType: 'blob',
@@ -20,10 +50,35 @@ const RegistrationService = {
 
 export default RegistrationService
 
+export type RegistrationStatus =
+  | 'submitted'
+  | 'email_verified'
+  | 'accepted'
+  | 'rejected'
+  | 'withdrawn'
+  | 'enrolled'
+  | 'dismissed'
+
+// Dates are formatted as YYYY-MM-DD, q searches the names and the email
+export interface RegistrationListParams extends ListParams {
+  grade?: number
+  email_verified?: boolean
+  created_from?: string
+  created_to?: string
+  school?: string
+  source?: string
+  q?: string
+}
+
 export interface Registration {
   ID: number
   CreatedAt: string
   UpdatedAt: string
+  status: RegistrationStatus
+  status_changed_at: string
+  rejection_reason: string
+  rejected_by_id: number | null
+  rejected_at: string | null
   birth_date: string
   email: string
   first_name: string
@@ -39,6 +94,14 @@ export interface Registration {
   patronymic: string
   source: string
   vmsh: boolean
+  merged_into_id: number | null
+  duplicates?: DuplicateCandidate[]
+}
+
+export interface DuplicateCandidate {
+  registration_id: number
+  score: number
+  reasons: string[]
 }
 
 export interface RegistrationRequest {
@@ -58,3 +121,13 @@ export interface RegistrationRequest {
   source: string
   vmsh: boolean
 }
+
+export interface RegistrationChange {
+  ID: number
+  CreatedAt: string
+  registration_data_id: number
+  changed_by_id: number
+  field: string
+  old_value: string
+  new_value: string
+}
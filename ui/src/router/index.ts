@@ -51,7 +51,7 @@ router.beforeEach(async (to, from, next) => {
     let isAdmin = false
     try {
       const me = await authStore.me()
-      if (me.role) isAdmin = me.role.admin
+      if (me.role) isAdmin = me.role.permissions.includes('admin.panel')
     } catch {
       isAdmin = false
     }